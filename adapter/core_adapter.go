@@ -33,6 +33,14 @@ func (a *CoreAdapter) Execute(ctx context.Context, inputs map[string]any) (map[s
 		return a.executeEcho(ctx, inputs)
 	case constants.CoreConvertOpenAPI:
 		return a.executeConvertOpenAPI(ctx, inputs)
+	case constants.CoreBlobPut:
+		return a.executeBlobPut(ctx, inputs)
+	case constants.CoreBlobGet:
+		return a.executeBlobGet(ctx, inputs)
+	case constants.CoreBlobList:
+		return a.executeBlobList(ctx, inputs)
+	case constants.CoreBlobURL:
+		return a.executeBlobURL(ctx, inputs)
 	default:
 		return nil, fmt.Errorf("unknown core tool: %s", use)
 	}
@@ -127,6 +135,9 @@ func (a *CoreAdapter) convertOpenAPIToManifests(spec map[string]any, apiName, ba
 			continue
 		}
 
+		// Parameters shared by every operation on the path
+		shared, _ := pathObj["parameters"].([]any)
+
 		// Process each HTTP method
 		for method, operation := range pathObj {
 			if !a.isValidHTTPMethod(method) {
@@ -145,7 +156,7 @@ func (a *CoreAdapter) convertOpenAPIToManifests(spec map[string]any, apiName, ba
 			description := a.extractDescription(opObj, path)
 
 			// Extract parameters schema
-			parameters := a.extractParameters(opObj, method)
+			parameters := a.extractParameters(opObj, method, shared)
 
 			// Create manifest
 			manifest := map[string]any{
@@ -160,6 +171,9 @@ func (a *CoreAdapter) convertOpenAPIToManifests(spec map[string]any, apiName, ba
 					constants.HeaderAuthorization: "Bearer $env:" + strings.ToUpper(apiName) + "_API_KEY",
 				},
 			}
+			if bodyType := a.determineBodyType(opObj, method); bodyType != "" {
+				manifest["body_type"] = bodyType
+			}
 
 			manifests = append(manifests, manifest)
 		}
@@ -224,73 +238,113 @@ func (a *CoreAdapter) extractDescription(operation map[string]any, path string)
 	return "API endpoint: " + path
 }
 
-func (a *CoreAdapter) extractParameters(operation map[string]any, method string) map[string]any {
-	// For POST/PUT/PATCH, look for requestBody
-	if strings.ToUpper(method) != constants.HTTPMethodGET {
-		if requestBody, ok := operation["requestBody"].(map[string]any); ok {
-			if content, ok := requestBody["content"].(map[string]any); ok {
-				// Try application/json first
-				if jsonContent, ok := content[constants.ContentTypeJSON].(map[string]any); ok {
-					if schema, ok := jsonContent["schema"].(map[string]any); ok {
-						return schema
-					}
-				}
-				// Try application/x-www-form-urlencoded
-				if formContent, ok := content[constants.ContentTypeForm].(map[string]any); ok {
-					if schema, ok := formContent["schema"].(map[string]any); ok {
-						return schema
-					}
-				}
+// extractParameters builds the tool's parameter schema from the operation's path, query and
+// header parameters, marked with their "in", and the properties of its request body.
+func (a *CoreAdapter) extractParameters(operation map[string]any, method string, shared []any) map[string]any {
+	properties := make(map[string]any)
+	var required []string
+
+	params, _ := operation["parameters"].([]any)
+	for _, param := range append(shared, params...) {
+		paramObj, ok := param.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, ok := paramObj["name"].(string)
+		if !ok {
+			continue
+		}
+		in, _ := paramObj["in"].(string)
+		if in == "" {
+			in = "query"
+		}
+		if in != "path" && in != "query" && in != "header" {
+			continue // cookies aren't supported
+		}
+		prop := map[string]any{
+			"type": "string", // Default type
+			"in":   in,
+		}
+
+		if desc, ok := paramObj["description"].(string); ok {
+			prop["description"] = desc
+		}
+
+		if schema, ok := paramObj["schema"].(map[string]any); ok {
+			if paramType, ok := schema["type"].(string); ok {
+				prop["type"] = paramType
+			}
+			if enum, ok := schema["enum"].([]any); ok {
+				prop["enum"] = enum
+			}
+			if items, ok := schema["items"].(map[string]any); ok {
+				prop["items"] = items
+			}
+		}
+
+		// Operation parameters override path-level ones of the same name
+		if _, seen := properties[name]; !seen {
+			if req, ok := paramObj["required"].(bool); ok && req {
+				required = append(required, name)
 			}
 		}
+		properties[name] = prop
 	}
 
-	// For GET or if no requestBody, look for parameters
-	if params, ok := operation["parameters"].([]any); ok && len(params) > 0 {
-		properties := make(map[string]any)
-		var required []string
-
-		for _, param := range params {
-			if paramObj, ok := param.(map[string]any); ok {
-				if name, ok := paramObj["name"].(string); ok {
-					prop := map[string]any{
-						"type": "string", // Default type
-					}
-
-					if desc, ok := paramObj["description"].(string); ok {
-						prop["description"] = desc
-					}
-
-					if schema, ok := paramObj["schema"].(map[string]any); ok {
-						if paramType, ok := schema["type"].(string); ok {
-							prop["type"] = paramType
-						}
-						if enum, ok := schema["enum"].([]any); ok {
-							prop["enum"] = enum
-						}
-					}
-
-					properties[name] = prop
-
-					if req, ok := paramObj["required"].(bool); ok && req {
-						required = append(required, name)
-					}
+	// For POST/PUT/PATCH, look for requestBody
+	if body := a.requestBodySchema(operation, method); body != nil {
+		if len(properties) == 0 {
+			return body
+		}
+		bodyProps, _ := body["properties"].(map[string]any)
+		for name, prop := range bodyProps {
+			if _, taken := properties[name]; !taken {
+				properties[name] = prop
+			}
+		}
+		if bodyRequired, ok := body["required"].([]any); ok {
+			for _, name := range bodyRequired {
+				if s, ok := name.(string); ok {
+					required = append(required, s)
 				}
 			}
 		}
+	}
 
+	// Default empty schema
+	if len(properties) == 0 {
 		return map[string]any{
 			"type":       "object",
-			"properties": properties,
-			"required":   required,
+			"properties": map[string]any{},
 		}
 	}
 
-	// Default empty schema
 	return map[string]any{
 		"type":       "object",
-		"properties": map[string]any{},
+		"properties": properties,
+		"required":   required,
+	}
+}
+
+// requestBodyContentTypes are the request body media types the converter understands, in
+// order of preference.
+var requestBodyContentTypes = []string{constants.ContentTypeJSON, constants.ContentTypeForm, constants.ContentTypeMultipart}
+
+// requestBodySchema returns the schema of the operation's request body, if it has one.
+func (a *CoreAdapter) requestBodySchema(operation map[string]any, method string) map[string]any {
+	if strings.ToUpper(method) == constants.HTTPMethodGET {
+		return nil
+	}
+	requestBody, _ := operation["requestBody"].(map[string]any)
+	content, _ := requestBody["content"].(map[string]any)
+	for _, contentType := range requestBodyContentTypes {
+		if media, ok := content[contentType].(map[string]any); ok {
+			if schema, ok := media["schema"].(map[string]any); ok {
+				return schema
+			}
+		}
 	}
+	return nil
 }
 
 func (a *CoreAdapter) determineContentType(operation map[string]any, method string) string {
@@ -301,15 +355,32 @@ func (a *CoreAdapter) determineContentType(operation map[string]any, method stri
 	// Check if requestBody specifies form data
 	if requestBody, ok := operation["requestBody"].(map[string]any); ok {
 		if content, ok := requestBody["content"].(map[string]any); ok {
+			if _, hasJSON := content[constants.ContentTypeJSON]; hasJSON {
+				return constants.ContentTypeJSON
+			}
 			if _, hasForm := content[constants.ContentTypeForm]; hasForm {
 				return constants.ContentTypeForm
 			}
+			if _, hasMultipart := content[constants.ContentTypeMultipart]; hasMultipart {
+				return constants.ContentTypeMultipart
+			}
 		}
 	}
 
 	return constants.ContentTypeJSON
 }
 
+// determineBodyType returns the body_type for a form or multipart request body, else "".
+func (a *CoreAdapter) determineBodyType(operation map[string]any, method string) string {
+	switch a.determineContentType(operation, method) {
+	case constants.ContentTypeForm:
+		return "form"
+	case constants.ContentTypeMultipart:
+		return "multipart"
+	}
+	return ""
+}
+
 func (a *CoreAdapter) Manifest() *registry.ToolManifest {
 	return nil
 }
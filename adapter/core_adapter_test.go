@@ -615,7 +615,7 @@ func TestCoreAdapter_ExtractParameters_Comprehensive(t *testing.T) {
 		},
 	}
 
-	params := a.extractParameters(postOpJSON, "POST")
+	params := a.extractParameters(postOpJSON, "POST", nil)
 	if params["type"] != "object" {
 		t.Errorf("expected type 'object', got %v", params["type"])
 	}
@@ -638,7 +638,7 @@ func TestCoreAdapter_ExtractParameters_Comprehensive(t *testing.T) {
 		},
 	}
 
-	params = a.extractParameters(getOpParams, "GET")
+	params = a.extractParameters(getOpParams, "GET", nil)
 	properties, ok := params["properties"].(map[string]any)
 	if !ok {
 		t.Fatalf("expected properties to be map, got %T", params["properties"])
@@ -659,7 +659,7 @@ func TestCoreAdapter_ExtractParameters_Comprehensive(t *testing.T) {
 
 	// Test operation with no parameters or requestBody
 	emptyOp := map[string]any{}
-	params = a.extractParameters(emptyOp, "GET")
+	params = a.extractParameters(emptyOp, "GET", nil)
 	if params["type"] != "object" {
 		t.Errorf("expected default type 'object', got %v", params["type"])
 	}
@@ -671,9 +671,61 @@ func TestCoreAdapter_ExtractParameters_Comprehensive(t *testing.T) {
 			map[string]any{},    // missing name
 		},
 	}
-	params = a.extractParameters(malformedOp, "GET")
+	params = a.extractParameters(malformedOp, "GET", nil)
 	properties, ok = params["properties"].(map[string]any)
 	if !ok || len(properties) != 0 {
 		t.Errorf("expected empty properties for malformed parameters, got %v", properties)
 	}
 }
+
+// TestCoreAdapter_ConvertOpenAPI_ParameterPlacement tests that manifests say where each parameter goes
+func TestCoreAdapter_ConvertOpenAPI_ParameterPlacement(t *testing.T) {
+	a := &CoreAdapter{}
+	spec := map[string]any{
+		"paths": map[string]any{
+			"/items/{id}": map[string]any{
+				"parameters": []any{
+					map[string]any{"name": "id", "in": "path", "required": true, "schema": map[string]any{"type": "string"}},
+				},
+				"put": map[string]any{
+					"parameters": []any{
+						map[string]any{"name": "dryRun", "in": "query", "schema": map[string]any{"type": "boolean"}},
+						map[string]any{"name": "Idempotency-Key", "in": "header"},
+						map[string]any{"name": "session", "in": "cookie"},
+					},
+					"requestBody": map[string]any{"content": map[string]any{
+						"application/x-www-form-urlencoded": map[string]any{"schema": map[string]any{
+							"type":       "object",
+							"required":   []any{"name"},
+							"properties": map[string]any{"name": map[string]any{"type": "string"}},
+						}},
+					}},
+				},
+			},
+		},
+	}
+
+	result, err := a.Execute(context.Background(), map[string]any{"__use": "core.convert_openapi", "openapi": spec, "api_name": "items", "base_url": "https://api.example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	manifest := result["manifests"].([]map[string]any)[0]
+	if manifest["method"] != "PUT" || manifest["body_type"] != "form" || manifest["endpoint"] != "https://api.example.com/items/{id}" {
+		t.Errorf("unexpected manifest %v", manifest)
+	}
+	params := manifest["parameters"].(map[string]any)
+	props := params["properties"].(map[string]any)
+	want := map[string]any{"id": "path", "dryRun": "query", "Idempotency-Key": "header", "name": nil}
+	if len(props) != len(want) {
+		t.Errorf("expected %d parameters, got %v", len(want), props)
+	}
+	for name, in := range want {
+		prop, ok := props[name].(map[string]any)
+		if !ok || prop["in"] != in {
+			t.Errorf("expected %s in %v, got %v", name, in, props[name])
+		}
+	}
+	if required := params["required"].([]string); strings.Join(required, ",") != "id,name" {
+		t.Errorf("expected id and name to be required, got %v", required)
+	}
+}
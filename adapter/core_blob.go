@@ -0,0 +1,372 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/constants"
+	"github.com/google/uuid"
+)
+
+// Blob encodings accepted by core.blob.put and returned by core.blob.get.
+const (
+	blobEncodingText   = "text"
+	blobEncodingBase64 = "base64"
+	blobEncodingJSON   = "json"
+)
+
+// executeBlobPut stores content in the engine's blob store. The content comes from exactly one
+// of `text`, `base64` or `url` (fetched with GET, optionally with `headers`). `filename` and
+// `mime` are optional; a URL's Content-Type is used when `mime` is not given.
+func (a *CoreAdapter) executeBlobPut(ctx context.Context, inputs map[string]any) (map[string]any, error) {
+	store, err := blobStoreFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	mimeType, _ := inputs["mime"].(string)
+	filename, _ := inputs["filename"].(string)
+
+	var body io.Reader
+	text, hasText := inputs["text"].(string)
+	encoded, hasBase64 := inputs["base64"].(string)
+	url, hasURL := inputs["url"].(string)
+	switch {
+	case countTrue(hasText, hasBase64, hasURL) != 1:
+		return nil, fmt.Errorf("%s requires exactly one of text, base64 or url", constants.CoreBlobPut)
+	case hasText:
+		body = strings.NewReader(text)
+		if mimeType == "" {
+			mimeType = "text/plain; charset=utf-8"
+		}
+	case hasBase64:
+		data, err := decodeBase64(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 content: %w", err)
+		}
+		body = bytes.NewReader(data)
+		if mimeType == "" {
+			mimeType = http.DetectContentType(data)
+		}
+	case hasURL:
+		policy := blob.FetchPolicyFromContext(ctx)
+		resp, err := fetchBlobSource(ctx, url, inputs["headers"], policy)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body = &limitedBody{r: io.LimitReader(resp.Body, policy.MaxBytes+1), max: policy.MaxBytes, url: url}
+		if mimeType == "" {
+			mimeType = resp.Header.Get(constants.HeaderContentType)
+		}
+	}
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	if filename == "" {
+		filename = "blobs/" + uuid.NewString() + extensionFor(mimeType)
+	}
+
+	counter := &countingReader{r: body}
+	blobURL, err := blob.PutStream(ctx, store, counter, mimeType, filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store blob: %w", err)
+	}
+	// Content-addressed stores choose their own key
+	id := filename
+	if s, ok := store.(blob.StreamingBlobStore); ok {
+		if info, err := s.Stat(ctx, blobURL); err == nil {
+			id = info.Key
+		}
+	}
+	return map[string]any{
+		"url":  blobURL,
+		"id":   id,
+		"mime": mimeType,
+		"size": counter.n,
+	}, nil
+}
+
+// executeBlobGet reads a blob back by `url`. The content is returned under the key named by
+// `as` (text, base64 or json); by default text-like blobs come back as text and others as base64.
+func (a *CoreAdapter) executeBlobGet(ctx context.Context, inputs map[string]any) (map[string]any, error) {
+	store, err := blobStoreFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	url, _ := inputs["url"].(string)
+	if url == "" {
+		return nil, fmt.Errorf("missing required field: url")
+	}
+
+	var mimeType string
+	if s, ok := store.(blob.StreamingBlobStore); ok {
+		info, err := s.Stat(ctx, url)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read blob %s: %w", url, err)
+		}
+		mimeType = info.Mime
+	}
+	data, err := store.Get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", url, err)
+	}
+
+	as, _ := inputs["as"].(string)
+	if as == "" {
+		as = blobEncodingBase64
+		if isTextMime(mimeType) {
+			as = blobEncodingText
+		}
+	}
+	result := map[string]any{
+		"url":  url,
+		"mime": mimeType,
+		"size": len(data),
+	}
+	switch as {
+	case blobEncodingText:
+		result[as] = string(data)
+	case blobEncodingBase64:
+		result[as] = base64.StdEncoding.EncodeToString(data)
+	case blobEncodingJSON:
+		var v any
+		if err := json.Unmarshal(data, &v); err != nil {
+			return nil, fmt.Errorf("blob %s is not valid JSON: %w", url, err)
+		}
+		result[as] = v
+	default:
+		return nil, fmt.Errorf("invalid as %q: must be text, base64 or json", as)
+	}
+	return result, nil
+}
+
+// executeBlobList lists the blobs whose ID starts with `prefix`.
+func (a *CoreAdapter) executeBlobList(ctx context.Context, inputs map[string]any) (map[string]any, error) {
+	store, err := blobStoreFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s, ok := store.(blob.StreamingBlobStore)
+	if !ok {
+		return nil, fmt.Errorf("the configured blob store does not support listing")
+	}
+	prefix, _ := inputs["prefix"].(string)
+	infos, err := s.List(ctx, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+	blobs := make([]any, 0, len(infos))
+	for _, info := range infos {
+		blobs = append(blobs, map[string]any{
+			"url":      info.URL,
+			"id":       info.Key,
+			"mime":     info.Mime,
+			"size":     info.Size,
+			"modified": info.ModTime,
+		})
+	}
+	return map[string]any{"blobs": blobs, "count": len(blobs)}, nil
+}
+
+// executeBlobURL returns a time-limited HTTP URL for the blob at `url`, valid for `ttl`
+// (a duration, default 24h), for sharing outside BeemFlow.
+func (a *CoreAdapter) executeBlobURL(ctx context.Context, inputs map[string]any) (map[string]any, error) {
+	store, err := blobStoreFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	url, _ := inputs["url"].(string)
+	if url == "" {
+		return nil, fmt.Errorf("missing required field: url")
+	}
+	ttl := blob.DefaultPresignTTL
+	if s, ok := inputs["ttl"].(string); ok && s != "" {
+		if ttl, err = time.ParseDuration(s); err != nil || ttl <= 0 {
+			return nil, fmt.Errorf("invalid ttl %q: expected a duration like 24h", s)
+		}
+	}
+	signed, err := blob.PresignURL(ctx, store, url, ttl)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign blob URL %s: %w", url, err)
+	}
+	return map[string]any{
+		"url":     signed,
+		"expires": time.Now().Add(ttl).UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func blobStoreFor(ctx context.Context) (blob.BlobStore, error) {
+	store := blob.StoreFromContext(ctx)
+	if store == nil {
+		return nil, fmt.Errorf("no blob store configured")
+	}
+	return store, nil
+}
+
+// fetchBlobSource GETs url for core.blob.put, failing on non-2xx responses and on bodies
+// declared larger than the policy allows. Unless the policy allows private destinations, every
+// address dialed, including those of redirects, must be public.
+func fetchBlobSource(ctx context.Context, url string, headers any, policy blob.FetchPolicy) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %s: %w", url, err)
+	}
+	if h, ok := headers.(map[string]any); ok {
+		for k, v := range h {
+			if s, ok := v.(string); ok {
+				req.Header.Set(k, s)
+			}
+		}
+	}
+	client := getHTTPClient()
+	if !policy.AllowPrivate {
+		dialer := &net.Dialer{Control: rejectPrivateAddress}
+		client.Transport = &http.Transport{DialContext: dialer.DialContext}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: status %d", url, resp.StatusCode)
+	}
+	if resp.ContentLength > policy.MaxBytes {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: body of %d bytes exceeds the %d byte limit", url, resp.ContentLength, policy.MaxBytes)
+	}
+	return resp, nil
+}
+
+// nonPublicPrefixes are special-purpose ranges that netip.Addr has no predicate for: shared
+// (CGNAT) address space, "this network", IETF protocol assignments, benchmarking, documentation,
+// reserved space, and IPv6 transition prefixes that embed an IPv4 address.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("100::/64"),
+	netip.MustParsePrefix("2001::/23"),
+	netip.MustParsePrefix("2001:db8::/32"),
+	netip.MustParsePrefix("2002::/16"),
+}
+
+// rejectPrivateAddress is a net.Dialer Control function that refuses every address that is
+// not public unicast. It sees the address actually being dialed, after DNS resolution, so a
+// public name that resolves (or is rebound) to an internal address is refused too.
+func rejectPrivateAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("refusing to fetch from unparseable address %s: %w", address, err)
+	}
+	if !isPublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("refusing to fetch from non-public address %s", addrPort.Addr())
+	}
+	return nil
+}
+
+func isPublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsUnspecified() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// limitedBody reads a fetched body through an io.LimitReader of max+1 bytes and fails once
+// more than max bytes arrive, so an oversized download is never stored.
+type limitedBody struct {
+	r   io.Reader
+	max int64
+	n   int64
+	url string
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.n += int64(n)
+	if l.n > l.max {
+		return 0, fmt.Errorf("failed to fetch %s: body exceeds the %d byte limit", l.url, l.max)
+	}
+	return n, err
+}
+
+func decodeBase64(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if data, err := base64.StdEncoding.DecodeString(s); err == nil {
+		return data, nil
+	}
+	return base64.RawStdEncoding.DecodeString(s)
+}
+
+// extensionFor returns a file extension for a MIME type, or "" if none is known.
+func extensionFor(mimeType string) string {
+	mediaType, _, err := mime.ParseMediaType(mimeType)
+	if err != nil {
+		return ""
+	}
+	switch mediaType {
+	case "text/plain":
+		return ".txt"
+	case "application/json":
+		return ".json"
+	}
+	if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+func isTextMime(mimeType string) bool {
+	mediaType, _, _ := mime.ParseMediaType(mimeType)
+	return strings.HasPrefix(mediaType, "text/") || mediaType == "application/json" ||
+		strings.HasSuffix(mediaType, "+json") || mediaType == "application/xml"
+}
+
+func countTrue(bs ...bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,227 @@
+package adapter
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/constants"
+)
+
+func newBlobTestContext(t *testing.T) context.Context {
+	store, err := blob.NewFilesystemBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemBlobStore failed: %v", err)
+	}
+	return blob.WithStore(context.Background(), store)
+}
+
+func TestCoreAdapter_BlobPutGetText(t *testing.T) {
+	ctx := newBlobTestContext(t)
+	a := &CoreAdapter{}
+
+	put, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobPut, "text": "a,b\n1,2\n", "filename": "reports/out.csv"})
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if put["id"] != "reports/out.csv" || put["size"] != int64(8) || !strings.HasPrefix(put["url"].(string), "file://") {
+		t.Errorf("unexpected put result: %v", put)
+	}
+
+	got, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobGet, "url": put["url"]})
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got["text"] != "a,b\n1,2\n" || got["size"] != 8 || !strings.HasPrefix(got["mime"].(string), "text/csv") {
+		t.Errorf("unexpected get result: %v", got)
+	}
+}
+
+func TestCoreAdapter_BlobPutBase64(t *testing.T) {
+	ctx := newBlobTestContext(t)
+	a := &CoreAdapter{}
+	pdf := []byte("%PDF-1.4\nbinary\x00\x01")
+
+	put, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobPut, "base64": base64.StdEncoding.EncodeToString(pdf)})
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if put["mime"] != "application/pdf" || !strings.HasSuffix(put["id"].(string), ".pdf") {
+		t.Errorf("expected a sniffed PDF, got %v", put)
+	}
+
+	got, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobGet, "url": put["url"]})
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if got["base64"] != base64.StdEncoding.EncodeToString(pdf) {
+		t.Errorf("expected binary content back as base64, got %v", got)
+	}
+}
+
+func TestCoreAdapter_BlobPutURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Token") != "secret" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"items":[1,2,3]}`))
+	}))
+	defer srv.Close()
+	ctx := blob.WithFetchPolicy(newBlobTestContext(t), blob.FetchPolicy{AllowPrivate: true})
+	a := &CoreAdapter{}
+
+	if _, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobPut, "url": srv.URL}); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("expected the failed fetch to surface its status, got %v", err)
+	}
+	put, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobPut, "url": srv.URL, "headers": map[string]any{"X-Token": "secret"}})
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if put["mime"] != "application/json" || put["size"] != int64(17) {
+		t.Errorf("unexpected put result: %v", put)
+	}
+
+	got, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobGet, "url": put["url"], "as": "json"})
+	if err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	items := got["json"].(map[string]any)["items"].([]any)
+	if len(items) != 3 {
+		t.Errorf("expected decoded JSON, got %v", got)
+	}
+}
+
+func TestCoreAdapter_BlobPutURLPolicy(t *testing.T) {
+	body := strings.Repeat("x", 64)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// No Content-Length for /chunked, so only the read limit can catch it
+		if r.URL.Path == "/chunked" {
+			w.(http.Flusher).Flush()
+		}
+		_, _ = w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	a := &CoreAdapter{}
+
+	// Loopback is refused by default
+	ctx := newBlobTestContext(t)
+	if _, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobPut, "url": srv.URL}); err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Errorf("expected a loopback fetch to be refused, got %v", err)
+	}
+
+	ctx = blob.WithFetchPolicy(ctx, blob.FetchPolicy{AllowPrivate: true, MaxBytes: 32})
+	for _, path := range []string{"/", "/chunked"} {
+		if _, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobPut, "url": srv.URL + path, "filename": "big.txt"}); err == nil || !strings.Contains(err.Error(), "32 byte limit") {
+			t.Errorf("%s: expected a body over the limit to fail, got %v", path, err)
+		}
+	}
+	if infos, _ := blob.StoreFromContext(ctx).(blob.StreamingBlobStore).List(ctx, ""); len(infos) != 0 {
+		t.Errorf("expected nothing stored for an oversized body, got %d blobs", len(infos))
+	}
+
+	ctx = blob.WithFetchPolicy(ctx, blob.FetchPolicy{AllowPrivate: true, MaxBytes: 64})
+	if put, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobPut, "url": srv.URL + "/chunked"}); err != nil || put["size"] != int64(64) {
+		t.Errorf("expected a body at the limit to be stored, got %v, %v", put, err)
+	}
+}
+
+func TestRejectPrivateAddress(t *testing.T) {
+	refused := []string{
+		"127.0.0.1:80", "10.1.2.3:80", "172.16.0.1:80", "192.168.1.1:80", "169.254.169.254:80",
+		"100.64.0.1:80", "100.127.255.254:80", "0.0.0.0:80", "0.1.2.3:80", "192.0.0.8:80",
+		"198.18.0.1:80", "203.0.113.5:80", "240.0.0.1:80", "255.255.255.255:80", "224.0.0.1:80",
+		"[::]:80", "[::1]:80", "[fe80::1]:80", "[fc00::1]:80", "[ff02::1]:80", "[::ffff:10.0.0.1]:80",
+		"[::ffff:100.64.0.1]:80", "[64:ff9b::a00:1]:80", "[2002:a00:1::]:80", "[2001:db8::1]:80",
+	}
+	for _, addr := range refused {
+		if err := rejectPrivateAddress("tcp", addr, nil); err == nil {
+			t.Errorf("expected %s to be refused", addr)
+		}
+	}
+	for _, addr := range []string{"93.184.216.34:443", "100.128.0.1:443", "[2606:4700::1111]:443", "[::ffff:8.8.8.8]:443"} {
+		if err := rejectPrivateAddress("tcp", addr, nil); err != nil {
+			t.Errorf("expected %s to be allowed, got %v", addr, err)
+		}
+	}
+}
+
+func TestCoreAdapter_BlobList(t *testing.T) {
+	ctx := newBlobTestContext(t)
+	a := &CoreAdapter{}
+	for _, name := range []string{"exports/b.txt", "exports/a.txt", "other.txt"} {
+		if _, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobPut, "text": name, "filename": name}); err != nil {
+			t.Fatalf("put %s failed: %v", name, err)
+		}
+	}
+	out, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobList, "prefix": "exports/"})
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	blobs := out["blobs"].([]any)
+	if out["count"] != 2 || blobs[0].(map[string]any)["id"] != "exports/a.txt" {
+		t.Errorf("unexpected list result: %v", out)
+	}
+}
+
+func TestCoreAdapter_BlobErrors(t *testing.T) {
+	a := &CoreAdapter{}
+	if _, err := a.Execute(context.Background(), map[string]any{"__use": constants.CoreBlobPut, "text": "x"}); err == nil {
+		t.Error("expected an error without a blob store")
+	}
+
+	ctx := newBlobTestContext(t)
+	cases := []map[string]any{
+		{"__use": constants.CoreBlobPut},
+		{"__use": constants.CoreBlobPut, "text": "x", "base64": "eA=="},
+		{"__use": constants.CoreBlobPut, "base64": "not base64!"},
+		{"__use": constants.CoreBlobGet},
+		{"__use": constants.CoreBlobGet, "url": "file:///nonexistent/blob"},
+	}
+	for _, in := range cases {
+		if _, err := a.Execute(ctx, in); err == nil {
+			t.Errorf("expected error for %v", in)
+		}
+	}
+	put, _ := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobPut, "text": "not json"})
+	if _, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobGet, "url": put["url"], "as": "json"}); err == nil {
+		t.Error("expected error decoding non-JSON content as json")
+	}
+	if _, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobGet, "url": put["url"], "as": "yaml"}); err == nil {
+		t.Error("expected error for an unknown encoding")
+	}
+}
+
+func TestCoreAdapter_BlobURL(t *testing.T) {
+	store, err := blob.NewFilesystemBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemBlobStore failed: %v", err)
+	}
+	ctx := blob.WithStore(context.Background(), store)
+	a := &CoreAdapter{}
+	put, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobPut, "text": "share me", "filename": "share.txt"})
+	if err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if _, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobURL, "url": put["url"]}); err == nil {
+		t.Error("expected an error when the store cannot sign URLs")
+	}
+
+	signer, _ := blob.NewURLSigner("https://flows.example.com", "key")
+	store.SetURLSigner(signer)
+	out, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobURL, "url": put["url"], "ttl": "15m"})
+	if err != nil {
+		t.Fatalf("url failed: %v", err)
+	}
+	if !strings.HasPrefix(out["url"].(string), "https://flows.example.com/blobs/share.txt?expires=") || out["expires"] == "" {
+		t.Errorf("unexpected url result: %v", out)
+	}
+	if _, err := a.Execute(ctx, map[string]any{"__use": constants.CoreBlobURL, "url": put["url"], "ttl": "soon"}); err == nil {
+		t.Error("expected an error for an invalid ttl")
+	}
+}
@@ -3,13 +3,13 @@ package adapter
 import (
 	"bytes"
 	"context"
-	"encoding/json"
 	"io"
 	"maps"
 	"net/http"
 	"os"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/awantoch/beemflow/constants"
 	"github.com/awantoch/beemflow/registry"
@@ -19,7 +19,7 @@ import (
 // getHTTPClient returns an HTTP client that respects context deadlines
 func getHTTPClient() *http.Client {
 	return &http.Client{
-		// Don't set a timeout here - let the context handle timeouts
+		// Don't set a timeout here - each attempt's context carries the policy timeout
 		// This allows proper context cancellation and deadline handling
 	}
 }
@@ -35,10 +35,11 @@ type HTTPAdapter struct {
 
 // HTTPRequest represents a prepared HTTP request
 type HTTPRequest struct {
-	Method  string
-	URL     string
-	Body    []byte
-	Headers map[string]string
+	Method      string
+	URL         string
+	Body        []byte
+	ContentType string // of Body; a Content-Type in Headers takes precedence, except for multipart
+	Headers     map[string]string
 }
 
 // HTTPResponse represents a processed HTTP response
@@ -55,46 +56,68 @@ func (a *HTTPAdapter) ID() string {
 
 // Execute performs HTTP requests based on manifest or generic parameters.
 func (a *HTTPAdapter) Execute(ctx context.Context, inputs map[string]any) (map[string]any, error) {
+	policy, err := a.resolvePolicy(inputs)
+	if err != nil {
+		return nil, err
+	}
+	paginate, err := a.resolvePagination(inputs)
+	if err != nil {
+		return nil, err
+	}
+	if paginate != nil {
+		return a.executePaginated(ctx, inputs, policy, paginate)
+	}
+
+	req, err := a.buildRequest(ctx, inputs)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := a.executeHTTPRequest(ctx, req, policy)
+	if err != nil {
+		return nil, err
+	}
+	return resp.output(), nil
+}
+
+// buildRequest prepares a manifest-based or generic request from the inputs
+func (a *HTTPAdapter) buildRequest(ctx context.Context, inputs map[string]any) (HTTPRequest, error) {
 	// Handle manifest-based requests
-	if a.ToolManifest != nil && a.ToolManifest.Endpoint != "" {
-		return a.executeManifestRequest(ctx, inputs)
+	if a.isManifestRequest() {
+		return a.prepareManifestRequest(ctx, inputs)
 	}
 
 	// Handle generic HTTP requests
-	return a.executeGenericRequest(ctx, inputs)
+	return a.prepareGenericRequest(ctx, inputs)
+}
+
+// isManifestRequest reports whether calls go to the manifest's endpoint
+func (a *HTTPAdapter) isManifestRequest() bool {
+	return a.ToolManifest != nil && a.ToolManifest.Endpoint != ""
 }
 
-// executeManifestRequest handles requests with a predefined manifest
-func (a *HTTPAdapter) executeManifestRequest(ctx context.Context, inputs map[string]any) (map[string]any, error) {
+// prepareManifestRequest prepares requests with a predefined manifest
+func (a *HTTPAdapter) prepareManifestRequest(ctx context.Context, inputs map[string]any) (HTTPRequest, error) {
 	// Create a copy of inputs to avoid mutation
 	enrichedInputs := a.enrichInputsWithDefaults(inputs)
-
-	// Prepare headers
-	headers := a.prepareManifestHeaders(enrichedInputs)
-
-	// Create request
-	req := HTTPRequest{
-		Method:  constants.HTTPMethodPOST,
-		URL:     a.ToolManifest.Endpoint,
-		Headers: headers,
-	}
-
-	// Marshal body
-	body, err := json.Marshal(enrichedInputs)
+	delete(enrichedInputs, constants.ParamHTTPTimeout)
+	delete(enrichedInputs, constants.ParamHTTPRetry)
+	delete(enrichedInputs, constants.ParamHTTPCircuitBreaker)
+	delete(enrichedInputs, constants.ParamHTTPExpectStatus)
+	delete(enrichedInputs, constants.ParamHTTPPaginate)
+
+	// Place inputs in the path, query, headers and body
+	req, err := a.buildManifestRequest(ctx, enrichedInputs)
 	if err != nil {
-		return nil, utils.Errorf("failed to marshal request body: %w", err)
+		return HTTPRequest{}, utils.Errorf("tool %s: %w", a.ToolManifest.Name, err)
 	}
-	req.Body = body
-
-	// Execute request
-	return a.executeHTTPRequest(ctx, req)
+	return req, nil
 }
 
-// executeGenericRequest handles generic HTTP requests
-func (a *HTTPAdapter) executeGenericRequest(ctx context.Context, inputs map[string]any) (map[string]any, error) {
+// prepareGenericRequest prepares generic HTTP requests
+func (a *HTTPAdapter) prepareGenericRequest(ctx context.Context, inputs map[string]any) (HTTPRequest, error) {
 	url, ok := utils.SafeStringAssert(inputs["url"])
 	if !ok || url == "" {
-		return nil, utils.Errorf("missing or invalid url")
+		return HTTPRequest{}, utils.Errorf("missing or invalid url")
 	}
 
 	method := a.extractMethod(inputs)
@@ -109,19 +132,69 @@ func (a *HTTPAdapter) executeGenericRequest(ctx context.Context, inputs map[stri
 	// Add body for non-GET requests
 	if method != constants.HTTPMethodGET {
 		if body := inputs["body"]; body != nil {
-			bodyBytes, err := json.Marshal(body)
+			bodyType, _ := utils.SafeStringAssert(inputs["body_type"])
+			bodyBytes, contentType, err := encodeRequestBody(ctx, bodyType, body)
 			if err != nil {
-				return nil, utils.Errorf("failed to marshal request body: %w", err)
+				return HTTPRequest{}, err
 			}
-			req.Body = bodyBytes
+			req.Body, req.ContentType = bodyBytes, contentType
 		}
 	}
+	return req, nil
+}
+
+// executeHTTPRequest executes an HTTP request under the call policy and returns the response.
+// Failed attempts are retried; a call that still fails counts against the circuit breaker.
+func (a *HTTPAdapter) executeHTTPRequest(ctx context.Context, req HTTPRequest, policy httpPolicy) (*httpResponse, error) {
+	httpReq, err := a.newHTTPRequest(ctx, req)
+	if err != nil {
+		return nil, err
+	}
 
-	return a.executeHTTPRequest(ctx, req)
+	key := a.breakerKey(req.URL)
+	breaker := breakerFor(key)
+	if wait, ok := breaker.allow(policy, time.Now()); !ok {
+		return nil, utils.Errorf("%w for %s: retry in %s", ErrCircuitOpen, key, wait.Round(time.Second))
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, data, err := a.sendHTTPRequest(ctx, httpReq, policy.timeout)
+		if err == nil && (policy.expectsStatus(resp.StatusCode) || !retryableStatus(resp.StatusCode)) {
+			breaker.succeed()
+			return a.processHTTPResponse(ctx, resp, data, req.Method, req.URL, policy)
+		}
+
+		header := http.Header{}
+		status := 0
+		if err == nil {
+			header, status = resp.Header, resp.StatusCode
+			err = &HTTPStatusError{Method: req.Method, URL: req.URL, Status: resp.StatusCode, Header: resp.Header, Body: data}
+		}
+		retry := attempt < policy.attempts && ctx.Err() == nil && policy.mayRetry(httpReq.Method, status, header)
+		var wait time.Duration
+		if retry {
+			wait, retry = policy.retryWait(attempt, header)
+		}
+		if retry && sleepContext(ctx, wait) == nil {
+			utils.Debug("Retrying HTTP %s %s in %s after attempt %d: %v", req.Method, req.URL, wait, attempt, err)
+			continue
+		}
+
+		// The caller giving up says nothing about the tool
+		if ctx.Err() != nil {
+			breaker.release()
+		} else {
+			breaker.fail(policy, time.Now())
+		}
+		if attempt > 1 {
+			return nil, utils.Errorf("%w (after %d attempts)", err, attempt)
+		}
+		return nil, err
+	}
 }
 
-// executeHTTPRequest executes an HTTP request and returns the response
-func (a *HTTPAdapter) executeHTTPRequest(ctx context.Context, req HTTPRequest) (map[string]any, error) {
+// newHTTPRequest builds the request every attempt is cloned from.
+func (a *HTTPAdapter) newHTTPRequest(ctx context.Context, req HTTPRequest) (*http.Request, error) {
 	// Create HTTP request
 	var bodyReader io.Reader
 	if len(req.Body) > 0 {
@@ -138,6 +211,12 @@ func (a *HTTPAdapter) executeHTTPRequest(ctx context.Context, req HTTPRequest) (
 		httpReq.Header.Set(k, v)
 	}
 
+	// Set content-type for the body unless the caller chose one. Multipart bodies need
+	// the boundary they were written with.
+	if req.ContentType != "" && (httpReq.Header.Get(constants.HeaderContentType) == "" || isMultipartContentType(req.ContentType)) {
+		httpReq.Header.Set(constants.HeaderContentType, req.ContentType)
+	}
+
 	// Set default headers if not provided
 	if req.Method != constants.HTTPMethodGET && httpReq.Header.Get(constants.HeaderContentType) == "" {
 		httpReq.Header.Set(constants.HeaderContentType, constants.ContentTypeJSON)
@@ -145,49 +224,48 @@ func (a *HTTPAdapter) executeHTTPRequest(ctx context.Context, req HTTPRequest) (
 	if httpReq.Header.Get(constants.HeaderAccept) == "" {
 		httpReq.Header.Set(constants.HeaderAccept, constants.DefaultJSONAccept)
 	}
+	return httpReq, nil
+}
 
-	// Set content-type if sending body
-	if len(req.Body) > 0 {
-		httpReq.Header.Set(constants.HeaderContentType, constants.ContentTypeJSON)
+// sendHTTPRequest makes a single attempt and reads the whole response within its timeout.
+func (a *HTTPAdapter) sendHTTPRequest(ctx context.Context, base *http.Request, timeout time.Duration) (*http.Response, []byte, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	httpReq := base.Clone(ctx)
+	if base.GetBody != nil {
+		body, err := base.GetBody()
+		if err != nil {
+			return nil, nil, utils.Errorf("failed to create HTTP request: %w", err)
+		}
+		httpReq.Body = body
 	}
-	httpReq.Header.Set(constants.HeaderAccept, constants.DefaultJSONAccept)
 
 	// Execute request with context-aware client
 	client := getHTTPClient()
 	resp, err := client.Do(httpReq)
 	if err != nil {
-		return nil, utils.Errorf("HTTP request failed: %w", err)
+		return nil, nil, utils.Errorf("HTTP request failed: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Process response
-	return a.processHTTPResponse(resp, req.Method, req.URL)
-}
-
-// processHTTPResponse processes an HTTP response and returns structured data
-func (a *HTTPAdapter) processHTTPResponse(resp *http.Response, method, url string) (map[string]any, error) {
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return nil, utils.Errorf("failed to read response body: %w", err)
-	}
-
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return nil, utils.Errorf("HTTP %s %s: status %d: %s", method, url, resp.StatusCode, string(data))
+		return nil, nil, utils.Errorf("failed to read response body: %w", err)
 	}
+	return resp, data, nil
+}
 
-	// Try to parse as JSON first
-	var parsed any
-	if err := json.Unmarshal(data, &parsed); err == nil {
-		// If it's a JSON object, return it directly for backward compatibility
-		if obj, ok := parsed.(map[string]any); ok {
-			return obj, nil
-		}
-		// For non-object JSON (arrays, primitives), wrap in body
-		return map[string]any{"body": parsed}, nil
+// processHTTPResponse checks the response status and decodes the body
+func (a *HTTPAdapter) processHTTPResponse(ctx context.Context, resp *http.Response, data []byte, method, url string, policy httpPolicy) (*httpResponse, error) {
+	if !policy.expectsStatus(resp.StatusCode) {
+		err := &HTTPStatusError{Method: method, URL: url, Status: resp.StatusCode, Header: resp.Header, Body: data}
+		utils.Error("%v", err)
+		return nil, err
 	}
-
-	// Fallback to raw string wrapped in body
-	return map[string]any{"body": string(data)}, nil
+	return newHTTPResponse(ctx, resp, data)
 }
 
 // enrichInputsWithDefaults creates a copy of inputs with defaults applied (no mutation)
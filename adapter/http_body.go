@@ -0,0 +1,257 @@
+package adapter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/model"
+)
+
+// Request body encodings accepted as `body_type`.
+const (
+	bodyTypeJSON      = "json"
+	bodyTypeForm      = "form"
+	bodyTypeMultipart = "multipart"
+	bodyTypeText      = "text"
+	bodyTypeBinary    = "binary"
+)
+
+const (
+	mimeOctetStream = "application/octet-stream"
+	mimeText        = "text/plain; charset=utf-8"
+)
+
+// encodeRequestBody encodes body as bodyType (json by default) and returns the bytes with the
+// Content-Type they are sent as. Multipart file parts and binary bodies are read from blobs.
+func encodeRequestBody(ctx context.Context, bodyType string, body any) ([]byte, string, error) {
+	switch bodyType {
+	case "", bodyTypeJSON:
+		// A string is taken to be JSON text already
+		if s, ok := body.(string); ok {
+			return []byte(s), constants.ContentTypeJSON, nil
+		}
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to marshal request body: %w", err)
+		}
+		return data, constants.ContentTypeJSON, nil
+	case bodyTypeForm:
+		values, err := formValues(body)
+		if err != nil {
+			return nil, "", err
+		}
+		return []byte(values.Encode()), constants.ContentTypeForm, nil
+	case bodyTypeMultipart:
+		return encodeMultipart(ctx, body)
+	case bodyTypeText:
+		s, ok := scalarString(body)
+		if !ok {
+			return nil, "", fmt.Errorf("text body must be a string, got %T", body)
+		}
+		return []byte(s), mimeText, nil
+	case bodyTypeBinary:
+		ref, ok := asBlobSource(body)
+		if !ok {
+			s, isString := body.(string)
+			if !isString {
+				return nil, "", fmt.Errorf("binary body must be a blob reference or base64 string, got %T", body)
+			}
+			data, err := decodeBase64(s)
+			if err != nil {
+				return nil, "", fmt.Errorf("invalid base64 body: %w", err)
+			}
+			return data, mimeOctetStream, nil
+		}
+		data, mimeType, err := readBlobSource(ctx, ref)
+		if err != nil {
+			return nil, "", err
+		}
+		return data, mimeType, nil
+	default:
+		return nil, "", fmt.Errorf("invalid body_type %q: must be json, form, multipart, text or binary", bodyType)
+	}
+}
+
+// formValues flattens a map into form fields. Lists become repeated fields.
+func formValues(body any) (url.Values, error) {
+	fields, ok := body.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("form body must be an object, got %T", body)
+	}
+	values := url.Values{}
+	for k, v := range fields {
+		items, isList := v.([]any)
+		if !isList {
+			items = []any{v}
+		}
+		for _, item := range items {
+			s, ok := scalarString(item)
+			if !ok {
+				return nil, fmt.Errorf("form field %s must be a string, number, boolean or list of them, got %T", k, item)
+			}
+			values.Add(k, s)
+		}
+	}
+	return values, nil
+}
+
+// encodeMultipart writes a multipart/form-data body. Fields holding blob references become
+// file parts; other fields are written like form fields.
+func encodeMultipart(ctx context.Context, body any) ([]byte, string, error) {
+	fields, ok := body.(map[string]any)
+	if !ok {
+		return nil, "", fmt.Errorf("multipart body must be an object, got %T", body)
+	}
+	names := make([]string, 0, len(fields))
+	for k := range fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	for _, name := range names {
+		v := fields[name]
+		if ref, ok := asBlobSource(v); ok {
+			if err := writeFilePart(ctx, w, name, ref); err != nil {
+				return nil, "", err
+			}
+			continue
+		}
+		items, isList := v.([]any)
+		if !isList {
+			items = []any{v}
+		}
+		for _, item := range items {
+			s, ok := scalarString(item)
+			if !ok {
+				return nil, "", fmt.Errorf("multipart field %s must be a blob reference, string, number or boolean, got %T", name, item)
+			}
+			if err := w.WriteField(name, s); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), w.FormDataContentType(), nil
+}
+
+func writeFilePart(ctx context.Context, w *multipart.Writer, name string, ref blobSource) error {
+	data, mimeType, err := readBlobSource(ctx, ref)
+	if err != nil {
+		return err
+	}
+	filename := ref.Filename
+	if filename == "" {
+		filename = path.Base(ref.URL)
+	}
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, name, filename))
+	header.Set(constants.HeaderContentType, mimeType)
+	part, err := w.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	_, err = part.Write(data)
+	return err
+}
+
+// blobSource is a blob named in a request body.
+type blobSource struct {
+	URL      string
+	Mime     string
+	Filename string
+}
+
+// asBlobSource recognizes a blob reference: a blob URL, a {"$blob": ...} reference, or an
+// object with a blob `url` such as core.blob.put's output, optionally with `filename` and
+// `mime` (or `content_type`) overrides.
+func asBlobSource(v any) (blobSource, bool) {
+	if s, ok := v.(string); ok {
+		return blobSource{URL: s}, blob.IsBlobURL(s)
+	}
+	if ref, ok := model.AsBlobRef(v); ok {
+		return blobSource{URL: ref.URL, Mime: ref.Mime}, true
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return blobSource{}, false
+	}
+	src := blobSource{}
+	src.URL, _ = m[model.BlobRefKey].(string)
+	if src.URL == "" {
+		src.URL, _ = m["url"].(string)
+	}
+	if !blob.IsBlobURL(src.URL) {
+		return blobSource{}, false
+	}
+	src.Filename, _ = m["filename"].(string)
+	if src.Mime, _ = m["content_type"].(string); src.Mime == "" {
+		src.Mime, _ = m["mime"].(string)
+	}
+	return src, true
+}
+
+// readBlobSource reads a blob from the store in ctx, with its MIME type.
+func readBlobSource(ctx context.Context, src blobSource) ([]byte, string, error) {
+	store, err := blobStoreFor(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	r, err := blob.Open(ctx, store, src.URL)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read blob %s: %w", src.URL, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read blob %s: %w", src.URL, err)
+	}
+	mimeType := src.Mime
+	if mimeType == "" {
+		if info, err := blob.Stat(ctx, store, src.URL); err == nil {
+			mimeType = info.Mime
+		}
+	}
+	if mimeType == "" {
+		mimeType = mimeOctetStream
+	}
+	return data, mimeType, nil
+}
+
+// scalarString formats strings, numbers and booleans; other values are rejected.
+func scalarString(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case nil:
+		return "", true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool, int, int64:
+		return fmt.Sprint(v), true
+	case json.Number:
+		return v.String(), true
+	default:
+		return "", false
+	}
+}
+
+// isMultipartContentType reports whether a Content-Type names multipart/form-data.
+func isMultipartContentType(contentType string) bool {
+	return strings.HasPrefix(strings.ToLower(strings.TrimSpace(contentType)), "multipart/")
+}
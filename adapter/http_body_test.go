@@ -0,0 +1,125 @@
+package adapter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/registry"
+)
+
+// captureServer records the last request's Content-Type and body.
+func captureServer(t *testing.T) (*httptest.Server, *http.Request, *[]byte) {
+	t.Helper()
+	var last http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		last = *r.Clone(context.Background())
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+			if err := r.ParseMultipartForm(1 << 20); err != nil {
+				t.Errorf("ParseMultipartForm failed: %v", err)
+			}
+			last.MultipartForm = r.MultipartForm
+		} else {
+			body, _ = io.ReadAll(r.Body)
+		}
+		w.Write([]byte(`{}`))
+	}))
+	t.Cleanup(server.Close)
+	return server, &last, &body
+}
+
+func TestHTTPAdapter_BodyTypes(t *testing.T) {
+	server, last, body := captureServer(t)
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	post := func(inputs map[string]any) {
+		t.Helper()
+		inputs["url"], inputs["method"] = server.URL, "POST"
+		if _, err := adapter.Execute(context.Background(), inputs); err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+	}
+
+	post(map[string]any{"body_type": "form", "body": map[string]any{"grant_type": "client_credentials", "scope": []any{"a", "b"}, "n": 1.5}})
+	if ct := last.Header.Get("Content-Type"); ct != "application/x-www-form-urlencoded" {
+		t.Errorf("expected a form Content-Type, got %s", ct)
+	}
+	if got := string(*body); got != "grant_type=client_credentials&n=1.5&scope=a&scope=b" {
+		t.Errorf("unexpected form body %s", got)
+	}
+
+	// JSON text is sent as written, and a user Content-Type wins
+	post(map[string]any{"body": `{"query": "x"}`, "headers": map[string]any{"content-type": "application/vnd.api+json"}})
+	if ct := last.Header.Get("Content-Type"); ct != "application/vnd.api+json" || string(*body) != `{"query": "x"}` {
+		t.Errorf("expected the JSON text with the user Content-Type, got %s %s", ct, *body)
+	}
+
+	post(map[string]any{"body_type": "text", "body": "hello"})
+	if ct := last.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") || string(*body) != "hello" {
+		t.Errorf("expected a text body, got %s %s", ct, *body)
+	}
+
+	post(map[string]any{"body_type": "binary", "body": "AAEC"})
+	if ct := last.Header.Get("Content-Type"); ct != "application/octet-stream" || string(*body) != "\x00\x01\x02" {
+		t.Errorf("expected decoded bytes, got %s %q", ct, *body)
+	}
+
+	if _, err := adapter.Execute(context.Background(), map[string]any{"url": server.URL, "method": "POST", "body_type": "xml", "body": "<a/>"}); err == nil || !strings.Contains(err.Error(), "invalid body_type") {
+		t.Errorf("expected an invalid body_type error, got %v", err)
+	}
+}
+
+func TestHTTPAdapter_MultipartFromBlobs(t *testing.T) {
+	ctx := newBlobTestContext(t)
+	store := blob.StoreFromContext(ctx)
+	url, err := store.Put(ctx, []byte("a,b\n1,2\n"), "text/csv", "report.csv")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	server, last, body := captureServer(t)
+
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	_, err = adapter.Execute(ctx, map[string]any{
+		"url":       server.URL,
+		"method":    "POST",
+		"body_type": "multipart",
+		"headers":   map[string]any{"Content-Type": "multipart/form-data"},
+		"body": map[string]any{
+			"title": "Q1",
+			"file":  map[string]any{"url": url, "filename": "q1.csv"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	form := last.MultipartForm
+	if form == nil {
+		t.Fatal("expected a multipart body with a boundary")
+	}
+	if form.Value["title"][0] != "Q1" || len(form.File["file"]) != 1 {
+		t.Fatalf("unexpected form %v", form)
+	}
+	file := form.File["file"][0]
+	if file.Filename != "q1.csv" || !strings.HasPrefix(file.Header.Get("Content-Type"), "text/csv") {
+		t.Errorf("unexpected file part %s %s", file.Filename, file.Header.Get("Content-Type"))
+	}
+	f, _ := file.Open()
+	data, _ := io.ReadAll(f)
+	if string(data) != "a,b\n1,2\n" {
+		t.Errorf("expected the blob content, got %q", data)
+	}
+
+	// Manifests choose the encoding for their tool, and binary bodies stream a blob as is
+	tool := &HTTPAdapter{AdapterID: "upload", ToolManifest: &registry.ToolManifest{Name: "upload", Endpoint: server.URL, BodyType: "form"}}
+	if _, err := tool.Execute(ctx, map[string]any{"name": "x"}); err != nil || string(*body) != "name=x" {
+		t.Errorf("expected a form body from the manifest, got %s: %v", *body, err)
+	}
+	_, err = adapter.Execute(ctx, map[string]any{"url": server.URL, "method": "PUT", "body_type": "binary", "body": url})
+	if err != nil || string(*body) != "a,b\n1,2\n" || !strings.HasPrefix(last.Header.Get("Content-Type"), "text/csv") {
+		t.Errorf("expected the blob as the body, got %s %q: %v", last.Header.Get("Content-Type"), *body, err)
+	}
+}
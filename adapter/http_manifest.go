@@ -0,0 +1,165 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/awantoch/beemflow/constants"
+)
+
+// Where a manifest parameter is sent, declared with "in" on its property. Parameters without
+// one fill a matching {name} in the endpoint, else go to the query for GET, HEAD and DELETE
+// and to the body otherwise.
+const (
+	paramInPath   = "path"
+	paramInQuery  = "query"
+	paramInHeader = "header"
+	paramInBody   = "body"
+)
+
+// pathParamPattern matches {name} path parameters in a manifest endpoint.
+var pathParamPattern = regexp.MustCompile(`\{([^{}/]+)\}`)
+
+// buildManifestRequest places the inputs in the path, query, headers and body of the
+// manifest's endpoint, on top of the manifest's static headers, query and body.
+func (a *HTTPAdapter) buildManifestRequest(ctx context.Context, inputs map[string]any) (HTTPRequest, error) {
+	m := a.ToolManifest
+	method := strings.ToUpper(m.Method)
+	if method == "" {
+		method = constants.HTTPMethodPOST
+	}
+	placements := a.parameterPlacements()
+	pathParams := map[string]bool{}
+	for _, match := range pathParamPattern.FindAllStringSubmatch(m.Endpoint, -1) {
+		pathParams[match[1]] = true
+	}
+
+	headers := a.prepareManifestHeaders(inputs)
+	query := url.Values{}
+	for k, v := range m.Query {
+		query.Set(k, expandEnvValue(v))
+	}
+	body := make(map[string]any, len(m.Body)+len(inputs))
+	for k, v := range m.Body {
+		if s, ok := v.(string); ok {
+			v = expandEnvValue(s)
+		}
+		body[k] = v
+	}
+	pathValues := map[string]string{}
+
+	for name, value := range inputs {
+		in, declared := placements[name]
+		if !declared && name == "headers" {
+			continue // consumed by prepareManifestHeaders
+		}
+		if in == "" {
+			switch {
+			case pathParams[name]:
+				in = paramInPath
+			case bodylessMethod(method):
+				in = paramInQuery
+			default:
+				in = paramInBody
+			}
+		}
+		switch in {
+		case paramInPath:
+			s, ok := scalarString(value)
+			if !ok {
+				return HTTPRequest{}, fmt.Errorf("path parameter %s must be a string or number, got %T", name, value)
+			}
+			pathValues[name] = s
+		case paramInQuery:
+			items, isList := value.([]any)
+			if !isList {
+				items = []any{value}
+			}
+			query.Del(name)
+			for _, item := range items {
+				s, ok := scalarString(item)
+				if !ok {
+					return HTTPRequest{}, fmt.Errorf("query parameter %s must be a string, number, boolean or list of them, got %T", name, item)
+				}
+				query.Add(name, s)
+			}
+		case paramInHeader:
+			s, ok := scalarString(value)
+			if !ok {
+				return HTTPRequest{}, fmt.Errorf("header parameter %s must be a string or number, got %T", name, value)
+			}
+			headers[name] = s
+		case paramInBody:
+			body[name] = value
+		default:
+			return HTTPRequest{}, fmt.Errorf("parameter %s has invalid \"in\" %q: must be path, query, header or body", name, in)
+		}
+	}
+
+	endpoint, err := expandPathParams(m.Endpoint, pathValues)
+	if err != nil {
+		return HTTPRequest{}, err
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return HTTPRequest{}, fmt.Errorf("invalid endpoint %s: %w", endpoint, err)
+	}
+	if len(query) > 0 {
+		merged := u.Query()
+		for k, vs := range query {
+			merged[k] = vs
+		}
+		u.RawQuery = merged.Encode()
+	}
+
+	req := HTTPRequest{Method: method, URL: u.String(), Headers: headers}
+	if len(body) > 0 {
+		data, contentType, err := encodeRequestBody(ctx, m.BodyType, body)
+		if err != nil {
+			return HTTPRequest{}, err
+		}
+		req.Body, req.ContentType = data, contentType
+	}
+	return req, nil
+}
+
+// parameterPlacements returns the "in" of every declared parameter, "" when unset.
+func (a *HTTPAdapter) parameterPlacements() map[string]string {
+	placements := map[string]string{}
+	props, ok := safeMapAssert(a.ToolManifest.Parameters["properties"])
+	if !ok {
+		return placements
+	}
+	for name, v := range props {
+		prop, _ := safeMapAssert(v)
+		in, _ := safeStringAssert(prop["in"])
+		placements[name] = in
+	}
+	return placements
+}
+
+// expandPathParams fills the {name} parameters of endpoint, escaping each value.
+func expandPathParams(endpoint string, values map[string]string) (string, error) {
+	var missing []string
+	expanded := pathParamPattern.ReplaceAllStringFunc(endpoint, func(match string) string {
+		name := match[1 : len(match)-1]
+		value, ok := values[name]
+		if !ok {
+			missing = append(missing, name)
+			return match
+		}
+		return url.PathEscape(value)
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("missing path parameter %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
+
+// bodylessMethod reports whether inputs of method go to the query by default.
+func bodylessMethod(method string) bool {
+	return method == constants.HTTPMethodGET || method == "HEAD" || method == constants.HTTPMethodDELETE
+}
@@ -0,0 +1,90 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/awantoch/beemflow/registry"
+)
+
+func TestHTTPAdapter_ManifestRequestPlacement(t *testing.T) {
+	t.Setenv("SHEETS_KEY", "k123")
+	var got *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	params := map[string]any{"properties": map[string]any{
+		"spreadsheetId":    map[string]any{"type": "string"},
+		"range":            map[string]any{"type": "string"},
+		"majorDimension":   map[string]any{"type": "string", "default": "ROWS"},
+		"X-Request-Id":     map[string]any{"type": "string", "in": "header"},
+		"valueInputOption": map[string]any{"type": "string", "in": "query"},
+		"values":           map[string]any{"type": "array"},
+	}}
+	get := &HTTPAdapter{AdapterID: "sheets.get", ToolManifest: &registry.ToolManifest{
+		Name:       "sheets.get",
+		Endpoint:   server.URL + "/v4/spreadsheets/{spreadsheetId}/values/{range}?alt=json",
+		Method:     "get",
+		Query:      map[string]string{"key": "$env:SHEETS_KEY"},
+		Parameters: params,
+	}}
+	_, err := get.Execute(context.Background(), map[string]any{
+		"spreadsheetId": "abc",
+		"range":         "Sheet 1!A1:B2",
+		"X-Request-Id":  "r-1",
+	})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got.Method != http.MethodGet || got.URL.EscapedPath() != "/v4/spreadsheets/abc/values/Sheet%201%21A1:B2" {
+		t.Errorf("unexpected request %s %s", got.Method, got.URL.EscapedPath())
+	}
+	if q := got.URL.Query(); q.Get("alt") != "json" || q.Get("key") != "k123" || q.Get("majorDimension") != "ROWS" || len(q) != 3 {
+		t.Errorf("unexpected query %v", q)
+	}
+	if got.Header.Get("X-Request-Id") != "r-1" || len(body) != 0 {
+		t.Errorf("expected the header parameter and no body, got %v %q", got.Header, body)
+	}
+
+	update := &HTTPAdapter{AdapterID: "sheets.update", ToolManifest: &registry.ToolManifest{
+		Name:       "sheets.update",
+		Endpoint:   server.URL + "/v4/spreadsheets/{spreadsheetId}/values/{range}",
+		Method:     "PUT",
+		Body:       map[string]any{"majorDimension": "COLUMNS", "source": "beemflow"},
+		Parameters: params,
+	}}
+	_, err = update.Execute(context.Background(), map[string]any{
+		"spreadsheetId":    "abc",
+		"range":            "A1",
+		"valueInputOption": "RAW",
+		"values":           []any{[]any{"x"}},
+	})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	var sent map[string]any
+	if err := json.Unmarshal(body, &sent); err != nil {
+		t.Fatalf("expected a JSON body, got %q", body)
+	}
+	if got.Method != http.MethodPut || got.URL.Query().Get("valueInputOption") != "RAW" {
+		t.Errorf("unexpected request %s %s", got.Method, got.URL)
+	}
+	if sent["majorDimension"] != "ROWS" || sent["source"] != "beemflow" || sent["values"] == nil || sent["spreadsheetId"] != nil || len(sent) != 3 {
+		t.Errorf("expected inputs over the static body, without path parameters, got %v", sent)
+	}
+
+	_, err = get.Execute(context.Background(), map[string]any{"spreadsheetId": "abc"})
+	if err == nil || !strings.Contains(err.Error(), "missing path parameter range") {
+		t.Errorf("expected a missing path parameter error, got %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/registry"
+	"github.com/awantoch/beemflow/utils"
+)
+
+// A paginated call fetches page after page under the manifest's `paginate` policy, or the
+// per-call __paginate override. The items of all pages are collected into the output's
+// `items`, unless the context carries a PageHandler, which then receives each page's items
+// as the page arrives.
+
+// Pagination strategies accepted as `type`.
+const (
+	paginateCursor = "cursor"
+	paginateLink   = "link"
+	paginatePage   = "page"
+	paginateOffset = "offset"
+)
+
+const defaultMaxPages = 100
+
+// PageHandler receives the items of each page of a paginated HTTP call, in order.
+type PageHandler func(ctx context.Context, items []any) error
+
+type pageHandlerKey struct{}
+
+// WithPageHandler makes paginated HTTP calls made with ctx stream their pages to h instead
+// of collecting them. A nil h turns streaming off again.
+func WithPageHandler(ctx context.Context, h PageHandler) context.Context {
+	return context.WithValue(ctx, pageHandlerKey{}, h)
+}
+
+func pageHandlerFromContext(ctx context.Context) PageHandler {
+	h, _ := ctx.Value(pageHandlerKey{}).(PageHandler)
+	return h
+}
+
+// resolvePagination layers the per-call policy over the manifest's and fills in the
+// defaults. It returns nil for calls that don't paginate.
+func (a *HTTPAdapter) resolvePagination(inputs map[string]any) (*registry.PaginationPolicy, error) {
+	var call *registry.PaginationPolicy
+	if err := decodePolicy(inputs, constants.ParamHTTPPaginate, &call); err != nil {
+		return nil, err
+	}
+	var p registry.PaginationPolicy
+	if a.ToolManifest != nil && a.ToolManifest.Paginate != nil {
+		p = *a.ToolManifest.Paginate
+	} else if call == nil {
+		return nil, nil
+	}
+	if call != nil {
+		if call.Type != "" {
+			p.Type = call.Type
+		}
+		if call.Items != "" {
+			p.Items = call.Items
+		}
+		if call.Cursor != "" {
+			p.Cursor = call.Cursor
+		}
+		if call.Param != "" {
+			p.Param = call.Param
+		}
+		if call.Start != nil {
+			p.Start = call.Start
+		}
+		if call.MaxPages != 0 {
+			p.MaxPages = call.MaxPages
+		}
+	}
+
+	start := 0
+	switch p.Type {
+	case paginateCursor:
+		if p.Cursor == "" || p.Param == "" {
+			return nil, utils.Errorf("cursor pagination needs cursor and param")
+		}
+	case paginateLink:
+	case paginatePage:
+		start = 1
+		if p.Param == "" {
+			p.Param = paginatePage
+		}
+	case paginateOffset:
+		if p.Param == "" {
+			p.Param = paginateOffset
+		}
+	default:
+		return nil, utils.Errorf("invalid paginate type %q: must be cursor, link, page or offset", p.Type)
+	}
+	if p.Start == nil {
+		p.Start = &start
+	}
+	if p.MaxPages <= 0 {
+		p.MaxPages = defaultMaxPages
+	}
+	return &p, nil
+}
+
+// executePaginated fetches pages until the policy says there are no more.
+func (a *HTTPAdapter) executePaginated(ctx context.Context, inputs map[string]any, policy httpPolicy, p *registry.PaginationPolicy) (map[string]any, error) {
+	handler := pageHandlerFromContext(ctx)
+	position := *p.Start // page number or offset
+	var req HTTPRequest
+	var err error
+	if p.Type == paginatePage || p.Type == paginateOffset {
+		req, err = a.pageRequest(ctx, inputs, p.Param, position)
+	} else {
+		req, err = a.buildRequest(ctx, inputs)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	items := []any{}
+	count := 0
+	var resp *httpResponse
+	for page := 1; ; page++ {
+		resp, err = a.executeHTTPRequest(ctx, req, policy)
+		if err != nil {
+			return nil, utils.Errorf("page %d: %w", page, err)
+		}
+		pageItems, err := paginatedItems(resp.body, p.Items)
+		if err != nil {
+			return nil, utils.Errorf("page %d: %w", page, err)
+		}
+		count += len(pageItems)
+		if handler != nil {
+			if err := handler(ctx, pageItems); err != nil {
+				return nil, err
+			}
+		} else {
+			items = append(items, pageItems...)
+		}
+
+		// Work out the next request, if there is a next page
+		more := len(pageItems) > 0
+		switch p.Type {
+		case paginateCursor:
+			cursor, _ := scalarString(lookupPath(resp.body, p.Cursor))
+			if more = cursor != ""; more {
+				req, err = a.pageRequest(ctx, inputs, p.Param, cursor)
+			}
+		case paginateLink:
+			link, _ := resp.headers["Link"].(string)
+			next := nextLink(link, req.URL)
+			if more = next != ""; more {
+				req.URL = next
+			}
+		case paginatePage:
+			position++
+			if more {
+				req, err = a.pageRequest(ctx, inputs, p.Param, position)
+			}
+		case paginateOffset:
+			position += len(pageItems)
+			if more {
+				req, err = a.pageRequest(ctx, inputs, p.Param, position)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !more {
+			return paginatedOutput(resp, page, count, items, handler == nil), nil
+		}
+		if page >= p.MaxPages {
+			utils.Warn("Stopped paginating %s after max_pages (%d); more pages are available", req.URL, p.MaxPages)
+			return paginatedOutput(resp, page, count, items, handler == nil), nil
+		}
+	}
+}
+
+// pageRequest builds the request with param set to value. Manifest tools place the value
+// like any other input; generic requests send it in the query.
+func (a *HTTPAdapter) pageRequest(ctx context.Context, inputs map[string]any, param string, value any) (HTTPRequest, error) {
+	if a.isManifestRequest() {
+		paged := maps.Clone(inputs)
+		paged[param] = value
+		return a.buildRequest(ctx, paged)
+	}
+	req, err := a.buildRequest(ctx, inputs)
+	if err != nil {
+		return req, err
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil {
+		return req, utils.Errorf("invalid url %s: %w", req.URL, err)
+	}
+	s, _ := scalarString(value)
+	query := u.Query()
+	query.Set(param, s)
+	u.RawQuery = query.Encode()
+	req.URL = u.String()
+	return req, nil
+}
+
+// paginatedOutput is the output of a paginated call: the last response's status and
+// headers, the number of pages and items, and the items unless they were streamed.
+func paginatedOutput(last *httpResponse, pages, count int, items []any, collected bool) map[string]any {
+	out := map[string]any{
+		constants.OutputKeyStatus:  last.status,
+		constants.OutputKeyHeaders: last.headers,
+		constants.OutputKeyPages:   pages,
+		constants.OutputKeyCount:   count,
+	}
+	if collected {
+		out[constants.OutputKeyItems] = items
+	}
+	return out
+}
+
+// paginatedItems returns the list at path in a page's body, or the body itself. A page
+// without the list has no items.
+func paginatedItems(body any, path string) ([]any, error) {
+	if path != "" {
+		body = lookupPath(body, path)
+		if body == nil {
+			return nil, nil
+		}
+	}
+	items, ok := body.([]any)
+	if !ok {
+		if path == "" {
+			return nil, fmt.Errorf("response body is not a list; set paginate items to the path of the list")
+		}
+		return nil, fmt.Errorf("paginate items %s is not a list, got %T", path, body)
+	}
+	return items, nil
+}
+
+// lookupPath follows a dotted path through nested objects, returning nil if it is missing.
+func lookupPath(v any, path string) any {
+	for _, key := range strings.Split(path, ".") {
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil
+		}
+		v = m[key]
+	}
+	return v
+}
+
+// nextLink returns the rel="next" URL of a Link header, resolved against the request URL.
+func nextLink(header, base string) string {
+	for _, link := range strings.Split(header, ",") {
+		target, params, _ := strings.Cut(link, ";")
+		target = strings.TrimSpace(target)
+		if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+			continue
+		}
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if !strings.EqualFold(key, "rel") || !slices.Contains(strings.Fields(strings.Trim(value, `"`)), "next") {
+				continue
+			}
+			next, err := url.Parse(target[1 : len(target)-1])
+			if err != nil {
+				return ""
+			}
+			if baseURL, err := url.Parse(base); err == nil {
+				next = baseURL.ResolveReference(next)
+			}
+			return next.String()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,150 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/awantoch/beemflow/registry"
+)
+
+func TestHTTPAdapter_PaginateCursor(t *testing.T) {
+	pages := map[string]string{
+		"":   `{"files": [{"id": 1}, {"id": 2}], "nextPageToken": "p2"}`,
+		"p2": `{"files": [{"id": 3}], "nextPageToken": "p3"}`,
+		"p3": `{}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("q") != "reports" {
+			t.Errorf("expected q on every page, got %s", r.URL.RawQuery)
+		}
+		w.Write([]byte(pages[r.URL.Query().Get("pageToken")]))
+	}))
+	defer server.Close()
+
+	adapter := &HTTPAdapter{AdapterID: "drive.files.list", ToolManifest: &registry.ToolManifest{
+		Name:     "drive.files.list",
+		Endpoint: server.URL + "/files",
+		Method:   "GET",
+		Paginate: &registry.PaginationPolicy{Type: "cursor", Items: "files", Cursor: "nextPageToken", Param: "pageToken"},
+	}}
+	result, err := adapter.Execute(context.Background(), map[string]any{"q": "reports"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	items, _ := result["items"].([]any)
+	if len(items) != 3 || result["pages"] != 3 || result["count"] != 3 || result["$status"] != http.StatusOK {
+		t.Errorf("expected 3 items over 3 pages, got %v", result)
+	}
+
+	// max_pages stops early
+	result, err = adapter.Execute(context.Background(), map[string]any{"q": "reports", "__paginate": map[string]any{"max_pages": 1}})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if items, _ := result["items"].([]any); len(items) != 2 || result["pages"] != 1 {
+		t.Errorf("expected one page of 2 items, got %v", result)
+	}
+}
+
+func TestHTTPAdapter_PaginateLinkHeader(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			w.Header().Set("Link", `<`+server.URL+`/repos?page=2>; rel="next", <`+server.URL+`/repos?page=3>; rel="last"`)
+			w.Write([]byte(`[1, 2]`))
+		case "2":
+			w.Header().Set("Link", `</repos?page=3>; rel="next"`)
+			w.Write([]byte(`[3]`))
+		default:
+			w.Write([]byte(`[4]`))
+		}
+	}))
+	defer server.Close()
+
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	result, err := adapter.Execute(context.Background(), map[string]any{
+		"url":        server.URL + "/repos",
+		"__paginate": map[string]any{"type": "link"},
+	})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got, _ := json.Marshal(result["items"]); string(got) != `[1,2,3,4]` || result["pages"] != 3 {
+		t.Errorf("expected items 1-4 over 3 pages, got %v", result)
+	}
+}
+
+func TestHTTPAdapter_PaginatePageAndOffset(t *testing.T) {
+	records := []int{1, 2, 3, 4, 5}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := 0
+		if page := r.URL.Query().Get("page"); page != "" {
+			n, _ := strconv.Atoi(page)
+			start = n * 2
+		} else {
+			start, _ = strconv.Atoi(r.URL.Query().Get("offset"))
+		}
+		end := min(start+2, len(records))
+		start = min(start, end)
+		data, _ := json.Marshal(map[string]any{"data": map[string]any{"records": records[start:end]}})
+		w.Write(data)
+	}))
+	defer server.Close()
+
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	for _, paginate := range []map[string]any{
+		{"type": "page", "items": "data.records", "start": 0},
+		{"type": "offset", "items": "data.records"},
+	} {
+		result, err := adapter.Execute(context.Background(), map[string]any{"url": server.URL, "__paginate": paginate})
+		if err != nil {
+			t.Fatalf("%v: Execute failed: %v", paginate["type"], err)
+		}
+		// The empty fourth page ends the listing
+		if got, _ := json.Marshal(result["items"]); string(got) != `[1,2,3,4,5]` || result["pages"] != 4 {
+			t.Errorf("%v: expected all 5 records over 4 pages, got %v", paginate["type"], result)
+		}
+	}
+
+	if _, err := adapter.Execute(context.Background(), map[string]any{"url": server.URL, "__paginate": map[string]any{"type": "scroll"}}); err == nil {
+		t.Error("expected an invalid paginate type to be rejected")
+	}
+	if _, err := adapter.Execute(context.Background(), map[string]any{"url": server.URL, "__paginate": map[string]any{"type": "page"}}); err == nil {
+		t.Error("expected an object body without items to be rejected")
+	}
+}
+
+func TestHTTPAdapter_PaginateStreamsPages(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page > 2 {
+			w.Write([]byte(`[]`))
+			return
+		}
+		fmt.Fprintf(w, `["a%d", "b%d"]`, page, page)
+	}))
+	defer server.Close()
+
+	var streamed [][]any
+	ctx := WithPageHandler(context.Background(), func(ctx context.Context, items []any) error {
+		streamed = append(streamed, items)
+		return nil
+	})
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	result, err := adapter.Execute(ctx, map[string]any{"url": server.URL, "__paginate": map[string]any{"type": "page"}})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if len(streamed) != 3 || len(streamed[0]) != 2 || len(streamed[2]) != 0 {
+		t.Errorf("expected two pages of items and an empty last page, got %v", streamed)
+	}
+	if _, ok := result["items"]; ok || result["count"] != 4 {
+		t.Errorf("expected streamed items to stay out of the output, got %v", result)
+	}
+}
@@ -0,0 +1,300 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/registry"
+	"github.com/awantoch/beemflow/utils"
+)
+
+// HTTP calls run under a policy built from the adapter defaults, the tool manifest's
+// timeout/retry/circuit_breaker settings and the per-call __timeout/__retry/__circuit_breaker
+// inputs, each layer overriding the fields it sets. Every attempt gets its own timeout when
+// one is configured; by default attempts only end with the run's context.
+// Transport errors, and 429 and 5xx responses that expect_status doesn't list, are retried
+// for idempotent methods; POST and PATCH are only retried on 429 or a Retry-After header
+// unless the retry policy opts in. A call to a manifest tool that still fails counts against
+// the tool's circuit breaker. Generic requests only use a breaker, shared by every call to
+// the same host, when the step sets __circuit_breaker.
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryBackoff    = 500 * time.Millisecond
+	defaultRetryMaxBackoff = 30 * time.Second
+	defaultBreakerFailures = 5
+	defaultBreakerCooldown = 30 * time.Second
+)
+
+// ErrCircuitOpen is returned without making a request while a tool's circuit is open.
+var ErrCircuitOpen = errors.New("circuit breaker open")
+
+// httpPolicy is the resolved timeout, retry, circuit breaker and expected status settings
+// for one call.
+type httpPolicy struct {
+	timeout         time.Duration
+	attempts        int
+	backoff         time.Duration
+	maxBackoff      time.Duration
+	retryAll        bool // retry non-idempotent methods too
+	breakerFailures int
+	breakerCooldown time.Duration
+	expectStatus    []string // codes such as "404" and classes such as "4xx"; empty means 2xx
+}
+
+// resolvePolicy layers the manifest and per-call settings over the defaults.
+func (a *HTTPAdapter) resolvePolicy(inputs map[string]any) (httpPolicy, error) {
+	p := httpPolicy{
+		attempts:        defaultRetryAttempts,
+		backoff:         defaultRetryBackoff,
+		maxBackoff:      defaultRetryMaxBackoff,
+		breakerFailures: defaultBreakerFailures,
+		breakerCooldown: defaultBreakerCooldown,
+	}
+	if m := a.ToolManifest; m != nil {
+		if err := p.apply(m.Timeout, m.Retry, m.CircuitBreaker); err != nil {
+			return p, utils.Errorf("tool %s: %w", m.Name, err)
+		}
+		expected, err := parseExpectStatus(m.ExpectStatus)
+		if err != nil {
+			return p, utils.Errorf("tool %s: %w", m.Name, err)
+		}
+		p.expectStatus = expected
+	}
+	if v := inputs[constants.ParamHTTPExpectStatus]; v != nil {
+		expected, err := parseExpectStatus(v)
+		if err != nil {
+			return p, err
+		}
+		p.expectStatus = expected
+	}
+
+	var timeout string
+	switch v := inputs[constants.ParamHTTPTimeout].(type) {
+	case nil:
+	case string:
+		timeout = v
+	case float64:
+		timeout = strconv.FormatFloat(v, 'f', -1, 64) + "s"
+	case int:
+		timeout = strconv.Itoa(v) + "s"
+	default:
+		return p, utils.Errorf("%s must be a duration, got %T", constants.ParamHTTPTimeout, v)
+	}
+	var retry *registry.RetryPolicy
+	if err := decodePolicy(inputs, constants.ParamHTTPRetry, &retry); err != nil {
+		return p, err
+	}
+	var breaker *registry.CircuitBreakerPolicy
+	if err := decodePolicy(inputs, constants.ParamHTTPCircuitBreaker, &breaker); err != nil {
+		return p, err
+	}
+	if !a.hasToolBreaker() && breaker == nil {
+		// A host breaker would let one flow's failures block every other flow calling that host
+		p.breakerFailures = -1
+	}
+	return p, p.apply(timeout, retry, breaker)
+}
+
+// apply overrides the policy with the fields that are set.
+func (p *httpPolicy) apply(timeout string, retry *registry.RetryPolicy, breaker *registry.CircuitBreakerPolicy) error {
+	if err := parsePolicyDuration("timeout", timeout, &p.timeout); err != nil {
+		return err
+	}
+	if retry != nil {
+		if retry.Attempts > 0 {
+			p.attempts = retry.Attempts
+		}
+		if err := parsePolicyDuration("retry backoff", retry.Backoff, &p.backoff); err != nil {
+			return err
+		}
+		if err := parsePolicyDuration("retry max_backoff", retry.MaxBackoff, &p.maxBackoff); err != nil {
+			return err
+		}
+		if retry.NonIdempotent {
+			p.retryAll = true
+		}
+	}
+	if breaker != nil {
+		if breaker.Failures != 0 {
+			p.breakerFailures = breaker.Failures
+		}
+		if err := parsePolicyDuration("circuit breaker cooldown", breaker.Cooldown, &p.breakerCooldown); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parsePolicyDuration sets *dst from value unless value is empty. "0" is accepted.
+func parsePolicyDuration(name, value string, dst *time.Duration) error {
+	if value == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return utils.Errorf("invalid %s %q", name, value)
+	}
+	*dst = d
+	return nil
+}
+
+// decodePolicy decodes the per-call policy object under key into dst.
+func decodePolicy(inputs map[string]any, key string, dst any) error {
+	raw, ok := inputs[key]
+	if !ok || raw == nil {
+		return nil
+	}
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, dst)
+	}
+	if err != nil {
+		return utils.Errorf("invalid %s: %w", key, err)
+	}
+	return nil
+}
+
+// mayRetry reports whether a failed request may be sent again. A 429 or a Retry-After header
+// means the server refused the request, so every method may retry then; otherwise only
+// idempotent methods do, unless the policy opts in to retrying all of them.
+func (p httpPolicy) mayRetry(method string, status int, header http.Header) bool {
+	if p.retryAll || status == http.StatusTooManyRequests || header.Get(constants.HeaderRetryAfter) != "" {
+		return true
+	}
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// retryWait returns how long to wait before the attempt after the given one, and false if
+// the server asked for a longer wait than the policy allows.
+func (p httpPolicy) retryWait(attempt int, header http.Header) (time.Duration, bool) {
+	if after, ok := parseRetryAfter(header.Get(constants.HeaderRetryAfter), time.Now()); ok {
+		return after, after <= p.maxBackoff
+	}
+	wait := p.backoff
+	for i := 1; i < attempt && wait < p.maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, p.maxBackoff), true
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return max(at.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryableStatus reports whether a response status is worth retrying.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// circuitBreaker counts consecutive failed calls to one tool or host. Breakers are shared by
+// every adapter in the process, so one failing vendor trips once for all runs.
+type circuitBreaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	trial     bool // a call is testing the half-open circuit
+}
+
+var breakers sync.Map // key -> *circuitBreaker
+
+// hasToolBreaker reports whether calls go through the breaker of a named manifest tool.
+func (a *HTTPAdapter) hasToolBreaker() bool {
+	return a.ToolManifest != nil && a.ToolManifest.Name != ""
+}
+
+// breakerKey names the breaker for a call: the tool for manifest requests, else the host.
+func (a *HTTPAdapter) breakerKey(rawURL string) string {
+	if a.hasToolBreaker() {
+		return a.ToolManifest.Name
+	}
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return rawURL
+}
+
+func breakerFor(key string) *circuitBreaker {
+	b, _ := breakers.LoadOrStore(key, &circuitBreaker{})
+	return b.(*circuitBreaker)
+}
+
+// allow reports whether a call may proceed. While the circuit is open it returns the time
+// left; once the cooldown passes, a single trial call is allowed through.
+func (b *circuitBreaker) allow(p httpPolicy, now time.Time) (time.Duration, bool) {
+	if p.breakerFailures < 0 {
+		return 0, true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < p.breakerFailures {
+		return 0, true
+	}
+	if now.Before(b.openUntil) {
+		return b.openUntil.Sub(now), false
+	}
+	if b.trial {
+		return 0, false
+	}
+	b.trial = true
+	return 0, true
+}
+
+// succeed closes the circuit.
+func (b *circuitBreaker) succeed() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	b.failures = 0
+}
+
+// fail counts a failed call and opens the circuit once the threshold is reached.
+func (b *circuitBreaker) fail(p httpPolicy, now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+	b.failures++
+	if p.breakerFailures > 0 && b.failures >= p.breakerFailures {
+		b.openUntil = now.Add(p.breakerCooldown)
+	}
+}
+
+// release ends a trial call whose caller gave up, which says nothing about the tool.
+func (b *circuitBreaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.trial = false
+}
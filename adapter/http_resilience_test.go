@@ -0,0 +1,245 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/registry"
+)
+
+func TestHTTPAdapter_RetriesThrottledAndFailedResponses(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch hits.Add(1) {
+		case 1:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 2:
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.Write([]byte(`{"ok": true}`))
+		}
+	}))
+	defer server.Close()
+
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	result, err := adapter.Execute(context.Background(), map[string]any{
+		"url":     server.URL,
+		"__retry": map[string]any{"attempts": 3, "backoff": "1ms"},
+	})
+	if err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %v", err)
+	}
+	if result["ok"] != true || hits.Load() != 3 {
+		t.Errorf("expected success after 3 attempts, got %v after %d", result, hits.Load())
+	}
+
+	// Client errors are not retried
+	hits.Store(0)
+	notFound := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer notFound.Close()
+	if _, err := adapter.Execute(context.Background(), map[string]any{"url": notFound.URL}); err == nil || hits.Load() != 1 {
+		t.Errorf("expected one failed attempt for a 404, got %d: %v", hits.Load(), err)
+	}
+}
+
+func TestHTTPAdapter_RetriesPostOnlyWhenRefusedOrOptedIn(t *testing.T) {
+	var hits atomic.Int32
+	var status atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			w.WriteHeader(int(status.Load()))
+			return
+		}
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	post := func(code int, retry map[string]any) error {
+		hits.Store(0)
+		status.Store(int32(code))
+		_, err := adapter.Execute(context.Background(), map[string]any{
+			"url":     server.URL,
+			"method":  "POST",
+			"body":    map[string]any{"charge": 1},
+			"__retry": retry,
+		})
+		return err
+	}
+
+	// A POST that failed may have taken effect, so it is not sent again
+	if err := post(http.StatusServiceUnavailable, map[string]any{"backoff": "1ms"}); err == nil || hits.Load() != 1 {
+		t.Errorf("expected a POST receiving 503 to be sent once, got %d attempts: %v", hits.Load(), err)
+	}
+	// A 429 means the server refused it
+	if err := post(http.StatusTooManyRequests, map[string]any{"backoff": "1ms"}); err != nil || hits.Load() != 2 {
+		t.Errorf("expected a throttled POST to be retried, got %d attempts: %v", hits.Load(), err)
+	}
+	// Retrying every method is opt-in
+	if err := post(http.StatusServiceUnavailable, map[string]any{"backoff": "1ms", "non_idempotent": true}); err != nil || hits.Load() != 2 {
+		t.Errorf("expected an opted-in POST to be retried, got %d attempts: %v", hits.Load(), err)
+	}
+}
+
+func TestHTTPAdapter_RetryAfterBeyondMaxBackoffStops(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	start := time.Now()
+	_, err := adapter.Execute(context.Background(), map[string]any{
+		"url":     server.URL,
+		"__retry": map[string]any{"max_backoff": "1s"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "status 503") {
+		t.Fatalf("expected the 503 to be returned, got %v", err)
+	}
+	if hits.Load() != 1 || time.Since(start) > time.Second {
+		t.Errorf("expected no retry after a long Retry-After, got %d attempts in %s", hits.Load(), time.Since(start))
+	}
+}
+
+func TestHTTPAdapter_TimeoutPerAttempt(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	_, err := adapter.Execute(context.Background(), map[string]any{
+		"url":       server.URL,
+		"__timeout": "20ms",
+		"__retry":   map[string]any{"attempts": 2, "backoff": "1ms"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "deadline exceeded") || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Errorf("expected both attempts to time out, got %v", err)
+	}
+
+	if _, err := adapter.Execute(context.Background(), map[string]any{"url": server.URL, "__timeout": "soon"}); err == nil {
+		t.Error("expected an invalid timeout to be rejected")
+	}
+}
+
+func TestHTTPAdapter_CircuitBreaker(t *testing.T) {
+	var hits atomic.Int32
+	var healthy atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		if _, ok := body["__retry"]; ok {
+			t.Errorf("expected policy inputs to stay out of the body, got %v", body)
+		}
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"ok": true}`))
+	}))
+	defer server.Close()
+
+	adapter := &HTTPAdapter{AdapterID: "flaky.tool", ToolManifest: &registry.ToolManifest{
+		Name:           "flaky.tool",
+		Endpoint:       server.URL,
+		Retry:          &registry.RetryPolicy{Attempts: 1},
+		CircuitBreaker: &registry.CircuitBreakerPolicy{Failures: 2, Cooldown: "50ms"},
+	}}
+	call := func() error {
+		_, err := adapter.Execute(context.Background(), map[string]any{"q": "x", "__retry": map[string]any{"backoff": "1ms"}})
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := call(); err == nil || errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected call %d to reach the failing tool, got %v", i+1, err)
+		}
+	}
+	if err := call(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the circuit to open, got %v", err)
+	}
+	if hits.Load() != 2 {
+		t.Errorf("expected the open circuit to skip the request, got %d requests", hits.Load())
+	}
+
+	// After the cooldown a trial call goes through and closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	healthy.Store(true)
+	if err := call(); err != nil {
+		t.Fatalf("expected the trial call to succeed, got %v", err)
+	}
+	if err := call(); err != nil {
+		t.Errorf("expected the circuit to be closed, got %v", err)
+	}
+}
+
+func TestHTTPAdapter_GenericCallsShareNoBreakerByDefault(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	call := func(inputs map[string]any) error {
+		inputs["url"] = server.URL
+		inputs["__retry"] = map[string]any{"attempts": 1}
+		_, err := adapter.Execute(context.Background(), inputs)
+		return err
+	}
+
+	// Failures of one flow's calls don't block other calls to the host
+	for i := 0; i < defaultBreakerFailures+2; i++ {
+		if err := call(map[string]any{}); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("expected call %d to reach the host, got %v", i+1, err)
+		}
+	}
+	if hits.Load() != defaultBreakerFailures+2 {
+		t.Errorf("expected every call to reach the host, got %d requests", hits.Load())
+	}
+
+	// A step can opt in to a breaker for the host
+	breaker := map[string]any{"failures": 1, "cooldown": "1m"}
+	if err := call(map[string]any{"__circuit_breaker": breaker}); errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("expected the first opted-in call to reach the host, got %v", err)
+	}
+	if err := call(map[string]any{"__circuit_breaker": breaker}); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected the opted-in breaker to open, got %v", err)
+	}
+}
+
+func TestHTTPAdapter_NoTimeoutByDefault(t *testing.T) {
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	policy, err := adapter.resolvePolicy(map[string]any{})
+	if err != nil {
+		t.Fatalf("resolvePolicy failed: %v", err)
+	}
+	if policy.timeout != 0 {
+		t.Errorf("expected no timeout unless one is configured, got %s", policy.timeout)
+	}
+	tool := &HTTPAdapter{AdapterID: "slow.tool", ToolManifest: &registry.ToolManifest{Name: "slow.tool", Timeout: "5m"}}
+	if policy, _ = tool.resolvePolicy(map[string]any{}); policy.timeout != 5*time.Minute {
+		t.Errorf("expected the manifest timeout, got %s", policy.timeout)
+	}
+}
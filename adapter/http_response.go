@@ -0,0 +1,171 @@
+package adapter
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/model"
+	"github.com/google/uuid"
+)
+
+// HTTP outputs are the fields of a JSON object body, or the body under `body` when it is
+// anything else. JSON bodies are parsed, text bodies are kept as strings and anything else is
+// written to the blob store, leaving a blob reference as the body. The response status and
+// headers are added under `$status` and `$headers`, which body fields don't use.
+
+// HTTPStatusError is returned for a response whose status wasn't expected. It carries the
+// response so callers can inspect what the server said.
+type HTTPStatusError struct {
+	Method string
+	URL    string
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("HTTP %s %s: status %d: %s", e.Method, e.URL, e.Status, string(e.Body))
+}
+
+// statusPattern matches an expected status: a code such as "404" or a class such as "4xx".
+var statusPattern = regexp.MustCompile(`^[1-5]([0-9]{2}|xx)$`)
+
+// parseExpectStatus reads an expect_status value: a status code, a class such as "2xx", or
+// a list of them.
+func parseExpectStatus(v any) ([]string, error) {
+	items, isList := v.([]any)
+	if !isList {
+		if v == nil {
+			return nil, nil
+		}
+		items = []any{v}
+	}
+	expected := make([]string, 0, len(items))
+	for _, item := range items {
+		s, ok := scalarString(item)
+		s = strings.ToLower(strings.TrimSpace(s))
+		if !ok || !statusPattern.MatchString(s) {
+			return nil, fmt.Errorf("invalid expect_status %v: must be a status code such as 201, a class such as \"4xx\", or a list of them", item)
+		}
+		expected = append(expected, s)
+	}
+	return expected, nil
+}
+
+// expectsStatus reports whether status is one of the expected ones; any 2xx when none are set.
+func (p httpPolicy) expectsStatus(status int) bool {
+	if len(p.expectStatus) == 0 {
+		return status >= 200 && status < 300
+	}
+	code := strconv.Itoa(status)
+	for _, want := range p.expectStatus {
+		if want == code || (strings.HasSuffix(want, "xx") && want[0] == code[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpResponse is a response with an expected status and its decoded body.
+type httpResponse struct {
+	status  int
+	headers map[string]any
+	body    any
+	// object is set when body is a JSON object rather than a blob reference
+	object bool
+}
+
+// newHTTPResponse decodes the body of a response with an expected status.
+func newHTTPResponse(ctx context.Context, resp *http.Response, data []byte) (*httpResponse, error) {
+	body, err := decodeResponseBody(ctx, resp.Header.Get(constants.HeaderContentType), data)
+	if err != nil {
+		return nil, err
+	}
+	_, isMap := body.(map[string]any)
+	_, isBlob := model.AsBlobRef(body)
+	return &httpResponse{
+		status:  resp.StatusCode,
+		headers: responseHeaders(resp.Header),
+		body:    body,
+		object:  isMap && !isBlob,
+	}, nil
+}
+
+// output builds the step output: the fields of a JSON object body as they are, or the
+// body under `body`, plus the status and headers.
+func (r *httpResponse) output() map[string]any {
+	out := map[string]any{}
+	if r.object {
+		maps.Copy(out, r.body.(map[string]any))
+	} else {
+		out[constants.OutputKeyBody] = r.body
+	}
+	out[constants.OutputKeyStatus] = r.status
+	out[constants.OutputKeyHeaders] = r.headers
+	return out
+}
+
+// responseHeaders flattens headers to one value per name, joining repeated values with ", ".
+func responseHeaders(header http.Header) map[string]any {
+	headers := make(map[string]any, len(header))
+	for k, vs := range header {
+		headers[k] = strings.Join(vs, ", ")
+	}
+	return headers
+}
+
+// decodeResponseBody parses JSON, keeps text as a string and stores binary content as a
+// blob. Without a blob store binary content is returned as base64.
+func decodeResponseBody(ctx context.Context, contentType string, data []byte) (any, error) {
+	if len(data) == 0 {
+		return "", nil
+	}
+	var parsed any
+	if err := json.Unmarshal(data, &parsed); err == nil {
+		return parsed, nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if isTextResponse(mediaType, data) {
+		return string(data), nil
+	}
+
+	store := blob.StoreFromContext(ctx)
+	if store == nil {
+		return base64.StdEncoding.EncodeToString(data), nil
+	}
+	if mediaType == "" {
+		mediaType = mimeOctetStream
+	}
+	blobURL, err := store.Put(ctx, data, mediaType, "blobs/"+uuid.NewString()+extensionFor(mediaType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store response body: %w", err)
+	}
+	return model.BlobRef{URL: blobURL, Mime: mediaType, Size: int64(len(data))}.Map(), nil
+}
+
+// isTextResponse reports whether a response body should be returned as text. Untyped
+// bodies are text when they are valid UTF-8.
+func isTextResponse(mediaType string, data []byte) bool {
+	switch {
+	case mediaType == "":
+		return utf8.Valid(data)
+	case isTextMime(mediaType), strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/javascript", "application/x-www-form-urlencoded", "application/x-ndjson":
+		return true
+	}
+	return false
+}
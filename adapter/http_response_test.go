@@ -0,0 +1,132 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/registry"
+)
+
+func TestHTTPAdapter_ResponseMetadata(t *testing.T) {
+	png := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/json":
+			w.Header().Set("Location", "/items/7")
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"id": 7, "status": "queued"}`))
+		case "/text":
+			w.Header().Set("Content-Type", "text/csv")
+			w.Write([]byte("a,b\n1,2\n"))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write(png)
+		}
+	}))
+	defer server.Close()
+
+	ctx := newBlobTestContext(t)
+	adapter := &HTTPAdapter{AdapterID: "http"}
+
+	result, err := adapter.Execute(ctx, map[string]any{"url": server.URL + "/json", "method": "POST"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	headers, _ := result["$headers"].(map[string]any)
+	if result["$status"] != http.StatusCreated || headers["Location"] != "/items/7" {
+		t.Errorf("expected status 201 and the Location header, got %v %v", result["$status"], headers)
+	}
+	// Body fields named like the metadata keep their value
+	if result["id"] != float64(7) || result["status"] != "queued" {
+		t.Errorf("expected the JSON fields unchanged at the top level, got %v", result)
+	}
+	if _, ok := result["body"]; ok {
+		t.Errorf("expected no body key for a JSON object body, got %v", result)
+	}
+
+	result, err = adapter.Execute(ctx, map[string]any{"url": server.URL + "/text"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if result["body"] != "a,b\n1,2\n" {
+		t.Errorf("expected the text body, got %v", result["body"])
+	}
+
+	result, err = adapter.Execute(ctx, map[string]any{"url": server.URL + "/image"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	ref, ok := model.AsBlobRef(result["body"])
+	if !ok || ref.Mime != "image/png" || ref.Size != int64(len(png)) {
+		t.Fatalf("expected a blob reference to the image, got %v", result["body"])
+	}
+	r, err := blob.Open(ctx, blob.StoreFromContext(ctx), ref.URL)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer r.Close()
+	if data, _ := io.ReadAll(r); string(data) != string(png) {
+		t.Errorf("expected the stored blob to hold the image, got %q", data)
+	}
+}
+
+func TestHTTPAdapter_ExpectStatus(t *testing.T) {
+	var hits atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "no such item"}`))
+		case "/down":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"ok": true}`))
+		}
+	}))
+	defer server.Close()
+
+	adapter := &HTTPAdapter{AdapterID: "http"}
+	result, err := adapter.Execute(context.Background(), map[string]any{
+		"url":             server.URL + "/missing",
+		"__expect_status": []any{200, "4xx"},
+	})
+	if err != nil || result["$status"] != http.StatusNotFound || result["error"] != "no such item" {
+		t.Errorf("expected the 404 to be returned as output, got %v: %v", result, err)
+	}
+
+	// An expected 503 is returned without retrying
+	hits.Store(0)
+	result, err = adapter.Execute(context.Background(), map[string]any{"url": server.URL + "/down", "__expect_status": 503})
+	if err != nil || result["$status"] != http.StatusServiceUnavailable || hits.Load() != 1 {
+		t.Errorf("expected one request returning the 503, got %d: %v %v", hits.Load(), result, err)
+	}
+
+	// A manifest expecting 201 rejects a 200, carrying the response
+	tool := &HTTPAdapter{AdapterID: "items.create", ToolManifest: &registry.ToolManifest{
+		Name:         "items.create",
+		Endpoint:     server.URL + "/items",
+		ExpectStatus: float64(201),
+	}}
+	_, err = tool.Execute(context.Background(), map[string]any{"name": "x"})
+	var statusErr *HTTPStatusError
+	if !errors.As(err, &statusErr) || statusErr.Status != http.StatusOK || string(statusErr.Body) != `{"ok": true}` {
+		t.Fatalf("expected an HTTPStatusError for the 200, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "status 200") {
+		t.Errorf("expected the status in the error, got %v", err)
+	}
+
+	if _, err := adapter.Execute(context.Background(), map[string]any{"url": server.URL, "__expect_status": "20x"}); err == nil {
+		t.Error("expected an invalid expect_status to be rejected")
+	}
+}
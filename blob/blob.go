@@ -1,9 +1,17 @@
 package blob
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/encryption"
 	"github.com/awantoch/beemflow/utils"
 )
 
@@ -13,30 +21,236 @@ type BlobStore interface {
 	Get(ctx context.Context, url string) ([]byte, error)
 }
 
+// StreamingBlobStore is implemented by blob stores that can stream blob contents without
+// buffering them in memory and that can inspect and clean up what they store. Both built-in
+// drivers implement it; use the package-level PutStream, Open and Stat helpers to work with any
+// BlobStore, and a type assertion to check for List and Delete.
+type StreamingBlobStore interface {
+	BlobStore
+	// PutStream stores everything read from r and returns the blob's URL.
+	PutStream(ctx context.Context, r io.Reader, mime, filename string) (url string, err error)
+	// Open returns a reader for the blob at url. The caller must close it.
+	Open(ctx context.Context, url string) (io.ReadCloser, error)
+	// Stat describes the blob at url without reading it.
+	Stat(ctx context.Context, url string) (*BlobInfo, error)
+	// List describes every blob whose key starts with prefix, sorted by key.
+	List(ctx context.Context, prefix string) ([]*BlobInfo, error)
+	// Delete removes the blob at url.
+	Delete(ctx context.Context, url string) error
+	// KeyURL returns the URL of the blob stored under key, the BlobInfo.Key form. The blob
+	// need not exist.
+	KeyURL(key string) (string, error)
+}
+
+// Toucher is implemented by blob stores that can mark a blob as just written, resetting its
+// ModTime, without rewriting its content.
+type Toucher interface {
+	Touch(ctx context.Context, url string) error
+}
+
+// BlobInfo describes a stored blob.
+type BlobInfo struct {
+	URL     string    `json:"url"`
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	Mime    string    `json:"mime,omitempty"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// ErrBlobNotFound is returned by StreamingBlobStore methods when the blob does not exist.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// ErrTouchUnsupported is returned by Touch when a wrapped store cannot reset ModTime.
+var ErrTouchUnsupported = errors.New("blob store cannot touch blobs")
+
 // See filesystem.go and s3.go for driver implementations.
 
+type contextKey struct{}
+
+// WithStore attaches a blob store to ctx, making it available to tools executed with ctx.
+func WithStore(ctx context.Context, store BlobStore) context.Context {
+	return context.WithValue(ctx, contextKey{}, store)
+}
+
+// StoreFromContext returns the blob store attached to ctx, or nil.
+func StoreFromContext(ctx context.Context) BlobStore {
+	if store, ok := ctx.Value(contextKey{}).(BlobStore); ok {
+		return store
+	}
+	return nil
+}
+
+// FetchPolicy limits what core.blob.put downloads when it stores the contents of a URL.
+type FetchPolicy struct {
+	// MaxBytes is the largest response body accepted; 0 uses constants.DefaultBlobFetchMaxBytes.
+	MaxBytes int64
+	// AllowPrivate permits private, loopback and link-local destinations, which are refused by
+	// default so flows can't reach internal services or cloud metadata endpoints.
+	AllowPrivate bool
+}
+
+type fetchPolicyKey struct{}
+
+// WithFetchPolicy attaches a fetch policy to ctx for the URL downloads of tools executed with ctx.
+func WithFetchPolicy(ctx context.Context, policy FetchPolicy) context.Context {
+	return context.WithValue(ctx, fetchPolicyKey{}, policy)
+}
+
+// FetchPolicyFromContext returns the fetch policy attached to ctx, with defaults filled in.
+func FetchPolicyFromContext(ctx context.Context) FetchPolicy {
+	policy, _ := ctx.Value(fetchPolicyKey{}).(FetchPolicy)
+	if policy.MaxBytes <= 0 {
+		policy.MaxBytes = constants.DefaultBlobFetchMaxBytes
+	}
+	return policy
+}
+
+// PutStream stores the contents of r in store, streaming them if the store supports it and
+// buffering them for a plain Put otherwise.
+func PutStream(ctx context.Context, store BlobStore, r io.Reader, mime, filename string) (string, error) {
+	if s, ok := store.(StreamingBlobStore); ok {
+		return s.PutStream(ctx, r, mime, filename)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	return store.Put(ctx, data, mime, filename)
+}
+
+// Open returns a reader for the blob at url, falling back to a buffered Get for stores that
+// cannot stream.
+func Open(ctx context.Context, store BlobStore, url string) (io.ReadCloser, error) {
+	if s, ok := store.(StreamingBlobStore); ok {
+		return s.Open(ctx, url)
+	}
+	data, err := store.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Stat describes the blob at url. Stores that cannot stat blobs have it read to learn its size.
+func Stat(ctx context.Context, store BlobStore, url string) (*BlobInfo, error) {
+	if s, ok := store.(StreamingBlobStore); ok {
+		return s.Stat(ctx, url)
+	}
+	data, err := store.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return &BlobInfo{URL: url, Size: int64(len(data))}, nil
+}
+
+// IsBlobURL reports whether s is a URL produced by one of the blob store drivers.
+func IsBlobURL(s string) bool {
+	return strings.HasPrefix(s, "file://") || strings.HasPrefix(s, "s3://")
+}
+
 // BlobConfig is a minimal struct for blob store configuration.
 type BlobConfig struct {
 	Driver    string
 	Directory string
 	Bucket    string
 	Region    string
+
+	// S3 driver options; see S3Options.
+	Endpoint        string
+	PathStyle       bool
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Encryption      S3Encryption
+
+	// ContentAddressed stores blobs under the SHA-256 of their content; see ContentAddressedStore.
+	ContentAddressed bool
+
+	// PublicURL is the HTTP server's externally reachable address and SigningKey the secret
+	// for the signed download URLs it serves; see URLSigner.
+	PublicURL  string
+	SigningKey string
+
+	// Envelope, when set, encrypts blobs at rest; see EncryptedBlobStore.
+	Envelope *encryption.Envelope
+}
+
+// URLSigner returns the signer for download URLs served by the HTTP server, or nil if no
+// signing key is configured.
+func (cfg *BlobConfig) URLSigner() (*URLSigner, error) {
+	if cfg == nil || cfg.SigningKey == "" {
+		return nil, nil
+	}
+	return NewURLSigner(cfg.PublicURL, expandEnv(cfg.SigningKey))
 }
 
 // NewDefaultBlobStore returns a BlobStore based on config, or FilesystemBlobStore in ./beemflow-files if config is nil or empty.
 func NewDefaultBlobStore(ctx context.Context, cfg *BlobConfig) (BlobStore, error) {
+	store, err := newDriverBlobStore(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg != nil && cfg.Envelope != nil {
+		encrypted := NewEncryptedBlobStore(store, cfg.Envelope)
+		signer, err := cfg.URLSigner()
+		if err != nil {
+			return nil, err
+		}
+		if signer != nil {
+			encrypted.SetURLSigner(signer)
+		}
+		store = encrypted
+	}
+	if cfg != nil && cfg.ContentAddressed {
+		return NewContentAddressedStore(store), nil
+	}
+	return store, nil
+}
+
+// newDriverBlobStore creates the blob store for cfg's driver.
+func newDriverBlobStore(ctx context.Context, cfg *BlobConfig) (StreamingBlobStore, error) {
 	if cfg == nil || cfg.Driver == "" || cfg.Driver == "filesystem" {
 		dir := config.DefaultBlobDir
 		if cfg != nil && cfg.Directory != "" {
 			dir = cfg.Directory
 		}
-		return NewFilesystemBlobStore(dir)
+		store, err := NewFilesystemBlobStore(dir)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := cfg.URLSigner()
+		if err != nil {
+			return nil, err
+		}
+		if signer != nil {
+			store.SetURLSigner(signer)
+		}
+		return store, nil
 	}
 	if cfg.Driver == "s3" {
-		if cfg.Bucket == "" || cfg.Region == "" {
+		if cfg.Bucket == "" || (cfg.Region == "" && cfg.Endpoint == "") {
 			return nil, utils.Errorf("s3 driver requires bucket and region")
 		}
-		return NewS3BlobStore(ctx, cfg.Bucket, cfg.Region)
+		return NewS3BlobStoreWithOptions(ctx, S3Options{
+			Bucket:          cfg.Bucket,
+			Region:          cfg.Region,
+			Endpoint:        cfg.Endpoint,
+			PathStyle:       cfg.PathStyle,
+			Prefix:          cfg.Prefix,
+			AccessKeyID:     expandEnv(cfg.AccessKeyID),
+			SecretAccessKey: expandEnv(cfg.SecretAccessKey),
+			SessionToken:    expandEnv(cfg.SessionToken),
+			Encryption:      cfg.Encryption,
+		})
 	}
 	return nil, utils.Errorf("unsupported blob driver: %s", cfg.Driver)
 }
+
+// expandEnv resolves "$env:NAME" values so credentials can stay out of flow.config.json.
+func expandEnv(s string) string {
+	if name, ok := strings.CutPrefix(s, "$env:"); ok {
+		return os.Getenv(name)
+	}
+	return s
+}
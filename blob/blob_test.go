@@ -0,0 +1,76 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// bufferedBlobStore implements only the basic BlobStore interface.
+type bufferedBlobStore struct {
+	blobs map[string][]byte
+}
+
+func (b *bufferedBlobStore) Put(ctx context.Context, data []byte, mime, filename string) (string, error) {
+	url := "mem://" + filename
+	b.blobs[url] = data
+	return url, nil
+}
+
+func (b *bufferedBlobStore) Get(ctx context.Context, url string) ([]byte, error) {
+	data, ok := b.blobs[url]
+	if !ok {
+		return nil, fmt.Errorf("no blob %s", url)
+	}
+	return data, nil
+}
+
+func TestStreamingHelpers_FallBackToBufferedStore(t *testing.T) {
+	ctx := context.Background()
+	store := &bufferedBlobStore{blobs: map[string][]byte{}}
+	if _, ok := BlobStore(store).(StreamingBlobStore); ok {
+		t.Fatal("buffered store must not satisfy StreamingBlobStore")
+	}
+
+	url, err := PutStream(ctx, store, strings.NewReader("streamed"), "text/plain", "a.txt")
+	if err != nil {
+		t.Fatalf("PutStream failed: %v", err)
+	}
+	rc, err := Open(ctx, store, url)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	got, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(got) != "streamed" {
+		t.Errorf("expected %q, got %q", "streamed", got)
+	}
+	info, err := Stat(ctx, store, url)
+	if err != nil || info.Size != int64(len("streamed")) {
+		t.Errorf("Stat = %+v, %v", info, err)
+	}
+	if _, err := Open(ctx, store, "mem://missing"); err == nil {
+		t.Error("expected error opening a missing blob")
+	}
+}
+
+func TestStreamingHelpers_UseStreamingStore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFilesystemBlobStore(t)
+	data := bytes.Repeat([]byte("x"), 1<<16)
+
+	url, err := PutStream(ctx, store, bytes.NewReader(data), "application/octet-stream", "big.bin")
+	if err != nil {
+		t.Fatalf("PutStream failed: %v", err)
+	}
+	info, err := Stat(ctx, store, url)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size != int64(len(data)) || info.Key != "big.bin" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
@@ -0,0 +1,143 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"time"
+
+	"github.com/awantoch/beemflow/utils"
+)
+
+// ContentAddressedPrefix is the key prefix under which ContentAddressedStore keeps blobs.
+const ContentAddressedPrefix = "sha256/"
+
+var (
+	_ StreamingBlobStore = (*ContentAddressedStore)(nil)
+	_ Presigner          = (*ContentAddressedStore)(nil)
+	_ Reencrypter        = (*ContentAddressedStore)(nil)
+)
+
+// ContentAddressedStore stores blobs in an underlying store under the SHA-256 of their
+// content ("sha256/ab/abcdef..."), ignoring the filename callers pass. Storing content that is
+// already present is a no-op that returns the existing URL, so repeated runs producing the
+// same file cost no extra space. Unreferenced blobs are removed by garbage collection rather
+// than by callers, since any number of runs may share one.
+type ContentAddressedStore struct {
+	inner StreamingBlobStore
+}
+
+// NewContentAddressedStore wraps inner with a content-addressed layout.
+func NewContentAddressedStore(inner StreamingBlobStore) *ContentAddressedStore {
+	return &ContentAddressedStore{inner: inner}
+}
+
+// ContentKey returns the key content with the given SHA-256 digest is stored under.
+func ContentKey(sum []byte) string {
+	h := hex.EncodeToString(sum)
+	return ContentAddressedPrefix + h[:2] + "/" + h
+}
+
+// Put stores data under its content hash. The filename is ignored.
+func (c *ContentAddressedStore) Put(ctx context.Context, data []byte, mime, filename string) (string, error) {
+	sum := sha256.Sum256(data)
+	return c.putKeyed(ctx, ContentKey(sum[:]), bytes.NewReader(data), mime)
+}
+
+// PutStream stores the contents of r under their content hash. The content is spooled to a
+// temporary file while it is hashed, so it is never held in memory.
+func (c *ContentAddressedStore) PutStream(ctx context.Context, r io.Reader, mime, filename string) (string, error) {
+	tmp, err := os.CreateTemp("", "beemflow-blob-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		return "", err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return c.putKeyed(ctx, ContentKey(h.Sum(nil)), tmp, mime)
+}
+
+// putKeyed uploads r under key unless a blob with that key already exists. A blob that is
+// reused gets a fresh ModTime, so garbage collection's grace period protects it until the run
+// reusing it has saved its reference; stores that can't touch a blob have it uploaded again.
+func (c *ContentAddressedStore) putKeyed(ctx context.Context, key string, r io.Reader, mime string) (string, error) {
+	existing, err := c.inner.List(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	for _, info := range existing {
+		if info.Key != key {
+			continue
+		}
+		t, ok := c.inner.(Toucher)
+		if !ok {
+			break
+		}
+		if err := t.Touch(ctx, info.URL); err != nil {
+			utils.Debug("Could not touch blob %s, uploading it again: %v", key, err)
+			break
+		}
+		utils.Debug("Blob %s already stored, skipping upload", key)
+		return info.URL, nil
+	}
+	return c.inner.PutStream(ctx, r, mime, key)
+}
+
+// Get retrieves the blob at url.
+func (c *ContentAddressedStore) Get(ctx context.Context, url string) ([]byte, error) {
+	return c.inner.Get(ctx, url)
+}
+
+// Open returns a reader for the blob at url.
+func (c *ContentAddressedStore) Open(ctx context.Context, url string) (io.ReadCloser, error) {
+	return c.inner.Open(ctx, url)
+}
+
+// Stat describes the blob at url.
+func (c *ContentAddressedStore) Stat(ctx context.Context, url string) (*BlobInfo, error) {
+	return c.inner.Stat(ctx, url)
+}
+
+// List describes the blobs in the underlying store whose key starts with prefix.
+func (c *ContentAddressedStore) List(ctx context.Context, prefix string) ([]*BlobInfo, error) {
+	return c.inner.List(ctx, prefix)
+}
+
+// KeyURL returns the URL of the blob stored under key in the underlying store.
+func (c *ContentAddressedStore) KeyURL(key string) (string, error) {
+	return c.inner.KeyURL(key)
+}
+
+// PresignURL returns a time-limited HTTP URL for the blob at url if the underlying store can
+// issue one.
+func (c *ContentAddressedStore) PresignURL(ctx context.Context, url string, ttl time.Duration) (string, error) {
+	p, ok := c.inner.(Presigner)
+	if !ok {
+		return "", ErrPresignUnsupported
+	}
+	return p.PresignURL(ctx, url, ttl)
+}
+
+// Reencrypt re-encrypts blobs under prefix if the underlying store encrypts them.
+func (c *ContentAddressedStore) Reencrypt(ctx context.Context, prefix string) (int, error) {
+	r, ok := c.inner.(Reencrypter)
+	if !ok {
+		return 0, nil
+	}
+	return r.Reencrypt(ctx, prefix)
+}
+
+// Delete removes the blob at url.
+func (c *ContentAddressedStore) Delete(ctx context.Context, url string) error {
+	return c.inner.Delete(ctx, url)
+}
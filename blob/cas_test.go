@@ -0,0 +1,60 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func TestContentAddressedStore_Dedup(t *testing.T) {
+	ctx := context.Background()
+	fs, err := NewFilesystemBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemBlobStore failed: %v", err)
+	}
+	store := NewContentAddressedStore(fs)
+
+	data := []byte("same report every day")
+	url1, err := store.Put(ctx, data, "text/plain", "monday.txt")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	url2, err := store.PutStream(ctx, bytes.NewReader(data), "text/plain", "tuesday.txt")
+	if err != nil {
+		t.Fatalf("PutStream failed: %v", err)
+	}
+	if url1 != url2 {
+		t.Errorf("identical content stored at %s and %s", url1, url2)
+	}
+	sum := sha256.Sum256(data)
+	if !strings.HasSuffix(url1, ContentKey(sum[:])) {
+		t.Errorf("expected URL to end with the content key, got %s", url1)
+	}
+
+	if _, err := store.Put(ctx, []byte("different"), "text/plain", "monday.txt"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	infos, err := store.List(ctx, ContentAddressedPrefix)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Errorf("expected 2 stored blobs, got %d", len(infos))
+	}
+	got, err := store.Get(ctx, url1)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+}
+
+func TestNewDefaultBlobStore_ContentAddressed(t *testing.T) {
+	store, err := NewDefaultBlobStore(context.Background(), &BlobConfig{Directory: t.TempDir(), ContentAddressed: true})
+	if err != nil {
+		t.Fatalf("NewDefaultBlobStore failed: %v", err)
+	}
+	if _, ok := store.(*ContentAddressedStore); !ok {
+		t.Errorf("expected *ContentAddressedStore, got %T", store)
+	}
+}
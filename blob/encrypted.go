@@ -0,0 +1,188 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/awantoch/beemflow/encryption"
+	"github.com/awantoch/beemflow/utils"
+)
+
+var (
+	_ StreamingBlobStore = (*EncryptedBlobStore)(nil)
+	_ Presigner          = (*EncryptedBlobStore)(nil)
+	_ Reencrypter        = (*EncryptedBlobStore)(nil)
+)
+
+// Reencrypter is implemented by blob stores that encrypt blobs at rest.
+type Reencrypter interface {
+	// Reencrypt rewrites the blobs whose key starts with prefix that are stored in the clear
+	// or under a key other than the current one, and returns how many it rewrote.
+	Reencrypt(ctx context.Context, prefix string) (int, error)
+}
+
+// EncryptedBlobStore encrypts blobs before storing them in another store and decrypts them
+// on the way out. Blobs stored before encryption was enabled are read as-is. Stat and List
+// report the stored (encrypted) size.
+//
+// Presigned URLs from the underlying store would hand out ciphertext, so PresignURL only
+// issues URLs for the HTTP server, which decrypts, and needs a URLSigner.
+type EncryptedBlobStore struct {
+	inner  StreamingBlobStore
+	env    *encryption.Envelope
+	signer *URLSigner
+}
+
+// NewEncryptedBlobStore wraps inner so that blobs are encrypted with env.
+func NewEncryptedBlobStore(inner StreamingBlobStore, env *encryption.Envelope) *EncryptedBlobStore {
+	return &EncryptedBlobStore{inner: inner, env: env}
+}
+
+// SetURLSigner enables PresignURL, which then issues download URLs signed by signer.
+func (e *EncryptedBlobStore) SetURLSigner(signer *URLSigner) {
+	e.signer = signer
+}
+
+// Put encrypts data and stores it.
+func (e *EncryptedBlobStore) Put(ctx context.Context, data []byte, mime, filename string) (string, error) {
+	return e.PutStream(ctx, bytes.NewReader(data), mime, filename)
+}
+
+// PutStream encrypts the contents of r while streaming them to the underlying store.
+func (e *EncryptedBlobStore) PutStream(ctx context.Context, r io.Reader, mime, filename string) (string, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		w, err := e.env.NewWriter(ctx, pw)
+		if err == nil {
+			if _, err = io.Copy(w, r); err == nil {
+				err = w.Close()
+			}
+		}
+		pw.CloseWithError(err)
+	}()
+	url, err := e.inner.PutStream(ctx, pr, mime, filename)
+	pr.Close()
+	return url, err
+}
+
+// Get retrieves and decrypts the blob at url.
+func (e *EncryptedBlobStore) Get(ctx context.Context, url string) ([]byte, error) {
+	rc, err := e.Open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// Open returns a reader that decrypts the blob at url as it is read.
+func (e *EncryptedBlobStore) Open(ctx context.Context, url string) (io.ReadCloser, error) {
+	rc, err := e.inner.Open(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.env.NewReader(ctx, rc)
+	if err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, rc}, nil
+}
+
+// Stat describes the blob at url.
+func (e *EncryptedBlobStore) Stat(ctx context.Context, url string) (*BlobInfo, error) {
+	return e.inner.Stat(ctx, url)
+}
+
+// List describes the blobs whose key starts with prefix.
+func (e *EncryptedBlobStore) List(ctx context.Context, prefix string) ([]*BlobInfo, error) {
+	return e.inner.List(ctx, prefix)
+}
+
+// Delete removes the blob at url.
+func (e *EncryptedBlobStore) Delete(ctx context.Context, url string) error {
+	return e.inner.Delete(ctx, url)
+}
+
+// Touch resets the blob's ModTime if the underlying store can, and otherwise reports
+// ErrTouchUnsupported.
+func (e *EncryptedBlobStore) Touch(ctx context.Context, url string) error {
+	t, ok := e.inner.(Toucher)
+	if !ok {
+		return ErrTouchUnsupported
+	}
+	return t.Touch(ctx, url)
+}
+
+// KeyURL returns the URL of the blob stored under key.
+func (e *EncryptedBlobStore) KeyURL(key string) (string, error) {
+	return e.inner.KeyURL(key)
+}
+
+// PresignURL returns a signed HTTP server URL for the blob at url.
+func (e *EncryptedBlobStore) PresignURL(ctx context.Context, url string, ttl time.Duration) (string, error) {
+	if e.signer == nil {
+		return "", ErrPresignUnsupported
+	}
+	info, err := e.inner.Stat(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	return e.signer.Sign(info.Key, time.Now().Add(ttl)), nil
+}
+
+// Reencrypt rewrites blobs under prefix that are not encrypted with the current key.
+func (e *EncryptedBlobStore) Reencrypt(ctx context.Context, prefix string) (int, error) {
+	infos, err := e.inner.List(ctx, prefix)
+	if err != nil {
+		return 0, err
+	}
+	current := e.env.CurrentKeyID()
+	rewritten := 0
+	for _, info := range infos {
+		keyID, err := e.storedKeyID(ctx, info.URL)
+		if err != nil {
+			return rewritten, err
+		}
+		if keyID == current {
+			continue
+		}
+		if err := e.rewrite(ctx, info); err != nil {
+			return rewritten, err
+		}
+		rewritten++
+		utils.Debug("Re-encrypted blob %s", info.Key)
+	}
+	return rewritten, nil
+}
+
+// storedKeyID returns the ID of the key the blob at url is encrypted with, or "" if it is not.
+func (e *EncryptedBlobStore) storedKeyID(ctx context.Context, url string) (string, error) {
+	rc, err := e.inner.Open(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	keyID, err := encryption.ReadKeyID(rc)
+	if errors.Is(err, encryption.ErrNotEncrypted) {
+		return "", nil
+	}
+	return keyID, err
+}
+
+// rewrite stores the blob again under the same key, encrypted with the current key.
+func (e *EncryptedBlobStore) rewrite(ctx context.Context, info *BlobInfo) error {
+	rc, err := e.Open(ctx, info.URL)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	_, err = e.PutStream(ctx, rc, info.Mime, info.Key)
+	return err
+}
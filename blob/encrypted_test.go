@@ -0,0 +1,107 @@
+package blob
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/awantoch/beemflow/encryption"
+)
+
+func newTestEnvelope(t *testing.T, keyFile string) *encryption.Envelope {
+	t.Helper()
+	if _, err := encryption.RotateKeyFile(keyFile); err != nil {
+		t.Fatalf("RotateKeyFile failed: %v", err)
+	}
+	provider, err := encryption.LoadKeyFile(keyFile)
+	if err != nil {
+		t.Fatalf("LoadKeyFile failed: %v", err)
+	}
+	return encryption.New(provider)
+}
+
+func TestEncryptedBlobStore_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	fs, err := NewFilesystemBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatalf("NewFilesystemBlobStore failed: %v", err)
+	}
+	store := NewEncryptedBlobStore(fs, newTestEnvelope(t, filepath.Join(dir, "keys.json")))
+
+	data := bytes.Repeat([]byte("confidential quarterly numbers\n"), 5000)
+	url, err := store.PutStream(ctx, bytes.NewReader(data), "text/plain", "q3.txt")
+	if err != nil {
+		t.Fatalf("PutStream failed: %v", err)
+	}
+	onDisk, err := os.ReadFile(strings.TrimPrefix(url, "file://"))
+	if err != nil {
+		t.Fatalf("reading stored blob failed: %v", err)
+	}
+	if !encryption.IsEncrypted(onDisk) || bytes.Contains(onDisk, []byte("confidential")) {
+		t.Error("blob is stored in the clear")
+	}
+	got, err := store.Get(ctx, url)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Get returned %d bytes, %v", len(got), err)
+	}
+
+	// Blobs written before encryption was enabled stay readable
+	legacy, err := fs.Put(ctx, []byte("plain old blob"), "text/plain", "legacy.txt")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got, err := store.Get(ctx, legacy); err != nil || string(got) != "plain old blob" {
+		t.Errorf("legacy Get = %q, %v", got, err)
+	}
+
+	if _, err := store.PresignURL(ctx, url, 0); !errors.Is(err, ErrPresignUnsupported) {
+		t.Errorf("expected ErrPresignUnsupported without a signer, got %v", err)
+	}
+}
+
+func TestEncryptedBlobStore_Reencrypt(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.json")
+	fs, err := NewFilesystemBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatalf("NewFilesystemBlobStore failed: %v", err)
+	}
+	store := NewEncryptedBlobStore(fs, newTestEnvelope(t, keyFile))
+	old, err := store.Put(ctx, []byte("under the old key"), "text/plain", "old.txt")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := fs.Put(ctx, []byte("never encrypted"), "text/plain", "legacy.txt"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	rotated := NewEncryptedBlobStore(fs, newTestEnvelope(t, keyFile))
+	if _, err := rotated.Put(ctx, []byte("already current"), "text/plain", "new.txt"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	n, err := rotated.Reencrypt(ctx, "")
+	if err != nil || n != 2 {
+		t.Fatalf("Reencrypt = %d, %v; want 2", n, err)
+	}
+	rc, err := fs.Open(ctx, old)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	keyID, err := encryption.ReadKeyID(rc)
+	rc.Close()
+	if err != nil || keyID != rotated.env.CurrentKeyID() {
+		t.Errorf("old blob key = %q, %v; want %s", keyID, err, rotated.env.CurrentKeyID())
+	}
+	if got, err := rotated.Get(ctx, old); err != nil || string(got) != "under the old key" {
+		t.Errorf("Get after re-encryption = %q, %v", got, err)
+	}
+	if n, err := rotated.Reencrypt(ctx, ""); err != nil || n != 0 {
+		t.Errorf("second Reencrypt = %d, %v; want 0", n, err)
+	}
+}
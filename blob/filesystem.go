@@ -1,20 +1,34 @@
 package blob
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/awantoch/beemflow/utils"
 )
 
+var (
+	_ StreamingBlobStore = (*FilesystemBlobStore)(nil)
+	_ Presigner          = (*FilesystemBlobStore)(nil)
+	_ Toucher            = (*FilesystemBlobStore)(nil)
+)
+
 // FilesystemBlobStore implements BlobStore using the local filesystem.
 // This is the default and recommended blob store for local/dev/prod.
 type FilesystemBlobStore struct {
-	dir string
+	dir    string
+	signer *URLSigner
 }
 
 // NewFilesystemBlobStore creates a new FilesystemBlobStore with the given directory.
@@ -26,29 +40,226 @@ func NewFilesystemBlobStore(dir string) (*FilesystemBlobStore, error) {
 	return &FilesystemBlobStore{dir: dir}, nil
 }
 
+// SetURLSigner enables PresignURL, which then issues download URLs signed by signer.
+func (f *FilesystemBlobStore) SetURLSigner(signer *URLSigner) {
+	f.signer = signer
+}
+
+// PresignURL returns a signed HTTP server URL for the file behind a file:// URL.
+func (f *FilesystemBlobStore) PresignURL(ctx context.Context, url string, ttl time.Duration) (string, error) {
+	if f.signer == nil {
+		return "", ErrPresignUnsupported
+	}
+	info, err := f.Stat(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	return f.signer.Sign(info.Key, time.Now().Add(ttl)), nil
+}
+
 // Put stores the blob as a file in the directory. Returns a file:// URL.
 func (f *FilesystemBlobStore) Put(ctx context.Context, data []byte, mime, filename string) (string, error) {
+	return f.PutStream(ctx, bytes.NewReader(data), mime, filename)
+}
+
+// Get retrieves the blob from the file:// URL.
+func (f *FilesystemBlobStore) Get(ctx context.Context, url string) ([]byte, error) {
+	path, err := f.pathFor(url)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return data, nil
+}
+
+// PutStream streams r into a file in the directory and returns a file:// URL.
+// Filenames may contain slashes to store the blob in a subdirectory.
+func (f *FilesystemBlobStore) PutStream(ctx context.Context, r io.Reader, mime, filename string) (string, error) {
 	if filename == "" {
 		filename = fmt.Sprintf("blob-%d", time.Now().UnixNano())
 	}
 	path := filepath.Join(f.dir, filename)
-	// Write atomically
-	tmpPath := path + ".tmp"
-	if err := os.WriteFile(tmpPath, data, 0o644); err != nil {
+	if _, err := f.pathFor("file://" + path); err != nil {
 		return "", err
 	}
-	if err := os.Rename(tmpPath, path); err != nil {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+	// Write atomically; the random suffix keeps concurrent writers of one name apart
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
 		return "", err
 	}
 	return "file://" + path, nil
 }
 
-// Get retrieves the blob from the file:// URL.
-func (f *FilesystemBlobStore) Get(ctx context.Context, url string) ([]byte, error) {
+// Open opens the file behind a file:// URL for reading.
+func (f *FilesystemBlobStore) Open(ctx context.Context, url string) (io.ReadCloser, error) {
+	path, err := f.pathFor(url)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return file, nil
+}
+
+// Stat describes the file behind a file:// URL. The MIME type is derived from the file
+// extension, or sniffed from the content when the extension is unknown.
+func (f *FilesystemBlobStore) Stat(ctx context.Context, url string) (*BlobInfo, error) {
+	path, err := f.pathFor(url)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if fi.IsDir() {
+		return nil, ErrBlobNotFound
+	}
+	return f.info(path, fi), nil
+}
+
+// List describes the files in the directory whose key (path relative to the directory,
+// slash-separated) starts with prefix. In-progress writes are skipped.
+func (f *FilesystemBlobStore) List(ctx context.Context, prefix string) ([]*BlobInfo, error) {
+	// Only walk the directory the prefix points into
+	root := f.dir
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		root = filepath.Join(f.dir, filepath.FromSlash(prefix[:i]))
+	}
+	var infos []*BlobInfo
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(path, ".tmp") {
+			return nil
+		}
+		rel, err := filepath.Rel(f.dir, path)
+		if err != nil || !strings.HasPrefix(filepath.ToSlash(rel), prefix) {
+			return err
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		infos = append(infos, f.info(path, fi))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
+
+// Delete removes the file behind a file:// URL.
+func (f *FilesystemBlobStore) Delete(ctx context.Context, url string) error {
+	path, err := f.pathFor(url)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return notFound(err)
+	}
+	return nil
+}
+
+// Touch sets the modification time of the file behind a file:// URL to now.
+func (f *FilesystemBlobStore) Touch(ctx context.Context, url string) error {
+	path, err := f.pathFor(url)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	return notFound(os.Chtimes(path, now, now))
+}
+
+// KeyURL returns the file:// URL for key, refusing keys that leave the store's directory.
+func (f *FilesystemBlobStore) KeyURL(key string) (string, error) {
+	url := "file://" + filepath.Join(f.dir, filepath.FromSlash(key))
+	if _, err := f.pathFor(url); err != nil {
+		return "", err
+	}
+	return url, nil
+}
+
+// pathFor maps a file:// URL to its path, refusing paths outside the store's directory so
+// that Get, Open, Stat and Delete cannot be pointed at arbitrary files.
+func (f *FilesystemBlobStore) pathFor(url string) (string, error) {
 	const prefix = "file://"
 	if !strings.HasPrefix(url, prefix) {
-		return nil, utils.Errorf("invalid file URL: %s", url)
+		return "", utils.Errorf("invalid file URL: %s", url)
+	}
+	path := filepath.Clean(url[len(prefix):])
+	dir, err := filepath.Abs(f.dir)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(dir, abs); err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", utils.Errorf("file URL %s is outside the blob directory", url)
+	}
+	return path, nil
+}
+
+func (f *FilesystemBlobStore) info(path string, fi fs.FileInfo) *BlobInfo {
+	key, _ := filepath.Rel(f.dir, path)
+	return &BlobInfo{
+		URL:     "file://" + path,
+		Key:     filepath.ToSlash(key),
+		Size:    fi.Size(),
+		Mime:    detectMime(path),
+		ModTime: fi.ModTime(),
+	}
+}
+
+// detectMime guesses a file's MIME type from its extension, falling back to content sniffing.
+func detectMime(path string) string {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	return http.DetectContentType(head[:n])
+}
+
+// notFound maps a missing file to ErrBlobNotFound.
+func notFound(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrBlobNotFound
 	}
-	path := url[len(prefix):]
-	return os.ReadFile(path)
+	return err
 }
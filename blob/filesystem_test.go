@@ -3,8 +3,11 @@ package blob
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/awantoch/beemflow/config"
@@ -147,6 +150,23 @@ func TestFilesystemBlobStore_EmptyFilename(t *testing.T) {
 	}
 }
 
+func TestFilesystemBlobStore_KeyURL(t *testing.T) {
+	store := newTestFilesystemBlobStore(t)
+	ctx := context.Background()
+	url, err := store.Put(ctx, []byte("q3"), "text/plain", "reports/q3.txt")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if got, err := store.KeyURL("reports/q3.txt"); err != nil || got != url {
+		t.Errorf("KeyURL = %q, %v; want %q", got, err, url)
+	}
+	for _, key := range []string{"", "../outside.txt", "reports/../../outside.txt"} {
+		if got, err := store.KeyURL(key); err == nil {
+			t.Errorf("KeyURL(%q) = %q; expected keys outside the directory to be refused", key, got)
+		}
+	}
+}
+
 // Tests for NewDefaultBlobStore function
 
 func TestNewDefaultBlobStore(t *testing.T) {
@@ -435,3 +455,108 @@ func TestBlobConfig_AllFieldsCovered(t *testing.T) {
 		t.Error("Data mismatch")
 	}
 }
+
+func TestFilesystemBlobStore_StreamRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFilesystemBlobStore(t)
+	url, err := store.PutStream(ctx, strings.NewReader("hello stream"), "text/plain", "nested/dir/hello.txt")
+	if err != nil {
+		t.Fatalf("PutStream failed: %v", err)
+	}
+	rc, err := store.Open(ctx, url)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer rc.Close()
+	got, err := io.ReadAll(rc)
+	if err != nil || string(got) != "hello stream" {
+		t.Errorf("expected %q, got %q (%v)", "hello stream", got, err)
+	}
+
+	info, err := store.Stat(ctx, url)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Key != "nested/dir/hello.txt" || info.Size != 12 || !strings.HasPrefix(info.Mime, "text/plain") || info.URL != url {
+		t.Errorf("unexpected info: %+v", info)
+	}
+}
+
+func TestFilesystemBlobStore_StatSniffsMime(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFilesystemBlobStore(t)
+	url, err := store.Put(ctx, []byte("\x89PNG\r\n\x1a\n0000"), "", "image-without-extension")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	info, err := store.Stat(ctx, url)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Mime != "image/png" {
+		t.Errorf("expected image/png, got %q", info.Mime)
+	}
+}
+
+func TestFilesystemBlobStore_ListAndDelete(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFilesystemBlobStore(t)
+	for _, name := range []string{"runs/b.txt", "runs/a.txt", "other.txt"} {
+		if _, err := store.Put(ctx, []byte(name), "text/plain", name); err != nil {
+			t.Fatalf("Put %s failed: %v", name, err)
+		}
+	}
+
+	all, err := store.List(ctx, "")
+	if err != nil || len(all) != 3 {
+		t.Fatalf("List(\"\") = %d blobs, %v", len(all), err)
+	}
+	runs, err := store.List(ctx, "runs/")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(runs) != 2 || runs[0].Key != "runs/a.txt" || runs[1].Key != "runs/b.txt" {
+		t.Fatalf("expected runs/a.txt and runs/b.txt in order, got %+v", runs)
+	}
+
+	if err := store.Delete(ctx, runs[0].URL); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Delete(ctx, runs[0].URL); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound deleting twice, got %v", err)
+	}
+	if _, err := store.Stat(ctx, runs[0].URL); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound from Stat, got %v", err)
+	}
+	if _, err := store.Open(ctx, runs[0].URL); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound from Open, got %v", err)
+	}
+	if left, _ := store.List(ctx, "runs/"); len(left) != 1 {
+		t.Errorf("expected 1 blob left, got %d", len(left))
+	}
+}
+
+func TestFilesystemBlobStore_RejectsPathsOutsideDir(t *testing.T) {
+	ctx := context.Background()
+	store := newTestFilesystemBlobStore(t)
+	outside := filepath.Join(t.TempDir(), "secret.txt")
+	if err := os.WriteFile(outside, []byte("keep"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get(ctx, "file://"+outside); err == nil {
+		t.Error("expected Get outside the blob directory to fail")
+	}
+	if err := store.Delete(ctx, "file://"+outside); err == nil {
+		t.Error("expected Delete outside the blob directory to fail")
+	}
+	if _, err := store.Open(ctx, "file://"+store.dir+"/../"+filepath.Base(store.dir)+"-x"); err == nil {
+		t.Error("expected Open of a sibling directory to fail")
+	}
+	if _, err := store.PutStream(ctx, strings.NewReader("x"), "text/plain", "../escape.txt"); err == nil {
+		t.Error("expected PutStream with an escaping filename to fail")
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Errorf("file outside the blob directory was touched: %v", err)
+	}
+}
@@ -3,22 +3,61 @@ package blob
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
+	"time"
 
 	"github.com/awantoch/beemflow/utils"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
-// S3BlobStore implements BlobStore using AWS S3.
+var (
+	_ StreamingBlobStore = (*S3BlobStore)(nil)
+	_ Presigner          = (*S3BlobStore)(nil)
+)
+
+// S3BlobStore implements BlobStore using AWS S3 or any S3-compatible service (MinIO, R2, ...).
 // This is NOT the default. Use only if configured explicitly.
 type S3BlobStore struct {
 	client *s3.Client
 	bucket string
 	region string
+	prefix string
+	sse    S3Encryption
+}
+
+// S3Options configures an S3BlobStore. Only Bucket is required; Region defaults to us-east-1
+// when a custom Endpoint is set.
+type S3Options struct {
+	Bucket string
+	Region string
+	// Endpoint overrides the AWS endpoint, e.g. "http://localhost:9000" for MinIO.
+	Endpoint string
+	// PathStyle addresses objects as endpoint/bucket/key instead of bucket.endpoint/key,
+	// which most S3-compatible services require.
+	PathStyle bool
+	// Prefix is prepended to every object key, so several deployments can share a bucket.
+	Prefix string
+	// AccessKeyID and SecretAccessKey (plus an optional SessionToken) replace the default
+	// AWS credential chain when set.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Encryption      S3Encryption
+}
+
+// S3Encryption selects server-side encryption for uploaded objects.
+type S3Encryption struct {
+	// Mode is "AES256" or "aws:kms"; empty leaves the bucket default.
+	Mode string
+	// KMSKeyID picks the KMS key when Mode is "aws:kms".
+	KMSKeyID string
 }
 
 // NewS3BlobStore creates a new S3BlobStore using the provided context.
@@ -26,40 +65,74 @@ func NewS3BlobStore(ctx context.Context, bucket, region string) (*S3BlobStore, e
 	if bucket == "" || region == "" {
 		return nil, utils.Errorf("bucket and region must be non-empty")
 	}
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(region))
+	return NewS3BlobStoreWithOptions(ctx, S3Options{Bucket: bucket, Region: region})
+}
+
+// NewS3BlobStoreWithOptions creates a new S3BlobStore from opts.
+func NewS3BlobStoreWithOptions(ctx context.Context, opts S3Options) (*S3BlobStore, error) {
+	if opts.Region == "" && opts.Endpoint != "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Bucket == "" || opts.Region == "" {
+		return nil, utils.Errorf("bucket and region must be non-empty")
+	}
+	switch opts.Encryption.Mode {
+	case "", string(types.ServerSideEncryptionAes256), string(types.ServerSideEncryptionAwsKms):
+	default:
+		return nil, utils.Errorf("unsupported s3 encryption %q: must be AES256 or aws:kms", opts.Encryption.Mode)
+	}
+	if (opts.AccessKeyID == "") != (opts.SecretAccessKey == "") {
+		return nil, utils.Errorf("s3 accessKeyId and secretAccessKey must be set together")
+	}
+
+	loadOpts := []func(*config.LoadOptions) error{config.WithRegion(opts.Region)}
+	if opts.AccessKeyID != "" {
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretAccessKey, opts.SessionToken)))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
 	if err != nil {
 		return nil, err
 	}
-	client := s3.NewFromConfig(cfg)
-	return &S3BlobStore{client: client, bucket: bucket, region: region}, nil
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.PathStyle
+	})
+	return &S3BlobStore{
+		client: client,
+		bucket: opts.Bucket,
+		region: opts.Region,
+		prefix: opts.Prefix,
+		sse:    opts.Encryption,
+	}, nil
 }
 
 // Put uploads data to S3 and returns its URL.
 func (s *S3BlobStore) Put(ctx context.Context, data []byte, mime, filename string) (string, error) {
+	key := s.objectKey(filename)
 	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(filename),
-		Body:        bytes.NewReader(data),
-		ContentType: aws.String(mime),
-		ACL:         types.ObjectCannedACLPrivate,
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		Body:                 bytes.NewReader(data),
+		ContentType:          aws.String(mime),
+		ACL:                  types.ObjectCannedACLPrivate,
+		ServerSideEncryption: s.sseMode(),
+		SSEKMSKeyId:          s.sseKMSKeyID(),
 	})
 	if err != nil {
 		return "", err
 	}
-	return fmt.Sprintf("s3://%s/%s", s.bucket, filename), nil
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
 }
 
 // Get retrieves data from S3 by URL.
 func (s *S3BlobStore) Get(ctx context.Context, url string) ([]byte, error) {
-	// Expect url format: s3://bucket/key
-	var bucket, key string
-	_, err := fmt.Sscanf(url, "s3://%[^/]/%s", &bucket, &key)
+	key, err := s.keyFor(url)
 	if err != nil {
 		return nil, err
 	}
-	if bucket != s.bucket {
-		return nil, fmt.Errorf("requested bucket %s does not match configured bucket %s", bucket, s.bucket)
-	}
 	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
@@ -70,3 +143,241 @@ func (s *S3BlobStore) Get(ctx context.Context, url string) ([]byte, error) {
 	defer resp.Body.Close()
 	return io.ReadAll(resp.Body)
 }
+
+// s3PartSize is the chunk size PutStream uploads in; S3 requires at least 5 MiB per part.
+const s3PartSize = 8 << 20
+
+// PutStream uploads r to S3 and returns its URL. Streams that fit in a single part are sent
+// with one PutObject; larger ones use a multipart upload so only one part is held in memory.
+func (s *S3BlobStore) PutStream(ctx context.Context, r io.Reader, mime, filename string) (string, error) {
+	buf := make([]byte, s3PartSize)
+	n, err := io.ReadFull(r, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s.Put(ctx, buf[:n], mime, filename)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	key := s.objectKey(filename)
+	upload, err := s.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		ContentType:          aws.String(mime),
+		ACL:                  types.ObjectCannedACLPrivate,
+		ServerSideEncryption: s.sseMode(),
+		SSEKMSKeyId:          s.sseKMSKeyID(),
+	})
+	if err != nil {
+		return "", err
+	}
+	parts, err := s.uploadParts(ctx, upload.UploadId, key, buf, r)
+	if err == nil {
+		_, err = s.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          aws.String(s.bucket),
+			Key:             aws.String(key),
+			UploadId:        upload.UploadId,
+			MultipartUpload: &types.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if err != nil {
+		// Best effort: the upload is abandoned either way, this only frees the stored parts
+		_, _ = s.client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   aws.String(s.bucket),
+			Key:      aws.String(key),
+			UploadId: upload.UploadId,
+		})
+		return "", err
+	}
+	return fmt.Sprintf("s3://%s/%s", s.bucket, key), nil
+}
+
+// uploadParts uploads first, which is already full, followed by the rest of r in s3PartSize chunks.
+func (s *S3BlobStore) uploadParts(ctx context.Context, uploadID *string, key string, first []byte, r io.Reader) ([]types.CompletedPart, error) {
+	var parts []types.CompletedPart
+	buf, n := first, len(first)
+	for number := int32(1); ; number++ {
+		resp, err := s.client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(s.bucket),
+			Key:        aws.String(key),
+			UploadId:   uploadID,
+			PartNumber: aws.Int32(number),
+			Body:       bytes.NewReader(buf[:n]),
+		})
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, types.CompletedPart{ETag: resp.ETag, PartNumber: aws.Int32(number)})
+
+		n, err = io.ReadFull(r, buf)
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+	}
+}
+
+// Open streams an object from S3 by URL.
+func (s *S3BlobStore) Open(ctx context.Context, url string) (io.ReadCloser, error) {
+	key, err := s.keyFor(url)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3NotFound(err)
+	}
+	return resp.Body, nil
+}
+
+// Stat describes an object in S3 by URL.
+func (s *S3BlobStore) Stat(ctx context.Context, url string) (*BlobInfo, error) {
+	key, err := s.keyFor(url)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, s3NotFound(err)
+	}
+	return &BlobInfo{
+		URL:     url,
+		Key:     strings.TrimPrefix(key, s.prefix),
+		Size:    aws.ToInt64(resp.ContentLength),
+		Mime:    aws.ToString(resp.ContentType),
+		ModTime: aws.ToTime(resp.LastModified),
+	}, nil
+}
+
+// List describes the objects under the store's prefix whose key starts with prefix. Keys are
+// reported relative to the store's prefix. S3 listings carry no content type, so Mime is left
+// empty; use Stat for it.
+func (s *S3BlobStore) List(ctx context.Context, prefix string) ([]*BlobInfo, error) {
+	var infos []*BlobInfo
+	pages := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.prefix + prefix),
+	})
+	for pages.HasMorePages() {
+		page, err := pages.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			infos = append(infos, &BlobInfo{
+				URL:     fmt.Sprintf("s3://%s/%s", s.bucket, key),
+				Key:     strings.TrimPrefix(key, s.prefix),
+				Size:    aws.ToInt64(obj.Size),
+				ModTime: aws.ToTime(obj.LastModified),
+			})
+		}
+	}
+	return infos, nil
+}
+
+// Delete removes an object from S3 by URL. S3 deletes are idempotent, so the object is
+// looked up first to report ErrBlobNotFound consistently with the filesystem store.
+func (s *S3BlobStore) Delete(ctx context.Context, url string) error {
+	if _, err := s.Stat(ctx, url); err != nil {
+		return err
+	}
+	key, _ := s.keyFor(url)
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// KeyURL returns the s3:// URL for key under the store's prefix.
+func (s *S3BlobStore) KeyURL(key string) (string, error) {
+	if key == "" {
+		return "", utils.Errorf("empty blob key")
+	}
+	return fmt.Sprintf("s3://%s/%s", s.bucket, s.objectKey(key)), nil
+}
+
+// s3MaxPresignTTL is the longest expiry S3 accepts for a presigned URL.
+const s3MaxPresignTTL = 7 * 24 * time.Hour
+
+// PresignURL returns an S3 presigned GET URL for the object, valid for ttl (at most 7 days).
+func (s *S3BlobStore) PresignURL(ctx context.Context, url string, ttl time.Duration) (string, error) {
+	if ttl > s3MaxPresignTTL {
+		return "", utils.Errorf("S3 presigned URLs expire after at most %s, got %s", s3MaxPresignTTL, ttl)
+	}
+	key, err := s.keyFor(url)
+	if err != nil {
+		return "", err
+	}
+	req, err := s3.NewPresignClient(s.client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
+
+// objectKey maps a filename to its object key under the store's prefix.
+func (s *S3BlobStore) objectKey(filename string) string {
+	if filename == "" {
+		filename = fmt.Sprintf("blob-%d", time.Now().UnixNano())
+	}
+	return s.prefix + filename
+}
+
+func (s *S3BlobStore) sseMode() types.ServerSideEncryption {
+	return types.ServerSideEncryption(s.sse.Mode)
+}
+
+func (s *S3BlobStore) sseKMSKeyID() *string {
+	if s.sse.KMSKeyID == "" {
+		return nil
+	}
+	return aws.String(s.sse.KMSKeyID)
+}
+
+// keyFor extracts the object key from an s3://bucket/key URL for this store's bucket.
+func (s *S3BlobStore) keyFor(url string) (string, error) {
+	bucket, key, err := parseS3URL(url)
+	if err != nil {
+		return "", err
+	}
+	if bucket != s.bucket {
+		return "", fmt.Errorf("requested bucket %s does not match configured bucket %s", bucket, s.bucket)
+	}
+	return key, nil
+}
+
+// parseS3URL splits an s3://bucket/key URL.
+func parseS3URL(url string) (bucket, key string, err error) {
+	rest, ok := strings.CutPrefix(url, "s3://")
+	if !ok {
+		return "", "", utils.Errorf("invalid s3 URL: %s", url)
+	}
+	bucket, key, _ = strings.Cut(rest, "/")
+	if bucket == "" || key == "" {
+		return "", "", utils.Errorf("invalid s3 URL: %s", url)
+	}
+	return bucket, key, nil
+}
+
+// s3NotFound maps S3's missing-object errors to ErrBlobNotFound.
+func s3NotFound(err error) error {
+	var noSuchKey *types.NoSuchKey
+	var notFound *types.NotFound
+	if errors.As(err, &noSuchKey) || errors.As(err, &notFound) {
+		return ErrBlobNotFound
+	}
+	return err
+}
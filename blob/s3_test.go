@@ -1,11 +1,20 @@
 package blob
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func newTestS3BlobStore(t *testing.T) *S3BlobStore {
@@ -430,3 +439,307 @@ func TestS3BlobStore_ErrorMessages(t *testing.T) {
 	// Note: We can't easily test bucket mismatch error due to the format string issue
 	// in the actual S3 implementation, so we'll focus on testing the validation errors
 }
+
+func TestParseS3URL(t *testing.T) {
+	bucket, key, err := parseS3URL("s3://my-bucket/path/to/file.jpg")
+	if err != nil || bucket != "my-bucket" || key != "path/to/file.jpg" {
+		t.Errorf("parseS3URL = %q, %q, %v", bucket, key, err)
+	}
+	for _, url := range []string{"", "http://example.com/file.txt", "s3://", "s3://bucket-only", "s3://bucket/", "s3:///key"} {
+		if _, _, err := parseS3URL(url); err == nil {
+			t.Errorf("expected error for %q", url)
+		}
+	}
+
+	store := &S3BlobStore{bucket: "test-bucket", region: "us-west-2"}
+	if _, err := store.keyFor("s3://wrong-bucket/test-key"); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("expected bucket mismatch error, got %v", err)
+	}
+	if key, err := store.keyFor("s3://test-bucket/a/b.txt"); err != nil || key != "a/b.txt" {
+		t.Errorf("keyFor = %q, %v", key, err)
+	}
+}
+
+func TestS3BlobStore_StreamListDelete(t *testing.T) {
+	store := newTestS3BlobStore(t)
+	ctx := context.Background()
+	prefix := fmt.Sprintf("beemflow-test-%d/", os.Getpid())
+	url, err := store.PutStream(ctx, strings.NewReader("streamed"), "text/plain", prefix+"s.txt")
+	if err != nil {
+		t.Fatalf("PutStream failed: %v", err)
+	}
+	info, err := store.Stat(ctx, url)
+	if err != nil || info.Size != int64(len("streamed")) {
+		t.Errorf("Stat = %+v, %v", info, err)
+	}
+	if list, err := store.List(ctx, prefix); err != nil || len(list) != 1 {
+		t.Errorf("List = %d objects, %v", len(list), err)
+	}
+	if err := store.Delete(ctx, url); err != nil {
+		t.Errorf("Delete failed: %v", err)
+	}
+	if _, err := store.Stat(ctx, url); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound after delete, got %v", err)
+	}
+}
+
+// fakeS3 is a minimal path-style S3 stand-in covering the calls S3BlobStore makes.
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string]fakeS3Object // "bucket/key" -> object
+	uploads map[string]map[int][]byte
+	headers []http.Header // headers of every request, for assertions
+}
+
+type fakeS3Object struct {
+	data []byte
+	mime string
+	sse  string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{objects: map[string]fakeS3Object{}, uploads: map[string]map[int][]byte{}}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, srv
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.headers = append(f.headers, r.Header.Clone())
+	path := strings.TrimPrefix(r.URL.Path, "/")
+	q := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+	lastModified := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC).Format(http.TimeFormat)
+
+	switch {
+	case r.Method == http.MethodGet && q.Get("list-type") == "2":
+		bucket := path
+		var b strings.Builder
+		b.WriteString(`<ListBucketResult><IsTruncated>false</IsTruncated>`)
+		var keys []string
+		for k := range f.objects {
+			if key, ok := strings.CutPrefix(k, bucket+"/"); ok && strings.HasPrefix(key, q.Get("prefix")) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(&b, `<Contents><Key>%s</Key><Size>%d</Size><LastModified>2025-01-02T03:04:05.000Z</LastModified></Contents>`,
+				key, len(f.objects[bucket+"/"+key].data))
+		}
+		b.WriteString(`</ListBucketResult>`)
+		_, _ = w.Write([]byte(b.String()))
+	case r.Method == http.MethodPost && q.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = map[int][]byte{}
+		f.objects["pending/"+id] = fakeS3Object{mime: r.Header.Get("Content-Type"), sse: r.Header.Get("X-Amz-Server-Side-Encryption")}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, id)
+	case r.Method == http.MethodPut && q.Has("uploadId"):
+		n, _ := strconv.Atoi(q.Get("partNumber"))
+		f.uploads[q.Get("uploadId")][n] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"part-%d"`, n))
+	case r.Method == http.MethodPost && q.Has("uploadId"):
+		id := q.Get("uploadId")
+		obj := f.objects["pending/"+id]
+		for i := 1; i <= len(f.uploads[id]); i++ {
+			obj.data = append(obj.data, f.uploads[id][i]...)
+		}
+		delete(f.objects, "pending/"+id)
+		delete(f.uploads, id)
+		f.objects[path] = obj
+		_, _ = w.Write([]byte(`<CompleteMultipartUploadResult><ETag>"done"</ETag></CompleteMultipartUploadResult>`))
+	case r.Method == http.MethodPut:
+		f.objects[path] = fakeS3Object{data: body, mime: r.Header.Get("Content-Type"), sse: r.Header.Get("X-Amz-Server-Side-Encryption")}
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		obj, ok := f.objects[path]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>missing</Message></Error>`))
+			}
+			return
+		}
+		w.Header().Set("Content-Type", obj.mime)
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		w.Header().Set("Last-Modified", lastModified)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(obj.data)
+		}
+	case r.Method == http.MethodDelete:
+		delete(f.objects, path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+func newFakeS3BlobStore(t *testing.T, opts S3Options) (*fakeS3, *S3BlobStore) {
+	fake, srv := newFakeS3(t)
+	opts.Endpoint = srv.URL
+	opts.PathStyle = true
+	if opts.Bucket == "" {
+		opts.Bucket = "test-bucket"
+	}
+	if opts.AccessKeyID == "" {
+		opts.AccessKeyID, opts.SecretAccessKey = "test-access-key", "test-secret"
+	}
+	store, err := NewS3BlobStoreWithOptions(context.Background(), opts)
+	if err != nil {
+		t.Fatalf("NewS3BlobStoreWithOptions failed: %v", err)
+	}
+	return fake, store
+}
+
+func TestS3BlobStore_CompatibleEndpoint(t *testing.T) {
+	ctx := context.Background()
+	fake, store := newFakeS3BlobStore(t, S3Options{
+		Prefix:     "env/prod/",
+		Encryption: S3Encryption{Mode: "aws:kms", KMSKeyID: "key-1"},
+	})
+
+	url, err := store.Put(ctx, []byte("hello"), "text/plain", "greetings/hello.txt")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if url != "s3://test-bucket/env/prod/greetings/hello.txt" {
+		t.Errorf("unexpected URL %s", url)
+	}
+	obj := fake.objects["test-bucket/env/prod/greetings/hello.txt"]
+	if string(obj.data) != "hello" || obj.sse != "aws:kms" {
+		t.Errorf("unexpected stored object %+v", obj)
+	}
+	if auth := fake.headers[0].Get("Authorization"); !strings.Contains(auth, "Credential=test-access-key/") {
+		t.Errorf("expected static credentials to sign the request, got %q", auth)
+	}
+	if got := fake.headers[0].Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"); got != "key-1" {
+		t.Errorf("expected the KMS key header, got %q", got)
+	}
+
+	got, err := store.Get(ctx, url)
+	if err != nil || string(got) != "hello" {
+		t.Errorf("Get = %q, %v", got, err)
+	}
+	info, err := store.Stat(ctx, url)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Key != "greetings/hello.txt" || info.Size != 5 || info.Mime != "text/plain" {
+		t.Errorf("unexpected info %+v", info)
+	}
+	list, err := store.List(ctx, "greetings/")
+	if err != nil || len(list) != 1 || list[0].Key != "greetings/hello.txt" || list[0].URL != url {
+		t.Errorf("List = %+v, %v", list, err)
+	}
+	if err := store.Delete(ctx, url); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Delete(ctx, url); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound, got %v", err)
+	}
+	if _, err := store.Open(ctx, url); !errors.Is(err, ErrBlobNotFound) {
+		t.Errorf("expected ErrBlobNotFound from Open, got %v", err)
+	}
+}
+
+func TestS3BlobStore_PutStreamMultipart(t *testing.T) {
+	ctx := context.Background()
+	fake, store := newFakeS3BlobStore(t, S3Options{Encryption: S3Encryption{Mode: "AES256"}})
+	data := bytes.Repeat([]byte("0123456789"), (s3PartSize*2+s3PartSize/2)/10)
+
+	url, err := store.PutStream(ctx, bytes.NewReader(data), "application/octet-stream", "big.bin")
+	if err != nil {
+		t.Fatalf("PutStream failed: %v", err)
+	}
+	obj := fake.objects["test-bucket/big.bin"]
+	if !bytes.Equal(obj.data, data) || obj.sse != "AES256" {
+		t.Errorf("multipart upload stored %d bytes (sse %q), want %d", len(obj.data), obj.sse, len(data))
+	}
+	rc, err := store.Open(ctx, url)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer rc.Close()
+	if got, _ := io.ReadAll(rc); !bytes.Equal(got, data) {
+		t.Errorf("Open returned %d bytes, want %d", len(got), len(data))
+	}
+}
+
+func TestNewS3BlobStoreWithOptions_Validation(t *testing.T) {
+	ctx := context.Background()
+	cases := map[string]S3Options{
+		"missing bucket":     {Region: "us-east-1"},
+		"missing region":     {Bucket: "b"},
+		"unknown encryption": {Bucket: "b", Region: "us-east-1", Encryption: S3Encryption{Mode: "rot13"}},
+		"half of a key pair": {Bucket: "b", Region: "us-east-1", AccessKeyID: "AK"},
+	}
+	for name, opts := range cases {
+		if _, err := NewS3BlobStoreWithOptions(ctx, opts); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	store, err := NewS3BlobStoreWithOptions(ctx, S3Options{Bucket: "b", Endpoint: "http://localhost:9000"})
+	if err != nil || store.region != "us-east-1" {
+		t.Errorf("expected a custom endpoint to default the region, got %v, %v", store, err)
+	}
+}
+
+func TestNewDefaultBlobStore_S3Options(t *testing.T) {
+	fake, srv := newFakeS3(t)
+	t.Setenv("TEST_S3_SECRET", "from-env")
+	store, err := NewDefaultBlobStore(context.Background(), &BlobConfig{
+		Driver:          "s3",
+		Bucket:          "cfg-bucket",
+		Endpoint:        srv.URL,
+		PathStyle:       true,
+		Prefix:          "beemflow/",
+		AccessKeyID:     "cfg-key",
+		SecretAccessKey: "$env:TEST_S3_SECRET",
+	})
+	if err != nil {
+		t.Fatalf("NewDefaultBlobStore failed: %v", err)
+	}
+	s3Store := store.(*S3BlobStore)
+	if s3Store.prefix != "beemflow/" || s3Store.region != "us-east-1" {
+		t.Errorf("options not plumbed through: %+v", s3Store)
+	}
+	if _, err := store.Put(context.Background(), []byte("x"), "text/plain", "x.txt"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, ok := fake.objects["cfg-bucket/beemflow/x.txt"]; !ok {
+		t.Errorf("expected the object under the configured bucket and prefix, have %v", fake.objects)
+	}
+}
+
+func TestS3BlobStore_PresignURL(t *testing.T) {
+	ctx := context.Background()
+	_, store := newFakeS3BlobStore(t, S3Options{})
+	url, err := store.Put(ctx, []byte("shared"), "text/plain", "share/me.txt")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	signed, err := PresignURL(ctx, store, url, time.Hour)
+	if err != nil {
+		t.Fatalf("PresignURL failed: %v", err)
+	}
+	if !strings.Contains(signed, "/test-bucket/share/me.txt?") || !strings.Contains(signed, "X-Amz-Expires=3600") || !strings.Contains(signed, "X-Amz-Signature=") {
+		t.Errorf("unexpected presigned URL %s", signed)
+	}
+	resp, err := http.Get(signed)
+	if err != nil {
+		t.Fatalf("GET presigned URL failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "shared" {
+		t.Errorf("GET presigned URL = %d %q", resp.StatusCode, body)
+	}
+
+	if _, err := store.PresignURL(ctx, url, 8*24*time.Hour); err == nil {
+		t.Error("expected error for a TTL beyond S3's 7 day limit")
+	}
+}
@@ -0,0 +1,96 @@
+package blob
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/awantoch/beemflow/utils"
+)
+
+// DefaultPresignTTL is how long a presigned blob URL stays valid when no TTL is given.
+const DefaultPresignTTL = 24 * time.Hour
+
+// DownloadPath is the HTTP server path under which blobs are served to signed URLs.
+const DownloadPath = "/blobs/"
+
+// Presigner is implemented by blob stores that can issue time-limited HTTP URLs for their
+// blobs, for handing to people and services that cannot read file:// or s3:// URLs. The S3
+// driver presigns with S3 itself; the filesystem driver issues URLs signed with a URLSigner,
+// served by the HTTP server under DownloadPath.
+type Presigner interface {
+	// PresignURL returns a URL that downloads the blob at url until ttl has passed.
+	PresignURL(ctx context.Context, url string, ttl time.Duration) (string, error)
+}
+
+// ErrPresignUnsupported is returned by PresignURL when the store cannot issue signed URLs.
+var ErrPresignUnsupported = errors.New("blob store cannot issue signed URLs; set blob.signingKey")
+
+// PresignURL returns a time-limited HTTP URL for the blob at url. A ttl of 0 uses
+// DefaultPresignTTL.
+func PresignURL(ctx context.Context, store BlobStore, url string, ttl time.Duration) (string, error) {
+	if ttl == 0 {
+		ttl = DefaultPresignTTL
+	}
+	if ttl < 0 {
+		return "", utils.Errorf("invalid ttl %s", ttl)
+	}
+	p, ok := store.(Presigner)
+	if !ok {
+		return "", ErrPresignUnsupported
+	}
+	return p.PresignURL(ctx, url, ttl)
+}
+
+// URLSigner issues and verifies HMAC-SHA256 signed download URLs of the form
+// <baseURL>/blobs/<key>?expires=<unix>&sig=<signature>.
+type URLSigner struct {
+	baseURL string
+	secret  []byte
+}
+
+// NewURLSigner returns a signer for URLs rooted at baseURL (the HTTP server's public address).
+func NewURLSigner(baseURL, secret string) (*URLSigner, error) {
+	if secret == "" {
+		return nil, utils.Errorf("blob URL signing key is empty")
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, utils.Errorf("invalid blob public URL %q: %w", baseURL, err)
+	}
+	return &URLSigner{baseURL: strings.TrimSuffix(baseURL, "/"), secret: []byte(secret)}, nil
+}
+
+// Sign returns a URL for the blob with the given key that is valid until expires.
+func (s *URLSigner) Sign(key string, expires time.Time) string {
+	exp := strconv.FormatInt(expires.Unix(), 10)
+	q := url.Values{"expires": {exp}, "sig": {s.signature(key, exp)}}
+	path := (&url.URL{Path: DownloadPath + key}).EscapedPath()
+	return s.baseURL + path + "?" + q.Encode()
+}
+
+// Verify checks the expires and sig query parameters of a download request for key.
+func (s *URLSigner) Verify(key, expires, sig string, now time.Time) error {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return errors.New("invalid signed URL: bad expiry")
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.signature(key, expires))) {
+		return errors.New("invalid signed URL: signature mismatch")
+	}
+	if now.Unix() > exp {
+		return errors.New("signed URL has expired")
+	}
+	return nil
+}
+
+func (s *URLSigner) signature(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
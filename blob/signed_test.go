@@ -0,0 +1,76 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestURLSigner_SignVerify(t *testing.T) {
+	signer, err := NewURLSigner("https://flows.example.com/", "s3cret")
+	if err != nil {
+		t.Fatalf("NewURLSigner failed: %v", err)
+	}
+	now := time.Now()
+	signed := signer.Sign("reports/q3 summary.pdf", now.Add(time.Hour))
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("signed URL does not parse: %v", err)
+	}
+	if u.Host != "flows.example.com" || u.Path != "/blobs/reports/q3 summary.pdf" {
+		t.Errorf("unexpected signed URL %s", signed)
+	}
+	key := strings.TrimPrefix(u.Path, DownloadPath)
+	expires, sig := u.Query().Get("expires"), u.Query().Get("sig")
+
+	if err := signer.Verify(key, expires, sig, now); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+	if err := signer.Verify("reports/other.pdf", expires, sig, now); err == nil {
+		t.Error("expected a signature for one key to be rejected for another")
+	}
+	if err := signer.Verify(key, expires, sig, now.Add(2*time.Hour)); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected expiry error, got %v", err)
+	}
+	other, _ := NewURLSigner("https://flows.example.com", "different")
+	if err := other.Verify(key, expires, sig, now); err == nil {
+		t.Error("expected a signature from another key to be rejected")
+	}
+	if _, err := NewURLSigner("https://flows.example.com", ""); err == nil {
+		t.Error("expected error for an empty signing key")
+	}
+}
+
+func TestFilesystemBlobStore_PresignURL(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewFilesystemBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemBlobStore failed: %v", err)
+	}
+	url, err := store.Put(ctx, []byte("hi"), "text/plain", "a/b.txt")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	if _, err := PresignURL(ctx, store, url, 0); !errors.Is(err, ErrPresignUnsupported) {
+		t.Errorf("expected ErrPresignUnsupported without a signer, got %v", err)
+	}
+
+	signer, _ := NewURLSigner("http://localhost:3333", "key")
+	store.SetURLSigner(signer)
+	signed, err := PresignURL(ctx, NewContentAddressedStore(store), url, 0)
+	if err != nil {
+		t.Fatalf("PresignURL failed: %v", err)
+	}
+	if !strings.HasPrefix(signed, "http://localhost:3333/blobs/a/b.txt?expires=") {
+		t.Errorf("unexpected signed URL %s", signed)
+	}
+	if _, err := PresignURL(ctx, store, url, -time.Second); err == nil {
+		t.Error("expected error for a negative TTL")
+	}
+	if _, err := PresignURL(ctx, &bufferedBlobStore{}, "mem://x", 0); !errors.Is(err, ErrPresignUnsupported) {
+		t.Errorf("expected ErrPresignUnsupported for a store without presigning, got %v", err)
+	}
+}
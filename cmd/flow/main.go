@@ -5,8 +5,10 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"os/signal"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	// Load environment variables from .env file.
@@ -22,6 +24,7 @@ import (
 	mcpserver "github.com/awantoch/beemflow/mcp"
 	"github.com/awantoch/beemflow/registry"
 	"github.com/awantoch/beemflow/utils"
+	"github.com/awantoch/beemflow/worker"
 )
 
 var (
@@ -72,6 +75,7 @@ func NewRootCmd() *cobra.Command {
 	// Add all subcommands directly (no more need for CommandConstructors)
 	rootCmd.AddCommand(
 		newServeCmd(),
+		newWorkerCmd(),
 		newRunCmd(),
 		newMCPCmd(),
 	)
@@ -154,6 +158,62 @@ func newServeCmd() *cobra.Command {
 	return cmd
 }
 
+// ============================================================================
+// WORKER COMMAND
+// ============================================================================
+
+// newWorkerCmd creates the 'worker' subcommand, which executes runs enqueued in queue mode.
+func newWorkerCmd() *cobra.Command {
+	var workerID string
+	var concurrency int
+
+	cmd := &cobra.Command{
+		Use:   constants.CmdWorker,
+		Short: constants.DescWorker,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.LoadConfig(constants.ConfigFileName)
+			if err != nil {
+				if os.IsNotExist(err) {
+					cfg = &config.Config{}
+				} else {
+					utils.Error("Failed to load config: %v", err)
+					exit(1)
+				}
+			}
+			opts, err := worker.OptionsFromConfig(cfg.Queue)
+			if err != nil {
+				utils.Error("Invalid queue config: %v", err)
+				exit(1)
+			}
+			if workerID != "" {
+				opts.ID = workerID
+			}
+			if concurrency > 0 {
+				opts.Concurrency = concurrency
+			}
+
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer stop()
+
+			w, err := api.NewWorker(ctx, opts)
+			if err != nil {
+				utils.Error("Failed to start worker: %v", err)
+				exit(1)
+			}
+			if err := w.Run(ctx); err != nil {
+				utils.Error("Worker stopped: %v", err)
+				exit(1)
+			}
+			utils.Info("Worker %s stopped", w.ID())
+		},
+	}
+
+	cmd.Flags().StringVar(&workerID, "id", "", "Worker ID used as the lease owner (default: host-pid-random)")
+	cmd.Flags().IntVar(&concurrency, "concurrency", 0, "Runs to execute at once (overrides queue.concurrency)")
+
+	return cmd
+}
+
 // ============================================================================
 // RUN COMMAND (from run.go)
 // ============================================================================
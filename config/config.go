@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/awantoch/beemflow/docs"
 	"github.com/awantoch/beemflow/utils"
@@ -83,6 +84,7 @@ type Config struct {
 	Storage    StorageConfig              `json:"storage"`
 	Blob       *BlobConfig                `json:"blob,omitempty"`
 	Event      *EventConfig               `json:"event,omitempty"`
+	Webhooks   map[string]WebhookConfig   `json:"webhooks,omitempty"`
 	Secrets    *SecretsConfig             `json:"secrets,omitempty"`
 	Registries []RegistryConfig           `json:"registries,omitempty"`
 	HTTP       *HTTPConfig                `json:"http,omitempty"`
@@ -90,6 +92,8 @@ type Config struct {
 	FlowsDir   string                     `json:"flowsDir,omitempty"`
 	MCPServers map[string]MCPServerConfig `json:"mcpServers,omitempty"`
 	Tracing    *TracingConfig             `json:"tracing,omitempty"`
+	Queue      *QueueConfig               `json:"queue,omitempty"`
+	Encryption *EncryptionConfig          `json:"encryption,omitempty"`
 }
 
 type StorageConfig struct {
@@ -97,23 +101,124 @@ type StorageConfig struct {
 	DSN    string `json:"dsn"`
 }
 
+// BlobConfig configures the blob store.
+//
+// Supported drivers:
+//   - "filesystem" (default; files under Directory, default .beemflow/files)
+//   - "s3" (requires Bucket, and Region unless Endpoint points at an S3-compatible service)
+//
+// Credential fields accept "$env:NAME" to read the value from the environment; when they are
+// empty the default AWS credential chain is used.
 type BlobConfig struct {
-	Driver string `json:"driver,omitempty"`
-	Bucket string `json:"bucket,omitempty"`
+	Driver    string `json:"driver,omitempty"`
+	Directory string `json:"directory,omitempty"`
+	Bucket    string `json:"bucket,omitempty"`
+	Region    string `json:"region,omitempty"`
+
+	Endpoint        string `json:"endpoint,omitempty"`  // e.g. "http://localhost:9000" for MinIO
+	PathStyle       bool   `json:"pathStyle,omitempty"` // endpoint/bucket/key addressing
+	Prefix          string `json:"prefix,omitempty"`    // prepended to every object key
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+	SSE             string `json:"sse,omitempty"`         // "AES256" or "aws:kms"
+	SSEKMSKeyID     string `json:"sseKmsKeyId,omitempty"` // KMS key for "aws:kms"
+
+	// OffloadThreshold is the size in bytes above which step output values are stored as blobs
+	// instead of inline. Offloading is off unless it is set to a positive value.
+	OffloadThreshold int `json:"offloadThreshold,omitempty"`
+
+	// FetchMaxBytes caps the body core.blob.put downloads from a URL (default 100 MiB).
+	// FetchAllowPrivate lets it fetch from private, loopback, link-local and other non-public
+	// addresses, which are refused by default.
+	FetchMaxBytes     int64 `json:"fetchMaxBytes,omitempty"`
+	FetchAllowPrivate bool  `json:"fetchAllowPrivate,omitempty"`
+
+	// ContentAddressed stores blobs under the SHA-256 of their content, so identical files are
+	// kept once. Unreferenced blobs are removed with `flow blobs gc`.
+	ContentAddressed bool `json:"contentAddressed,omitempty"`
+
+	// SigningKey enables signed, expiring download URLs served by the HTTP server under
+	// /blobs/. PublicURL is the server address put in those URLs (default
+	// http://localhost:<http.port>). S3 stores presign with S3 instead.
+	SigningKey string `json:"signingKey,omitempty"`
+	PublicURL  string `json:"publicUrl,omitempty"`
+}
+
+// EncryptionConfig enables envelope encryption of run data and blobs at rest.
+//
+// Supported providers:
+//   - "local" (default; keys in KeyFile, created by `flow keys rotate`)
+//   - any provider registered with encryption.RegisterProvider, configured through Options
+type EncryptionConfig struct {
+	Provider string            `json:"provider,omitempty"`
+	KeyFile  string            `json:"keyFile,omitempty"`
+	Options  map[string]string `json:"options,omitempty"`
 }
 
 // EventConfig configures the event bus.
 //
 // Supported drivers:
 //   - "memory" (default, in-process event bus)
+//   - "embedded" (in-process NATS server with JetStream, storing events under Directory)
 //   - "nats" (requires URL)
 //
 // Unknown drivers will error out at startup.
 //
+// A subscriber whose handler panics or fails gets the event again, with exponential backoff,
+// up to MaxAttempts times; after that it is dead-lettered. Durations use Go syntax ("500ms", "1m").
+//
+// Log records every published event in the configured storage, so await_event steps see resume
+// events that arrived before the run paused and subscribers can replay past events.
+//
+// Schemas maps topic patterns to the JSON Schemas published payloads must match; flows can
+// also declare a schema on their event triggers.
+//
 // Future: Extend with fields like ClusterID, ClientID, TLS options as needed.
 type EventConfig struct {
-	Driver string `json:"driver,omitempty"`
-	URL    string `json:"url,omitempty"`
+	Driver          string         `json:"driver,omitempty"`
+	URL             string         `json:"url,omitempty"`
+	Directory       string         `json:"directory,omitempty"`       // for "embedded", default ~/.beemflow/nats
+	MaxAttempts     int            `json:"maxAttempts,omitempty"`     // default 3
+	RetryBackoff    string         `json:"retryBackoff,omitempty"`    // wait before the first retry, default "1s"
+	MaxRetryBackoff string         `json:"maxRetryBackoff,omitempty"` // default "30s"
+	Log             bool           `json:"log,omitempty"`
+	LogRetention    string         `json:"logRetention,omitempty"` // default "168h"
+	Schemas         map[string]any `json:"schemas,omitempty"`
+}
+
+// WebhookConfig configures an inbound webhook served at POST /hooks/{name}. Topic and Token are
+// templates over the request: body (the decoded JSON or form payload), headers (lowercase
+// names with "-" replaced by "_", e.g. headers.x_github_event), query and name. When Topic
+// renders non-empty the payload is published there; when Token does, the run paused on that
+// token is resumed with it.
+//
+// Verify checks the request signature with Secret, which accepts "$env:NAME":
+//   - "github" (X-Hub-Signature-256)
+//   - "stripe" (Stripe-Signature)
+//   - "slack" (X-Slack-Signature and X-Slack-Request-Timestamp)
+//   - "hmac" (hex HMAC-SHA256 of the body in Header, default X-Signature)
+type WebhookConfig struct {
+	Topic     string `json:"topic,omitempty"`
+	Token     string `json:"token,omitempty"`
+	Verify    string `json:"verify,omitempty"`
+	Secret    string `json:"secret,omitempty"`
+	Header    string `json:"header,omitempty"`
+	Tolerance string `json:"tolerance,omitempty"` // max timestamp age for stripe and slack, default "5m"
+}
+
+// QueueConfig enables queue mode: starting a run enqueues it in storage and `flow worker`
+// processes lease and execute it. Durations use Go syntax ("30s", "2m").
+//
+// FlowConcurrency caps how many runs of a flow execute at once across all workers.
+type QueueConfig struct {
+	Enabled           bool           `json:"enabled,omitempty"`
+	LeaseTTL          string         `json:"leaseTTL,omitempty"`          // default "30s"
+	HeartbeatInterval string         `json:"heartbeatInterval,omitempty"` // default leaseTTL/3
+	PollInterval      string         `json:"pollInterval,omitempty"`      // default "1s"
+	MaxAttempts       int            `json:"maxAttempts,omitempty"`       // default 3
+	Concurrency       int            `json:"concurrency,omitempty"`       // runs per worker process, default 1
+	FlowConcurrency   map[string]int `json:"flowConcurrency,omitempty"`
 }
 
 type SecretsConfig struct {
@@ -471,6 +576,20 @@ func (c *Config) Validate() error {
 	if c.HTTP != nil && c.HTTP.Port == 0 {
 		return fmt.Errorf("config: http.port must be set and nonzero")
 	}
+	if c.Queue != nil {
+		for name, val := range map[string]string{
+			"leaseTTL":          c.Queue.LeaseTTL,
+			"heartbeatInterval": c.Queue.HeartbeatInterval,
+			"pollInterval":      c.Queue.PollInterval,
+		} {
+			if val == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(val); err != nil || d <= 0 {
+				return fmt.Errorf("config: queue.%s must be a positive duration, got %q", name, val)
+			}
+		}
+	}
 	// Add more validation as needed (blob, event, etc.)
 	return nil
 }
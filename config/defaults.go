@@ -23,6 +23,10 @@ var (
 	DefaultBlobDir = filepath.Join(DefaultConfigDir, "files")
 	// DefaultLocalRegistryPath is the default path for the local registry file.
 	DefaultLocalRegistryPath = filepath.Join(DefaultConfigDir, "registry.json")
+	// DefaultKeyFile is the default key file for at-rest encryption with the local provider.
+	DefaultKeyFile = filepath.Join(DefaultConfigDir, "keys.json")
+	// DefaultNATSDir is the default JetStream directory of the embedded NATS event bus.
+	DefaultNATSDir = filepath.Join(DefaultConfigDir, "nats")
 	// DefaultSQLiteDSN is the default data source name for SQLite storage.
 	DefaultSQLiteDSN = filepath.Join(DefaultConfigDir, "flow.db")
 	// DefaultFlowsDir is the default directory for flow YAMLs.
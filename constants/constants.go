@@ -60,12 +60,22 @@ const (
 // Special Parameters
 const (
 	ParamSpecialUse = "__use"
+	// Per-call HTTP policy overrides, see registry.ToolManifest
+	ParamHTTPTimeout        = "__timeout"
+	ParamHTTPRetry          = "__retry"
+	ParamHTTPCircuitBreaker = "__circuit_breaker"
+	ParamHTTPExpectStatus   = "__expect_status"
+	ParamHTTPPaginate       = "__paginate"
 )
 
 // Core Tools
 const (
 	CoreEcho           = "core.echo"
 	CoreConvertOpenAPI = "core.convert_openapi"
+	CoreBlobPut        = "core.blob.put"
+	CoreBlobGet        = "core.blob.get"
+	CoreBlobList       = "core.blob.list"
+	CoreBlobURL        = "core.blob.url"
 )
 
 // ============================================================================
@@ -76,6 +86,7 @@ const (
 const (
 	CmdRun     = "run"
 	CmdServe   = "serve"
+	CmdWorker  = "worker"
 	CmdMCP     = "mcp"
 	CmdTools   = "tools"
 	CmdSearch  = "search"
@@ -97,6 +108,7 @@ const (
 	DescListTools     = "List installed tool manifests"
 	DescGetTool       = "Get a tool manifest by name"
 	DescMCPServe      = "Start MCP server for BeemFlow tools"
+	DescWorker        = "Execute runs from the storage-backed run queue"
 )
 
 // CLI Messages
@@ -165,10 +177,11 @@ const (
 
 // Content Types
 const (
-	ContentTypeJSON = "application/json"
-	ContentTypeText = "text/plain"
-	ContentTypeYAML = "application/x-yaml"
-	ContentTypeForm = "application/x-www-form-urlencoded"
+	ContentTypeJSON      = "application/json"
+	ContentTypeText      = "text/plain"
+	ContentTypeYAML      = "application/x-yaml"
+	ContentTypeForm      = "application/x-www-form-urlencoded"
+	ContentTypeMultipart = "multipart/form-data"
 )
 
 // HTTP Headers
@@ -176,6 +189,7 @@ const (
 	HeaderContentType   = "Content-Type"
 	HeaderAuthorization = "Authorization"
 	HeaderAccept        = "Accept"
+	HeaderRetryAfter    = "Retry-After"
 )
 
 // HTTP Defaults
@@ -218,6 +232,9 @@ const (
 	DefaultToolPageSize = 100
 	DefaultRetryCount   = 3
 	DefaultTimeoutSec   = 30
+
+	// DefaultBlobFetchMaxBytes is the largest body core.blob.put downloads from a URL.
+	DefaultBlobFetchMaxBytes = 100 << 20
 )
 
 // Template Field Names
@@ -234,8 +251,8 @@ const (
 	ErrAwaitEventPause         = "step is waiting for event"
 	ErrSaveRunFailed           = "failed to save run"
 	ErrFailedToPersistStep     = "failed to persist step"
-	ErrAwaitEventMissingToken  = "await_event step missing token in match"
-	ErrFailedToRenderToken     = "failed to render token: %v"
+	ErrAwaitEventMissingToken  = "await_event step missing token in match and has no source"
+	ErrFailedToRenderMatch     = "failed to render match field %s: %v"
 	ErrStepWaitingForEvent     = "step '%s' is waiting for event"
 	ErrFailedToDeletePausedRun = "failed to delete paused run"
 	// New engine error messages
@@ -247,12 +264,19 @@ const (
 	ErrTemplateErrorStepID      = "template error in step ID %s: %w"
 	ErrForeachNotList           = "foreach expression did not evaluate to a list, got: %T"
 	ErrTemplateErrorForeach     = "template error in foreach expression: %w"
+	ErrToolDidNotPaginate       = "step %s: %s did not stream any pages; set a paginate policy to loop over its items"
 )
 
 // Engine constants
 const (
 	MatchKeyToken          = "token"
 	EventTopicResumePrefix = "resume."
+	// TriggerKeyEvent is the key of an event trigger in a flow's `on:` list
+	TriggerKeyEvent = "event"
+	// TriggerKeySchema is the key of the JSON Schema an event trigger's payloads must match
+	TriggerKeySchema = "schema"
+	// EventKeyTopic holds the topic that started an event-triggered run
+	EventKeyTopic = "topic"
 	// New engine constants
 	AdapterIDMCP          = "mcp"
 	AdapterIDCore         = "core"
@@ -286,13 +310,28 @@ const (
 	InterfaceDescStaticAssets    = "Static asset serving"
 	InterfaceDescListFlows       = "List all available flows"
 	InterfaceDescGetFlow         = "Get a specific flow by name"
+	InterfaceDescSaveFlow        = "Save a flow definition as a new version in the flow repository"
+	InterfaceDescDeleteFlow      = "Delete a flow and its version history"
+	InterfaceDescListFlowVersion = "List the stored versions of a flow"
+	InterfaceDescDiffFlow        = "Show a line diff between two versions of a flow"
 	InterfaceDescValidateFlow    = "Validate a flow definition"
 	InterfaceDescGraphFlow       = "Generate a graph representation of a flow"
 	InterfaceDescStartRun        = "Start a new flow run"
 	InterfaceDescGetRun          = "Get details of a specific run"
 	InterfaceDescListRuns        = "List all flow runs"
+	InterfaceDescExportRun       = "Export a run, its steps, flow and blobs as a portable archive with secrets redacted"
+	InterfaceDescImportRun       = "Import a run archive into the configured storage"
+	InterfaceDescFlowStats       = "Run counts, success rates, durations and step failure reasons per flow over a time window"
+	InterfaceDescGCBlobs         = "Delete blobs that no retained run references"
+	InterfaceDescSignBlobURL     = "Create a time-limited HTTP download URL for a blob"
+	InterfaceDescServeBlob       = "Download a blob through a signed URL"
+	InterfaceDescRotateKey       = "Add a new at-rest encryption key and use it for new data"
+	InterfaceDescReencrypt       = "Re-encrypt stored run data and blobs with the current encryption key"
 	InterfaceDescPublishEvent    = "Publish an event to the event bus"
+	InterfaceDescListDLQ         = "List events whose subscribers failed on every delivery attempt"
+	InterfaceDescReplayDLQ       = "Publish dead-lettered events to their topic again and remove them from the dead-letter store"
 	InterfaceDescResumeRun       = "Resume a paused flow run"
+	InterfaceDescWebhook         = "Receive a configured webhook, verify its signature and publish or resume"
 	InterfaceDescListTools       = "List all available tools"
 	InterfaceDescGetToolManifest = "Get tool manifest information"
 	InterfaceDescConvertOpenAPI  = "Convert OpenAPI spec to BeemFlow tools"
@@ -312,9 +351,24 @@ const (
 	InterfaceIDListTools       = "listTools"
 	InterfaceIDGetToolManifest = "getToolManifest"
 	InterfaceIDListRuns        = "listRuns"
+	InterfaceIDExportRun       = "exportRun"
+	InterfaceIDImportRun       = "importRun"
+	InterfaceIDFlowStats       = "flowStats"
+	InterfaceIDGCBlobs         = "gcBlobs"
+	InterfaceIDSignBlobURL     = "signBlobURL"
+	InterfaceIDServeBlob       = "serveBlob"
+	InterfaceIDRotateKey       = "rotateKey"
+	InterfaceIDReencrypt       = "reencrypt"
 	InterfaceIDPublishEvent    = "publishEvent"
+	InterfaceIDListDLQ         = "listDeadLetters"
+	InterfaceIDReplayDLQ       = "replayDeadLetters"
+	InterfaceIDWebhook         = "webhook"
 	InterfaceIDListFlows       = "listFlows"
 	InterfaceIDGetFlow         = "getFlow"
+	InterfaceIDSaveFlow        = "saveFlow"
+	InterfaceIDDeleteFlow      = "deleteFlow"
+	InterfaceIDListFlowVersion = "listFlowVersions"
+	InterfaceIDDiffFlow        = "diffFlow"
 	InterfaceIDSpec            = "spec"
 	InterfaceIDConvertOpenAPI  = "convertOpenAPI"
 	InterfaceIDLintFlow        = "lintFlow"
@@ -356,6 +410,11 @@ const (
 	OutputKeyMessage = "message"
 	OutputKeyContent = "content"
 	OutputKeyBody    = "body"
+	OutputKeyStatus  = "$status"
+	OutputKeyHeaders = "$headers"
+	OutputKeyItems   = "items"
+	OutputKeyPages   = "pages"
+	OutputKeyCount   = "count"
 )
 
 // Output prefixes
@@ -416,6 +475,8 @@ const (
 	PausedRunKeyOutputs = "outputs"
 	PausedRunKeyToken   = "token"
 	PausedRunKeyRunID   = "run_id"
+	PausedRunKeySource  = "source"
+	PausedRunKeyMatch   = "match"
 )
 
 // Environment variable handling
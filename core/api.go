@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/awantoch/beemflow/config"
@@ -17,12 +18,30 @@ import (
 	"github.com/awantoch/beemflow/registry"
 	"github.com/awantoch/beemflow/storage"
 	"github.com/awantoch/beemflow/utils"
+	"github.com/awantoch/beemflow/worker"
 	"github.com/google/uuid"
 )
 
 // GetStoreFromConfig returns a storage instance based on config, or an error if the driver is unknown.
+// Run data is encrypted at rest when the config has an encryption section.
 // This is a utility function that can be used by other packages.
 func GetStoreFromConfig(cfg *config.Config) (storage.Storage, error) {
+	store, err := storeForDriver(cfg)
+	if err != nil {
+		return nil, err
+	}
+	env, err := envelopeFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if env != nil {
+		return storage.NewEncryptedStorage(store, env), nil
+	}
+	return store, nil
+}
+
+// storeForDriver creates the storage backend selected by the config's storage section.
+func storeForDriver(cfg *config.Config) (storage.Storage, error) {
 	if cfg != nil && cfg.Storage.Driver != "" {
 		switch strings.ToLower(cfg.Storage.Driver) {
 		case "sqlite":
@@ -62,16 +81,14 @@ func SetFlowsDir(dir string) {
 	}
 }
 
-// ListFlows returns the names of all available flows.
+// ListFlows returns the names of all available flows, from the flows directory and the flow repository.
 func ListFlows(ctx context.Context) ([]string, error) {
 	entries, err := os.ReadDir(flowsDir)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return []string{}, nil
-		}
+	if err != nil && !os.IsNotExist(err) {
 		return nil, err
 	}
-	var flows []string
+	flows := []string{}
+	seen := make(map[string]bool)
 	for _, entry := range entries {
 		if entry.IsDir() {
 			continue
@@ -80,19 +97,31 @@ func ListFlows(ctx context.Context) ([]string, error) {
 		if strings.HasSuffix(name, constants.FlowFileExtension) {
 			base := strings.TrimSuffix(name, constants.FlowFileExtension)
 			flows = append(flows, base)
+			seen[base] = true
+		}
+	}
+
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := store.ListFlowNames(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range stored {
+		if !seen[name] {
+			flows = append(flows, name)
 		}
 	}
+	sort.Strings(flows)
 	return flows, nil
 }
 
 // GetFlow returns the parsed flow definition for the given name.
 func GetFlow(ctx context.Context, name string) (model.Flow, error) {
-	path := buildFlowPath(name)
-	flow, err := dsl.Parse(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return model.Flow{}, nil
-		}
+	flow, err := parseFlowByName(ctx, name)
+	if err != nil || flow == nil {
 		return model.Flow{}, err
 	}
 	return *flow, nil
@@ -100,25 +129,17 @@ func GetFlow(ctx context.Context, name string) (model.Flow, error) {
 
 // ValidateFlow validates the given flow by name.
 func ValidateFlow(ctx context.Context, name string) error {
-	path := buildFlowPath(name)
-	flow, err := dsl.Parse(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil // treat missing as valid for test robustness
-		}
-		return err
+	flow, err := parseFlowByName(ctx, name)
+	if err != nil || flow == nil {
+		return err // treat missing as valid for test robustness
 	}
 	return dsl.Validate(flow)
 }
 
 // GraphFlow returns the Mermaid diagram for the given flow.
 func GraphFlow(ctx context.Context, name string) (string, error) {
-	path := buildFlowPath(name)
-	flow, err := dsl.Parse(path)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return "", nil
-		}
+	flow, err := parseFlowByName(ctx, name)
+	if err != nil || flow == nil {
 		return "", err
 	}
 	return graph.ExportMermaid(flow)
@@ -126,34 +147,41 @@ func GraphFlow(ctx context.Context, name string) (string, error) {
 
 // createEngineFromConfig creates a new engine instance with storage from config
 func createEngineFromConfig(ctx context.Context) (*engine.Engine, error) {
-	// Check if store is already in context (e.g., from tests)
-	if store := GetStoreFromContext(ctx); store != nil {
-		return engine.NewEngine(
-			engine.NewDefaultAdapterRegistry(ctx),
-			dsl.NewTemplater(),
-			event.NewInProcEventBus(),
-			nil, // blob store not needed here
-			store,
-		), nil
-	}
-
-	cfg, err := config.LoadConfig(constants.ConfigFileName)
-	if err != nil && !os.IsNotExist(err) {
+	store, err := resolveStore(ctx)
+	if err != nil {
 		return nil, err
 	}
 
-	store, err := GetStoreFromConfig(cfg)
+	cfg := configFromContext(ctx)
+	blobStore, err := blobStoreFromConfig(ctx, cfg)
 	if err != nil {
-		return nil, err
+		utils.WarnCtx(ctx, "Failed to create blob store, large outputs will stay inline", "error", err)
+		blobStore = nil
 	}
 
-	return engine.NewEngine(
+	eng := engine.NewEngine(
 		engine.NewDefaultAdapterRegistry(ctx),
 		dsl.NewTemplater(),
-		event.NewInProcEventBus(),
-		nil, // blob store not needed here
+		engineEventBus(),
+		blobStore,
 		store,
-	), nil
+	)
+	configureOffload(eng, cfg)
+	return eng, nil
+}
+
+// resolveStore returns the store attached to ctx (e.g., from tests), or the one from config.
+func resolveStore(ctx context.Context) (storage.Storage, error) {
+	if store := GetStoreFromContext(ctx); store != nil {
+		return store, nil
+	}
+
+	cfg, err := config.LoadConfig(constants.ConfigFileName)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return GetStoreFromConfig(cfg)
 }
 
 // buildFlowPath constructs the full path to a flow file
@@ -161,17 +189,14 @@ func buildFlowPath(flowName string) string {
 	return filepath.Join(flowsDir, flowName+constants.FlowFileExtension)
 }
 
-// parseFlowByName loads and parses a flow file by name
-func parseFlowByName(flowName string) (*model.Flow, error) {
-	path := buildFlowPath(flowName)
-	flow, err := dsl.Parse(path)
+// parseFlowByName loads and parses the current definition of a flow by name.
+// Returns nil, nil if the flow does not exist.
+func parseFlowByName(ctx context.Context, flowName string) (*model.Flow, error) {
+	store, err := resolveStore(ctx)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
 		return nil, err
 	}
-	return flow, nil
+	return loadFlow(ctx, store, flowName)
 }
 
 // findLatestRunForFlow finds the most recent run for a specific flow
@@ -236,7 +261,7 @@ func StartRun(ctx context.Context, flowName string, eventData map[string]any) (u
 		return uuid.Nil, err
 	}
 
-	flow, err := parseFlowByName(flowName)
+	flow, err := loadFlow(ctx, eng.Storage, flowName)
 	if err != nil {
 		return uuid.Nil, err
 	}
@@ -244,10 +269,57 @@ func StartRun(ctx context.Context, flowName string, eventData map[string]any) (u
 		return uuid.Nil, nil
 	}
 
+	// Publish the flow so the run is pinned to a stored version. In queue mode the run is
+	// only recorded and a `flow worker`, possibly without access to the flows directory,
+	// loads that version to execute it.
+	if err := publishFlow(ctx, eng.Storage, flow); err != nil {
+		return uuid.Nil, err
+	}
+	if queueEnabled(ctx) {
+		return eng.Enqueue(ctx, flow, eventData)
+	}
+
 	_, execErr := eng.Execute(ctx, flow, eventData)
 	return handleExecutionResult(eng.Storage, flowName, execErr)
 }
 
+// queueEnabled reports whether runs should be enqueued for workers instead of executed inline.
+func queueEnabled(ctx context.Context) bool {
+	cfg := configFromContext(ctx)
+	return cfg != nil && cfg.Queue != nil && cfg.Queue.Enabled
+}
+
+// configFromContext returns the config attached to ctx, falling back to the config file.
+// It returns nil if neither is available.
+func configFromContext(ctx context.Context) *config.Config {
+	if cfg := GetConfigFromContext(ctx); cfg != nil {
+		return cfg
+	}
+	cfg, _ := config.LoadConfig(constants.ConfigFileName)
+	return cfg
+}
+
+// NewWorker creates a queue worker backed by the configured storage. Runs pinned to a flow
+// version execute exactly that version from the flow repository; others load the current
+// definition each time a run is leased, so workers pick up edits without a restart.
+func NewWorker(ctx context.Context, opts worker.Options) (*worker.Worker, error) {
+	eng, err := createEngineFromConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	load := func(ctx context.Context, run *model.Run) (*model.Flow, error) {
+		if run.FlowVersion > 0 {
+			return loadFlowVersion(ctx, eng.Storage, run.FlowName, run.FlowVersion)
+		}
+		flow, err := loadFlow(ctx, eng.Storage, run.FlowName)
+		if err == nil && flow == nil {
+			err = fmt.Errorf("flow %s not found", run.FlowName)
+		}
+		return flow, err
+	}
+	return worker.New(eng, load, opts), nil
+}
+
 // GetRun returns the run by ID.
 func GetRun(ctx context.Context, runID uuid.UUID) (*model.Run, error) {
 	eng, err := createEngineFromConfig(ctx)
@@ -272,17 +344,58 @@ func ListRuns(ctx context.Context) ([]*model.Run, error) {
 	return eng.ListRuns(ctx)
 }
 
-// PublishEvent publishes an event to a topic.
+// PublishEvent publishes an event to a topic, on the server's event bus when called inside
+// the server and otherwise on the bus described by the config. Payloads that don't match the
+// schemas declared for the topic are rejected with an error wrapping event.ErrInvalidPayload.
 func PublishEvent(ctx context.Context, topic string, payload map[string]any) error {
-	cfg, _ := config.LoadConfig(constants.ConfigFileName)
+	if err := validateEventPayload(ctx, topic, payload); err != nil {
+		return err
+	}
+	bus, release, err := publishBus(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+	return bus.Publish(topic, payload)
+}
+
+// engineEventBus returns the bus for a new engine: the server's, so its resume subscriptions
+// see published events, or a private in-process bus outside the server.
+func engineEventBus() event.EventBus {
+	if bus := sharedEventBus(); bus != nil {
+		return bus
+	}
+	return event.NewInProcEventBus()
+}
+
+// publishBus returns the bus PublishEvent publishes on and a function that releases it.
+// Outside the server it connects to the configured bus, except the embedded one: that bus
+// lives inside the server process, and starting a second one here would publish events the
+// server never sees.
+func publishBus(ctx context.Context) (event.EventBus, func(), error) {
+	if bus := sharedEventBus(); bus != nil {
+		return bus, func() {}, nil
+	}
+	cfg := configFromContext(ctx)
 	if cfg == nil || cfg.Event == nil {
-		return fmt.Errorf("event bus not configured: missing config or event section")
+		return nil, nil, fmt.Errorf("event bus not configured: missing config or event section")
+	}
+	if cfg.Event.Driver == "embedded" {
+		return nil, nil, fmt.Errorf("the embedded event bus only runs inside the BeemFlow server; publish through the server (POST /events) instead")
 	}
 	bus, err := event.NewEventBusFromConfig(cfg.Event)
 	if bus == nil || err != nil {
-		return fmt.Errorf("event bus not configured: %w", err)
+		return nil, nil, fmt.Errorf("event bus not configured: %w", err)
 	}
-	return bus.Publish(topic, payload)
+	if cfg.Event.Log {
+		store, err := resolveStore(ctx)
+		if err != nil {
+			bus.Close()
+			return nil, nil, err
+		}
+		attachEventStore(ctx, bus, store, cfg)
+	}
+	return bus, func() { bus.Close() }, nil
 }
 
 // ResumeRun resumes a paused run with the given token and event, returning outputs if available.
@@ -460,14 +573,7 @@ func GetToolManifest(ctx context.Context, name string) (*registry.ToolManifest,
 
 	for _, entry := range entries {
 		if entry.Name == name {
-			return &registry.ToolManifest{
-				Name:        entry.Name,
-				Description: entry.Description,
-				Kind:        entry.Kind,
-				Parameters:  entry.Parameters,
-				Endpoint:    entry.Endpoint,
-				Headers:     entry.Headers,
-			}, nil
+			return entry.ToolManifest(), nil
 		}
 	}
 	return nil, nil
@@ -483,14 +589,7 @@ func ListToolManifests(ctx context.Context) ([]registry.ToolManifest, error) {
 	}
 	var manifests []registry.ToolManifest
 	for _, entry := range entries {
-		manifests = append(manifests, registry.ToolManifest{
-			Name:        entry.Name,
-			Description: entry.Description,
-			Kind:        entry.Kind,
-			Parameters:  entry.Parameters,
-			Endpoint:    entry.Endpoint,
-			Headers:     entry.Headers,
-		})
+		manifests = append(manifests, *entry.ToolManifest())
 	}
 	return manifests, nil
 }
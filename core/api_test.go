@@ -11,6 +11,7 @@ import (
 	"github.com/awantoch/beemflow/model"
 	"github.com/awantoch/beemflow/storage"
 	"github.com/awantoch/beemflow/utils"
+	"github.com/awantoch/beemflow/worker"
 	"github.com/google/uuid"
 )
 
@@ -81,6 +82,15 @@ func TestPublishEvent(t *testing.T) {
 	}
 }
 
+func TestPublishEvent_EmbeddedBusOutsideServer(t *testing.T) {
+	cfg := &config.Config{Event: &config.EventConfig{Driver: "embedded", Directory: t.TempDir()}}
+	ctx := WithConfig(WithStore(context.Background(), storage.NewMemoryStorage()), cfg)
+	err := PublishEvent(ctx, "orders.created", map[string]any{"id": "o1"})
+	if err == nil || !strings.Contains(err.Error(), "publish through the server") {
+		t.Errorf("expected the embedded bus to be refused outside the server, got %v", err)
+	}
+}
+
 func TestResumeRun(t *testing.T) {
 	outputs, err := ResumeRun(context.Background(), "dummy-token", map[string]any{"foo": "bar"})
 	if err != nil {
@@ -484,7 +494,7 @@ func TestListFlows_CustomDir(t *testing.T) {
 		t.Fatalf("failed to write flow file: %v", err)
 	}
 	SetFlowsDir(custom)
-	flows, err := ListFlows(context.Background())
+	flows, err := ListFlows(WithStore(context.Background(), storage.NewMemoryStorage()))
 	if err != nil {
 		t.Fatalf("ListFlows error: %v", err)
 	}
@@ -697,7 +707,7 @@ func TestListFlows_EmptyDir(t *testing.T) {
 	SetFlowsDir(tempDir)
 	defer SetFlowsDir(originalDir)
 
-	ctx := context.Background()
+	ctx := WithStore(context.Background(), storage.NewMemoryStorage())
 	flows, err := ListFlows(ctx)
 	if err != nil {
 		t.Errorf("ListFlows failed: %v", err)
@@ -734,7 +744,7 @@ func TestListFlows_WithSubdirectories(t *testing.T) {
 	SetFlowsDir(tempDir)
 	defer SetFlowsDir(originalDir)
 
-	ctx := context.Background()
+	ctx := WithStore(context.Background(), storage.NewMemoryStorage())
 	flows, err := ListFlows(ctx)
 	if err != nil {
 		t.Errorf("ListFlows failed: %v", err)
@@ -1073,3 +1083,66 @@ func TestGetFlow_Direct(t *testing.T) {
 	// Note: Our implementation returns an empty flow rather than an error for non-existent flows
 	_ = flow
 }
+
+func TestStartRun_PinsInlineRuns(t *testing.T) {
+	dir := t.TempDir()
+	flowYAML := "name: pinned\nsteps:\n  - id: s1\n    use: core.echo\n    with:\n      text: hi\n"
+	if err := os.WriteFile(filepath.Join(dir, "pinned.flow.yaml"), []byte(flowYAML), 0644); err != nil {
+		t.Fatalf("os.WriteFile failed: %v", err)
+	}
+	SetFlowsDir(dir)
+	defer SetFlowsDir(config.DefaultFlowsDir)
+
+	store := storage.NewMemoryStorage()
+	ctx := WithStore(context.Background(), store)
+	runID, err := StartRun(ctx, "pinned", map[string]any{})
+	if err != nil {
+		t.Fatalf("StartRun failed: %v", err)
+	}
+	run, err := store.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if run.FlowVersion != 1 {
+		t.Fatalf("expected the inline run to be pinned to version 1, got %d", run.FlowVersion)
+	}
+	fv, err := store.GetFlowVersion(ctx, "pinned", run.FlowVersion)
+	if err != nil || fv.Source != flowYAML {
+		t.Errorf("expected the pinned version to hold the flow source, got %v: %v", fv, err)
+	}
+}
+
+func TestStartRun_QueueMode(t *testing.T) {
+	dir := t.TempDir()
+	flowYAML := "name: queued\nsteps:\n  - id: s1\n    use: core.echo\n    with:\n      text: \"{{ event.msg }}\"\n"
+	if err := os.WriteFile(filepath.Join(dir, "queued.flow.yaml"), []byte(flowYAML), 0644); err != nil {
+		t.Fatalf("os.WriteFile failed: %v", err)
+	}
+	SetFlowsDir(dir)
+	defer SetFlowsDir(config.DefaultFlowsDir)
+
+	store := storage.NewMemoryStorage()
+	ctx := WithConfig(WithStore(context.Background(), store), &config.Config{Queue: &config.QueueConfig{Enabled: true}})
+	runID, err := StartRun(ctx, "queued", map[string]any{"msg": "later"})
+	if err != nil {
+		t.Fatalf("StartRun failed: %v", err)
+	}
+	run, err := store.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if run.Status != model.RunPending {
+		t.Fatalf("expected queued run to stay PENDING until a worker runs it, got %s", run.Status)
+	}
+
+	w, err := NewWorker(ctx, worker.Options{ID: "test-worker"})
+	if err != nil {
+		t.Fatalf("NewWorker failed: %v", err)
+	}
+	if leased, err := w.ProcessNext(ctx); err != nil || !leased {
+		t.Fatalf("expected worker to process the queued run, got %v, %v", leased, err)
+	}
+	if run, _ = store.GetRun(ctx, runID); run.Status != model.RunSucceeded {
+		t.Errorf("expected SUCCEEDED after worker ran it, got %s", run.Status)
+	}
+}
@@ -0,0 +1,559 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+	"github.com/awantoch/beemflow/utils"
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// Run archives are gzipped tarballs that carry everything needed to inspect a run on
+// another machine:
+//
+//	manifest.json  format/version, provenance and the blob index
+//	run.json       the run with its steps, secrets redacted
+//	flow.yaml      the flow definition the run executed (when it can be found)
+//	blobs/...      blob contents referenced from the event or step outputs
+const (
+	runArchiveFormat  = "beemflow.run-archive"
+	runArchiveVersion = 1
+
+	archiveManifestFile = "manifest.json"
+	archiveRunFile      = "run.json"
+	archiveFlowFile     = "flow.yaml"
+	archiveBlobDir      = "blobs/"
+
+	redactedValue = "[REDACTED]"
+)
+
+// RunArchiveManifest describes the contents of a run archive.
+type RunArchiveManifest struct {
+	Format     string         `json:"format"`
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exportedAt"`
+	RunID      uuid.UUID      `json:"runId"`
+	FlowName   string         `json:"flowName"`
+	FlowSource string         `json:"flowSource,omitempty"` // "repository", "paused_run" or "flows_dir"; empty if the flow wasn't found
+	Redacted   int            `json:"redacted"`             // number of values replaced with [REDACTED]
+	Blobs      []ArchivedBlob `json:"blobs,omitempty"`
+}
+
+// ArchivedBlob maps a blob URL referenced by the run to its file in the archive.
+type ArchivedBlob struct {
+	URL     string `json:"url"`
+	Path    string `json:"path,omitempty"`
+	Size    int    `json:"size"`
+	Missing bool   `json:"missing,omitempty"` // the blob could not be read at export time
+}
+
+// RunImportResult summarizes an imported run archive.
+type RunImportResult struct {
+	RunID       uuid.UUID `json:"runId"`
+	FlowName    string    `json:"flowName"`
+	Steps       int       `json:"steps"`
+	Blobs       int       `json:"blobs"`
+	FlowWritten string    `json:"flowWritten,omitempty"` // path the flow definition was written to, if it was missing locally
+}
+
+// ExportRun writes a portable archive of the run to w.
+func ExportRun(ctx context.Context, runID uuid.UUID, w io.Writer) (*RunArchiveManifest, error) {
+	eng, err := createEngineFromConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	run, err := eng.Storage.GetRun(ctx, runID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("run %s not found", runID)
+		}
+		return nil, err
+	}
+	steps, err := eng.Storage.GetSteps(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	run.Steps = make([]model.StepRun, 0, len(steps))
+	for _, step := range steps {
+		run.Steps = append(run.Steps, *step)
+	}
+
+	manifest := &RunArchiveManifest{
+		Format:     runArchiveFormat,
+		Version:    runArchiveVersion,
+		ExportedAt: time.Now().UTC(),
+		RunID:      run.ID,
+		FlowName:   run.FlowName,
+	}
+	flowYAML, source := findRunFlow(ctx, eng.Storage, run)
+	manifest.FlowSource = source
+
+	red := newRedactor(run, flowYAML)
+	redactRun(run, red)
+	flowYAML = []byte(red.redactString(string(flowYAML)))
+
+	// Collect blob contents before writing so the manifest can index them
+	blobStore, err := blobStoreFromConfig(ctx, configFromContext(ctx))
+	if err != nil {
+		utils.WarnCtx(ctx, "Blob store unavailable, exporting without blobs", "error", err)
+	}
+	var blobData [][]byte
+	for i, url := range collectBlobURLs(run) {
+		entry := ArchivedBlob{URL: url}
+		var data []byte
+		if blobStore != nil {
+			data, err = readStoredBlob(ctx, blobStore, url)
+		}
+		if blobStore == nil || err != nil {
+			utils.WarnCtx(ctx, "Blob referenced by run could not be read", "url", url, "error", err)
+			entry.Missing = true
+		} else {
+			data = red.redactBlob(data)
+			entry.Path = fmt.Sprintf("%s%03d-%s", archiveBlobDir, i, path.Base(url))
+			entry.Size = len(data)
+			blobData = append(blobData, data)
+		}
+		manifest.Blobs = append(manifest.Blobs, entry)
+	}
+	manifest.Redacted = red.count
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeArchiveJSON(tw, archiveManifestFile, manifest); err != nil {
+		return nil, err
+	}
+	if err := writeArchiveJSON(tw, archiveRunFile, run); err != nil {
+		return nil, err
+	}
+	if len(flowYAML) > 0 {
+		if err := writeArchiveFile(tw, archiveFlowFile, flowYAML); err != nil {
+			return nil, err
+		}
+	}
+	dataIdx := 0
+	for _, entry := range manifest.Blobs {
+		if entry.Missing {
+			continue
+		}
+		if err := writeArchiveFile(tw, entry.Path, blobData[dataIdx]); err != nil {
+			return nil, err
+		}
+		dataIdx++
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// ImportRun loads a run archive into the configured storage. Blobs are stored in the local
+// blob store and references to them are rewritten. The flow definition is written to the
+// flows directory only if no flow with that name exists yet.
+func ImportRun(ctx context.Context, r io.Reader) (*RunImportResult, error) {
+	manifest, run, flowYAML, blobs, err := readRunArchive(r)
+	if err != nil {
+		return nil, err
+	}
+	// The flow name becomes a path in the flows directory
+	if err := validateFlowName(run.FlowName); err != nil {
+		return nil, fmt.Errorf("invalid run archive: %w", err)
+	}
+
+	eng, err := createEngineFromConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := eng.Storage.GetRun(ctx, run.ID); err == nil {
+		return nil, fmt.Errorf("run %s already exists", run.ID)
+	}
+
+	// Re-home blobs and rewrite the URLs that point at them
+	rewrites := make(map[string]string)
+	if len(blobs) > 0 {
+		blobStore, err := blobStoreFromConfig(ctx, configFromContext(ctx))
+		if err != nil {
+			return nil, fmt.Errorf("blob store unavailable: %w", err)
+		}
+		for _, entry := range manifest.Blobs {
+			data, ok := blobs[entry.Path]
+			if entry.Missing || !ok {
+				continue
+			}
+			filename := fmt.Sprintf("import-%s-%s", run.ID.String()[:8], path.Base(entry.Path))
+			newURL, err := blobStore.Put(ctx, data, "", filename)
+			if err != nil {
+				return nil, fmt.Errorf("failed to store blob %s: %w", entry.URL, err)
+			}
+			rewrites[entry.URL] = newURL
+		}
+	}
+	rewrite := func(v any) any {
+		return mapStrings(v, func(s string) string {
+			if newURL, ok := rewrites[s]; ok {
+				return newURL
+			}
+			return s
+		})
+	}
+	run.Event = asMap(rewrite(run.Event))
+	run.Vars = asMap(rewrite(run.Vars))
+	// Version numbers belong to the exporting flow repository; only the content hash carries over
+	run.FlowVersion = 0
+
+	steps := run.Steps
+	run.Steps = nil
+	if err := eng.Storage.SaveRun(ctx, run); err != nil {
+		return nil, err
+	}
+	for i := range steps {
+		step := steps[i]
+		step.RunID = run.ID
+		step.Outputs = asMap(rewrite(step.Outputs))
+		if err := eng.Storage.SaveStep(ctx, &step); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &RunImportResult{RunID: run.ID, FlowName: run.FlowName, Steps: len(steps), Blobs: len(rewrites)}
+	if len(flowYAML) > 0 && run.FlowName != "" {
+		flowPath := buildFlowPath(run.FlowName)
+		if existing, err := loadFlow(ctx, eng.Storage, run.FlowName); err == nil && existing == nil {
+			if err := os.MkdirAll(flowsDir, 0755); err == nil && os.WriteFile(flowPath, flowYAML, 0644) == nil {
+				result.FlowWritten = flowPath
+			}
+		}
+	}
+	return result, nil
+}
+
+// findRunFlow locates the flow definition a run executed: the flow repository version the run
+// was pinned to, the copy persisted with a paused run, or failing those the current file in
+// the flows directory.
+func findRunFlow(ctx context.Context, store storage.Storage, run *model.Run) ([]byte, string) {
+	if run.FlowVersion > 0 {
+		if fv, err := store.GetFlowVersion(ctx, run.FlowName, run.FlowVersion); err == nil {
+			return []byte(fv.Source), "repository"
+		}
+	}
+	if paused, err := store.LoadPausedRuns(ctx); err == nil {
+		for _, raw := range paused {
+			data, err := json.Marshal(raw)
+			if err != nil {
+				continue
+			}
+			var persisted struct {
+				Flow  *model.Flow `json:"flow"`
+				RunID string      `json:"run_id"`
+			}
+			if json.Unmarshal(data, &persisted) != nil || persisted.Flow == nil || persisted.RunID != run.ID.String() {
+				continue
+			}
+			if out, err := yaml.Marshal(persisted.Flow); err == nil {
+				return out, "paused_run"
+			}
+		}
+	}
+	if run.FlowName != "" {
+		if data, err := os.ReadFile(buildFlowPath(run.FlowName)); err == nil {
+			return data, "flows_dir"
+		}
+	}
+	return nil, ""
+}
+
+func readRunArchive(r io.Reader) (*RunArchiveManifest, *model.Run, []byte, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("invalid run archive: %w", err)
+	}
+	defer gz.Close()
+
+	var manifest *RunArchiveManifest
+	var run *model.Run
+	var flowYAML []byte
+	blobs := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, nil, fmt.Errorf("invalid run archive: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, nil, nil, err
+		}
+		switch {
+		case hdr.Name == archiveManifestFile:
+			manifest = &RunArchiveManifest{}
+			if err := json.Unmarshal(data, manifest); err != nil {
+				return nil, nil, nil, nil, fmt.Errorf("invalid archive manifest: %w", err)
+			}
+		case hdr.Name == archiveRunFile:
+			run = &model.Run{}
+			if err := json.Unmarshal(data, run); err != nil {
+				return nil, nil, nil, nil, fmt.Errorf("invalid archived run: %w", err)
+			}
+		case hdr.Name == archiveFlowFile:
+			flowYAML = data
+		case strings.HasPrefix(hdr.Name, archiveBlobDir):
+			blobs[hdr.Name] = data
+		}
+	}
+	if manifest == nil || manifest.Format != runArchiveFormat {
+		return nil, nil, nil, nil, fmt.Errorf("not a run archive: missing %s", archiveManifestFile)
+	}
+	if manifest.Version > runArchiveVersion {
+		return nil, nil, nil, nil, fmt.Errorf("run archive version %d is newer than supported version %d", manifest.Version, runArchiveVersion)
+	}
+	if run == nil {
+		return nil, nil, nil, nil, fmt.Errorf("run archive is missing %s", archiveRunFile)
+	}
+	return manifest, run, flowYAML, blobs, nil
+}
+
+func writeArchiveJSON(tw *tar.Writer, name string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeArchiveFile(tw, name, data)
+}
+
+func writeArchiveFile(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: time.Now()}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// ============================================================================
+// REDACTION
+// ============================================================================
+
+// sensitiveKeyParts marks map keys whose values are always redacted.
+var sensitiveKeyParts = []string{"secret", "password", "passwd", "api_key", "apikey", "authorization", "access_token", "refresh_token", "private_key"}
+
+// secretRefPattern finds `secrets.NAME` references in a flow definition.
+var secretRefPattern = regexp.MustCompile(`secrets\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// minSecretLen avoids redacting short values that would match ordinary text.
+const minSecretLen = 4
+
+// redactor replaces known secret values and values under sensitive keys.
+type redactor struct {
+	values []string
+	count  int
+}
+
+// newRedactor collects the secret values a run could have seen: event-supplied secrets,
+// $env values, and environment values for secrets the flow references.
+func newRedactor(run *model.Run, flowYAML []byte) *redactor {
+	r := &redactor{}
+	if eventSecrets, ok := utils.SafeMapAssert(run.Event[constants.SecretsKey]); ok {
+		for _, v := range eventSecrets {
+			r.addValue(v)
+		}
+	}
+	for k, v := range run.Event {
+		if strings.HasPrefix(k, constants.EnvVarPrefix) {
+			r.addValue(v)
+		}
+	}
+	for _, m := range secretRefPattern.FindAllStringSubmatch(string(flowYAML), -1) {
+		r.addValue(os.Getenv(m[1]))
+	}
+	return r
+}
+
+func (r *redactor) addValue(v any) {
+	if s, ok := v.(string); ok && len(s) >= minSecretLen {
+		r.values = append(r.values, s)
+	}
+}
+
+func (r *redactor) redactString(s string) string {
+	for _, secret := range r.values {
+		if n := strings.Count(s, secret); n > 0 {
+			s = strings.ReplaceAll(s, secret, redactedValue)
+			r.count += n
+		}
+	}
+	return s
+}
+
+func (r *redactor) redact(v any) any {
+	switch val := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			if item != nil && (k == constants.SecretsKey || strings.HasPrefix(k, constants.EnvVarPrefix) || isSensitiveKey(k)) {
+				out[k] = r.redactAll(item)
+				continue
+			}
+			out[k] = r.redact(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = r.redact(item)
+		}
+		return out
+	case string:
+		return r.redactString(val)
+	default:
+		return v
+	}
+}
+
+// redactAll replaces every leaf value, keeping the shape of maps so readers can see which keys were set.
+func (r *redactor) redactAll(v any) any {
+	if m, ok := v.(map[string]any); ok {
+		out := make(map[string]any, len(m))
+		for k, item := range m {
+			out[k] = r.redactAll(item)
+		}
+		return out
+	}
+	r.count++
+	return redactedValue
+}
+
+func isSensitiveKey(key string) bool {
+	lower := strings.ToLower(strings.ReplaceAll(key, "-", "_"))
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(lower, part) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactBlob redacts blob contents. JSON, such as offloaded step outputs, is redacted like the
+// run's own values; other contents have known secret values replaced. Contents with nothing to
+// redact are returned unchanged.
+func (r *redactor) redactBlob(data []byte) []byte {
+	before := r.count
+	var v any
+	if json.Unmarshal(data, &v) == nil {
+		redacted := r.redact(v)
+		if r.count == before {
+			return data
+		}
+		if out, err := json.Marshal(redacted); err == nil {
+			return out
+		}
+		r.count = before
+	}
+	for _, secret := range r.values {
+		if n := bytes.Count(data, []byte(secret)); n > 0 {
+			data = bytes.ReplaceAll(data, []byte(secret), []byte(redactedValue))
+			r.count += n
+		}
+	}
+	return data
+}
+
+func redactRun(run *model.Run, r *redactor) {
+	run.Event = asMap(r.redact(run.Event))
+	run.Vars = asMap(r.redact(run.Vars))
+	for i := range run.Steps {
+		run.Steps[i].Outputs = asMap(r.redact(run.Steps[i].Outputs))
+		run.Steps[i].Error = r.redactString(run.Steps[i].Error)
+	}
+}
+
+// ============================================================================
+// HELPERS
+// ============================================================================
+
+// readStoredBlob reads a blob the run references if it lives in store. Other URLs, such as a
+// file:// path supplied in an event, are refused so exports can't copy arbitrary files.
+func readStoredBlob(ctx context.Context, store blob.BlobStore, url string) ([]byte, error) {
+	streaming, ok := store.(blob.StreamingBlobStore)
+	if !ok {
+		return nil, fmt.Errorf("blob store can't confirm it holds %s", url)
+	}
+	info, err := streaming.Stat(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	if owned, err := streaming.KeyURL(info.Key); err != nil || owned != url {
+		return nil, fmt.Errorf("%s is not in the configured blob store", url)
+	}
+	return streaming.Get(ctx, url)
+}
+
+// collectBlobURLs returns the distinct blob URLs referenced anywhere in the run.
+func collectBlobURLs(run *model.Run) []string {
+	seen := make(map[string]bool)
+	var urls []string
+	visit := func(s string) string {
+		if blob.IsBlobURL(s) && !seen[s] {
+			seen[s] = true
+			urls = append(urls, s)
+		}
+		return s
+	}
+	mapStrings(run.Event, visit)
+	mapStrings(run.Vars, visit)
+	for _, step := range run.Steps {
+		mapStrings(step.Outputs, visit)
+	}
+	return urls
+}
+
+// mapStrings returns a copy of v with fn applied to every string value.
+func mapStrings(v any, fn func(string) string) any {
+	switch val := v.(type) {
+	case map[string]any:
+		if val == nil {
+			return val
+		}
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = mapStrings(item, fn)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = mapStrings(item, fn)
+		}
+		return out
+	case string:
+		return fn(val)
+	default:
+		return v
+	}
+}
+
+func asMap(v any) map[string]any {
+	m, _ := v.(map[string]any)
+	return m
+}
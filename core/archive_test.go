@@ -0,0 +1,213 @@
+package api
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+	"github.com/google/uuid"
+)
+
+func TestExportImportRun_RoundTrip(t *testing.T) {
+	srcDir := t.TempDir()
+	flowYAML := "name: archived\nsteps:\n  - id: s1\n    use: core.echo\n    with:\n      text: \"{{ secrets.TEST_ARCHIVE_TOKEN }}\"\n"
+	if err := os.WriteFile(filepath.Join(srcDir, "archived.flow.yaml"), []byte(flowYAML), 0644); err != nil {
+		t.Fatalf("os.WriteFile failed: %v", err)
+	}
+	t.Setenv("TEST_ARCHIVE_TOKEN", "tok-abcdef")
+	blobDir := t.TempDir()
+	blobPath := filepath.Join(blobDir, "report.txt")
+	if err := os.WriteFile(blobPath, []byte("quarterly numbers for tok-abcdef"), 0644); err != nil {
+		t.Fatalf("os.WriteFile failed: %v", err)
+	}
+	offloadedPath := filepath.Join(blobDir, "offloaded.json")
+	if err := os.WriteFile(offloadedPath, []byte(`{"access_token": "opaque-value", "rows": [1, 2]}`), 0644); err != nil {
+		t.Fatalf("os.WriteFile failed: %v", err)
+	}
+	// A file outside the blob store, named in the event
+	foreignPath := filepath.Join(srcDir, "host-file.txt")
+	if err := os.WriteFile(foreignPath, []byte("not a blob"), 0644); err != nil {
+		t.Fatalf("os.WriteFile failed: %v", err)
+	}
+	SetFlowsDir(srcDir)
+	defer SetFlowsDir(config.DefaultFlowsDir)
+
+	src := storage.NewMemoryStorage()
+	srcCtx := WithConfig(WithStore(context.Background(), src), &config.Config{Blob: &config.BlobConfig{Directory: blobDir}})
+	ended := time.Now()
+	run := &model.Run{
+		ID:       uuid.New(),
+		FlowName: "archived",
+		Event: map[string]any{
+			"msg":     "hi",
+			"path":    "file://" + foreignPath,
+			"secrets": map[string]any{"API_KEY": "sk-live-123456"},
+			"headers": map[string]any{"Authorization": "Bearer xyz"},
+		},
+		Status:    model.RunSucceeded,
+		StartedAt: ended.Add(-time.Second),
+		EndedAt:   &ended,
+	}
+	if err := src.SaveRun(srcCtx, run); err != nil {
+		t.Fatalf("SaveRun failed: %v", err)
+	}
+	step := &model.StepRun{
+		ID:        uuid.New(),
+		RunID:     run.ID,
+		StepName:  "s1",
+		Status:    model.StepSucceeded,
+		StartedAt: run.StartedAt,
+		Outputs: map[string]any{
+			"text":     "called with sk-live-123456 and tok-abcdef",
+			"file":     "file://" + blobPath,
+			"response": map[string]any{"$blob": map[string]any{"url": "file://" + offloadedPath}},
+		},
+	}
+	if err := src.SaveStep(srcCtx, step); err != nil {
+		t.Fatalf("SaveStep failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	manifest, err := ExportRun(srcCtx, run.ID, &buf)
+	if err != nil {
+		t.Fatalf("ExportRun failed: %v", err)
+	}
+	if manifest.FlowSource != "flows_dir" || len(manifest.Blobs) != 3 {
+		t.Fatalf("unexpected manifest: %+v", manifest)
+	}
+	for _, entry := range manifest.Blobs {
+		if missing := entry.URL == "file://"+foreignPath; entry.Missing != missing {
+			t.Errorf("expected only blobs in the blob store to be exported, got %+v", entry)
+		}
+	}
+
+	// Secrets must not survive anywhere in the archive
+	_, archived, _, blobs, err := readRunArchive(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("readRunArchive failed: %v", err)
+	}
+	raw, _ := json.Marshal(archived)
+	for _, data := range blobs {
+		raw = append(raw, data...)
+	}
+	for _, secret := range []string{"sk-live-123456", "tok-abcdef", "Bearer xyz", "opaque-value", "not a blob"} {
+		if strings.Contains(string(raw), secret) {
+			t.Errorf("archive still contains %q: %s", secret, raw)
+		}
+	}
+	if archived.Event["msg"] != "hi" {
+		t.Errorf("expected non-secret event data to be kept, got %v", archived.Event)
+	}
+
+	// Import into an empty environment
+	dstDir := t.TempDir()
+	SetFlowsDir(dstDir)
+	dst := storage.NewMemoryStorage()
+	dstCtx := WithStore(context.Background(), dst)
+	result, err := ImportRun(dstCtx, bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ImportRun failed: %v", err)
+	}
+	if result.RunID != run.ID || result.Steps != 1 || result.Blobs != 2 {
+		t.Errorf("unexpected import result: %+v", result)
+	}
+	if result.FlowWritten != filepath.Join(dstDir, "archived.flow.yaml") {
+		t.Errorf("expected flow to be written to the empty flows dir, got %q", result.FlowWritten)
+	}
+
+	imported, err := dst.GetRun(dstCtx, run.ID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if imported.Status != model.RunSucceeded || imported.FlowName != "archived" {
+		t.Errorf("unexpected imported run: %+v", imported)
+	}
+	steps, _ := dst.GetSteps(dstCtx, run.ID)
+	if len(steps) != 1 {
+		t.Fatalf("expected 1 imported step, got %d", len(steps))
+	}
+	newURL, _ := steps[0].Outputs["file"].(string)
+	if newURL == "file://"+blobPath || !strings.HasPrefix(newURL, "file://") {
+		t.Fatalf("expected blob reference to be rewritten, got %q", newURL)
+	}
+	defer os.Remove(strings.TrimPrefix(newURL, "file://"))
+	if ref, _ := steps[0].Outputs["response"].(map[string]any)["$blob"].(map[string]any); ref != nil {
+		defer os.Remove(strings.TrimPrefix(ref["url"].(string), "file://"))
+	}
+	data, err := os.ReadFile(strings.TrimPrefix(newURL, "file://"))
+	if err != nil || string(data) != "quarterly numbers for [REDACTED]" {
+		t.Errorf("expected imported blob content, got %q, %v", data, err)
+	}
+
+	if _, err := ImportRun(dstCtx, bytes.NewReader(buf.Bytes())); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("expected duplicate import to fail, got %v", err)
+	}
+}
+
+func TestExportRun_NotFound(t *testing.T) {
+	ctx := WithStore(context.Background(), storage.NewMemoryStorage())
+	var buf bytes.Buffer
+	if _, err := ExportRun(ctx, uuid.New(), &buf); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found error, got %v", err)
+	}
+}
+
+func TestImportRun_InvalidArchive(t *testing.T) {
+	ctx := WithStore(context.Background(), storage.NewMemoryStorage())
+	if _, err := ImportRun(ctx, strings.NewReader("not an archive")); err == nil {
+		t.Errorf("expected error for invalid archive")
+	}
+}
+
+func TestImportRun_RejectsUnsafeFlowName(t *testing.T) {
+	ctx := WithStore(context.Background(), storage.NewMemoryStorage())
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	run := &model.Run{ID: uuid.New(), FlowName: "../../escaped", Status: model.RunSucceeded}
+	writeArchiveJSON(tw, archiveManifestFile, &RunArchiveManifest{Format: runArchiveFormat, Version: runArchiveVersion, RunID: run.ID})
+	writeArchiveJSON(tw, archiveRunFile, run)
+	writeArchiveFile(tw, archiveFlowFile, []byte("name: escaped\n"))
+	tw.Close()
+	gz.Close()
+
+	if _, err := ImportRun(ctx, &buf); err == nil || !strings.Contains(err.Error(), "invalid flow name") {
+		t.Fatalf("expected the flow name to be rejected, got %v", err)
+	}
+	if _, err := GetStoreFromContext(ctx).GetRun(ctx, run.ID); err == nil {
+		t.Error("expected nothing to be stored for a rejected archive")
+	}
+}
+
+func TestRedactor_SensitiveKeys(t *testing.T) {
+	r := &redactor{}
+	out := asMap(r.redact(map[string]any{
+		"api-key": "k",
+		"nested":  map[string]any{"password": "p", "user": "u"},
+		"list":    []any{map[string]any{"client_secret": "s"}},
+		"empty":   nil,
+	}))
+	if out["api-key"] != redactedValue {
+		t.Errorf("expected api-key redacted, got %v", out["api-key"])
+	}
+	nested := asMap(out["nested"])
+	if nested["password"] != redactedValue || nested["user"] != "u" {
+		t.Errorf("unexpected nested redaction: %v", nested)
+	}
+	if item := asMap(out["list"].([]any)[0]); item["client_secret"] != redactedValue {
+		t.Errorf("expected secrets inside lists redacted, got %v", item)
+	}
+	if r.count != 3 {
+		t.Errorf("expected 3 redactions, got %d", r.count)
+	}
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/utils"
+)
+
+// defaultBlobGCMinAge is the grace period `flow blobs gc` gives new blobs. It protects blobs
+// written by runs that are still executing, whose outputs have not been persisted yet and so
+// cannot be seen as references.
+const defaultBlobGCMinAge = time.Hour
+
+// BlobGCOptions controls GCBlobs.
+type BlobGCOptions struct {
+	DryRun bool          // report what would be deleted without deleting it
+	MinAge time.Duration // only delete blobs older than this
+	Prefix string        // only consider blobs whose key starts with this
+}
+
+// BlobGCResult reports what GCBlobs found and removed.
+type BlobGCResult struct {
+	Scanned    int      `json:"scanned"`
+	Referenced int      `json:"referenced"`
+	Deleted    []string `json:"deleted"`
+	FreedBytes int64    `json:"freedBytes"`
+	DryRun     bool     `json:"dryRun,omitempty"`
+}
+
+// GCBlobs deletes blobs that no retained run refers to. References are collected from the
+// event, vars and step outputs of every stored run and from the state of paused runs, so
+// deleting a run makes the blobs only it used eligible for collection.
+func GCBlobs(ctx context.Context, opts BlobGCOptions) (*BlobGCResult, error) {
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	blobStore, err := blobStoreFromConfig(ctx, configFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("blob store unavailable: %w", err)
+	}
+	lister, ok := blobStore.(blob.StreamingBlobStore)
+	if !ok {
+		return nil, fmt.Errorf("the configured blob store does not support listing")
+	}
+
+	referenced := make(map[string]bool)
+	runs, err := store.ListRuns(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	for _, run := range runs {
+		steps, err := store.GetSteps(ctx, run.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load steps of run %s: %w", run.ID, err)
+		}
+		withSteps := *run
+		withSteps.Steps = make([]model.StepRun, 0, len(steps))
+		for _, step := range steps {
+			withSteps.Steps = append(withSteps.Steps, *step)
+		}
+		for _, url := range collectBlobURLs(&withSteps) {
+			referenced[url] = true
+		}
+	}
+	paused, err := store.LoadPausedRuns(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load paused runs: %w", err)
+	}
+	for _, raw := range paused {
+		// Paused states are storage structs or maps holding the engine's StepContext; a JSON
+		// round trip turns them into plain maps and slices that mapStrings can walk.
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode paused run: %w", err)
+		}
+		var state any
+		if err := json.Unmarshal(data, &state); err != nil {
+			return nil, fmt.Errorf("failed to decode paused run: %w", err)
+		}
+		mapStrings(state, func(s string) string {
+			if blob.IsBlobURL(s) {
+				referenced[s] = true
+			}
+			return s
+		})
+	}
+
+	infos, err := lister.List(ctx, opts.Prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list blobs: %w", err)
+	}
+	result := &BlobGCResult{Scanned: len(infos), Deleted: []string{}, DryRun: opts.DryRun}
+	cutoff := time.Now().Add(-opts.MinAge)
+	for _, info := range infos {
+		if referenced[info.URL] {
+			result.Referenced++
+			continue
+		}
+		if info.ModTime.After(cutoff) {
+			continue
+		}
+		if !opts.DryRun {
+			if err := lister.Delete(ctx, info.URL); err != nil {
+				utils.WarnCtx(ctx, "Failed to delete unreferenced blob", "url", info.URL, "error", err)
+				continue
+			}
+		}
+		result.Deleted = append(result.Deleted, info.URL)
+		result.FreedBytes += info.Size
+	}
+	return result, nil
+}
+
+// SignedBlobURL is a time-limited HTTP URL for a blob.
+type SignedBlobURL struct {
+	URL     string    `json:"url"`
+	Expires time.Time `json:"expires"`
+}
+
+// SignBlobURL returns a URL anyone can download the blob at blobURL from until ttl has passed.
+// A ttl of 0 uses blob.DefaultPresignTTL.
+func SignBlobURL(ctx context.Context, blobURL string, ttl time.Duration) (*SignedBlobURL, error) {
+	if ttl == 0 {
+		ttl = blob.DefaultPresignTTL
+	}
+	blobStore, err := blobStoreFromConfig(ctx, configFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("blob store unavailable: %w", err)
+	}
+	signed, err := blob.PresignURL(ctx, blobStore, blobURL, ttl)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedBlobURL{URL: signed, Expires: time.Now().Add(ttl).UTC().Truncate(time.Second)}, nil
+}
+
+// blobServer is the blob store and URL signer serveBlobHTTPHandler downloads through. The
+// running server builds it once in InitializeDependencies.
+type blobServer struct {
+	store  blob.StreamingBlobStore
+	signer *blob.URLSigner
+}
+
+var (
+	sharedBlobsMu sync.RWMutex
+	sharedBlobs   *blobServer
+)
+
+// newBlobServer pairs store with the signer the config's blob section describes. The signer
+// is nil when no signing key is configured.
+func newBlobServer(cfg *config.Config, store blob.BlobStore) (*blobServer, error) {
+	streaming, ok := store.(blob.StreamingBlobStore)
+	if !ok {
+		return nil, fmt.Errorf("blob store cannot serve downloads")
+	}
+	blobConfig, err := blobConfigFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	srv := &blobServer{store: streaming}
+	if blobConfig != nil {
+		if srv.signer, err = blobConfig.URLSigner(); err != nil {
+			return nil, err
+		}
+	}
+	return srv, nil
+}
+
+func setSharedBlobServer(srv *blobServer) {
+	sharedBlobsMu.Lock()
+	defer sharedBlobsMu.Unlock()
+	sharedBlobs = srv
+}
+
+// releaseSharedBlobServer unsets srv as the shared blob server, unless another one replaced it.
+func releaseSharedBlobServer(srv *blobServer) {
+	sharedBlobsMu.Lock()
+	defer sharedBlobsMu.Unlock()
+	if sharedBlobs == srv {
+		sharedBlobs = nil
+	}
+}
+
+func sharedBlobServer() *blobServer {
+	sharedBlobsMu.RLock()
+	defer sharedBlobsMu.RUnlock()
+	return sharedBlobs
+}
+
+// serveBlobHTTPHandler serves GET /blobs/{key...} to holders of a URL signed by the server's
+// blob.URLSigner.
+func serveBlobHTTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	srv := sharedBlobServer()
+	if srv == nil {
+		http.Error(w, "blob store unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if srv.signer == nil {
+		http.Error(w, "blob downloads are not enabled; set blob.signingKey", http.StatusNotFound)
+		return
+	}
+	key := r.PathValue("key")
+	if err := srv.signer.Verify(key, r.URL.Query().Get("expires"), r.URL.Query().Get("sig"), time.Now()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	blobURL, err := srv.store.KeyURL(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	info, err := srv.store.Stat(ctx, blobURL)
+	if errors.Is(err, blob.ErrBlobNotFound) {
+		http.Error(w, "blob not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rc, err := srv.store.Open(ctx, info.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	mimeType := info.Mime
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": path.Base(key)}))
+	// Blobs hold arbitrary flow output; never let them run as pages on this origin
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", info.ModTime, rs)
+		return
+	}
+	// Not seekable, as with decrypting readers. info.Size may be the stored (encrypted) size,
+	// so leave out Content-Length and let the response be chunked.
+	if _, err := io.Copy(w, rc); err != nil {
+		utils.Error("Failed to stream blob %s: %v", key, err)
+	}
+}
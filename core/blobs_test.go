@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/dsl"
+	"github.com/awantoch/beemflow/encryption"
+	"github.com/awantoch/beemflow/engine"
+	"github.com/awantoch/beemflow/event"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+	"github.com/google/uuid"
+)
+
+func TestGCBlobs(t *testing.T) {
+	cfg := &config.Config{Blob: &config.BlobConfig{Directory: t.TempDir(), ContentAddressed: true}}
+	store := storage.NewMemoryStorage()
+	ctx := WithConfig(WithStore(context.Background(), store), cfg)
+
+	blobStore, err := blobStoreFromConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("blobStoreFromConfig failed: %v", err)
+	}
+	kept, err := blobStore.Put(ctx, []byte("still needed"), "text/plain", "")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	orphan, err := blobStore.Put(ctx, []byte("run was deleted"), "text/plain", "")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	run := &model.Run{ID: uuid.New(), FlowName: "f", Status: model.RunSucceeded, StartedAt: time.Now()}
+	if err := store.SaveRun(ctx, run); err != nil {
+		t.Fatalf("SaveRun failed: %v", err)
+	}
+	step := &model.StepRun{
+		ID:       uuid.New(),
+		RunID:    run.ID,
+		StepName: "s1",
+		Status:   model.StepSucceeded,
+		Outputs:  map[string]any{"report": model.BlobRef{URL: kept, Mime: "text/plain"}.Map()},
+	}
+	if err := store.SaveStep(ctx, step); err != nil {
+		t.Fatalf("SaveStep failed: %v", err)
+	}
+
+	// New blobs are protected by the grace period
+	result, err := GCBlobs(ctx, BlobGCOptions{MinAge: time.Hour})
+	if err != nil {
+		t.Fatalf("GCBlobs failed: %v", err)
+	}
+	if result.Scanned != 2 || result.Referenced != 1 || len(result.Deleted) != 0 {
+		t.Errorf("unexpected result with grace period: %+v", result)
+	}
+
+	result, err = GCBlobs(ctx, BlobGCOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("GCBlobs failed: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0] != orphan || result.FreedBytes != int64(len("run was deleted")) {
+		t.Errorf("unexpected dry-run result: %+v", result)
+	}
+	if _, err := blobStore.Get(ctx, orphan); err != nil {
+		t.Errorf("dry run deleted %s: %v", orphan, err)
+	}
+
+	if _, err := GCBlobs(ctx, BlobGCOptions{}); err != nil {
+		t.Fatalf("GCBlobs failed: %v", err)
+	}
+	if _, err := blobStore.Get(ctx, orphan); err == nil {
+		t.Errorf("expected %s to be deleted", orphan)
+	}
+	if _, err := blobStore.Get(ctx, kept); err != nil {
+		t.Errorf("referenced blob %s was deleted: %v", kept, err)
+	}
+	if infos, _ := blobStore.(blob.StreamingBlobStore).List(ctx, ""); len(infos) != 1 {
+		t.Errorf("expected 1 blob left, got %d", len(infos))
+	}
+}
+
+func TestGCBlobs_KeepsReusedBlobs(t *testing.T) {
+	dir := t.TempDir()
+	for _, encrypted := range []bool{false, true} {
+		cfg := &config.Config{Blob: &config.BlobConfig{Directory: dir, ContentAddressed: true}}
+		if encrypted {
+			keyFile := filepath.Join(dir, "keys.json")
+			if _, err := encryption.RotateKeyFile(keyFile); err != nil {
+				t.Fatalf("RotateKeyFile failed: %v", err)
+			}
+			cfg.Encryption = &config.EncryptionConfig{KeyFile: keyFile}
+			cfg.Blob.Directory = filepath.Join(dir, "encrypted")
+		}
+		ctx := WithConfig(WithStore(context.Background(), storage.NewMemoryStorage()), cfg)
+		blobStore, err := blobStoreFromConfig(ctx, cfg)
+		if err != nil {
+			t.Fatalf("blobStoreFromConfig failed: %v", err)
+		}
+		content := []byte(fmt.Sprintf("shared report %v", encrypted))
+		url, err := blobStore.Put(ctx, content, "text/plain", "")
+		if err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		// An unreferenced blob from long ago
+		old := time.Now().Add(-2 * time.Hour)
+		if err := os.Chtimes(strings.TrimPrefix(url, "file://"), old, old); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+
+		// A running step stores the same content before its outputs are saved
+		if reused, err := blobStore.Put(ctx, content, "text/plain", ""); err != nil || reused != url {
+			t.Fatalf("expected the existing blob to be reused, got %q: %v", reused, err)
+		}
+		result, err := GCBlobs(ctx, BlobGCOptions{MinAge: time.Hour})
+		if err != nil {
+			t.Fatalf("GCBlobs failed: %v", err)
+		}
+		if len(result.Deleted) != 0 {
+			t.Errorf("expected the reused blob to be kept by the grace period, deleted %v", result.Deleted)
+		}
+		if _, err := blobStore.Get(ctx, url); err != nil {
+			t.Errorf("reused blob %s was deleted: %v", url, err)
+		}
+	}
+}
+
+func TestGCBlobs_KeepsBlobsOfPausedRuns(t *testing.T) {
+	cfg := &config.Config{Blob: &config.BlobConfig{Directory: t.TempDir()}}
+	// SQLite returns paused runs as storage.PausedRunPersist structs
+	store, err := storage.NewSqliteStorage(filepath.Join(t.TempDir(), "gc.db"))
+	if err != nil {
+		t.Fatalf("NewSqliteStorage failed: %v", err)
+	}
+	defer store.Close()
+	ctx := WithConfig(WithStore(context.Background(), store), cfg)
+
+	blobStore, err := blobStoreFromConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("blobStoreFromConfig failed: %v", err)
+	}
+	eng := engine.NewEngine(engine.NewDefaultAdapterRegistry(ctx), dsl.NewTemplater(), event.NewInProcEventBus(), blobStore, store)
+	defer eng.Close()
+	eng.OffloadThreshold = 100
+
+	// The run pauses holding a $blob reference to its offloaded output. Deleting the run leaves
+	// the paused state as the only reference.
+	flow := &model.Flow{Name: "gc_paused", Steps: []model.Step{
+		{ID: "big", Use: "core.echo", With: map[string]any{"text": "{{ event.body }}"}},
+		{ID: "wait", AwaitEvent: &model.AwaitEventSpec{Source: "test", Match: map[string]any{"token": "gc-paused"}}},
+	}}
+	if _, err := eng.Execute(ctx, flow, map[string]any{"body": strings.Repeat("a", 500)}); err == nil {
+		t.Fatal("expected the run to pause")
+	}
+	runs, err := store.ListRuns(ctx)
+	if err != nil {
+		t.Fatalf("ListRuns failed: %v", err)
+	}
+	for _, run := range runs {
+		if err := store.DeleteRun(ctx, run.ID); err != nil {
+			t.Fatalf("DeleteRun failed: %v", err)
+		}
+	}
+
+	result, err := GCBlobs(ctx, BlobGCOptions{})
+	if err != nil {
+		t.Fatalf("GCBlobs failed: %v", err)
+	}
+	if result.Scanned != 1 || result.Referenced != 1 || len(result.Deleted) != 0 {
+		t.Errorf("expected the paused run's blob to survive, got %+v", result)
+	}
+}
+
+func TestGCBlobsHandler_InvalidMinAge(t *testing.T) {
+	if _, err := gcBlobsHandler(context.Background(), &GCBlobsArgs{MinAge: "soon"}); err == nil {
+		t.Error("expected error for invalid min age")
+	}
+}
+
+func TestServeBlob_SignedURL(t *testing.T) {
+	cfg := &config.Config{Blob: &config.BlobConfig{
+		Directory:  t.TempDir(),
+		SigningKey: "test-signing-key",
+		PublicURL:  "https://flows.example.com",
+	}}
+	ctx := WithConfig(context.Background(), cfg)
+	blobStore, err := blobStoreFromConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("blobStoreFromConfig failed: %v", err)
+	}
+	blobURL, err := blobStore.Put(ctx, []byte("<h1>report</h1>"), "text/html", "reports/q3.html")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+
+	signed, err := SignBlobURL(ctx, blobURL, time.Hour)
+	if err != nil {
+		t.Fatalf("SignBlobURL failed: %v", err)
+	}
+	if !strings.HasPrefix(signed.URL, "https://flows.example.com/blobs/reports/q3.html?") {
+		t.Errorf("unexpected signed URL %s", signed.URL)
+	}
+
+	srv, err := newBlobServer(cfg, blobStore)
+	if err != nil {
+		t.Fatalf("newBlobServer failed: %v", err)
+	}
+	setSharedBlobServer(srv)
+	defer releaseSharedBlobServer(srv)
+
+	op, ok := GetOperation(constants.InterfaceIDServeBlob)
+	if !ok {
+		t.Fatal("serveBlob operation not registered")
+	}
+	mux := http.NewServeMux()
+	GenerateHTTPHandlersForOperations(mux, map[string]*OperationDefinition{op.ID: op})
+	get := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(target, "https://flows.example.com"), nil)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req.WithContext(ctx))
+		return w
+	}
+
+	w := get(signed.URL)
+	if w.Code != http.StatusOK || w.Body.String() != "<h1>report</h1>" {
+		t.Fatalf("GET signed URL = %d %q", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("unexpected Content-Type %q", ct)
+	}
+	if w.Header().Get("Content-Security-Policy") != "sandbox" || w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Errorf("missing protective headers: %v", w.Header())
+	}
+
+	if w := get(strings.Replace(signed.URL, "sig=", "sig=x", 1)); w.Code != http.StatusForbidden {
+		t.Errorf("tampered signature: expected 403, got %d", w.Code)
+	}
+	if w := get(strings.Replace(signed.URL, "q3.html", "q4.html", 1)); w.Code != http.StatusForbidden {
+		t.Errorf("other key: expected 403, got %d", w.Code)
+	}
+	if err := blobStore.(blob.StreamingBlobStore).Delete(ctx, blobURL); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if w := get(signed.URL); w.Code != http.StatusNotFound {
+		t.Errorf("deleted blob: expected 404, got %d", w.Code)
+	}
+}
+
+func TestServeBlob_EncryptedStore(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.json")
+	if _, err := encryption.RotateKeyFile(keyFile); err != nil {
+		t.Fatalf("RotateKeyFile failed: %v", err)
+	}
+	cfg := &config.Config{
+		Blob:       &config.BlobConfig{Directory: filepath.Join(dir, "files"), SigningKey: "test-signing-key"},
+		Encryption: &config.EncryptionConfig{KeyFile: keyFile},
+	}
+	ctx := WithConfig(context.Background(), cfg)
+	blobStore, err := blobStoreFromConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("blobStoreFromConfig failed: %v", err)
+	}
+	content := strings.Repeat("quarterly numbers\n", 100)
+	blobURL, err := blobStore.Put(ctx, []byte(content), "text/plain", "reports/q3.txt")
+	if err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	srv, err := newBlobServer(cfg, blobStore)
+	if err != nil {
+		t.Fatalf("newBlobServer failed: %v", err)
+	}
+	setSharedBlobServer(srv)
+	defer releaseSharedBlobServer(srv)
+
+	signed, err := SignBlobURL(ctx, blobURL, time.Hour)
+	if err != nil {
+		t.Fatalf("SignBlobURL failed: %v", err)
+	}
+	op, _ := GetOperation(constants.InterfaceIDServeBlob)
+	mux := http.NewServeMux()
+	GenerateHTTPHandlersForOperations(mux, map[string]*OperationDefinition{op.ID: op})
+	req := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(signed.URL, "http://localhost:3333"), nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req.WithContext(ctx))
+
+	if w.Code != http.StatusOK || w.Body.String() != content {
+		t.Fatalf("GET signed URL = %d, %d bytes; want the %d decrypted bytes", w.Code, w.Body.Len(), len(content))
+	}
+	// The stored size is the ciphertext's, so the length must not be declared up front
+	if cl := w.Header().Get("Content-Length"); cl != "" {
+		t.Errorf("expected no Content-Length for a decrypted stream, got %s", cl)
+	}
+}
+
+func TestSignBlobURL_NoSigningKey(t *testing.T) {
+	cfg := &config.Config{Blob: &config.BlobConfig{Directory: t.TempDir()}}
+	ctx := WithConfig(context.Background(), cfg)
+	blobStore, _ := blobStoreFromConfig(ctx, cfg)
+	blobURL, _ := blobStore.Put(ctx, []byte("x"), "text/plain", "x.txt")
+	if _, err := SignBlobURL(ctx, blobURL, 0); !errors.Is(err, blob.ErrPresignUnsupported) {
+		t.Errorf("expected ErrPresignUnsupported, got %v", err)
+	}
+}
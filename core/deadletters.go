@@ -0,0 +1,70 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/awantoch/beemflow/model"
+)
+
+// ReplayResult reports the dead letters ReplayDeadLetters published again.
+type ReplayResult struct {
+	Replayed []string `json:"replayed"`
+}
+
+// ListDeadLetters returns the events whose subscribers failed on every delivery attempt,
+// oldest first.
+func ListDeadLetters(ctx context.Context) ([]*model.DeadLetter, error) {
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.ListDeadLetters(ctx)
+}
+
+// ReplayDeadLetters publishes the dead letter with the given ID, or all of them, to its
+// original topic again and removes it from the store. Every subscriber of the topic gets the
+// event again, not just the one that failed. With the in-memory driver, replay through the
+// server so the event reaches its subscribers.
+func ReplayDeadLetters(ctx context.Context, id string, all bool) (*ReplayResult, error) {
+	if (id == "") == !all {
+		return nil, fmt.Errorf("specify either a dead letter ID or all")
+	}
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var letters []*model.DeadLetter
+	if all {
+		if letters, err = store.ListDeadLetters(ctx); err != nil {
+			return nil, err
+		}
+	} else {
+		dl, err := store.GetDeadLetter(ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", err, id)
+		}
+		letters = []*model.DeadLetter{dl}
+	}
+
+	result := &ReplayResult{Replayed: []string{}}
+	if len(letters) == 0 {
+		return result, nil
+	}
+	bus, release, err := publishBus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	for _, dl := range letters {
+		// The payload is the published message body, so publishing it as-is recreates the event
+		if err := bus.Publish(dl.Topic, dl.Payload); err != nil {
+			return result, fmt.Errorf("failed to replay dead letter %s: %w", dl.ID, err)
+		}
+		if err := store.DeleteDeadLetter(ctx, dl.ID); err != nil {
+			return result, fmt.Errorf("replayed dead letter %s but failed to remove it: %w", dl.ID, err)
+		}
+		result.Replayed = append(result.Replayed, dl.ID)
+	}
+	return result, nil
+}
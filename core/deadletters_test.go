@@ -0,0 +1,107 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/event"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+)
+
+func TestDeadLetters_TriggerFailureAndReplay(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldDir := flowsDir
+	SetFlowsDir(tmpDir)
+	defer SetFlowsDir(oldDir)
+
+	flowPath := filepath.Join(tmpDir, "order_audit.flow.yaml")
+	flowYAML := []byte(`name: order_audit
+on:
+  - event: orders.*
+steps:
+  - id: log
+    use: core.echo
+    with:
+      text: "{{ event.id }}"
+`)
+	if err := os.WriteFile(flowPath, flowYAML, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := storage.NewMemoryStorage()
+	ctx := WithConfig(WithStore(context.Background(), store), &config.Config{})
+	bus := event.NewInProcEventBus()
+	defer bus.Close()
+	bus.SetRedeliveryPolicy(event.RedeliveryPolicy{MaxAttempts: 2, Backoff: time.Millisecond})
+	bus.SetDeadLetterStore(store)
+	setSharedEventBus(bus)
+	defer releaseSharedEventBus(bus)
+
+	if _, err := SubscribeEventTriggers(ctx, bus); err != nil {
+		t.Fatalf("SubscribeEventTriggers failed: %v", err)
+	}
+	// The flow disappears after subscribing, so the triggered run can't start
+	if err := os.Remove(flowPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := PublishEvent(ctx, "orders.created", map[string]any{"id": "o1"}); err != nil {
+		t.Fatalf("PublishEvent failed: %v", err)
+	}
+
+	var letters []*model.DeadLetter
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if letters, _ = ListDeadLetters(ctx); len(letters) > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %+v", letters)
+	}
+	dl := letters[0]
+	if dl.Topic != "orders.created" || dl.Subscription != "orders.*" || dl.Attempts != 2 ||
+		!strings.Contains(dl.Error, "order_audit") {
+		t.Errorf("unexpected dead letter: %+v", dl)
+	}
+
+	if _, err := ReplayDeadLetters(ctx, "", false); err == nil {
+		t.Error("expected replay without an ID or all to fail")
+	}
+	if _, err := ReplayDeadLetters(ctx, "missing", false); !errors.Is(err, storage.ErrDeadLetterNotFound) {
+		t.Errorf("expected ErrDeadLetterNotFound, got %v", err)
+	}
+
+	if err := os.WriteFile(flowPath, flowYAML, 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := ReplayDeadLetters(ctx, dl.ID, false)
+	if err != nil {
+		t.Fatalf("ReplayDeadLetters failed: %v", err)
+	}
+	if len(result.Replayed) != 1 || result.Replayed[0] != dl.ID {
+		t.Errorf("unexpected replay result: %+v", result)
+	}
+	if _, err := store.GetDeadLetter(ctx, dl.ID); !errors.Is(err, storage.ErrDeadLetterNotFound) {
+		t.Errorf("expected the replayed dead letter to be removed, got %v", err)
+	}
+
+	var runs []*model.Run
+	deadline = time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if runs, _ = store.ListRuns(ctx); len(runs) > 0 && runs[0].Status == model.RunSucceeded {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(runs) != 1 || runs[0].Event["id"] != "o1" || runs[0].Event["topic"] != "orders.created" {
+		t.Fatalf("expected the replayed event to start the flow, got %+v", runs)
+	}
+}
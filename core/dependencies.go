@@ -2,16 +2,38 @@ package api
 
 import (
 	"context"
+	"fmt"
 	"io"
 
 	"github.com/awantoch/beemflow/blob"
 	"github.com/awantoch/beemflow/config"
 	"github.com/awantoch/beemflow/dsl"
+	"github.com/awantoch/beemflow/encryption"
 	beemengine "github.com/awantoch/beemflow/engine"
 	"github.com/awantoch/beemflow/event"
+	"github.com/awantoch/beemflow/storage"
 	"github.com/awantoch/beemflow/utils"
 )
 
+// attachEventStore has bus dead-letter failed deliveries to store and, when the config enables
+// the event log, record published events there.
+func attachEventStore(ctx context.Context, bus event.EventBus, store storage.Storage, cfg *config.Config) {
+	wb, ok := bus.(*event.WatermillEventBus)
+	if !ok {
+		return
+	}
+	wb.SetDeadLetterStore(store)
+	if cfg == nil || cfg.Event == nil || !cfg.Event.Log {
+		return
+	}
+	retention, err := event.LogRetentionFromConfig(cfg.Event)
+	if err != nil {
+		utils.WarnCtx(ctx, "Invalid event log retention, using the default", "error", err)
+		retention = event.DefaultLogRetention
+	}
+	wb.SetEventLog(store, retention)
+}
+
 // InitializeDependencies sets up all the heavy dependencies (engine, storage, etc.)
 // Returns a cleanup function that should be called when shutting down
 func InitializeDependencies(cfg *config.Config) (func(), error) {
@@ -32,32 +54,60 @@ func InitializeDependencies(cfg *config.Config) (func(), error) {
 	} else {
 		bus = event.NewInProcEventBus()
 	}
+	attachEventStore(context.Background(), bus, store, cfg)
 
 	// Initialize blob store
-	var blobStore blob.BlobStore
-	blobConfig := (*blob.BlobConfig)(nil)
-	if cfg.Blob != nil {
-		blobConfig = &blob.BlobConfig{
-			Driver: cfg.Blob.Driver,
-			Bucket: cfg.Blob.Bucket,
-		}
-	}
-	blobStore, err = blob.NewDefaultBlobStore(context.Background(), blobConfig)
+	blobStore, err := blobStoreFromConfig(context.Background(), cfg)
 	if err != nil {
 		utils.WarnCtx(context.Background(), "Failed to create blob store: %v, using nil fallback", "error", err)
 		blobStore = nil
 	}
 
+	// Serve signed blob downloads from the same store
+	var blobs *blobServer
+	if blobStore != nil {
+		if blobs, err = newBlobServer(cfg, blobStore); err != nil {
+			utils.WarnCtx(context.Background(), "Blob downloads disabled", "error", err)
+		} else {
+			setSharedBlobServer(blobs)
+		}
+	}
+
 	// Create engine
 	adapters := beemengine.NewDefaultAdapterRegistry(context.Background())
 	templ := dsl.NewTemplater()
 	engine := beemengine.NewEngine(adapters, templ, bus, blobStore, store)
+	configureOffload(engine, cfg)
+
+	// Resume runs that paused before this process started on their source events too
+	if err := engine.RestorePausedRuns(context.Background()); err != nil {
+		utils.WarnCtx(context.Background(), "Failed to restore paused runs", "error", err)
+	}
+
+	// Start flows on the events they subscribe to, and let PublishEvent reach them
+	triggerCtx := WithConfig(WithStore(context.Background(), store), cfg)
+	triggers, err := subscribeTriggers(triggerCtx, bus)
+	if err != nil {
+		utils.WarnCtx(triggerCtx, "Failed to subscribe event triggers", "error", err)
+	} else {
+		setSharedTriggers(triggers)
+	}
+	setSharedEventBus(bus)
 
 	// Return cleanup function
 	cleanup := func() {
+		if triggers != nil {
+			releaseSharedTriggers(triggers)
+			triggers.close()
+		}
+		releaseSharedEventBus(bus)
+		releaseSharedBlobServer(blobs)
 		if err := engine.Close(); err != nil {
 			utils.Error("Failed to close engine: %v", err)
 		}
+		if err := bus.Close(); err != nil {
+			utils.Error("Failed to close event bus: %v", err)
+		}
 		if store != nil {
 			if closer, ok := store.(io.Closer); ok {
 				if err := closer.Close(); err != nil {
@@ -76,3 +126,74 @@ func InitializeDependencies(cfg *config.Config) (func(), error) {
 
 	return cleanup, nil
 }
+
+// blobStoreFromConfig builds the blob store described by the config's blob section.
+func blobStoreFromConfig(ctx context.Context, cfg *config.Config) (blob.BlobStore, error) {
+	blobConfig, err := blobConfigFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return blob.NewDefaultBlobStore(ctx, blobConfig)
+}
+
+// blobConfigFromConfig maps the config's blob and encryption sections to the blob package's
+// configuration, or returns nil for the default store.
+func blobConfigFromConfig(cfg *config.Config) (*blob.BlobConfig, error) {
+	if cfg == nil || (cfg.Blob == nil && cfg.Encryption == nil) {
+		return nil, nil
+	}
+	env, err := envelopeFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Blob == nil {
+		return &blob.BlobConfig{Envelope: env}, nil
+	}
+	publicURL := cfg.Blob.PublicURL
+	if publicURL == "" {
+		port := 3333 // the HTTP server's default
+		if cfg.HTTP != nil && cfg.HTTP.Port != 0 {
+			port = cfg.HTTP.Port
+		}
+		publicURL = fmt.Sprintf("http://localhost:%d", port)
+	}
+	return &blob.BlobConfig{
+		Driver:          cfg.Blob.Driver,
+		Directory:       cfg.Blob.Directory,
+		Bucket:          cfg.Blob.Bucket,
+		Region:          cfg.Blob.Region,
+		Endpoint:        cfg.Blob.Endpoint,
+		PathStyle:       cfg.Blob.PathStyle,
+		Prefix:          cfg.Blob.Prefix,
+		AccessKeyID:     cfg.Blob.AccessKeyID,
+		SecretAccessKey: cfg.Blob.SecretAccessKey,
+		SessionToken:    cfg.Blob.SessionToken,
+		Encryption:      blob.S3Encryption{Mode: cfg.Blob.SSE, KMSKeyID: cfg.Blob.SSEKMSKeyID},
+
+		ContentAddressed: cfg.Blob.ContentAddressed,
+
+		PublicURL:  publicURL,
+		SigningKey: cfg.Blob.SigningKey,
+
+		Envelope: env,
+	}, nil
+}
+
+// envelopeFromConfig returns the envelope for at-rest encryption, or nil if the config has no
+// encryption section.
+func envelopeFromConfig(cfg *config.Config) (*encryption.Envelope, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	return encryption.NewFromConfig(context.Background(), cfg.Encryption)
+}
+
+// configureOffload applies the blob section's output offload threshold and URL fetch limits
+// to eng.
+func configureOffload(eng *beemengine.Engine, cfg *config.Config) {
+	if cfg == nil || cfg.Blob == nil {
+		return
+	}
+	eng.OffloadThreshold = cfg.Blob.OffloadThreshold
+	eng.BlobFetch = blob.FetchPolicy{MaxBytes: cfg.Blob.FetchMaxBytes, AllowPrivate: cfg.Blob.FetchAllowPrivate}
+}
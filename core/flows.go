@@ -0,0 +1,216 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/awantoch/beemflow/dsl"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+)
+
+// SaveFlow validates source and stores it as the next version of the named flow in the flow
+// repository. Saving a definition identical to the latest version returns that version unchanged.
+func SaveFlow(ctx context.Context, name, source string) (*model.FlowVersion, error) {
+	if err := validateFlowName(name); err != nil {
+		return nil, err
+	}
+	flow, err := dsl.ParseFromString(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid flow: %w", err)
+	}
+	if flow.Name != name {
+		return nil, fmt.Errorf("invalid flow: name %q does not match %q", flow.Name, name)
+	}
+	if err := dsl.Validate(flow); err != nil {
+		return nil, fmt.Errorf("invalid flow: %w", err)
+	}
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fv := &model.FlowVersion{FlowName: name, Hash: model.FlowHash(source), Source: source}
+	if err := store.SaveFlowVersion(ctx, fv); err != nil {
+		return nil, err
+	}
+	invalidateEventSchemas()
+	refreshEventTriggers(ctx)
+	return fv, nil
+}
+
+// DeleteFlow removes a flow from the flow repository, including its version history, and
+// deletes its file from the flows directory. Runs keep the version number they were pinned to.
+func DeleteFlow(ctx context.Context, name string) error {
+	if err := validateFlowName(name); err != nil {
+		return err
+	}
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return err
+	}
+	storeErr := store.DeleteFlow(ctx, name)
+	if storeErr != nil && !errors.Is(storeErr, storage.ErrFlowNotFound) {
+		return storeErr
+	}
+	fileErr := os.Remove(buildFlowPath(name))
+	if fileErr != nil && !os.IsNotExist(fileErr) {
+		return fileErr
+	}
+	if storeErr != nil && fileErr != nil {
+		return fmt.Errorf("flow %s not found", name)
+	}
+	invalidateEventSchemas()
+	refreshEventTriggers(ctx)
+	return nil
+}
+
+// ListFlowVersions returns the stored version history of a flow, newest first.
+func ListFlowVersions(ctx context.Context, name string) ([]*model.FlowVersion, error) {
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.ListFlowVersions(ctx, name)
+}
+
+// DiffFlowVersions returns a line diff between two stored versions of a flow. A zero `to`
+// selects the latest version and a zero `from` the one before `to`.
+func DiffFlowVersions(ctx context.Context, name string, from, to int) (string, error) {
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return "", err
+	}
+	newer, err := store.GetFlowVersion(ctx, name, to)
+	if err != nil {
+		return "", fmt.Errorf("flow %s version %d: %w", name, to, err)
+	}
+	if from == 0 {
+		from = newer.Version - 1
+	}
+	older := &model.FlowVersion{FlowName: name}
+	if from > 0 {
+		if older, err = store.GetFlowVersion(ctx, name, from); err != nil {
+			return "", fmt.Errorf("flow %s version %d: %w", name, from, err)
+		}
+	}
+	return diffLines(
+		fmt.Sprintf("%s@%d", name, older.Version), older.Source,
+		fmt.Sprintf("%s@%d", name, newer.Version), newer.Source,
+	), nil
+}
+
+// loadFlow returns the current definition of a flow with Origin set to the source it was parsed
+// from. Both the flow repository and the flows directory are consulted; when they disagree the
+// more recently changed definition wins, so editing a file still takes effect after the flow
+// was published. Returns nil, nil when the flow exists in neither.
+func loadFlow(ctx context.Context, store storage.Storage, name string) (*model.Flow, error) {
+	origin, err := store.GetFlowVersion(ctx, name, 0)
+	if errors.Is(err, storage.ErrFlowNotFound) {
+		origin = nil
+	} else if err != nil {
+		return nil, err
+	}
+	path := buildFlowPath(name)
+	if info, statErr := os.Stat(path); statErr == nil && (origin == nil || info.ModTime().After(origin.CreatedAt)) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if hash := model.FlowHash(string(data)); origin == nil || origin.Hash != hash {
+			origin = &model.FlowVersion{FlowName: name, Hash: hash, Source: string(data)}
+		}
+	} else if statErr != nil && !os.IsNotExist(statErr) && origin == nil {
+		return nil, statErr
+	}
+	if origin == nil {
+		return nil, nil
+	}
+	return parseFlowVersion(origin)
+}
+
+// loadFlowVersion returns a specific stored version of a flow.
+func loadFlowVersion(ctx context.Context, store storage.Storage, name string, version int) (*model.Flow, error) {
+	fv, err := store.GetFlowVersion(ctx, name, version)
+	if err != nil {
+		return nil, err
+	}
+	return parseFlowVersion(fv)
+}
+
+func parseFlowVersion(fv *model.FlowVersion) (*model.Flow, error) {
+	flow, err := dsl.ParseFromString(fv.Source)
+	if err != nil {
+		return nil, err
+	}
+	flow.Origin = fv
+	return flow, nil
+}
+
+// publishFlow stores a flow read from the flows directory in the flow repository, so that every
+// run is pinned to the version it executed and runs executed elsewhere (e.g. by queue workers
+// on other hosts) can load the exact same version.
+func publishFlow(ctx context.Context, store storage.Storage, flow *model.Flow) error {
+	if flow.Origin == nil || flow.Origin.Version > 0 {
+		return nil
+	}
+	return store.SaveFlowVersion(ctx, flow.Origin)
+}
+
+// validateFlowName rejects names that can't safely be used as a flow file name.
+func validateFlowName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid flow name %q", name)
+	}
+	return nil
+}
+
+// diffLines renders a line diff of two texts: unchanged lines are prefixed with a space,
+// removed lines with '-' and added lines with '+'.
+func diffLines(oldName, oldText, newName, newText string) string {
+	a, b := splitLines(oldText), splitLines(newText)
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", oldName, newName)
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			sb.WriteString(" " + a[i] + "\n")
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			sb.WriteString("-" + a[i] + "\n")
+			i++
+		default:
+			sb.WriteString("+" + b[j] + "\n")
+			j++
+		}
+	}
+	return sb.String()
+}
+
+func splitLines(s string) []string {
+	s = strings.TrimSuffix(s, "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,243 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+	"github.com/awantoch/beemflow/worker"
+)
+
+func echoFlowYAML(name, text string) string {
+	return "name: " + name + "\non: cli.manual\nsteps:\n  - id: s1\n    use: core.echo\n    with:\n      text: \"" + text + "\"\n"
+}
+
+func TestSaveFlow_VersionsAndDiff(t *testing.T) {
+	SetFlowsDir(t.TempDir())
+	defer SetFlowsDir(config.DefaultFlowsDir)
+	ctx := WithStore(context.Background(), storage.NewMemoryStorage())
+
+	v1, err := SaveFlow(ctx, "greet", echoFlowYAML("greet", "hello"))
+	if err != nil {
+		t.Fatalf("SaveFlow failed: %v", err)
+	}
+	if v1.Version != 1 || v1.Hash != model.FlowHash(echoFlowYAML("greet", "hello")) {
+		t.Errorf("unexpected first version: %+v", v1)
+	}
+	if again, _ := SaveFlow(ctx, "greet", echoFlowYAML("greet", "hello")); again.Version != 1 {
+		t.Errorf("expected identical save to return version 1, got %d", again.Version)
+	}
+	if v2, err := SaveFlow(ctx, "greet", echoFlowYAML("greet", "goodbye")); err != nil || v2.Version != 2 {
+		t.Fatalf("expected version 2, got %+v, %v", v2, err)
+	}
+
+	versions, err := ListFlowVersions(ctx, "greet")
+	if err != nil || len(versions) != 2 || versions[0].Version != 2 {
+		t.Errorf("expected two versions newest first, got %+v, %v", versions, err)
+	}
+
+	diff, err := DiffFlowVersions(ctx, "greet", 0, 0)
+	if err != nil {
+		t.Fatalf("DiffFlowVersions failed: %v", err)
+	}
+	for _, want := range []string{"--- greet@1", "+++ greet@2", "-      text: \"hello\"", "+      text: \"goodbye\"", " name: greet"} {
+		if !strings.Contains(diff, want) {
+			t.Errorf("expected diff to contain %q, got:\n%s", want, diff)
+		}
+	}
+	if _, err := DiffFlowVersions(ctx, "greet", 1, 5); err == nil {
+		t.Errorf("expected error diffing a missing version")
+	}
+
+	flows, err := ListFlows(ctx)
+	if err != nil || len(flows) != 1 || flows[0] != "greet" {
+		t.Errorf("expected stored flow to be listed, got %v, %v", flows, err)
+	}
+}
+
+func TestSaveFlow_Invalid(t *testing.T) {
+	ctx := WithStore(context.Background(), storage.NewMemoryStorage())
+	cases := map[string][2]string{
+		"name mismatch": {"greet", echoFlowYAML("other", "hi")},
+		"bad yaml":      {"greet", "not: [valid: yaml"},
+		"path name":     {"../greet", echoFlowYAML("../greet", "hi")},
+	}
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := SaveFlow(ctx, c[0], c[1]); err == nil {
+				t.Errorf("expected SaveFlow to reject %s", name)
+			}
+		})
+	}
+}
+
+func TestGetFlow_NewestDefinitionWins(t *testing.T) {
+	dir := t.TempDir()
+	SetFlowsDir(dir)
+	defer SetFlowsDir(config.DefaultFlowsDir)
+	ctx := WithStore(context.Background(), storage.NewMemoryStorage())
+
+	path := filepath.Join(dir, "greet.flow.yaml")
+	if err := os.WriteFile(path, []byte(echoFlowYAML("greet", "from file")), 0644); err != nil {
+		t.Fatalf("os.WriteFile failed: %v", err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("os.Chtimes failed: %v", err)
+	}
+	if _, err := SaveFlow(ctx, "greet", echoFlowYAML("greet", "from storage")); err != nil {
+		t.Fatalf("SaveFlow failed: %v", err)
+	}
+	flow, err := GetFlow(ctx, "greet")
+	if err != nil || flow.Steps[0].With["text"] != "from storage" {
+		t.Fatalf("expected the newer stored version, got %v, %v", flow.Steps, err)
+	}
+
+	// Editing the file afterwards takes precedence again
+	if err := os.WriteFile(path, []byte(echoFlowYAML("greet", "edited")), 0644); err != nil {
+		t.Fatalf("os.WriteFile failed: %v", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatalf("os.Chtimes failed: %v", err)
+	}
+	if flow, _ = GetFlow(ctx, "greet"); flow.Steps[0].With["text"] != "edited" {
+		t.Errorf("expected the edited file, got %v", flow.Steps)
+	}
+
+	if flows, _ := ListFlows(ctx); len(flows) != 1 {
+		t.Errorf("expected a flow in both places to be listed once, got %v", flows)
+	}
+}
+
+func TestStartRun_PinsFlowVersion(t *testing.T) {
+	SetFlowsDir(t.TempDir())
+	defer SetFlowsDir(config.DefaultFlowsDir)
+	store := storage.NewMemoryStorage()
+	ctx := WithStore(context.Background(), store)
+
+	fv, err := SaveFlow(ctx, "pinned", echoFlowYAML("pinned", "v1"))
+	if err != nil {
+		t.Fatalf("SaveFlow failed: %v", err)
+	}
+	runID, err := StartRun(ctx, "pinned", map[string]any{})
+	if err != nil {
+		t.Fatalf("StartRun failed: %v", err)
+	}
+	run, err := store.GetRun(ctx, runID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if run.FlowVersion != fv.Version || run.FlowHash != fv.Hash {
+		t.Errorf("expected run pinned to version %d/%s, got %d/%s", fv.Version, fv.Hash, run.FlowVersion, run.FlowHash)
+	}
+}
+
+func TestStartRun_QueueModeRunsPinnedVersion(t *testing.T) {
+	dir := t.TempDir()
+	SetFlowsDir(dir)
+	defer SetFlowsDir(config.DefaultFlowsDir)
+	if err := os.WriteFile(filepath.Join(dir, "pinned.flow.yaml"), []byte(echoFlowYAML("pinned", "v1")), 0644); err != nil {
+		t.Fatalf("os.WriteFile failed: %v", err)
+	}
+
+	store := storage.NewMemoryStorage()
+	ctx := WithConfig(WithStore(context.Background(), store), &config.Config{Queue: &config.QueueConfig{Enabled: true}})
+	runID, err := StartRun(ctx, "pinned", map[string]any{})
+	if err != nil {
+		t.Fatalf("StartRun failed: %v", err)
+	}
+	run, _ := store.GetRun(ctx, runID)
+	if run.FlowVersion != 1 {
+		t.Fatalf("expected enqueued run to publish and pin the flow file as version 1, got %d", run.FlowVersion)
+	}
+
+	// The flow changes before a worker picks the run up
+	if err := os.Remove(filepath.Join(dir, "pinned.flow.yaml")); err != nil {
+		t.Fatalf("os.Remove failed: %v", err)
+	}
+	if _, err := SaveFlow(ctx, "pinned", echoFlowYAML("pinned", "v2")); err != nil {
+		t.Fatalf("SaveFlow failed: %v", err)
+	}
+
+	w, err := NewWorker(ctx, worker.Options{ID: "test-worker"})
+	if err != nil {
+		t.Fatalf("NewWorker failed: %v", err)
+	}
+	if leased, err := w.ProcessNext(ctx); err != nil || !leased {
+		t.Fatalf("expected worker to process the queued run, got %v, %v", leased, err)
+	}
+	steps, _ := store.GetSteps(ctx, runID)
+	if len(steps) != 1 || steps[0].Outputs["text"] != "v1" {
+		t.Errorf("expected the worker to execute pinned version 1, got %+v", steps)
+	}
+}
+
+func TestDeleteFlow(t *testing.T) {
+	dir := t.TempDir()
+	SetFlowsDir(dir)
+	defer SetFlowsDir(config.DefaultFlowsDir)
+	ctx := WithStore(context.Background(), storage.NewMemoryStorage())
+
+	if err := os.WriteFile(filepath.Join(dir, "gone.flow.yaml"), []byte(echoFlowYAML("gone", "hi")), 0644); err != nil {
+		t.Fatalf("os.WriteFile failed: %v", err)
+	}
+	if _, err := SaveFlow(ctx, "gone", echoFlowYAML("gone", "hi")); err != nil {
+		t.Fatalf("SaveFlow failed: %v", err)
+	}
+	if err := DeleteFlow(ctx, "gone"); err != nil {
+		t.Fatalf("DeleteFlow failed: %v", err)
+	}
+	if flow, _ := GetFlow(ctx, "gone"); flow.Name != "" {
+		t.Errorf("expected flow to be gone, got %+v", flow)
+	}
+	if err := DeleteFlow(ctx, "gone"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("expected not found deleting twice, got %v", err)
+	}
+}
+
+func TestFlowRepositoryHTTPHandlers(t *testing.T) {
+	SetFlowsDir(t.TempDir())
+	defer SetFlowsDir(config.DefaultFlowsDir)
+	store := storage.NewMemoryStorage()
+	mux := http.NewServeMux()
+	GenerateHTTPHandlers(mux)
+
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		req = req.WithContext(WithStore(req.Context(), store))
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if rec := do(http.MethodPut, "/flows/greet", "application/yaml", echoFlowYAML("greet", "hi")); rec.Code != http.StatusOK {
+		t.Fatalf("expected 200 saving YAML, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPut, "/flows/greet", "application/json", `{"source": "name: greet\non: cli.manual\nsteps: []\n"}`); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"version":2`) {
+		t.Fatalf("expected version 2 saving JSON, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodPut, "/flows/greet", "application/yaml", echoFlowYAML("other", "hi")); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for mismatched name, got %d", rec.Code)
+	}
+	if rec := do(http.MethodGet, "/flows/greet/versions", "", ""); rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"version":1`) {
+		t.Errorf("expected version history, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/flows/greet", "", ""); rec.Code != http.StatusOK {
+		t.Errorf("expected 200 deleting, got %d: %s", rec.Code, rec.Body)
+	}
+	if rec := do(http.MethodDelete, "/flows/greet", "", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 deleting twice, got %d", rec.Code)
+	}
+}
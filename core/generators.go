@@ -3,6 +3,7 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -11,6 +12,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/awantoch/beemflow/event"
 	mcpserver "github.com/awantoch/beemflow/mcp"
 	"github.com/awantoch/beemflow/utils"
 	mcp "github.com/metoro-io/mcp-golang"
@@ -248,6 +250,15 @@ func generateMCPHandler(op *OperationDefinition) any {
 			return convertToMCPResponse(result)
 		}
 
+	case "ReplayDeadLettersArgs":
+		return func(args MCPReplayDeadLettersArgs) (*mcp.ToolResponse, error) {
+			result, err := op.Handler(context.Background(), &ReplayDeadLettersArgs{ID: args.ID, All: args.All})
+			if err != nil {
+				return nil, err
+			}
+			return convertToMCPResponse(result)
+		}
+
 	case "ResumeRunArgs":
 		return func(args MCPResumeRunArgs) (*mcp.ToolResponse, error) {
 			result, err := op.Handler(context.Background(), &ResumeRunArgs{
@@ -269,6 +280,51 @@ func generateMCPHandler(op *OperationDefinition) any {
 			return convertToMCPResponse(result)
 		}
 
+	case "SaveFlowArgs":
+		return func(args MCPSaveFlowArgs) (*mcp.ToolResponse, error) {
+			result, err := op.Handler(context.Background(), &SaveFlowArgs{Name: args.Name, Source: args.Source})
+			if err != nil {
+				return nil, err
+			}
+			return convertToMCPResponse(result)
+		}
+
+	case "DiffFlowArgs":
+		return func(args MCPDiffFlowArgs) (*mcp.ToolResponse, error) {
+			result, err := op.Handler(context.Background(), &DiffFlowArgs{Name: args.Name, From: args.From, To: args.To})
+			if err != nil {
+				return nil, err
+			}
+			return convertToMCPResponse(result)
+		}
+
+	case "FlowStatsArgs":
+		return func(args MCPFlowStatsArgs) (*mcp.ToolResponse, error) {
+			result, err := op.Handler(context.Background(), &FlowStatsArgs{Flow: args.Flow, Since: args.Since, Until: args.Until})
+			if err != nil {
+				return nil, err
+			}
+			return convertToMCPResponse(result)
+		}
+
+	case "GCBlobsArgs":
+		return func(args MCPGCBlobsArgs) (*mcp.ToolResponse, error) {
+			result, err := op.Handler(context.Background(), &GCBlobsArgs{DryRun: args.DryRun, MinAge: args.MinAge, Prefix: args.Prefix})
+			if err != nil {
+				return nil, err
+			}
+			return convertToMCPResponse(result)
+		}
+
+	case "SignBlobURLArgs":
+		return func(args MCPSignBlobURLArgs) (*mcp.ToolResponse, error) {
+			result, err := op.Handler(context.Background(), &SignBlobURLArgs{URL: args.URL, TTL: args.TTL})
+			if err != nil {
+				return nil, err
+			}
+			return convertToMCPResponse(result)
+		}
+
 	case "ValidateFlowArgs":
 		return func(args MCPValidateFlowArgs) (*mcp.ToolResponse, error) {
 			result, err := op.Handler(context.Background(), &ValidateFlowArgs{Name: args.Name})
@@ -394,7 +450,7 @@ func GenerateCLICommands() []*cobra.Command {
 		// Add subcommands
 		for _, op := range ops {
 			subCmd := generateCLISubcommand(op)
-			parentCmd.AddCommand(subCmd)
+			addCLISubcommand(parentCmd, subCmd)
 		}
 
 		commands = append(commands, parentCmd)
@@ -403,6 +459,32 @@ func GenerateCLICommands() []*cobra.Command {
 	return commands
 }
 
+// addCLISubcommand adds cmd to parent. A Use with more than one command word, such as
+// "dlq list", nests cmd under an intermediate "dlq" command shared with its siblings.
+func addCLISubcommand(parent, cmd *cobra.Command) {
+	words := strings.Fields(cmd.Use)
+	if len(words) < 2 || strings.HasPrefix(words[1], "<") || strings.HasPrefix(words[1], "[") {
+		parent.AddCommand(cmd)
+		return
+	}
+	var group *cobra.Command
+	for _, c := range parent.Commands() {
+		if c.Name() == words[0] {
+			group = c
+			break
+		}
+	}
+	if group == nil {
+		group = &cobra.Command{
+			Use:   words[0],
+			Short: fmt.Sprintf("Commands for %s %s", parent.Name(), words[0]),
+		}
+		parent.AddCommand(group)
+	}
+	cmd.Use = strings.Join(words[1:], " ")
+	addCLISubcommand(group, cmd)
+}
+
 // generateCLICommand creates a CLI command for the given operation
 func generateCLICommand(op *OperationDefinition) *cobra.Command {
 	cmd := &cobra.Command{
@@ -690,7 +772,7 @@ func generateCombinedHTTPHandler(ops []*OperationDefinition) http.HandlerFunc {
 		// Execute operation
 		result, err := matchedOp.Handler(r.Context(), args)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			http.Error(w, err.Error(), httpErrorStatus(err))
 			return
 		}
 
@@ -702,6 +784,15 @@ func generateCombinedHTTPHandler(ops []*OperationDefinition) http.HandlerFunc {
 	}
 }
 
+// httpErrorStatus maps an operation error to an HTTP status: errors caused by the request's
+// content are 400s, everything else is a 500.
+func httpErrorStatus(err error) int {
+	if errors.Is(err, event.ErrInvalidPayload) {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
 // ============================================================================
 // END OF FILE - Simplified by removing unnecessary "Unified" wrappers
 // ============================================================================
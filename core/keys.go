@@ -0,0 +1,72 @@
+package api
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/encryption"
+	"github.com/awantoch/beemflow/storage"
+)
+
+// KeyRotationResult reports the key created by RotateEncryptionKey.
+type KeyRotationResult struct {
+	KeyID   string `json:"keyId"`
+	KeyFile string `json:"keyFile"`
+}
+
+// ReencryptResult reports what ReencryptData rewrote.
+type ReencryptResult struct {
+	KeyID   string                   `json:"keyId"`
+	Storage *storage.ReencryptResult `json:"storage"`
+	Blobs   int                      `json:"blobs"`
+}
+
+// RotateEncryptionKey adds a new key to the local key file and makes it the key new data is
+// encrypted with, creating the file on first use. Existing data stays readable with the older
+// keys; ReencryptData moves it to the new key so they can be removed.
+func RotateEncryptionKey(ctx context.Context) (*KeyRotationResult, error) {
+	cfg := configFromContext(ctx)
+	keyFile := config.DefaultKeyFile
+	if cfg != nil && cfg.Encryption != nil {
+		if p := cfg.Encryption.Provider; p != "" && p != "local" {
+			return nil, fmt.Errorf("keys of the %s encryption provider are rotated by the provider", p)
+		}
+		if cfg.Encryption.KeyFile != "" {
+			keyFile = cfg.Encryption.KeyFile
+		}
+	}
+	id, err := encryption.RotateKeyFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate encryption key: %w", err)
+	}
+	return &KeyRotationResult{KeyID: id, KeyFile: keyFile}, nil
+}
+
+// ReencryptData rewrites stored run data and blobs that are in the clear or encrypted with an
+// older key, using the current key.
+func ReencryptData(ctx context.Context) (*ReencryptResult, error) {
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	encrypted, ok := store.(*storage.EncryptedStorage)
+	if !ok {
+		return nil, fmt.Errorf("encryption is not configured")
+	}
+	result := &ReencryptResult{KeyID: encrypted.CurrentKeyID()}
+	if result.Storage, err = encrypted.Reencrypt(ctx); err != nil {
+		return nil, fmt.Errorf("failed to re-encrypt run data: %w", err)
+	}
+	blobStore, err := blobStoreFromConfig(ctx, configFromContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("blob store unavailable: %w", err)
+	}
+	if r, ok := blobStore.(blob.Reencrypter); ok {
+		if result.Blobs, err = r.Reencrypt(ctx, ""); err != nil {
+			return nil, fmt.Errorf("failed to re-encrypt blobs: %w", err)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/model"
+	"github.com/google/uuid"
+)
+
+func TestRotateEncryptionKey_ReencryptData(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Storage:    config.StorageConfig{Driver: "sqlite", DSN: filepath.Join(dir, "flow.db")},
+		Blob:       &config.BlobConfig{Directory: filepath.Join(dir, "files")},
+		Encryption: &config.EncryptionConfig{KeyFile: filepath.Join(dir, "keys.json")},
+	}
+	ctx := WithConfig(context.Background(), cfg)
+
+	if _, err := GetStoreFromConfig(cfg); err == nil || !strings.Contains(err.Error(), "flow keys rotate") {
+		t.Errorf("expected a missing key file error, got %v", err)
+	}
+	first, err := RotateEncryptionKey(ctx)
+	if err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	if first.KeyFile != cfg.Encryption.KeyFile {
+		t.Errorf("unexpected key file %s", first.KeyFile)
+	}
+
+	store, err := GetStoreFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("GetStoreFromConfig failed: %v", err)
+	}
+	ctx = WithStore(ctx, store)
+	run := &model.Run{ID: uuid.New(), FlowName: "f", Event: map[string]any{"token": "hunter2"},
+		Status: model.RunSucceeded, StartedAt: time.Now()}
+	if err := store.SaveRun(ctx, run); err != nil {
+		t.Fatalf("SaveRun failed: %v", err)
+	}
+	blobStore, err := blobStoreFromConfig(ctx, cfg)
+	if err != nil {
+		t.Fatalf("blobStoreFromConfig failed: %v", err)
+	}
+	if _, err := blobStore.Put(ctx, []byte("hunter2"), "text/plain", "secret.txt"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	onDisk, _ := os.ReadFile(filepath.Join(dir, "files", "secret.txt"))
+	if len(onDisk) == 0 || bytes.Contains(onDisk, []byte("hunter2")) {
+		t.Error("blob is not encrypted on disk")
+	}
+
+	second, err := RotateEncryptionKey(ctx)
+	if err != nil {
+		t.Fatalf("RotateEncryptionKey failed: %v", err)
+	}
+	// The store picks up the new key when it is created again, as on restart
+	store, err = GetStoreFromConfig(cfg)
+	if err != nil {
+		t.Fatalf("GetStoreFromConfig failed: %v", err)
+	}
+	result, err := ReencryptData(WithStore(ctx, store))
+	if err != nil {
+		t.Fatalf("ReencryptData failed: %v", err)
+	}
+	if result.KeyID != second.KeyID || result.Storage.Runs != 1 || result.Blobs != 1 {
+		t.Errorf("unexpected result: %+v, %+v", result, result.Storage)
+	}
+	got, err := store.GetRun(ctx, run.ID)
+	if err != nil || got.Event["token"] != "hunter2" {
+		t.Errorf("GetRun after re-encryption = %v, %v", got, err)
+	}
+}
+
+func TestReencryptData_NotConfigured(t *testing.T) {
+	cfg := &config.Config{Storage: config.StorageConfig{Driver: "sqlite", DSN: ":memory:"}}
+	if _, err := ReencryptData(WithConfig(context.Background(), cfg)); err == nil {
+		t.Error("expected error when encryption is not configured")
+	}
+}
@@ -20,6 +20,12 @@ type MCPPublishEventArgs struct {
 	Payload string `json:"payload" jsonschema:"description=JSON string containing payload data"`
 }
 
+// MCPReplayDeadLettersArgs is a simplified version of ReplayDeadLettersArgs for MCP
+type MCPReplayDeadLettersArgs struct {
+	ID  string `json:"id" jsonschema:"description=ID of the dead letter to replay"`
+	All bool   `json:"all" jsonschema:"description=Replay every dead letter"`
+}
+
 // MCPResumeRunArgs is a simplified version of ResumeRunArgs for MCP
 type MCPResumeRunArgs struct {
 	Token string `json:"token" jsonschema:"required,description=Resume token"`
@@ -31,6 +37,39 @@ type MCPGetFlowArgs struct {
 	Name string `json:"name" jsonschema:"required,description=Name of the flow"`
 }
 
+// MCPSaveFlowArgs is a simplified version of SaveFlowArgs for MCP
+type MCPSaveFlowArgs struct {
+	Name   string `json:"name" jsonschema:"required,description=Name of the flow"`
+	Source string `json:"source" jsonschema:"required,description=Flow definition as YAML"`
+}
+
+// MCPDiffFlowArgs is a simplified version of DiffFlowArgs for MCP
+type MCPDiffFlowArgs struct {
+	Name string `json:"name" jsonschema:"required,description=Name of the flow"`
+	From int    `json:"from" jsonschema:"description=Older version (default: the version before to)"`
+	To   int    `json:"to" jsonschema:"description=Newer version (default: latest)"`
+}
+
+// MCPFlowStatsArgs is a simplified version of FlowStatsArgs for MCP
+type MCPFlowStatsArgs struct {
+	Flow  string `json:"flow" jsonschema:"description=Only report this flow"`
+	Since string `json:"since" jsonschema:"description=Window start: RFC3339 time or duration ago like 24h or 7d (default 24h)"`
+	Until string `json:"until" jsonschema:"description=Window end: RFC3339 time or duration ago (default now)"`
+}
+
+// MCPGCBlobsArgs is a simplified version of GCBlobsArgs for MCP
+type MCPGCBlobsArgs struct {
+	DryRun bool   `json:"dryRun" jsonschema:"description=Report what would be deleted without deleting it"`
+	MinAge string `json:"minAge" jsonschema:"description=Only delete blobs older than this duration (default 1h)"`
+	Prefix string `json:"prefix" jsonschema:"description=Only consider blobs whose ID starts with this"`
+}
+
+// MCPSignBlobURLArgs is a simplified version of SignBlobURLArgs for MCP
+type MCPSignBlobURLArgs struct {
+	URL string `json:"url" jsonschema:"required,description=Blob URL (file:// or s3://)"`
+	TTL string `json:"ttl" jsonschema:"description=How long the URL stays valid (default 24h)"`
+}
+
 // MCPValidateFlowArgs is a simplified version of ValidateFlowArgs for MCP
 type MCPValidateFlowArgs struct {
 	Name string `json:"name" jsonschema:"required,description=Name of the flow to validate"`
@@ -1,9 +1,11 @@
 package api
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"path"
@@ -17,6 +19,7 @@ import (
 	"github.com/awantoch/beemflow/docs"
 	"github.com/awantoch/beemflow/dsl"
 	"github.com/awantoch/beemflow/graph"
+	"github.com/awantoch/beemflow/model"
 	"github.com/awantoch/beemflow/utils"
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
@@ -50,6 +53,18 @@ type GetFlowArgs struct {
 	Name string `json:"name" flag:"name" description:"Flow name"`
 }
 
+type SaveFlowArgs struct {
+	Name   string `json:"name" flag:"name" description:"Flow name"`
+	File   string `json:"-" flag:"file" description:"Path to the flow YAML to save"`
+	Source string `json:"source" description:"Flow YAML"`
+}
+
+type DiffFlowArgs struct {
+	Name string `json:"name" flag:"name" description:"Flow name"`
+	From int    `json:"from" flag:"from" description:"Older version (default: the version before --to)"`
+	To   int    `json:"to" flag:"to" description:"Newer version (default: latest)"`
+}
+
 type ValidateFlowArgs struct {
 	Name string `json:"name" flag:"name" description:"Flow name or file path to validate"`
 }
@@ -67,11 +82,42 @@ type GetRunArgs struct {
 	RunID string `json:"runID" flag:"run-id" description:"Run ID"`
 }
 
+type ExportRunArgs struct {
+	RunID  string `json:"runID" flag:"run-id" description:"Run ID"`
+	Output string `json:"output" flag:"output" description:"Archive path (default: <run-id>.tar.gz)"`
+}
+
+type ImportRunArgs struct {
+	File string `json:"file" flag:"file" description:"Path to a run archive"`
+}
+
+type FlowStatsArgs struct {
+	Flow  string `json:"flow" flag:"flow" description:"Only report this flow"`
+	Since string `json:"since" flag:"since" description:"Window start: RFC3339 time or duration ago like 24h or 7d (default 24h)"`
+	Until string `json:"until" flag:"until" description:"Window end: RFC3339 time or duration ago (default now)"`
+}
+
+type GCBlobsArgs struct {
+	DryRun bool   `json:"dryRun" flag:"dry-run" description:"Report what would be deleted without deleting it"`
+	MinAge string `json:"minAge" flag:"min-age" description:"Only delete blobs older than this duration (default 1h)"`
+	Prefix string `json:"prefix" flag:"prefix" description:"Only consider blobs whose ID starts with this"`
+}
+
+type SignBlobURLArgs struct {
+	URL string `json:"url" flag:"url" description:"Blob URL (file:// or s3://)"`
+	TTL string `json:"ttl" flag:"ttl" description:"How long the URL stays valid (default 24h)"`
+}
+
 type PublishEventArgs struct {
 	Topic   string         `json:"topic" flag:"topic" description:"Event topic"`
 	Payload map[string]any `json:"payload" flag:"payload-json" description:"Event payload as JSON"`
 }
 
+type ReplayDeadLettersArgs struct {
+	ID  string `json:"id" flag:"id" description:"ID of the dead letter to replay"`
+	All bool   `json:"all" flag:"all" description:"Replay every dead letter"`
+}
+
 type ResumeRunArgs struct {
 	Token string         `json:"token" flag:"token" description:"Resume token"`
 	Event map[string]any `json:"event" flag:"event-json" description:"Event data as JSON"`
@@ -285,6 +331,12 @@ func lintFlowCLIHandler(cmd *cobra.Command, args []string) error {
 		utils.Error("Schema validation error: %v\n", err)
 		return fmt.Errorf("schema validation error: %w", err)
 	}
+	if issues := lintEventSchemas(flow); len(issues) > 0 {
+		for _, issue := range issues {
+			utils.Error("Event schema error: %s\n", issue)
+		}
+		return fmt.Errorf("event schema error: %s", strings.Join(issues, "; "))
+	}
 	utils.User("Lint OK: flow is valid!")
 	return nil
 }
@@ -299,9 +351,209 @@ func lintFlowHandler(ctx context.Context, args any) (any, error) {
 	if err != nil {
 		return nil, fmt.Errorf("schema validation error: %w", err)
 	}
+	if issues := lintEventSchemas(flow); len(issues) > 0 {
+		return nil, fmt.Errorf("event schema error: %s", strings.Join(issues, "; "))
+	}
 	return map[string]any{"status": "valid", "message": "Lint OK: flow is valid!"}, nil
 }
 
+func exportRunHandler(ctx context.Context, args any) (any, error) {
+	a := args.(*ExportRunArgs)
+	runID, err := uuid.Parse(a.RunID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid run ID: %w", err)
+	}
+	out := a.Output
+	if out == "" {
+		out = runID.String() + ".tar.gz"
+	}
+	f, err := os.Create(out)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive: %w", err)
+	}
+	manifest, err := ExportRun(ctx, runID, f)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(out)
+		return nil, err
+	}
+	return map[string]any{"archive": out, "manifest": manifest}, nil
+}
+
+func exportRunHTTPHandler(w http.ResponseWriter, r *http.Request) {
+	runID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "invalid run ID", http.StatusBadRequest)
+		return
+	}
+	// Build the archive in memory first so errors can still produce a proper status
+	var buf bytes.Buffer
+	if _, err := ExportRun(r.Context(), runID, &buf); err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", runID.String()+".tar.gz"))
+	_, _ = w.Write(buf.Bytes())
+}
+
+func importRunHandler(ctx context.Context, args any) (any, error) {
+	a := args.(*ImportRunArgs)
+	if a.File == "" {
+		return nil, fmt.Errorf("archive file is required")
+	}
+	f, err := os.Open(a.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ImportRun(ctx, f)
+}
+
+func importRunHTTPHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := ImportRun(r.Context(), r.Body)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "archive") {
+			status = http.StatusBadRequest
+		} else if strings.Contains(err.Error(), "already exists") {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		utils.Error("Failed to encode response: %v", err)
+	}
+}
+
+func saveFlowHandler(ctx context.Context, args any) (any, error) {
+	a := args.(*SaveFlowArgs)
+	if a.File != "" {
+		data, err := os.ReadFile(a.File)
+		if err != nil {
+			return nil, err
+		}
+		a.Source = string(data)
+	}
+	if a.Source == "" {
+		return nil, fmt.Errorf("flow source is required")
+	}
+	return SaveFlow(ctx, a.Name, a.Source)
+}
+
+// maxFlowSourceBytes caps the size of a flow definition accepted over HTTP.
+const maxFlowSourceBytes = 1 << 20
+
+// saveFlowHTTPHandler accepts the flow either as a raw YAML body or as JSON {"source": "..."}.
+func saveFlowHTTPHandler(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFlowSourceBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	source := string(body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var payload struct {
+			Source string `json:"source"`
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		source = payload.Source
+	}
+	fv, err := SaveFlow(r.Context(), r.PathValue("name"), source)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "invalid flow") {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(fv); err != nil {
+		utils.Error("Failed to encode response: %v", err)
+	}
+}
+
+func deleteFlowHandler(ctx context.Context, args any) (any, error) {
+	a := args.(*GetFlowArgs)
+	if err := DeleteFlow(ctx, a.Name); err != nil {
+		return nil, err
+	}
+	return map[string]any{"deleted": a.Name}, nil
+}
+
+func deleteFlowHTTPHandler(w http.ResponseWriter, r *http.Request) {
+	result, err := deleteFlowHandler(r.Context(), &GetFlowArgs{Name: r.PathValue("name")})
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.Contains(err.Error(), "not found") {
+			status = http.StatusNotFound
+		} else if strings.Contains(err.Error(), "invalid flow name") {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		utils.Error("Failed to encode response: %v", err)
+	}
+}
+
+func flowStatsHandler(ctx context.Context, args any) (any, error) {
+	a := args.(*FlowStatsArgs)
+	now := time.Now()
+	since, err := parseStatsTime(a.Since, now)
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseStatsTime(a.Until, now)
+	if err != nil {
+		return nil, err
+	}
+	return GetFlowStats(ctx, model.StatsQuery{FlowName: a.Flow, Since: since, Until: until})
+}
+
+func gcBlobsHandler(ctx context.Context, args any) (any, error) {
+	a := args.(*GCBlobsArgs)
+	opts := BlobGCOptions{DryRun: a.DryRun, MinAge: defaultBlobGCMinAge, Prefix: a.Prefix}
+	if a.MinAge != "" {
+		d, err := time.ParseDuration(a.MinAge)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid min age %q: expected a duration like 1h", a.MinAge)
+		}
+		opts.MinAge = d
+	}
+	return GCBlobs(ctx, opts)
+}
+
+func signBlobURLHandler(ctx context.Context, args any) (any, error) {
+	a := args.(*SignBlobURLArgs)
+	if a.URL == "" {
+		return nil, fmt.Errorf("blob URL is required")
+	}
+	var ttl time.Duration
+	if a.TTL != "" {
+		d, err := time.ParseDuration(a.TTL)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid ttl %q: expected a duration like 24h", a.TTL)
+		}
+		ttl = d
+	}
+	return SignBlobURL(ctx, a.URL, ttl)
+}
+
 // init registers all core operations
 func init() {
 	// List Flows
@@ -339,6 +591,74 @@ func init() {
 		},
 	})
 
+	// Save Flow
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDSaveFlow,
+		Name:        "Save Flow",
+		Description: constants.InterfaceDescSaveFlow,
+		Group:       "flows",
+		HTTPMethod:  http.MethodPut,
+		HTTPPath:    "/flows/{name}",
+		CLIUse:      "flows save <name>",
+		CLIShort:    "Save a flow file as a new version in storage",
+		MCPName:     "beemflow_save_flow",
+		ArgsType:    reflect.TypeOf(SaveFlowArgs{}),
+		Handler:     saveFlowHandler,
+		HTTPHandler: saveFlowHTTPHandler,
+	})
+
+	// Delete Flow
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDDeleteFlow,
+		Name:        "Delete Flow",
+		Description: constants.InterfaceDescDeleteFlow,
+		Group:       "flows",
+		HTTPMethod:  http.MethodDelete,
+		HTTPPath:    "/flows/{name}",
+		CLIUse:      "flows delete <name>",
+		CLIShort:    "Delete a flow and its version history",
+		MCPName:     "beemflow_delete_flow",
+		ArgsType:    reflect.TypeOf(GetFlowArgs{}),
+		Handler:     deleteFlowHandler,
+		HTTPHandler: deleteFlowHTTPHandler,
+	})
+
+	// List Flow Versions
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDListFlowVersion,
+		Name:        "List Flow Versions",
+		Description: constants.InterfaceDescListFlowVersion,
+		Group:       "flows",
+		HTTPMethod:  http.MethodGet,
+		HTTPPath:    "/flows/{name}/versions",
+		CLIUse:      "flows versions <name>",
+		CLIShort:    "List the stored versions of a flow",
+		MCPName:     "beemflow_list_flow_versions",
+		ArgsType:    reflect.TypeOf(GetFlowArgs{}),
+		Handler: func(ctx context.Context, args any) (any, error) {
+			a := args.(*GetFlowArgs)
+			return ListFlowVersions(ctx, a.Name)
+		},
+	})
+
+	// Diff Flow Versions
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDDiffFlow,
+		Name:        "Diff Flow Versions",
+		Description: constants.InterfaceDescDiffFlow,
+		Group:       "flows",
+		HTTPMethod:  http.MethodGet,
+		HTTPPath:    "/flows/{name}/diff",
+		CLIUse:      "flows diff <name>",
+		CLIShort:    "Diff two stored versions of a flow",
+		MCPName:     "beemflow_diff_flow",
+		ArgsType:    reflect.TypeOf(DiffFlowArgs{}),
+		Handler: func(ctx context.Context, args any) (any, error) {
+			a := args.(*DiffFlowArgs)
+			return DiffFlowVersions(ctx, a.Name, a.From, a.To)
+		},
+	})
+
 	// Validate Flow (Unified: handles both flow names and files)
 	RegisterOperation(&OperationDefinition{
 		ID:          constants.InterfaceIDValidateFlow,
@@ -428,6 +748,129 @@ func init() {
 		},
 	})
 
+	// Export Run
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDExportRun,
+		Name:        "Export Run",
+		Description: constants.InterfaceDescExportRun,
+		Group:       "runs",
+		HTTPMethod:  http.MethodGet,
+		HTTPPath:    "/runs/{id}/export",
+		CLIUse:      "runs export <run-id>",
+		CLIShort:    "Export a run as a portable archive",
+		ArgsType:    reflect.TypeOf(ExportRunArgs{}),
+		SkipMCP:     true,
+		Handler:     exportRunHandler,
+		HTTPHandler: exportRunHTTPHandler,
+	})
+
+	// Import Run
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDImportRun,
+		Name:        "Import Run",
+		Description: constants.InterfaceDescImportRun,
+		Group:       "runs",
+		HTTPMethod:  http.MethodPost,
+		HTTPPath:    "/runs/import",
+		CLIUse:      "runs import <file>",
+		CLIShort:    "Import a run archive into storage",
+		ArgsType:    reflect.TypeOf(ImportRunArgs{}),
+		SkipMCP:     true,
+		Handler:     importRunHandler,
+		HTTPHandler: importRunHTTPHandler,
+	})
+
+	// Flow Stats
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDFlowStats,
+		Name:        "Flow Stats",
+		Description: constants.InterfaceDescFlowStats,
+		Group:       "runs",
+		HTTPMethod:  http.MethodGet,
+		HTTPPath:    "/stats/flows",
+		CLIUse:      "stats",
+		CLIShort:    "Show run statistics per flow",
+		MCPName:     "beemflow_flow_stats",
+		ArgsType:    reflect.TypeOf(FlowStatsArgs{}),
+		Handler:     flowStatsHandler,
+	})
+
+	// GC Blobs
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDGCBlobs,
+		Name:        "GC Blobs",
+		Description: constants.InterfaceDescGCBlobs,
+		Group:       "runs",
+		HTTPMethod:  http.MethodPost,
+		HTTPPath:    "/blobs/gc",
+		CLIUse:      "blobs gc",
+		CLIShort:    "Delete blobs no retained run references",
+		MCPName:     "beemflow_gc_blobs",
+		ArgsType:    reflect.TypeOf(GCBlobsArgs{}),
+		Handler:     gcBlobsHandler,
+	})
+
+	// Sign Blob URL
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDSignBlobURL,
+		Name:        "Sign Blob URL",
+		Description: constants.InterfaceDescSignBlobURL,
+		Group:       "runs",
+		HTTPMethod:  http.MethodPost,
+		HTTPPath:    "/blobs/url",
+		CLIUse:      "blobs url",
+		CLIShort:    "Create a time-limited download URL for a blob",
+		MCPName:     "beemflow_sign_blob_url",
+		ArgsType:    reflect.TypeOf(SignBlobURLArgs{}),
+		Handler:     signBlobURLHandler,
+	})
+
+	// Serve Blob
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDServeBlob,
+		Name:        "Serve Blob",
+		Description: constants.InterfaceDescServeBlob,
+		Group:       "runs",
+		HTTPMethod:  http.MethodGet,
+		HTTPPath:    "/blobs/{key...}",
+		SkipCLI:     true,
+		SkipMCP:     true,
+		ArgsType:    reflect.TypeOf(EmptyArgs{}),
+		HTTPHandler: serveBlobHTTPHandler,
+	})
+
+	// Rotate Encryption Key
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDRotateKey,
+		Name:        "Rotate Encryption Key",
+		Description: constants.InterfaceDescRotateKey,
+		Group:       "system",
+		CLIUse:      "keys rotate",
+		CLIShort:    "Add a new encryption key and use it for new data",
+		ArgsType:    reflect.TypeOf(EmptyArgs{}),
+		SkipHTTP:    true,
+		SkipMCP:     true,
+		Handler: func(ctx context.Context, args any) (any, error) {
+			return RotateEncryptionKey(ctx)
+		},
+	})
+
+	// Re-encrypt Data
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDReencrypt,
+		Name:        "Re-encrypt Data",
+		Description: constants.InterfaceDescReencrypt,
+		Group:       "system",
+		CLIUse:      "keys reencrypt",
+		CLIShort:    "Re-encrypt stored run data and blobs with the current key",
+		ArgsType:    reflect.TypeOf(EmptyArgs{}),
+		SkipHTTP:    true,
+		SkipMCP:     true,
+		Handler: func(ctx context.Context, args any) (any, error) {
+			return ReencryptData(ctx)
+		},
+	})
+
 	// Publish Event
 	RegisterOperation(&OperationDefinition{
 		ID:          constants.InterfaceIDPublishEvent,
@@ -450,6 +893,41 @@ func init() {
 		},
 	})
 
+	// List Dead Letters
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDListDLQ,
+		Name:        "List Dead Letters",
+		Description: constants.InterfaceDescListDLQ,
+		Group:       "events",
+		HTTPMethod:  http.MethodGet,
+		HTTPPath:    "/events/dlq",
+		CLIUse:      "events dlq list",
+		CLIShort:    "List dead-lettered events",
+		MCPName:     "beemflow_list_dead_letters",
+		ArgsType:    reflect.TypeOf(EmptyArgs{}),
+		Handler: func(ctx context.Context, args any) (any, error) {
+			return ListDeadLetters(ctx)
+		},
+	})
+
+	// Replay Dead Letters
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDReplayDLQ,
+		Name:        "Replay Dead Letters",
+		Description: constants.InterfaceDescReplayDLQ,
+		Group:       "events",
+		HTTPMethod:  http.MethodPost,
+		HTTPPath:    "/events/dlq/replay",
+		CLIUse:      "events dlq replay [id]",
+		CLIShort:    "Publish dead-lettered events again",
+		MCPName:     "beemflow_replay_dead_letters",
+		ArgsType:    reflect.TypeOf(ReplayDeadLettersArgs{}),
+		Handler: func(ctx context.Context, args any) (any, error) {
+			a := args.(*ReplayDeadLettersArgs)
+			return ReplayDeadLetters(ctx, a.ID, a.All)
+		},
+	})
+
 	// Resume Run
 	RegisterOperation(&OperationDefinition{
 		ID:          constants.InterfaceIDResumeRun,
@@ -468,6 +946,20 @@ func init() {
 		},
 	})
 
+	// Webhook
+	RegisterOperation(&OperationDefinition{
+		ID:          constants.InterfaceIDWebhook,
+		Name:        "Webhook",
+		Description: constants.InterfaceDescWebhook,
+		Group:       "events",
+		HTTPMethod:  http.MethodPost,
+		HTTPPath:    "/hooks/{name}",
+		SkipCLI:     true,
+		SkipMCP:     true,
+		ArgsType:    reflect.TypeOf(EmptyArgs{}),
+		HTTPHandler: webhookHTTPHandler,
+	})
+
 	// Spec
 	RegisterOperation(&OperationDefinition{
 		ID:          "spec",
@@ -0,0 +1,250 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/event"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/utils"
+)
+
+// eventRefPattern finds `event.a.b` references in a flow definition.
+var eventRefPattern = regexp.MustCompile(`(?:^|[^\w.])event((?:\.[A-Za-z_]\w*)+)`)
+
+// eventSchemas collects the payload schemas declared in the config and on flows' event
+// triggers. An invalid schema in the config is an error; one in a flow is logged and skipped,
+// since lint reports it.
+func eventSchemas(ctx context.Context) (*event.SchemaSet, error) {
+	set := &event.SchemaSet{}
+	if cfg := configFromContext(ctx); cfg != nil && cfg.Event != nil {
+		patterns := make([]string, 0, len(cfg.Event.Schemas))
+		for pattern := range cfg.Event.Schemas {
+			patterns = append(patterns, pattern)
+		}
+		sort.Strings(patterns)
+		for _, pattern := range patterns {
+			if err := set.Add(pattern, "config", cfg.Event.Schemas[pattern]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	names, err := ListFlows(ctx)
+	if err != nil {
+		utils.WarnCtx(ctx, "Failed to list flows, validating events against config schemas only", "error", err)
+		return set, nil
+	}
+	for _, name := range names {
+		flow, err := parseFlowByName(ctx, name)
+		if err != nil || flow == nil {
+			continue
+		}
+		for _, trigger := range eventTriggers(flow) {
+			if trigger.Schema == nil {
+				continue
+			}
+			for _, pattern := range trigger.Patterns {
+				if err := set.Add(pattern, "flow "+name, trigger.Schema); err != nil {
+					utils.WarnCtx(ctx, "Skipping invalid event trigger schema", "flow", name, "error", err)
+				}
+			}
+		}
+	}
+	return set, nil
+}
+
+// schemaCache holds the last SchemaSet built by eventSchemas, so publishing an event doesn't
+// parse every flow. It is rebuilt when its key changes: the config's schemas, the flows
+// directory and its files, or the storage and its flow names. SaveFlow and DeleteFlow also
+// invalidate it, since stored flows can change without changing the list of names.
+var schemaCache struct {
+	sync.Mutex
+	key string
+	set *event.SchemaSet
+}
+
+// cachedEventSchemas returns the SchemaSet for ctx, building it only when it is not cached.
+func cachedEventSchemas(ctx context.Context) (*event.SchemaSet, error) {
+	key, err := eventSchemasKey(ctx)
+	if err != nil {
+		utils.DebugCtx(ctx, "Not caching event schemas", "error", err)
+		return eventSchemas(ctx)
+	}
+	schemaCache.Lock()
+	defer schemaCache.Unlock()
+	if schemaCache.set != nil && schemaCache.key == key {
+		return schemaCache.set, nil
+	}
+	set, err := eventSchemas(ctx)
+	if err != nil {
+		return nil, err
+	}
+	schemaCache.key, schemaCache.set = key, set
+	return set, nil
+}
+
+// invalidateEventSchemas drops the cached SchemaSet.
+func invalidateEventSchemas() {
+	schemaCache.Lock()
+	defer schemaCache.Unlock()
+	schemaCache.key, schemaCache.set = "", nil
+}
+
+// eventSchemasKey describes everything eventSchemas reads, so the cache is rebuilt when any
+// of it changes.
+func eventSchemasKey(ctx context.Context) (string, error) {
+	var b strings.Builder
+	if cfg := configFromContext(ctx); cfg != nil && cfg.Event != nil {
+		schemas, err := json.Marshal(cfg.Event.Schemas)
+		if err != nil {
+			return "", err
+		}
+		b.Write(schemas)
+	}
+	fmt.Fprintf(&b, "\n%s\n", flowsDir)
+	entries, err := os.ReadDir(flowsDir)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), constants.FlowFileExtension) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s %d %d\n", entry.Name(), info.Size(), info.ModTime().UnixNano())
+	}
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return "", err
+	}
+	names, err := store.ListFlowNames(ctx)
+	if err != nil {
+		return "", err
+	}
+	fmt.Fprintf(&b, "%p %s", store, strings.Join(names, ","))
+	return b.String(), nil
+}
+
+// validateEventPayload checks payload against the schemas declared for topic.
+func validateEventPayload(ctx context.Context, topic string, payload map[string]any) error {
+	schemas, err := cachedEventSchemas(ctx)
+	if err != nil {
+		return err
+	}
+	return schemas.Validate(topic, payload)
+}
+
+// lintEventSchemas checks a flow's event trigger schemas: each must compile, and every
+// `event.*` field the flow reads before its first await_event, including in the nested steps
+// of parallel and foreach blocks, must be declared by every trigger schema that declares
+// properties. Fields after an await_event may come from the resume event instead, so they
+// aren't checked.
+func lintEventSchemas(flow *model.Flow) []string {
+	var issues []string
+	var schemas []eventTrigger
+	for _, trigger := range eventTriggers(flow) {
+		if trigger.Schema == nil {
+			continue
+		}
+		if _, err := event.CompileSchema(trigger.Schema); err != nil {
+			issues = append(issues, fmt.Sprintf("invalid schema for event trigger %s: %v", strings.Join(trigger.Patterns, ", "), err))
+			continue
+		}
+		schemas = append(schemas, trigger)
+	}
+	if len(schemas) == 0 {
+		return issues
+	}
+
+	lintEventRefs(flow.Steps, schemas, &issues)
+	return issues
+}
+
+// lintEventRefs checks the event references of steps in execution order and reports whether
+// an await_event was reached. The steps of a parallel block all start before the block ends,
+// so every branch is checked even if one of them awaits.
+func lintEventRefs(steps []model.Step, schemas []eventTrigger, issues *[]string) bool {
+	for _, step := range steps {
+		// The step's own fields; nested steps are checked on their own below
+		own := step
+		own.Steps, own.Do = nil, nil
+		data, err := json.Marshal(own)
+		if err != nil {
+			continue
+		}
+		seen := make(map[string]bool)
+		for _, m := range eventRefPattern.FindAllStringSubmatch(string(data), -1) {
+			ref := m[1][1:]
+			if seen[ref] {
+				continue
+			}
+			seen[ref] = true
+			path := strings.Split(ref, ".")
+			if path[0] == constants.EventKeyTopic {
+				continue
+			}
+			for _, trigger := range schemas {
+				if !schemaDeclares(trigger.Schema, path) {
+					*issues = append(*issues, fmt.Sprintf("step %s references event.%s, which the schema of event trigger %s doesn't declare",
+						step.ID, ref, strings.Join(trigger.Patterns, ", ")))
+				}
+			}
+		}
+		if step.AwaitEvent != nil {
+			return true
+		}
+
+		awaited := false
+		if step.Parallel {
+			for _, child := range step.Steps {
+				if lintEventRefs([]model.Step{child}, schemas, issues) {
+					awaited = true
+				}
+			}
+		} else if lintEventRefs(step.Steps, schemas, issues) {
+			awaited = true
+		}
+		if !awaited && lintEventRefs(step.Do, schemas, issues) {
+			awaited = true
+		}
+		if awaited {
+			return true
+		}
+	}
+	return false
+}
+
+// schemaDeclares reports whether path can name a field of values matching schema. Only
+// schemas that list properties constrain field names; additionalProperties given as a schema
+// applies to the fields they don't list.
+func schemaDeclares(schema any, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+	m, ok := schema.(map[string]any)
+	if !ok {
+		return true
+	}
+	props, ok := m["properties"].(map[string]any)
+	if !ok {
+		return true
+	}
+	if sub, ok := props[path[0]]; ok {
+		return schemaDeclares(sub, path[1:])
+	}
+	if additional, ok := m["additionalProperties"].(map[string]any); ok {
+		return schemaDeclares(additional, path[1:])
+	}
+	return false
+}
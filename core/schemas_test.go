@@ -0,0 +1,200 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/dsl"
+	"github.com/awantoch/beemflow/event"
+	"github.com/awantoch/beemflow/storage"
+)
+
+const orderFlowYAML = `name: order_audit
+on:
+  - event: orders.*
+    schema:
+      type: object
+      required: [id]
+      properties:
+        id: {type: string}
+        customer:
+          type: object
+          properties:
+            email: {type: string}
+steps:
+  - id: log
+    use: core.echo
+    with:
+      text: "{{ event.id }} {{ event.customer.email }} {{ event.topic }}"
+`
+
+func TestPublishEvent_ValidatesSchemas(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldDir := flowsDir
+	SetFlowsDir(tmpDir)
+	defer SetFlowsDir(oldDir)
+	if err := os.WriteFile(filepath.Join(tmpDir, "order_audit.flow.yaml"), []byte(orderFlowYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{Event: &config.EventConfig{Schemas: map[string]any{
+		"users.created": map[string]any{"type": "object", "required": []any{"email"}},
+	}}}
+	ctx := WithConfig(WithStore(context.Background(), storage.NewMemoryStorage()), cfg)
+	bus := event.NewInProcEventBus()
+	defer bus.Close()
+	setSharedEventBus(bus)
+	defer releaseSharedEventBus(bus)
+
+	if err := PublishEvent(ctx, "orders.created", map[string]any{"id": "o1"}); err != nil {
+		t.Errorf("expected a valid order to publish, got %v", err)
+	}
+	err := PublishEvent(ctx, "orders.created", map[string]any{"id": 7})
+	if !errors.Is(err, event.ErrInvalidPayload) || !strings.Contains(err.Error(), "/id: expected string, but got number") {
+		t.Errorf("expected the flow trigger schema to reject the order, got %v", err)
+	}
+	err = PublishEvent(ctx, "users.created", map[string]any{"name": "Ada"})
+	if !errors.Is(err, event.ErrInvalidPayload) || !strings.Contains(err.Error(), "schema from config") {
+		t.Errorf("expected the config schema to reject the user, got %v", err)
+	}
+
+	// Invalid payloads are client errors over HTTP
+	mux := http.NewServeMux()
+	GenerateHTTPHandlersForOperations(mux, map[string]*OperationDefinition{"publishEvent": operationRegistry["publishEvent"]})
+	req := httptest.NewRequest(http.MethodPost, "/events", strings.NewReader(`{"topic":"orders.created","payload":{}}`)).WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "missing properties: 'id'") {
+		t.Errorf("expected 400 with the violation, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLintEventSchemas(t *testing.T) {
+	flow, err := dsl.ParseFromString(orderFlowYAML)
+	if err != nil {
+		t.Fatalf("ParseFromString failed: %v", err)
+	}
+	if issues := lintEventSchemas(flow); len(issues) != 0 {
+		t.Errorf("expected declared references to pass, got %v", issues)
+	}
+
+	typo := strings.Replace(orderFlowYAML, "event.customer.email", "event.customer.emial", 1)
+	typo = strings.Replace(typo, "{{ event.id }}", "{{ event.ammount }}", 1)
+	if flow, err = dsl.ParseFromString(typo); err != nil {
+		t.Fatalf("ParseFromString failed: %v", err)
+	}
+	issues := lintEventSchemas(flow)
+	if len(issues) != 2 || !strings.Contains(issues[0], "event.ammount") || !strings.Contains(issues[1], "event.customer.emial") {
+		t.Errorf("expected the misspelled references to be reported, got %v", issues)
+	}
+
+	// Fields read after await_event may come from the resume event
+	awaiting := typo + `  - id: wait
+    await_event:
+      source: orders
+      match:
+        token: "{{ event.id }}"
+  - id: after
+    use: core.echo
+    with:
+      text: "{{ event.approved_by }}"
+`
+	if flow, err = dsl.ParseFromString(awaiting); err != nil {
+		t.Fatalf("ParseFromString failed: %v", err)
+	}
+	if issues := lintEventSchemas(flow); len(issues) != 2 {
+		t.Errorf("expected references after await_event to be skipped, got %v", issues)
+	}
+
+	// Nested steps of parallel and foreach blocks are checked, up to an await_event among them
+	nested := orderFlowYAML + `  - id: fan_out
+    parallel: true
+    steps:
+      - id: notify
+        use: core.echo
+        with:
+          text: "{{ event.customer.phone }}"
+  - id: each
+    foreach: "{{ event.items }}"
+    as: item
+    do:
+      - id: wait_{{ item }}
+        await_event:
+          source: orders
+          match:
+            token: "{{ item }}"
+  - id: after
+    use: core.echo
+    with:
+      text: "{{ event.approved_by }}"
+`
+	if flow, err = dsl.ParseFromString(nested); err != nil {
+		t.Fatalf("ParseFromString failed: %v", err)
+	}
+	issues = lintEventSchemas(flow)
+	if len(issues) != 2 || !strings.Contains(issues[0], "step notify references event.customer.phone") || !strings.Contains(issues[1], "step each references event.items") {
+		t.Errorf("expected the nested references to be reported, got %v", issues)
+	}
+
+	invalid := strings.Replace(orderFlowYAML, "required: [id]", "required: id", 1)
+	if flow, err = dsl.ParseFromString(invalid); err != nil {
+		t.Fatalf("ParseFromString failed: %v", err)
+	}
+	if issues := lintEventSchemas(flow); len(issues) != 1 || !strings.Contains(issues[0], "invalid schema") {
+		t.Errorf("expected the invalid schema to be reported, got %v", issues)
+	}
+}
+
+func TestValidateEventPayload_CachesSchemas(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldDir := flowsDir
+	SetFlowsDir(tmpDir)
+	defer SetFlowsDir(oldDir)
+	path := filepath.Join(tmpDir, "order_audit.flow.yaml")
+	if err := os.WriteFile(path, []byte(orderFlowYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithConfig(WithStore(context.Background(), storage.NewMemoryStorage()), &config.Config{})
+
+	if err := validateEventPayload(ctx, "orders.created", map[string]any{}); !errors.Is(err, event.ErrInvalidPayload) {
+		t.Fatalf("expected the trigger schema to reject the order, got %v", err)
+	}
+	first, err := cachedEventSchemas(ctx)
+	if err != nil {
+		t.Fatalf("cachedEventSchemas failed: %v", err)
+	}
+	if again, _ := cachedEventSchemas(ctx); again != first {
+		t.Error("expected the schema set to be reused while nothing changed")
+	}
+
+	// Editing the flow file rebuilds the set
+	relaxed := strings.Replace(orderFlowYAML, "required: [id]", "required: []", 1)
+	if err := os.WriteFile(path, []byte(relaxed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateEventPayload(ctx, "orders.created", map[string]any{}); err != nil {
+		t.Errorf("expected the edited schema to accept the order, got %v", err)
+	}
+
+	// So does saving a flow to the repository
+	strict := strings.Replace(strings.Replace(orderFlowYAML, "order_audit", "order_strict", 1), "required: [id]", "required: [sku]", 1)
+	if _, err := SaveFlow(ctx, "order_strict", strict); err != nil {
+		t.Fatalf("SaveFlow failed: %v", err)
+	}
+	if err := validateEventPayload(ctx, "orders.created", map[string]any{}); !errors.Is(err, event.ErrInvalidPayload) {
+		t.Errorf("expected the saved flow's schema to apply, got %v", err)
+	}
+}
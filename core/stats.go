@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/awantoch/beemflow/model"
+)
+
+// defaultStatsWindow is how far back GetFlowStats looks when no start is given.
+const defaultStatsWindow = 24 * time.Hour
+
+// GetFlowStats returns per-flow run and step aggregates for the runs selected by q.
+// A zero q.Since defaults to the last 24 hours and a zero q.Until to now.
+func GetFlowStats(ctx context.Context, q model.StatsQuery) ([]*model.FlowStats, error) {
+	now := time.Now()
+	if q.Until.IsZero() {
+		q.Until = now
+	}
+	if q.Since.IsZero() {
+		q.Since = q.Until.Add(-defaultStatsWindow)
+	}
+	if !q.Since.Before(q.Until) {
+		return nil, fmt.Errorf("invalid stats window: since %s is not before until %s", q.Since.Format(time.RFC3339), q.Until.Format(time.RFC3339))
+	}
+	store, err := resolveStore(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return store.FlowStats(ctx, q)
+}
+
+// parseStatsTime parses a stats window bound given either as an RFC3339 time or as a duration
+// before now ("90m", "24h", "7d"). An empty string yields the zero time.
+func parseStatsTime(s string, now time.Time) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return now.Add(-time.Duration(n) * 24 * time.Hour), nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("invalid time %q: expected RFC3339 or a duration like 24h or 7d", s)
+	}
+	return now.Add(-d), nil
+}
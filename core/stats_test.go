@@ -0,0 +1,74 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+	"github.com/google/uuid"
+)
+
+func TestParseStatsTime(t *testing.T) {
+	now := time.Date(2025, 6, 10, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Time{
+		"":                     {},
+		"90m":                  now.Add(-90 * time.Minute),
+		"24h":                  now.Add(-24 * time.Hour),
+		"7d":                   now.Add(-7 * 24 * time.Hour),
+		"2025-06-01T00:00:00Z": time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for in, want := range cases {
+		got, err := parseStatsTime(in, now)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseStatsTime(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"yesterday", "-5h", "xd"} {
+		if _, err := parseStatsTime(bad, now); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
+
+func TestFlowStatsHandler(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	ctx := WithStore(context.Background(), store)
+	for i, status := range []model.RunStatus{model.RunSucceeded, model.RunFailed} {
+		started := time.Now().Add(-time.Duration(i+1) * time.Hour)
+		ended := started.Add(time.Second)
+		run := &model.Run{ID: uuid.New(), FlowName: "report", Status: status, StartedAt: started, EndedAt: &ended}
+		if err := store.SaveRun(ctx, run); err != nil {
+			t.Fatalf("SaveRun failed: %v", err)
+		}
+	}
+	old := time.Now().Add(-72 * time.Hour)
+	if err := store.SaveRun(ctx, &model.Run{ID: uuid.New(), FlowName: "report", Status: model.RunFailed, StartedAt: old}); err != nil {
+		t.Fatalf("SaveRun failed: %v", err)
+	}
+
+	result, err := flowStatsHandler(ctx, &FlowStatsArgs{})
+	if err != nil {
+		t.Fatalf("flowStatsHandler failed: %v", err)
+	}
+	stats := result.([]*model.FlowStats)
+	if len(stats) != 1 || stats[0].Runs != 2 || stats[0].SuccessRate != 0.5 {
+		t.Errorf("expected the default 24h window to hold 2 runs at 50%%, got %+v", stats)
+	}
+
+	result, err = flowStatsHandler(ctx, &FlowStatsArgs{Flow: "report", Since: "7d"})
+	if err != nil {
+		t.Fatalf("flowStatsHandler failed: %v", err)
+	}
+	if stats = result.([]*model.FlowStats); len(stats) != 1 || stats[0].Runs != 3 {
+		t.Errorf("expected 3 runs over 7 days, got %+v", stats)
+	}
+
+	if _, err := flowStatsHandler(ctx, &FlowStatsArgs{Since: "1h", Until: "2h"}); err == nil {
+		t.Errorf("expected error when since is after until")
+	}
+	if _, err := flowStatsHandler(ctx, &FlowStatsArgs{Since: "soon"}); err == nil {
+		t.Errorf("expected error for an unparseable since")
+	}
+}
@@ -0,0 +1,241 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sync"
+
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/event"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/utils"
+	"github.com/google/uuid"
+)
+
+// sharedBus is the event bus of the running server, set by InitializeDependencies. PublishEvent
+// uses it so events reach this process's event triggers, even with the in-memory driver.
+var (
+	sharedBusMu sync.RWMutex
+	sharedBus   event.EventBus
+)
+
+func setSharedEventBus(bus event.EventBus) {
+	sharedBusMu.Lock()
+	defer sharedBusMu.Unlock()
+	sharedBus = bus
+}
+
+// releaseSharedEventBus unsets bus as the shared bus, unless another one replaced it.
+func releaseSharedEventBus(bus event.EventBus) {
+	sharedBusMu.Lock()
+	defer sharedBusMu.Unlock()
+	if sharedBus == bus {
+		sharedBus = nil
+	}
+}
+
+func sharedEventBus() event.EventBus {
+	sharedBusMu.RLock()
+	defer sharedBusMu.RUnlock()
+	return sharedBus
+}
+
+// triggerSubs holds the event trigger subscriptions of the running server, set up by
+// InitializeDependencies. SaveFlow and DeleteFlow refresh them, so triggers follow flows saved
+// and deleted through the API without a restart.
+type triggerSubs struct {
+	mu   sync.Mutex
+	ctx  context.Context
+	bus  event.EventBus
+	subs []event.Subscription
+}
+
+var (
+	sharedTriggersMu sync.RWMutex
+	sharedTriggers   *triggerSubs
+)
+
+// subscribeTriggers subscribes the event triggers of every flow to bus and returns the set.
+func subscribeTriggers(ctx context.Context, bus event.EventBus) (*triggerSubs, error) {
+	subs, err := SubscribeEventTriggers(ctx, bus)
+	if err != nil {
+		return nil, err
+	}
+	return &triggerSubs{ctx: ctx, bus: bus, subs: subs}, nil
+}
+
+// refresh replaces the subscriptions with those of the current flows. The new ones are made
+// before the old ones close so no event is missed; a run started twice for one event in the
+// overlap is deduplicated by its deterministic run ID.
+func (t *triggerSubs) refresh() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	subs, err := SubscribeEventTriggers(t.ctx, t.bus)
+	if err != nil {
+		return err
+	}
+	closeSubscriptions(t.subs)
+	t.subs = subs
+	return nil
+}
+
+// close closes every subscription in the set.
+func (t *triggerSubs) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	closeSubscriptions(t.subs)
+	t.subs = nil
+}
+
+func closeSubscriptions(subs []event.Subscription) {
+	for _, sub := range subs {
+		if err := sub.Close(); err != nil {
+			utils.Warn("Failed to close event trigger subscription: %v", err)
+		}
+	}
+}
+
+func setSharedTriggers(t *triggerSubs) {
+	sharedTriggersMu.Lock()
+	defer sharedTriggersMu.Unlock()
+	sharedTriggers = t
+}
+
+// releaseSharedTriggers unsets t as the shared trigger set, unless another one replaced it.
+func releaseSharedTriggers(t *triggerSubs) {
+	sharedTriggersMu.Lock()
+	defer sharedTriggersMu.Unlock()
+	if sharedTriggers == t {
+		sharedTriggers = nil
+	}
+}
+
+// refreshEventTriggers resubscribes the running server's event triggers after a flow was
+// saved or deleted. It does nothing outside the server.
+func refreshEventTriggers(ctx context.Context) {
+	sharedTriggersMu.RLock()
+	t := sharedTriggers
+	sharedTriggersMu.RUnlock()
+	if t == nil {
+		return
+	}
+	if err := t.refresh(); err != nil {
+		utils.WarnCtx(ctx, "Failed to refresh event triggers", "error", err)
+	}
+}
+
+// eventTrigger is one entry of a flow's `on:` list that subscribes to events.
+type eventTrigger struct {
+	Patterns []string
+	Schema   any // JSON Schema the payloads must match, if declared
+}
+
+// eventTriggers returns a flow's event triggers:
+//
+//	on:
+//	  - event: orders.*
+//	    schema: {type: object, required: [id]}
+//	  - event: [github.>, gitlab.>]
+func eventTriggers(flow *model.Flow) []eventTrigger {
+	var entries []any
+	switch on := flow.On.(type) {
+	case []any:
+		entries = on
+	case map[string]any:
+		entries = []any{on}
+	}
+	var triggers []eventTrigger
+	for _, entry := range entries {
+		m, ok := entry.(map[string]any)
+		if !ok {
+			continue
+		}
+		var trigger eventTrigger
+		switch v := m[constants.TriggerKeyEvent].(type) {
+		case string:
+			trigger.Patterns = []string{v}
+		case []any:
+			for _, p := range v {
+				if s, ok := p.(string); ok {
+					trigger.Patterns = append(trigger.Patterns, s)
+				}
+			}
+		}
+		if len(trigger.Patterns) == 0 {
+			continue
+		}
+		trigger.Schema = m[constants.TriggerKeySchema]
+		triggers = append(triggers, trigger)
+	}
+	return triggers
+}
+
+// eventTriggerPatterns returns the topic patterns of a flow's event triggers.
+func eventTriggerPatterns(flow *model.Flow) []string {
+	var patterns []string
+	for _, trigger := range eventTriggers(flow) {
+		patterns = append(patterns, trigger.Patterns...)
+	}
+	return patterns
+}
+
+// SubscribeEventTriggers subscribes every flow with event triggers to bus, so that each
+// matching event starts a run of the flow. The run's event is the payload with the topic it
+// was published to added as `topic`. Events whose run fails to start are redelivered and
+// eventually dead-lettered by the bus. Flows that can't be loaded and invalid patterns are
+// logged and skipped. The subscriptions cover the flows that exist when it is called.
+func SubscribeEventTriggers(ctx context.Context, bus event.EventBus) ([]event.Subscription, error) {
+	names, err := ListFlows(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var subs []event.Subscription
+	for _, name := range names {
+		flow, err := parseFlowByName(ctx, name)
+		if err != nil || flow == nil {
+			utils.WarnCtx(ctx, "Skipping event triggers of unloadable flow", "flow", name, "error", err)
+			continue
+		}
+		for _, pattern := range eventTriggerPatterns(flow) {
+			flowName := name
+			sub, err := bus.SubscribeWithTopic(ctx, pattern, func(topic string, payload any) error {
+				return triggerFlow(ctx, flowName, topic, payload)
+			})
+			if err != nil {
+				utils.WarnCtx(ctx, "Skipping event trigger", "flow", name, "pattern", pattern, "error", err)
+				continue
+			}
+			utils.Debug("Flow %s subscribed to %s", name, pattern)
+			subs = append(subs, sub)
+		}
+	}
+	return subs, nil
+}
+
+// triggerFlow starts a run of flowName for an event published to topic. It only fails if no
+// run could be started.
+func triggerFlow(ctx context.Context, flowName, topic string, payload any) error {
+	eventData := map[string]any{}
+	if m, ok := payload.(map[string]any); ok {
+		maps.Copy(eventData, m)
+	} else if payload != nil {
+		eventData["payload"] = payload
+	}
+	eventData[constants.EventKeyTopic] = topic
+
+	runID, err := StartRun(ctx, flowName, eventData)
+	switch {
+	case runID == uuid.Nil && err != nil:
+		return fmt.Errorf("failed to start flow %s: %w", flowName, err)
+	case runID == uuid.Nil:
+		return fmt.Errorf("failed to start flow %s: flow not found", flowName)
+	case err != nil:
+		// The run started and failed on its own; delivering the event again won't help
+		utils.ErrorCtx(ctx, "Event-triggered run failed", "flow", flowName, "topic", topic,
+			"run_id", runID.String(), "error", err)
+		return nil
+	}
+	utils.InfoCtx(ctx, "Event triggered run", "flow", flowName, "topic", topic, "run_id", runID.String())
+	return nil
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/event"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+)
+
+func TestEventTriggerPatterns(t *testing.T) {
+	tests := []struct {
+		on   any
+		want []string
+	}{
+		{"cli.manual", nil},
+		{map[string]any{"event": "orders.*"}, []string{"orders.*"}},
+		{[]any{"cli.manual", map[string]any{"event": "github.>"}, map[string]any{"event": []any{"a", "b.*"}}}, []string{"github.>", "a", "b.*"}},
+	}
+	for _, tt := range tests {
+		got := eventTriggerPatterns(&model.Flow{On: tt.on})
+		if len(got) != len(tt.want) {
+			t.Errorf("eventTriggerPatterns(%v) = %v, want %v", tt.on, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("eventTriggerPatterns(%v) = %v, want %v", tt.on, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSubscribeEventTriggers(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldDir := flowsDir
+	SetFlowsDir(tmpDir)
+	defer SetFlowsDir(oldDir)
+
+	flowYAML := `name: order_audit
+on:
+  - event: orders.*
+steps:
+  - id: log
+    use: core.echo
+    with:
+      text: "{{ event.topic }} {{ event.id }}"
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "order_audit.flow.yaml"), []byte(flowYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	store := storage.NewMemoryStorage()
+	ctx := WithConfig(WithStore(context.Background(), store), &config.Config{})
+	bus := event.NewInProcEventBus()
+	defer bus.Close()
+
+	subs, err := SubscribeEventTriggers(ctx, bus)
+	if err != nil {
+		t.Fatalf("SubscribeEventTriggers failed: %v", err)
+	}
+	if len(subs) != 1 {
+		t.Fatalf("expected 1 subscription, got %d", len(subs))
+	}
+
+	if err := bus.Publish("payments.settled", map[string]any{"id": "p1"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if err := bus.Publish("orders.created", map[string]any{"id": "o1"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	var runs []*model.Run
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if runs, _ = store.ListRuns(ctx); len(runs) > 0 && runs[0].Status == model.RunSucceeded {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	runs, _ = store.ListRuns(ctx)
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 triggered run, got %d", len(runs))
+	}
+	run := runs[0]
+	if run.FlowName != "order_audit" || run.Event["topic"] != "orders.created" || run.Event["id"] != "o1" {
+		t.Errorf("unexpected run: flow %s, event %v", run.FlowName, run.Event)
+	}
+	steps, _ := store.GetSteps(ctx, run.ID)
+	if len(steps) != 1 || steps[0].Outputs["text"] != "orders.created o1" {
+		t.Errorf("expected the topic in the step output, got %+v", steps)
+	}
+}
+
+func TestTriggerSubs_FollowSavedAndDeletedFlows(t *testing.T) {
+	oldDir := flowsDir
+	SetFlowsDir(t.TempDir())
+	defer SetFlowsDir(oldDir)
+
+	store := storage.NewMemoryStorage()
+	ctx := WithConfig(WithStore(context.Background(), store), &config.Config{})
+	bus := event.NewInProcEventBus()
+	defer bus.Close()
+
+	triggers, err := subscribeTriggers(ctx, bus)
+	if err != nil {
+		t.Fatalf("subscribeTriggers failed: %v", err)
+	}
+	setSharedTriggers(triggers)
+	defer releaseSharedTriggers(triggers)
+	defer triggers.close()
+	if len(triggers.subs) != 0 {
+		t.Fatalf("expected no subscriptions without flows, got %d", len(triggers.subs))
+	}
+
+	flowYAML := `name: invoice_audit
+on:
+  - event: invoices.*
+steps:
+  - id: log
+    use: core.echo
+    with:
+      text: "{{ event.id }}"
+`
+	if _, err := SaveFlow(ctx, "invoice_audit", flowYAML); err != nil {
+		t.Fatalf("SaveFlow failed: %v", err)
+	}
+	if len(triggers.subs) != 1 {
+		t.Fatalf("expected the saved flow to be subscribed, got %d subscriptions", len(triggers.subs))
+	}
+	if err := bus.Publish("invoices.paid", map[string]any{"id": "i1"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if runs, _ := store.ListRuns(ctx); len(runs) == 1 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if runs, _ := store.ListRuns(ctx); len(runs) != 1 || runs[0].FlowName != "invoice_audit" {
+		t.Fatalf("expected one run of the saved flow, got %v", runs)
+	}
+
+	if err := DeleteFlow(ctx, "invoice_audit"); err != nil {
+		t.Fatalf("DeleteFlow failed: %v", err)
+	}
+	if len(triggers.subs) != 0 {
+		t.Errorf("expected the deleted flow to be unsubscribed, got %d subscriptions", len(triggers.subs))
+	}
+}
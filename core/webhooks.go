@@ -0,0 +1,292 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/dsl"
+	"github.com/awantoch/beemflow/utils"
+)
+
+// maxWebhookBytes caps the size of a webhook payload.
+const maxWebhookBytes = 5 << 20
+
+// defaultWebhookTolerance is how old a signed timestamp may be when the hook doesn't say.
+const defaultWebhookTolerance = 5 * time.Minute
+
+// errInvalidSignature is returned when a webhook request fails signature verification.
+var errInvalidSignature = errors.New("invalid webhook signature")
+
+// WebhookResult reports what a webhook request did.
+type WebhookResult struct {
+	Published string `json:"published,omitempty"` // topic the payload was published to
+	Resumed   string `json:"resumed,omitempty"`   // token of the run being resumed
+}
+
+// webhookHTTPHandler serves POST /hooks/{name} for the webhooks in the config.
+func webhookHTTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	name := r.PathValue("name")
+	var hook config.WebhookConfig
+	cfg := configFromContext(ctx)
+	ok := false
+	if cfg != nil {
+		hook, ok = cfg.Webhooks[name]
+	}
+	if !ok {
+		http.Error(w, fmt.Sprintf("webhook %q not found", name), http.StatusNotFound)
+		return
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := verifyWebhookSignature(hook, r.Header, body, time.Now()); err != nil {
+		status := http.StatusUnauthorized
+		if !errors.Is(err, errInvalidSignature) {
+			status = http.StatusInternalServerError
+		}
+		utils.WarnCtx(ctx, "Rejected webhook request", "webhook", name, "error", err)
+		http.Error(w, err.Error(), status)
+		return
+	}
+	payload, err := decodeWebhookPayload(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Slack confirms an Events API endpoint by expecting its challenge echoed back
+	if hook.Verify == "slack" && payload["type"] == "url_verification" {
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = io.WriteString(w, fmt.Sprint(payload["challenge"]))
+		return
+	}
+
+	result, err := HandleWebhook(ctx, name, hook, payload, r.Header, r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), httpErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		utils.ErrorCtx(ctx, "Failed to write webhook response", "error", err)
+	}
+}
+
+// HandleWebhook renders hook's topic and token templates for a verified request, publishes
+// payload to the topic and resumes the run paused on the token. The resumed run continues in
+// the background, so senders that expect a quick reply get one.
+func HandleWebhook(ctx context.Context, name string, hook config.WebhookConfig, payload map[string]any, header http.Header, query url.Values) (*WebhookResult, error) {
+	if hook.Topic == "" && hook.Token == "" {
+		return nil, fmt.Errorf("webhook %s has neither a topic nor a token", name)
+	}
+	data := map[string]any{
+		"name":    name,
+		"body":    payload,
+		"headers": webhookHeaders(header),
+		"query":   firstValues(query),
+	}
+	templater := dsl.NewTemplater()
+	render := func(field, tmpl string) (string, error) {
+		if tmpl == "" {
+			return "", nil
+		}
+		out, err := templater.Render(tmpl, data)
+		if err != nil {
+			return "", fmt.Errorf("failed to render %s of webhook %s: %w", field, name, err)
+		}
+		return strings.TrimSpace(out), nil
+	}
+	topic, err := render("topic", hook.Topic)
+	if err != nil {
+		return nil, err
+	}
+	token, err := render("token", hook.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &WebhookResult{}
+	if topic != "" {
+		if err := PublishEvent(ctx, topic, payload); err != nil {
+			return nil, err
+		}
+		result.Published = topic
+	}
+	if token != "" {
+		resumeCtx := context.WithoutCancel(ctx)
+		go func() {
+			if _, err := ResumeRun(resumeCtx, token, payload); err != nil {
+				utils.ErrorCtx(resumeCtx, "Failed to resume run from webhook", "webhook", name, "token", token, "error", err)
+			}
+		}()
+		result.Resumed = token
+	}
+	return result, nil
+}
+
+// decodeWebhookPayload decodes a JSON object or form-encoded body. An empty body is an empty
+// payload.
+func decodeWebhookPayload(contentType string, body []byte) (map[string]any, error) {
+	payload := map[string]any{}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil, fmt.Errorf("invalid form payload: %w", err)
+		}
+		return firstValues(values), nil
+	case len(strings.TrimSpace(string(body))) == 0:
+		return payload, nil
+	default:
+		if err := json.Unmarshal(body, &payload); err != nil {
+			return nil, fmt.Errorf("webhook payload must be a JSON object or a form: %w", err)
+		}
+		return payload, nil
+	}
+}
+
+// webhookHeaders exposes request headers to templates under lowercase names with "-" replaced
+// by "_", so headers.x_github_event works.
+func webhookHeaders(header http.Header) map[string]any {
+	out := make(map[string]any, len(header))
+	for k, v := range header {
+		if len(v) > 0 {
+			out[strings.ReplaceAll(strings.ToLower(k), "-", "_")] = v[0]
+		}
+	}
+	return out
+}
+
+// firstValues flattens multi-valued query or form values to their first value.
+func firstValues(values url.Values) map[string]any {
+	out := make(map[string]any, len(values))
+	for k, v := range values {
+		if len(v) > 0 {
+			out[k] = v[0]
+		}
+	}
+	return out
+}
+
+// verifyWebhookSignature checks body against the signature style configured for hook. Errors
+// that aren't errInvalidSignature are configuration mistakes.
+func verifyWebhookSignature(hook config.WebhookConfig, header http.Header, body []byte, now time.Time) error {
+	if hook.Verify == "" {
+		return nil
+	}
+	secret := hook.Secret
+	if name, ok := strings.CutPrefix(secret, "$env:"); ok {
+		secret = os.Getenv(name)
+	}
+	if secret == "" {
+		return fmt.Errorf("webhook secret is not set")
+	}
+	tolerance := defaultWebhookTolerance
+	if hook.Tolerance != "" {
+		d, err := time.ParseDuration(hook.Tolerance)
+		if err != nil {
+			return fmt.Errorf("invalid webhook tolerance %q: %w", hook.Tolerance, err)
+		}
+		tolerance = d
+	}
+
+	switch hook.Verify {
+	case "github":
+		sig, ok := strings.CutPrefix(header.Get("X-Hub-Signature-256"), "sha256=")
+		if !ok {
+			return fmt.Errorf("%w: missing X-Hub-Signature-256", errInvalidSignature)
+		}
+		return checkHMAC(secret, body, sig)
+	case "stripe":
+		var ts string
+		var sigs []string
+		for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+			switch k {
+			case "t":
+				ts = v
+			case "v1":
+				sigs = append(sigs, v)
+			}
+		}
+		if err := checkTimestamp(ts, now, tolerance); err != nil {
+			return err
+		}
+		signed := append([]byte(ts+"."), body...)
+		for _, sig := range sigs {
+			if checkHMAC(secret, signed, sig) == nil {
+				return nil
+			}
+		}
+		return errInvalidSignature
+	case "slack":
+		ts := header.Get("X-Slack-Request-Timestamp")
+		if err := checkTimestamp(ts, now, tolerance); err != nil {
+			return err
+		}
+		sig, ok := strings.CutPrefix(header.Get("X-Slack-Signature"), "v0=")
+		if !ok {
+			return fmt.Errorf("%w: missing X-Slack-Signature", errInvalidSignature)
+		}
+		return checkHMAC(secret, append([]byte("v0:"+ts+":"), body...), sig)
+	case "hmac":
+		name := hook.Header
+		if name == "" {
+			name = "X-Signature"
+		}
+		sig := strings.TrimPrefix(header.Get(name), "sha256=")
+		if sig == "" {
+			return fmt.Errorf("%w: missing %s", errInvalidSignature, name)
+		}
+		return checkHMAC(secret, body, sig)
+	default:
+		return fmt.Errorf("unknown webhook verification %q", hook.Verify)
+	}
+}
+
+// checkHMAC compares the hex HMAC-SHA256 of msg under secret with sig in constant time.
+func checkHMAC(secret string, msg []byte, sig string) error {
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return errInvalidSignature
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(msg)
+	if !hmac.Equal(got, mac.Sum(nil)) {
+		return errInvalidSignature
+	}
+	return nil
+}
+
+// checkTimestamp rejects Unix timestamps further than tolerance from now, which stops replays
+// of captured requests.
+func checkTimestamp(ts string, now time.Time, tolerance time.Duration) error {
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: missing or invalid timestamp", errInvalidSignature)
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+		return fmt.Errorf("%w: timestamp outside the %s tolerance", errInvalidSignature, tolerance)
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/event"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+)
+
+func signHex(secret, msg string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(msg))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	const secret = "s3cret"
+	body := `{"id":"evt_1"}`
+	now := time.Unix(1700000000, 0)
+	ts := strconv.FormatInt(now.Unix(), 10)
+	stale := strconv.FormatInt(now.Add(-10*time.Minute).Unix(), 10)
+	t.Setenv("HOOK_SECRET", secret)
+
+	tests := []struct {
+		name    string
+		hook    config.WebhookConfig
+		header  map[string]string
+		wantErr bool
+	}{
+		{"no verification", config.WebhookConfig{}, nil, false},
+		{"github", config.WebhookConfig{Verify: "github", Secret: secret},
+			map[string]string{"X-Hub-Signature-256": "sha256=" + signHex(secret, body)}, false},
+		{"github secret from env", config.WebhookConfig{Verify: "github", Secret: "$env:HOOK_SECRET"},
+			map[string]string{"X-Hub-Signature-256": "sha256=" + signHex(secret, body)}, false},
+		{"github wrong secret", config.WebhookConfig{Verify: "github", Secret: secret},
+			map[string]string{"X-Hub-Signature-256": "sha256=" + signHex("other", body)}, true},
+		{"github missing header", config.WebhookConfig{Verify: "github", Secret: secret}, nil, true},
+		{"stripe", config.WebhookConfig{Verify: "stripe", Secret: secret},
+			map[string]string{"Stripe-Signature": "t=" + ts + ",v1=deadbeef,v1=" + signHex(secret, ts+"."+body)}, false},
+		{"stripe stale", config.WebhookConfig{Verify: "stripe", Secret: secret},
+			map[string]string{"Stripe-Signature": "t=" + stale + ",v1=" + signHex(secret, stale+"."+body)}, true},
+		{"stripe wider tolerance", config.WebhookConfig{Verify: "stripe", Secret: secret, Tolerance: "15m"},
+			map[string]string{"Stripe-Signature": "t=" + stale + ",v1=" + signHex(secret, stale+"."+body)}, false},
+		{"slack", config.WebhookConfig{Verify: "slack", Secret: secret},
+			map[string]string{"X-Slack-Request-Timestamp": ts, "X-Slack-Signature": "v0=" + signHex(secret, "v0:"+ts+":"+body)}, false},
+		{"slack tampered timestamp", config.WebhookConfig{Verify: "slack", Secret: secret},
+			map[string]string{"X-Slack-Request-Timestamp": ts, "X-Slack-Signature": "v0=" + signHex(secret, "v0:"+stale+":"+body)}, true},
+		{"hmac custom header", config.WebhookConfig{Verify: "hmac", Secret: secret, Header: "X-Airtable-Signature"},
+			map[string]string{"X-Airtable-Signature": signHex(secret, body)}, false},
+		{"hmac default header", config.WebhookConfig{Verify: "hmac", Secret: secret},
+			map[string]string{"X-Signature": "not-hex"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			for k, v := range tt.header {
+				header.Set(k, v)
+			}
+			err := verifyWebhookSignature(tt.hook, header, []byte(body), now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verifyWebhookSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, errInvalidSignature) {
+				t.Errorf("expected errInvalidSignature, got %v", err)
+			}
+		})
+	}
+
+	if err := verifyWebhookSignature(config.WebhookConfig{Verify: "github", Secret: "$env:UNSET_HOOK_SECRET"}, http.Header{}, nil, now); err == nil || errors.Is(err, errInvalidSignature) {
+		t.Errorf("expected a configuration error for a missing secret, got %v", err)
+	}
+}
+
+func TestWebhook_PublishesAndResumes(t *testing.T) {
+	tmpDir := t.TempDir()
+	oldDir := flowsDir
+	SetFlowsDir(tmpDir)
+	defer SetFlowsDir(oldDir)
+	flowYAML := `name: await_approval
+on: cli.manual
+steps:
+  - id: wait
+    await_event:
+      source: airtable
+      match:
+        token: "{{ event.token }}"
+  - id: done
+    use: core.echo
+    with:
+      text: "{{ event.status }}"
+`
+	if err := os.WriteFile(filepath.Join(tmpDir, "await_approval.flow.yaml"), []byte(flowYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	const secret = "gh-secret"
+	store := storage.NewMemoryStorage()
+	cfg := &config.Config{Webhooks: map[string]config.WebhookConfig{
+		"github":   {Topic: "github.{{ headers.x_github_event }}", Verify: "github", Secret: secret},
+		"airtable": {Token: "{{ body.record }}"},
+	}}
+	ctx := WithConfig(WithStore(context.Background(), store), cfg)
+	bus := event.NewInProcEventBus()
+	defer bus.Close()
+	setSharedEventBus(bus)
+	defer releaseSharedEventBus(bus)
+
+	post := func(name, contentType, body string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/hooks/"+name, strings.NewReader(body)).WithContext(ctx)
+		req.SetPathValue("name", name)
+		req.Header.Set("Content-Type", contentType)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		webhookHTTPHandler(rec, req)
+		return rec
+	}
+
+	received := make(chan any, 1)
+	if _, err := bus.Subscribe(ctx, "github.push", func(payload any) { received <- payload }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	body := `{"ref":"refs/heads/main"}`
+	if rec := post("github", "application/json", body, map[string]string{"X-GitHub-Event": "push"}); rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected an unsigned request to be rejected, got %d", rec.Code)
+	}
+	rec := post("github", "application/json", body, map[string]string{
+		"X-GitHub-Event":      "push",
+		"X-Hub-Signature-256": "sha256=" + signHex(secret, body),
+	})
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var result WebhookResult
+	if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil || result.Published != "github.push" {
+		t.Errorf("unexpected response %s (%v)", rec.Body.String(), err)
+	}
+	select {
+	case payload := <-received:
+		if m, _ := payload.(map[string]any); m["ref"] != "refs/heads/main" {
+			t.Errorf("unexpected payload %v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("webhook payload was not published")
+	}
+
+	if _, err := StartRun(ctx, "await_approval", map[string]any{"token": "rec42"}); err != nil && !strings.Contains(err.Error(), "is waiting for event") {
+		t.Fatalf("StartRun failed: %v", err)
+	}
+	if rec := post("airtable", "application/x-www-form-urlencoded", "record=rec42&status=approved", nil); rec.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var runs []*model.Run
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		if runs, _ = store.ListRuns(ctx); len(runs) == 1 && runs[0].Status == model.RunSucceeded {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(runs) != 1 || runs[0].Status != model.RunSucceeded {
+		t.Fatalf("expected the webhook to resume the run, got %+v", runs)
+	}
+
+	if rec := post("missing", "application/json", "{}", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown webhook, got %d", rec.Code)
+	}
+	if rec := post("airtable", "application/json", "[1,2]", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a non-object payload, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,319 @@
+// Package encryption implements envelope encryption for data BeemFlow keeps at rest.
+//
+// Every encrypted value gets its own random data key (AES-256-GCM). The data key is wrapped
+// by a KeyProvider's key-encryption key and stored, with the ID of that key, in the value's
+// header, so rotating the key-encryption key never makes existing data unreadable: old keys
+// stay available for decryption while new data uses the current one.
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// KeyProvider manages key-encryption keys. LocalKeyProvider keeps them in a key file; other
+// implementations can delegate wrapping to a KMS without BeemFlow ever seeing the keys.
+type KeyProvider interface {
+	// CurrentKeyID returns the ID of the key new data keys are wrapped with.
+	CurrentKeyID() string
+	// GenerateDataKey returns a new 32-byte data key in plaintext and wrapped under the
+	// current key, together with that key's ID.
+	GenerateDataKey(ctx context.Context) (plaintext, wrapped []byte, keyID string, err error)
+	// DecryptDataKey unwraps a data key wrapped under keyID.
+	DecryptDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Envelope layout:
+//
+//	magic "BFE1" | keyID length (1 byte) | keyID | wrapped key length (2 bytes) | wrapped key |
+//	nonce prefix (7 bytes) | segments
+//
+// The plaintext is sealed in segments of segmentSize bytes so it can be streamed. Each
+// segment's nonce is the prefix, a 4-byte counter and a final-segment flag, and the header is
+// authenticated with every segment, so segments cannot be reordered, dropped or moved
+// between envelopes.
+const (
+	magic       = "BFE1"
+	segmentSize = 64 << 10
+	prefixSize  = 7
+	dataKeySize = 32
+)
+
+// ErrNotEncrypted is returned when data does not start with an envelope header.
+var ErrNotEncrypted = errors.New("data is not encrypted")
+
+// Envelope encrypts and decrypts data with keys from a KeyProvider.
+type Envelope struct {
+	provider KeyProvider
+}
+
+// New returns an Envelope that uses provider's keys.
+func New(provider KeyProvider) *Envelope {
+	return &Envelope{provider: provider}
+}
+
+// CurrentKeyID returns the ID of the key new data is encrypted with.
+func (e *Envelope) CurrentKeyID() string {
+	return e.provider.CurrentKeyID()
+}
+
+// Encrypt returns plaintext sealed in an envelope.
+func (e *Envelope) Encrypt(ctx context.Context, plaintext []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := e.NewWriter(ctx, &buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(plaintext); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Decrypt opens an envelope produced by Encrypt or NewWriter.
+func (e *Envelope) Decrypt(ctx context.Context, data []byte) ([]byte, error) {
+	r, err := e.NewReader(ctx, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// IsEncrypted reports whether data starts with an envelope header.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// KeyID returns the ID of the key that wrapped the data key of the envelope starting data.
+func KeyID(data []byte) (string, error) {
+	return ReadKeyID(bytes.NewReader(data))
+}
+
+// ReadKeyID reads an envelope header from r and returns the ID of the key that wrapped its
+// data key, or ErrNotEncrypted.
+func ReadKeyID(r io.Reader) (string, error) {
+	h, err := readHeader(bufio.NewReader(r))
+	if err != nil {
+		return "", err
+	}
+	return h.keyID, nil
+}
+
+// NewWriter returns a writer that encrypts everything written to it into w. The envelope is
+// only complete once Close has been called; Close does not close w.
+func (e *Envelope) NewWriter(ctx context.Context, w io.Writer) (io.WriteCloser, error) {
+	dataKey, wrapped, keyID, err := e.provider.GenerateDataKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	if len(keyID) > 255 || len(wrapped) > 65535 {
+		return nil, fmt.Errorf("key ID or wrapped data key too long")
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+	h := header{keyID: keyID, wrapped: wrapped, prefix: prefix}
+	raw := h.encode()
+	if _, err := w.Write(raw); err != nil {
+		return nil, err
+	}
+	return &writer{w: w, aead: aead, prefix: prefix, aad: raw, buf: make([]byte, 0, segmentSize)}, nil
+}
+
+// NewReader returns a reader that decrypts the envelope read from r. Data that is not
+// encrypted is passed through unchanged, so values written before encryption was enabled
+// stay readable.
+func (e *Envelope) NewReader(ctx context.Context, r io.Reader) (io.Reader, error) {
+	br := bufio.NewReaderSize(r, segmentSize+64)
+	if head, _ := br.Peek(len(magic)); string(head) != magic {
+		return br, nil
+	}
+	h, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	dataKey, err := e.provider.DecryptDataKey(ctx, h.keyID, h.wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt data key (key %q): %w", h.keyID, err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return &reader{r: br, aead: aead, prefix: h.prefix, aad: h.encode()}, nil
+}
+
+type header struct {
+	keyID   string
+	wrapped []byte
+	prefix  []byte
+}
+
+func (h header) encode() []byte {
+	out := make([]byte, 0, len(magic)+1+len(h.keyID)+2+len(h.wrapped)+len(h.prefix))
+	out = append(out, magic...)
+	out = append(out, byte(len(h.keyID)))
+	out = append(out, h.keyID...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(h.wrapped)))
+	out = append(out, h.wrapped...)
+	return append(out, h.prefix...)
+}
+
+func readHeader(r *bufio.Reader) (header, error) {
+	var h header
+	head := make([]byte, len(magic)+1)
+	if _, err := io.ReadFull(r, head); err != nil || string(head[:len(magic)]) != magic {
+		return h, ErrNotEncrypted
+	}
+	keyID := make([]byte, head[len(magic)])
+	var wrappedLen uint16
+	if _, err := io.ReadFull(r, keyID); err != nil {
+		return h, errTruncated
+	}
+	if err := binary.Read(r, binary.BigEndian, &wrappedLen); err != nil {
+		return h, errTruncated
+	}
+	h.keyID = string(keyID)
+	h.wrapped = make([]byte, wrappedLen)
+	h.prefix = make([]byte, prefixSize)
+	if _, err := io.ReadFull(r, h.wrapped); err != nil {
+		return h, errTruncated
+	}
+	if _, err := io.ReadFull(r, h.prefix); err != nil {
+		return h, errTruncated
+	}
+	return h, nil
+}
+
+var errTruncated = errors.New("encrypted data is truncated")
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func segmentNonce(prefix []byte, counter uint32, final bool) []byte {
+	nonce := make([]byte, 0, prefixSize+5)
+	nonce = append(nonce, prefix...)
+	nonce = binary.BigEndian.AppendUint32(nonce, counter)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// writer buffers one segment and seals it once more data arrives, so the last segment is
+// only written, with the final flag, by Close.
+type writer struct {
+	w       io.Writer
+	aead    cipher.AEAD
+	prefix  []byte
+	aad     []byte
+	buf     []byte
+	counter uint32
+	closed  bool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	if w.closed {
+		return 0, errors.New("write to closed encryption writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(w.buf) == segmentSize {
+			if err := w.flush(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(w.buf[len(w.buf):segmentSize], p)
+		w.buf = w.buf[:len(w.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (w *writer) Close() error {
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.flush(true)
+}
+
+func (w *writer) flush(final bool) error {
+	if w.counter == ^uint32(0) {
+		return errors.New("encrypted data too large")
+	}
+	sealed := w.aead.Seal(nil, segmentNonce(w.prefix, w.counter, final), w.buf, w.aad)
+	w.counter++
+	w.buf = w.buf[:0]
+	_, err := w.w.Write(sealed)
+	return err
+}
+
+// reader opens one segment at a time. A full-size segment is final only if nothing follows it.
+type reader struct {
+	r       *bufio.Reader
+	aead    cipher.AEAD
+	prefix  []byte
+	aad     []byte
+	plain   []byte
+	counter uint32
+	done    bool
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *reader) next() error {
+	sealed := make([]byte, segmentSize+r.aead.Overhead())
+	n, err := io.ReadFull(r.r, sealed)
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		r.done = true
+	case err != nil:
+		return err
+	default:
+		if _, peekErr := r.r.Peek(1); peekErr == io.EOF {
+			r.done = true
+		}
+	}
+	plain, err := r.aead.Open(nil, segmentNonce(r.prefix, r.counter, r.done), sealed[:n], r.aad)
+	if err != nil {
+		return errors.New("encrypted data is corrupt or was tampered with")
+	}
+	r.counter++
+	r.plain = plain
+	return nil
+}
@@ -0,0 +1,163 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestEnvelope(t *testing.T) (*Envelope, string) {
+	t.Helper()
+	keyFile := filepath.Join(t.TempDir(), "keys.json")
+	if _, err := RotateKeyFile(keyFile); err != nil {
+		t.Fatalf("RotateKeyFile failed: %v", err)
+	}
+	provider, err := LoadKeyFile(keyFile)
+	if err != nil {
+		t.Fatalf("LoadKeyFile failed: %v", err)
+	}
+	return New(provider), keyFile
+}
+
+func TestEnvelope_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	env, _ := newTestEnvelope(t)
+	for _, size := range []int{0, 1, segmentSize - 1, segmentSize, segmentSize + 1, 3*segmentSize + 17} {
+		plaintext := make([]byte, size)
+		if _, err := rand.Read(plaintext); err != nil {
+			t.Fatal(err)
+		}
+		sealed, err := env.Encrypt(ctx, plaintext)
+		if err != nil {
+			t.Fatalf("Encrypt(%d bytes) failed: %v", size, err)
+		}
+		if !IsEncrypted(sealed) || (size > 16 && bytes.Contains(sealed, plaintext[:16])) {
+			t.Errorf("size %d: output does not look encrypted", size)
+		}
+		got, err := env.Decrypt(ctx, sealed)
+		if err != nil {
+			t.Fatalf("Decrypt(%d bytes) failed: %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: round trip mismatch", size)
+		}
+	}
+}
+
+func TestEnvelope_DetectsTampering(t *testing.T) {
+	ctx := context.Background()
+	env, _ := newTestEnvelope(t)
+	plaintext := bytes.Repeat([]byte("secret "), segmentSize/3)
+	sealed, err := env.Encrypt(ctx, plaintext)
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+
+	flipped := bytes.Clone(sealed)
+	flipped[len(flipped)-1] ^= 1
+	if _, err := env.Decrypt(ctx, flipped); err == nil {
+		t.Error("expected error for a modified ciphertext")
+	}
+	// Dropping the final segment must not yield a shorter, valid plaintext
+	lastSegment := len(plaintext)%segmentSize + 16
+	if _, err := env.Decrypt(ctx, sealed[:len(sealed)-lastSegment]); err == nil {
+		t.Error("expected error for a truncated ciphertext")
+	}
+}
+
+func TestEnvelope_PassesPlaintextThrough(t *testing.T) {
+	env, _ := newTestEnvelope(t)
+	got, err := env.Decrypt(context.Background(), []byte(`{"legacy":true}`))
+	if err != nil || string(got) != `{"legacy":true}` {
+		t.Errorf("Decrypt(plaintext) = %q, %v", got, err)
+	}
+	if _, err := KeyID([]byte("plain")); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("expected ErrNotEncrypted, got %v", err)
+	}
+}
+
+func TestRotateKeyFile(t *testing.T) {
+	ctx := context.Background()
+	env, keyFile := newTestEnvelope(t)
+	oldKey := env.CurrentKeyID()
+	sealed, err := env.Encrypt(ctx, []byte("before rotation"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if fi, err := os.Stat(keyFile); err != nil || fi.Mode().Perm() != 0o600 {
+		t.Errorf("key file should be private, got %v, %v", fi.Mode(), err)
+	}
+
+	newKey, err := RotateKeyFile(keyFile)
+	if err != nil {
+		t.Fatalf("RotateKeyFile failed: %v", err)
+	}
+	provider, err := LoadKeyFile(keyFile)
+	if err != nil {
+		t.Fatalf("LoadKeyFile failed: %v", err)
+	}
+	if newKey == oldKey || provider.CurrentKeyID() != newKey || len(provider.KeyIDs()) != 2 {
+		t.Errorf("unexpected key ring after rotation: current %s, keys %v", provider.CurrentKeyID(), provider.KeyIDs())
+	}
+	rotated := New(provider)
+	got, err := rotated.Decrypt(ctx, sealed)
+	if err != nil || string(got) != "before rotation" {
+		t.Errorf("old data after rotation: %q, %v", got, err)
+	}
+	resealed, _ := rotated.Encrypt(ctx, got)
+	if id, _ := KeyID(resealed); id != newKey {
+		t.Errorf("expected new data under %s, got %s", newKey, id)
+	}
+	if id, _ := KeyID(sealed); id != oldKey {
+		t.Errorf("expected old data under %s, got %s", oldKey, id)
+	}
+}
+
+func TestLoadKeyFile_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := LoadKeyFile(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected error for a missing key file")
+	}
+	bad := filepath.Join(dir, "bad.json")
+	os.WriteFile(bad, []byte(`{"current":"a","keys":{"a":"dG9vIHNob3J0"}}`), 0o600)
+	if _, err := LoadKeyFile(bad); err == nil {
+		t.Error("expected error for a short key")
+	}
+	if _, err := NewLocalKeyProvider(&KeyFile{Current: "b", Keys: map[string]string{"a": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="}}); err == nil {
+		t.Error("expected error when the current key is missing")
+	}
+}
+
+func TestEnvelope_Streaming(t *testing.T) {
+	ctx := context.Background()
+	env, _ := newTestEnvelope(t)
+	plaintext := bytes.Repeat([]byte("0123456789"), segmentSize/4)
+	var sealed bytes.Buffer
+	w, err := env.NewWriter(ctx, &sealed)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	for rest := plaintext; len(rest) > 0; {
+		n := min(1000, len(rest))
+		if _, err := w.Write(rest[:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		rest = rest[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	r, err := env.NewReader(ctx, &sealed)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("streamed round trip failed: %v", err)
+	}
+}
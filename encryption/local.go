@@ -0,0 +1,175 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var _ KeyProvider = (*LocalKeyProvider)(nil)
+
+// KeyFile is the on-disk format of a local key ring: base64-encoded 32-byte keys by ID, and
+// the ID of the key used for new data.
+type KeyFile struct {
+	Current string            `json:"current"`
+	Keys    map[string]string `json:"keys"`
+}
+
+// LocalKeyProvider wraps data keys with AES-256-GCM keys read from a key file.
+type LocalKeyProvider struct {
+	current string
+	keys    map[string][]byte
+}
+
+// NewLocalKeyProvider returns a provider for an in-memory key ring.
+func NewLocalKeyProvider(kf *KeyFile) (*LocalKeyProvider, error) {
+	if kf == nil || len(kf.Keys) == 0 {
+		return nil, errors.New("key file has no keys")
+	}
+	p := &LocalKeyProvider{current: kf.Current, keys: make(map[string][]byte, len(kf.Keys))}
+	for id, encoded := range kf.Keys {
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != dataKeySize {
+			return nil, fmt.Errorf("key %q must be %d base64-encoded bytes", id, dataKeySize)
+		}
+		if len(id) > 255 {
+			return nil, fmt.Errorf("key ID %q is too long", id)
+		}
+		p.keys[id] = key
+	}
+	if _, ok := p.keys[p.current]; !ok {
+		return nil, fmt.Errorf("current key %q is not in the key file", kf.Current)
+	}
+	return p, nil
+}
+
+// LoadKeyFile reads a key file and returns a provider for it.
+func LoadKeyFile(path string) (*LocalKeyProvider, error) {
+	kf, err := readKeyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewLocalKeyProvider(kf)
+}
+
+// RotateKeyFile adds a new random key to the key file at path and makes it current, creating
+// the file if it does not exist. Older keys are kept so existing data stays readable; remove
+// them once everything has been re-encrypted with the new key. It returns the new key's ID.
+func RotateKeyFile(path string) (string, error) {
+	kf, err := readKeyFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		kf = &KeyFile{Keys: map[string]string{}}
+	} else if err != nil {
+		return "", err
+	}
+	key := make([]byte, dataKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	id := "k" + time.Now().UTC().Format("20060102T150405Z")
+	for n := 2; kf.Keys[id] != ""; n++ {
+		id = fmt.Sprintf("k%s-%d", time.Now().UTC().Format("20060102T150405Z"), n)
+	}
+	kf.Keys[id] = base64.StdEncoding.EncodeToString(key)
+	kf.Current = id
+	if err := writeKeyFile(path, kf); err != nil {
+		return "", err
+	}
+	return id, nil
+}
+
+// KeyIDs returns the IDs of all keys in the ring, sorted.
+func (p *LocalKeyProvider) KeyIDs() []string {
+	ids := make([]string, 0, len(p.keys))
+	for id := range p.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// CurrentKeyID returns the ID of the key new data keys are wrapped with.
+func (p *LocalKeyProvider) CurrentKeyID() string {
+	return p.current
+}
+
+// GenerateDataKey returns a random data key wrapped under the current key.
+func (p *LocalKeyProvider) GenerateDataKey(ctx context.Context) ([]byte, []byte, string, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, nil, "", err
+	}
+	aead, err := newAEAD(p.keys[p.current])
+	if err != nil {
+		return nil, nil, "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, "", err
+	}
+	wrapped := aead.Seal(nonce, nonce, dataKey, []byte(p.current))
+	return dataKey, wrapped, p.current, nil
+}
+
+// DecryptDataKey unwraps a data key wrapped under keyID.
+func (p *LocalKeyProvider) DecryptDataKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %q is not in the key file", keyID)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, errors.New("wrapped data key is truncated")
+	}
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	return aead.Open(nil, nonce, sealed, []byte(keyID))
+}
+
+func readKeyFile(path string) (*KeyFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var kf KeyFile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("invalid key file %s: %w", path, err)
+	}
+	return &kf, nil
+}
+
+// writeKeyFile replaces the key file atomically, readable only by its owner.
+func writeKeyFile(path string, kf *KeyFile) error {
+	data, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,59 @@
+package encryption
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/awantoch/beemflow/config"
+)
+
+// ProviderFactory creates a KeyProvider from the options in the encryption config.
+type ProviderFactory func(ctx context.Context, options map[string]string) (KeyProvider, error)
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]ProviderFactory{}
+)
+
+// RegisterProvider makes a KeyProvider, such as a KMS client, available as encryption.provider
+// in flow.config.json.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = factory
+}
+
+// NewFromConfig returns the Envelope described by cfg, or nil if encryption is not configured.
+func NewFromConfig(ctx context.Context, cfg *config.EncryptionConfig) (*Envelope, error) {
+	if cfg == nil {
+		return nil, nil
+	}
+	if cfg.Provider == "" || cfg.Provider == "local" {
+		keyFile := cfg.KeyFile
+		if keyFile == "" {
+			keyFile = config.DefaultKeyFile
+		}
+		provider, err := LoadKeyFile(keyFile)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("encryption key file %s does not exist (create it with 'flow keys rotate')", keyFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to load encryption key file: %w", err)
+		}
+		return New(provider), nil
+	}
+	providersMu.RLock()
+	factory, ok := providers[cfg.Provider]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unsupported encryption provider: %s", cfg.Provider)
+	}
+	provider, err := factory(ctx, cfg.Options)
+	if err != nil {
+		return nil, err
+	}
+	return New(provider), nil
+}
@@ -0,0 +1,116 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/utils"
+	"github.com/google/uuid"
+)
+
+// An await_event step resumes on an event published to its `source` topic whose payload
+// matches every field in `match`. Match values are rendered against the run when it pauses,
+// so `record_id: "{{ outputs.create.id }}"` compares the incoming record_id with the id the
+// run created. A `match.token` also keys the paused run, so POST /resume/{token} and the
+// resume.<token> topic keep working; without one the run gets a token of its own.
+
+const (
+	// matchKeyField and matchKeyEquals together require the payload field named by `field`
+	// to equal `equals`, as in `field: Status, equals: Approved`.
+	matchKeyField  = "field"
+	matchKeyEquals = "equals"
+)
+
+// renderAwaitMatch renders the step's match values against the run's context. Templated
+// values keep the type they evaluate to; other values are used as written.
+func (e *Engine) renderAwaitMatch(ctx context.Context, step *model.Step, stepCtx *StepContext) (map[string]any, error) {
+	match := step.AwaitEvent.Match
+	rendered := make(map[string]any, len(match))
+	if len(match) == 0 {
+		return rendered, nil
+	}
+	if err := e.loadReferencedBlobs(ctx, stepCtx, match); err != nil {
+		return nil, err
+	}
+	data := e.prepareTemplateDataAsMap(stepCtx)
+	for k, v := range match {
+		tmpl, ok := v.(string)
+		if !ok {
+			rendered[k] = v
+			continue
+		}
+		value, err := e.Templater.EvaluateExpression(tmpl, data)
+		if err != nil {
+			return nil, utils.Errorf(constants.ErrFailedToRenderMatch, k, err)
+		}
+		rendered[k] = value
+	}
+	return rendered, nil
+}
+
+// awaitToken returns the token that keys the paused run: the rendered match.token, or one
+// derived from the run and step when the step matches on other fields only.
+func awaitToken(step *model.Step, match map[string]any, runID uuid.UUID) (string, error) {
+	if raw, ok := match[constants.MatchKeyToken]; ok && raw != nil {
+		if token := fmt.Sprint(raw); token != constants.EmptyString {
+			return token, nil
+		}
+	}
+	if step.AwaitEvent.Source == constants.EmptyString {
+		return constants.EmptyString, utils.Errorf(constants.ErrAwaitEventMissingToken)
+	}
+	return runID.String() + "-" + step.ID, nil
+}
+
+// matchesAwait reports whether payload satisfies every rendered match field.
+func matchesAwait(match map[string]any, payload map[string]any) bool {
+	field, hasField := match[matchKeyField].(string)
+	equals, hasEquals := match[matchKeyEquals]
+	pair := hasField && hasEquals
+	for k, want := range match {
+		if pair && (k == matchKeyField || k == matchKeyEquals) {
+			continue
+		}
+		if !sameMatchValue(payloadValue(payload, k), want) {
+			return false
+		}
+	}
+	return !pair || sameMatchValue(payloadValue(payload, field), equals)
+}
+
+// payloadValue looks up key in payload, falling back to a dotted path into nested objects.
+func payloadValue(payload map[string]any, key string) any {
+	if v, ok := payload[key]; ok {
+		return v
+	}
+	if !strings.Contains(key, ".") {
+		return nil
+	}
+	current := payload
+	parts := strings.Split(key, ".")
+	for i, part := range parts {
+		v, ok := current[part]
+		if !ok {
+			return nil
+		}
+		if i == len(parts)-1 {
+			return v
+		}
+		if current, ok = v.(map[string]any); !ok {
+			return nil
+		}
+	}
+	return nil
+}
+
+// sameMatchValue compares a payload value with a match value by their printed form, so a
+// number decoded from JSON equals the same number written in YAML or rendered by a template.
+func sameMatchValue(got, want any) bool {
+	if got == nil || want == nil {
+		return got == want
+	}
+	return fmt.Sprint(got) == fmt.Sprint(want)
+}
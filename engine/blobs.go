@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/awantoch/beemflow/blob"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/utils"
+	"github.com/google/uuid"
+)
+
+// Large step outputs are kept out of run state: offloadOutputs moves each top-level output
+// value whose encoding exceeds OffloadThreshold to the blob store and leaves a model.BlobRef
+// in its place, which is what gets persisted with the step and any paused run. Templates see
+// the original value: before rendering, loadReferencedBlobs fetches the references of the
+// steps a template mentions, and prepareTemplateDataAsMap swaps them in. Loaded values are
+// cached on the StepContext, so each blob is read at most once per run.
+
+const (
+	mimeJSON = "application/json"
+	mimeText = "text/plain; charset=utf-8"
+)
+
+// offloadOutputs returns outputs with oversized values replaced by blob references.
+// The adapter's map is never modified; a value that fails to upload stays inline.
+func (e *Engine) offloadOutputs(ctx context.Context, stepID string, outputs map[string]any) map[string]any {
+	if e.BlobStore == nil || e.OffloadThreshold <= 0 || len(outputs) == 0 {
+		return outputs
+	}
+	var result map[string]any
+	for k, v := range outputs {
+		if _, ok := model.AsBlobRef(v); ok {
+			continue
+		}
+		data, mime, ext, ok := encodeOutputValue(v)
+		if !ok || len(data) <= e.OffloadThreshold {
+			continue
+		}
+		url, err := blob.PutStream(ctx, e.BlobStore, bytes.NewReader(data), mime, "outputs/"+uuid.NewString()+ext)
+		if err != nil {
+			utils.WarnCtx(ctx, "Failed to offload output, keeping it inline", "step", stepID, "field", k, "error", err)
+			continue
+		}
+		if result == nil {
+			result = copyMap(outputs)
+		}
+		result[k] = model.BlobRef{URL: url, Mime: mime, Size: int64(len(data))}.Map()
+		utils.Debug("Offloaded output %s.%s (%d bytes) to %s", stepID, k, len(data), url)
+	}
+	if result == nil {
+		return outputs
+	}
+	return result
+}
+
+// encodeOutputValue serializes an output value for the blob store: strings as text so they
+// come back unchanged, everything else as JSON.
+func encodeOutputValue(v any) (data []byte, mime, ext string, ok bool) {
+	if s, isString := v.(string); isString {
+		return []byte(s), mimeText, ".txt", true
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, "", "", false
+	}
+	return data, mimeJSON, ".json", true
+}
+
+// loadReferencedBlobs loads the offloaded outputs of every step that templates (a string, or
+// a nested map/slice of strings) mention, so the next prepareTemplateDataAsMap inlines them.
+func (e *Engine) loadReferencedBlobs(ctx context.Context, stepCtx *StepContext, templates any) error {
+	for stepID, out := range stepCtx.Snapshot().Outputs {
+		fields, ok := out.(map[string]any)
+		if !ok || !templateMentions(templates, stepID) {
+			continue
+		}
+		for _, v := range fields {
+			ref, ok := model.AsBlobRef(v)
+			if !ok {
+				continue
+			}
+			if _, loaded := stepCtx.loadedBlob(ref.URL); loaded {
+				continue
+			}
+			val, err := e.loadBlob(ctx, ref)
+			if err != nil {
+				return utils.Errorf("failed to load offloaded output of step %s from %s: %w", stepID, ref.URL, err)
+			}
+			stepCtx.setLoadedBlob(ref.URL, val)
+		}
+	}
+	return nil
+}
+
+// loadBlob reads and decodes the value behind ref.
+func (e *Engine) loadBlob(ctx context.Context, ref model.BlobRef) (any, error) {
+	if e.BlobStore == nil {
+		return nil, utils.Errorf("no blob store configured")
+	}
+	rc, err := blob.Open(ctx, e.BlobStore, ref.URL)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if strings.HasPrefix(ref.Mime, mimeJSON) {
+		var v any
+		if err := json.NewDecoder(rc).Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+	data, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// templateMentions reports whether any string in v contains name.
+func templateMentions(v any, name string) bool {
+	switch x := v.(type) {
+	case string:
+		return strings.Contains(x, name)
+	case []any:
+		for _, elem := range x {
+			if templateMentions(elem, name) {
+				return true
+			}
+		}
+	case map[string]any:
+		for _, elem := range x {
+			if templateMentions(elem, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// loadedBlob returns the cached value of an offloaded output.
+func (sc *StepContext) loadedBlob(url string) (any, bool) {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	val, ok := sc.blobs[url]
+	return val, ok
+}
+
+// setLoadedBlob caches the value of an offloaded output.
+func (sc *StepContext) setLoadedBlob(url string, val any) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	if sc.blobs == nil {
+		sc.blobs = make(map[string]any)
+	}
+	sc.blobs[url] = val
+}
+
+// loadedBlobs returns a copy of the cache of loaded offloaded outputs.
+func (sc *StepContext) loadedBlobs() map[string]any {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	if len(sc.blobs) == 0 {
+		return nil
+	}
+	return copyMap(sc.blobs)
+}
+
+// inlineLoadedBlobs returns outputs with every blob reference that has been loaded replaced by
+// its value. Step output maps are copied before substitution; outputs itself is modified.
+func (sc *StepContext) inlineLoadedBlobs(outputs StepOutputs) StepOutputs {
+	sc.mu.RLock()
+	defer sc.mu.RUnlock()
+	if len(sc.blobs) == 0 {
+		return outputs
+	}
+	for stepID, out := range outputs {
+		fields, ok := out.(map[string]any)
+		if !ok {
+			continue
+		}
+		var inlined map[string]any
+		for k, v := range fields {
+			ref, ok := model.AsBlobRef(v)
+			if !ok {
+				continue
+			}
+			val, loaded := sc.blobs[ref.URL]
+			if !loaded {
+				continue
+			}
+			if inlined == nil {
+				inlined = copyMap(fields)
+			}
+			inlined[k] = val
+		}
+		if inlined != nil {
+			outputs[stepID] = inlined
+		}
+	}
+	return outputs
+}
@@ -3,6 +3,7 @@ package engine
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"maps"
 	"regexp"
@@ -102,9 +103,17 @@ type Engine struct {
 	EventBus  event.EventBus
 	BlobStore blob.BlobStore
 	Storage   storage.Storage
+	// OffloadThreshold is the encoded size in bytes above which step output values are moved to
+	// BlobStore and replaced with a model.BlobRef. Zero or negative, the default, keeps all
+	// outputs inline.
+	OffloadThreshold int
+	// BlobFetch limits the URL downloads of core.blob.put.
+	BlobFetch blob.FetchPolicy
 	// In-memory state for waiting runs: token -> *PausedRun
 	waiting map[string]*PausedRun
-	mu      sync.Mutex
+	// Event bus subscriptions that resume waiting runs: token -> subscription
+	resumeSubs map[string]*resumeSubscription
+	mu         sync.Mutex
 	// Store completed outputs for resumed runs (token -> outputs)
 	completedOutputs map[string]map[string]any
 	// NOTE: Storage, blob, eventbus, and cron are pluggable; in-memory is the default for now.
@@ -118,6 +127,9 @@ type PausedRun struct {
 	Outputs map[string]any
 	Token   string
 	RunID   uuid.UUID
+	// Source and Match are the await_event step's topic and rendered match fields.
+	Source string
+	Match  map[string]any
 }
 
 // NewDefaultAdapterRegistry creates and returns a default adapter registry with core and registry tools.
@@ -155,15 +167,7 @@ func loadRegistryTools(ctx context.Context, reg *adapter.Registry) {
 		utils.Debug("Successfully loaded %d tools from registries", len(tools))
 		for _, entry := range tools {
 			if entry.Type == "tool" {
-				manifest := &registry.ToolManifest{
-					Name:        entry.Name,
-					Description: entry.Description,
-					Kind:        entry.Kind,
-					Parameters:  entry.Parameters,
-					Endpoint:    entry.Endpoint,
-					Headers:     entry.Headers,
-				}
-				reg.Register(&adapter.HTTPAdapter{AdapterID: entry.Name, ToolManifest: manifest})
+				reg.Register(&adapter.HTTPAdapter{AdapterID: entry.Name, ToolManifest: entry.ToolManifest()})
 				utils.Debug("Registered tool: %s (registry: %s)", entry.Name, entry.Registry)
 			}
 		}
@@ -180,6 +184,7 @@ func NewEngineWithBlobStore(ctx context.Context, blobStore blob.BlobStore) *Engi
 		EventBus:         event.NewInProcEventBus(),
 		BlobStore:        blobStore,
 		waiting:          make(map[string]*PausedRun),
+		resumeSubs:       make(map[string]*resumeSubscription),
 		completedOutputs: make(map[string]map[string]any),
 		Storage:          storage.NewMemoryStorage(),
 	}
@@ -200,6 +205,7 @@ func NewEngine(
 		BlobStore:        blobStore,
 		Storage:          storage,
 		waiting:          make(map[string]*PausedRun),
+		resumeSubs:       make(map[string]*resumeSubscription),
 		completedOutputs: make(map[string]map[string]any),
 	}
 }
@@ -241,35 +247,108 @@ func (e *Engine) setupExecutionContext(ctx context.Context, flow *model.Flow, ev
 	stepCtx := NewStepContext(event, flow.Vars, secretsMap)
 
 	// Create deterministic run ID based on flow name, event data, and time window
-	runID := generateDeterministicRunID(flow.Name, event)
+	runID, duplicate := e.resolveRunID(ctx, flow, event)
+	if duplicate != nil {
+		// This is a duplicate run within the deduplication window
+		utils.Info("Duplicate run detected for %s, skipping (existing run: %s)", flow.Name, duplicate.ID)
+		return stepCtx, uuid.Nil // Return nil ID to signal duplicate
+	}
 	
+	run := &model.Run{
+		ID:        runID,
+		FlowName:  flow.Name,
+		Event:     event,
+		Vars:      flow.Vars,
+		Status:    model.RunRunning,
+		StartedAt: time.Now(),
+	}
+	pinFlowVersion(run, flow)
+
+	if err := e.Storage.SaveRun(ctx, run); err != nil {
+		utils.ErrorCtx(ctx, "SaveRun failed: %v", "error", err)
+	}
+
+	return stepCtx, runID
+}
+
+// resolveRunID returns the deterministic run ID for flow and event, or the existing run if
+// the same event already started a run within the deduplication window.
+func (e *Engine) resolveRunID(ctx context.Context, flow *model.Flow, event map[string]any) (uuid.UUID, *model.Run) {
+	runID := generateDeterministicRunID(flow.Name, event)
+
 	// Check if this run already exists (deduplication)
 	existingRun, err := e.Storage.GetRun(ctx, runID)
 	if err == nil && existingRun != nil {
 		// Run already exists, check if it's recent (within 5 minutes)
 		if time.Since(existingRun.StartedAt) < 5*time.Minute {
-			// This is a duplicate run within the deduplication window
-			utils.Info("Duplicate run detected for %s, skipping (existing run: %s)", flow.Name, existingRun.ID)
-			return stepCtx, uuid.Nil // Return nil ID to signal duplicate
+			return runID, existingRun
 		}
 		// Older run with same ID, generate a new unique ID
 		runID = uuid.New()
 	}
-	
+	return runID, nil
+}
+
+// pinFlowVersion records on run the content hash of the flow definition it executes and,
+// when that definition is stored in the flow repository, its version number.
+func pinFlowVersion(run *model.Run, flow *model.Flow) {
+	if flow.Origin != nil {
+		run.FlowVersion = flow.Origin.Version
+		run.FlowHash = flow.Origin.Hash
+	}
+}
+
+// Enqueue records a PENDING run and adds it to the storage-backed run queue instead of
+// executing it; a worker later leases it and calls ExecuteRun. A duplicate event inside
+// the deduplication window returns the existing run's ID.
+func (e *Engine) Enqueue(ctx context.Context, flow *model.Flow, event map[string]any) (uuid.UUID, error) {
+	if flow == nil {
+		return uuid.Nil, nil
+	}
+	runID, duplicate := e.resolveRunID(ctx, flow, event)
+	if duplicate != nil {
+		utils.Info("Duplicate run detected for %s, skipping (existing run: %s)", flow.Name, duplicate.ID)
+		return duplicate.ID, nil
+	}
+
+	now := time.Now()
 	run := &model.Run{
 		ID:        runID,
 		FlowName:  flow.Name,
 		Event:     event,
 		Vars:      flow.Vars,
-		Status:    model.RunRunning,
-		StartedAt: time.Now(),
+		Status:    model.RunPending,
+		StartedAt: now,
 	}
+	pinFlowVersion(run, flow)
+	if err := e.Storage.EnqueueRun(ctx, run, &model.QueuedRun{RunID: runID, FlowName: flow.Name, EnqueuedAt: now}); err != nil {
+		return uuid.Nil, utils.Errorf("failed to enqueue run: %w", err)
+	}
+	return runID, nil
+}
 
-	if err := e.Storage.SaveRun(ctx, run); err != nil {
-		utils.ErrorCtx(ctx, "SaveRun failed: %v", "error", err)
+// ExecuteRun executes a run that was created ahead of time by Enqueue. A PENDING run is
+// claimed with a PENDING -> RUNNING transition; a RUNNING run is a redelivery after a
+// worker crashed and is executed again from the first step.
+func (e *Engine) ExecuteRun(ctx context.Context, flow *model.Flow, run *model.Run) (map[string]any, error) {
+	switch run.Status {
+	case model.RunPending:
+		if err := e.Storage.TransitionRun(ctx, run, model.RunRunning); err != nil {
+			return nil, err
+		}
+	case model.RunRunning:
+	default:
+		return nil, utils.Errorf("%w: run %s is %s", model.ErrInvalidRunTransition, run.ID, run.Status)
 	}
 
-	return stepCtx, runID
+	outputs := make(map[string]any)
+	if len(flow.Steps) == 0 {
+		return outputs, e.transitionRun(ctx, run.ID, model.RunRunning, model.RunSucceeded, nil)
+	}
+
+	stepCtx := NewStepContext(run.Event, flow.Vars, e.collectSecrets(run.Event))
+	outputs, err := e.executeStepsWithPersistence(ctx, flow, stepCtx, 0, run.ID)
+	return e.finalizeExecution(ctx, flow, run.Event, outputs, err, run.ID)
 }
 
 // finalizeExecution handles completion, error cases, and catch blocks
@@ -284,18 +363,12 @@ func (e *Engine) finalizeExecution(ctx context.Context, flow *model.Flow, event
 		}
 	}
 
-	// Update final run status
-	run := &model.Run{
-		ID:        runID,
-		FlowName:  flow.Name,
-		Event:     event,
-		Vars:      flow.Vars,
-		Status:    status,
-		StartedAt: time.Now(),
-		EndedAt:   ptrTime(time.Now()),
-	}
-	if saveErr := e.Storage.SaveRun(ctx, run); saveErr != nil {
-		utils.ErrorCtx(ctx, constants.ErrSaveRunFailed, "error", saveErr)
+	// Update final run status. Paused runs were already moved to WAITING before their
+	// resume subscription was registered, so a fast resume can't race this update.
+	if status != model.RunWaiting {
+		if transErr := e.transitionRun(ctx, runID, model.RunRunning, status, nil); transErr != nil {
+			utils.ErrorCtx(ctx, constants.ErrSaveRunFailed, "error", transErr)
+		}
 	}
 
 	// Handle catch blocks if there was an error
@@ -369,10 +442,11 @@ func (e *Engine) executeStepsWithPersistence(ctx context.Context, flow *model.Fl
 		}
 
 		// Execute regular step
+		startedAt := time.Now()
 		err := e.executeStep(ctx, step, stepCtx, step.ID)
 
 		// Persist the step after execution
-		if persistErr := e.persistStepResult(ctx, step, stepCtx, err, runID); persistErr != nil {
+		if persistErr := e.persistStepResult(ctx, step, stepCtx, err, runID, startedAt); persistErr != nil {
 			utils.Error(constants.ErrFailedToPersistStep, persistErr)
 		}
 
@@ -386,8 +460,12 @@ func (e *Engine) executeStepsWithPersistence(ctx context.Context, flow *model.Fl
 
 // handleAwaitEventStep processes await_event steps and sets up pause/resume logic
 func (e *Engine) handleAwaitEventStep(ctx context.Context, step *model.Step, flow *model.Flow, stepCtx *StepContext, stepIdx int, runID uuid.UUID) (map[string]any, error) {
-	// Extract and render token
-	token, err := e.extractAndRenderAwaitToken(step, stepCtx)
+	// Render the match fields and the token that keys the paused run
+	match, err := e.renderAwaitMatch(ctx, step, stepCtx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := awaitToken(step, match, runID)
 	if err != nil {
 		return nil, err
 	}
@@ -395,47 +473,175 @@ func (e *Engine) handleAwaitEventStep(ctx context.Context, step *model.Step, flo
 	// Handle existing paused run with same token
 	e.handleExistingPausedRun(ctx, token)
 
+	// Move the run to WAITING before anything can resume it
+	if err := e.transitionRun(ctx, runID, model.RunRunning, model.RunWaiting, nil); err != nil {
+		return nil, err
+	}
+
 	// Register new paused run
-	e.registerPausedRun(ctx, token, flow, stepCtx, stepIdx, runID)
+	e.registerPausedRun(ctx, token, flow, stepCtx, stepIdx, runID, step.AwaitEvent.Source, match)
+
+	// Setup event subscriptions for resume
+	e.setupResumeEventSubscription(ctx, step.AwaitEvent.Source, match, token, runID)
 
-	// Setup event subscription for resume
-	e.setupResumeEventSubscription(ctx, token)
+	// Fail the run if nothing resumes it in time
+	e.scheduleAwaitTimeout(ctx, step, token, runID)
 
 	return nil, utils.Errorf(constants.ErrStepWaitingForEvent, step.ID)
 }
 
-// extractAndRenderAwaitToken validates and renders the await event token
-func (e *Engine) extractAndRenderAwaitToken(step *model.Step, stepCtx *StepContext) (string, error) {
-	// Extract token from match configuration
-	match := step.AwaitEvent.Match
-	tokenRaw, ok := utils.SafeStringAssert(match[constants.MatchKeyToken])
-	if !ok || tokenRaw == constants.EmptyString {
-		return constants.EmptyString, utils.Errorf(constants.ErrAwaitEventMissingToken)
+// setupResumeEventSubscription configures event bus subscriptions for resume events: any
+// event on resume.<token>, and events on source whose payload matches every match field. The
+// subscriptions outlive ctx, which is usually the request that started the run; they are
+// released when the run leaves the waiting state (see releaseResumeSubscription) or the
+// engine is closed. When the bus logs events, events published since the run started are
+// replayed, so an event that arrived before the run paused still resumes it.
+func (e *Engine) setupResumeEventSubscription(ctx context.Context, source string, match map[string]any, token string, runID uuid.UUID) {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	since := time.Time{}
+	if e.Storage != nil {
+		if run, err := e.Storage.GetRun(ctx, runID); err == nil {
+			since = run.StartedAt
+		}
+	}
+	subscribe := func(topic string, matches func(map[string]any) bool) event.Subscription {
+		handler := func(_ string, payload any) error {
+			resumeEvent, ok := payload.(map[string]any)
+			if !ok || !matches(resumeEvent) {
+				return nil
+			}
+			// Resuming releases this subscription, so the run continues without its cancellation
+			e.Resume(context.WithoutCancel(ctx), token, resumeEvent)
+			return nil
+		}
+		var sub event.Subscription
+		err := event.ErrNoEventLog
+		if !since.IsZero() {
+			sub, err = e.EventBus.SubscribeFrom(ctx, topic, event.Position{Since: since}, handler)
+		}
+		if errors.Is(err, event.ErrNoEventLog) {
+			sub, err = e.EventBus.SubscribeWithTopic(ctx, topic, handler)
+		}
+		if err != nil {
+			utils.ErrorCtx(ctx, "Failed to subscribe to resume events", "topic", topic, "token", token, "error", err)
+			return nil
+		}
+		return sub
 	}
 
-	// Prepare template data and render token
-	data := e.prepareTemplateDataAsMap(stepCtx)
-	utils.Debug("About to render template for step %s: data = %#v", step.ID, data)
+	rs := &resumeSubscription{stop: cancel}
+	if sub := subscribe(constants.EventTopicResumePrefix+token, func(map[string]any) bool { return true }); sub != nil {
+		rs.subs = append(rs.subs, sub)
+	}
+	if source != constants.EmptyString {
+		if sub := subscribe(source, func(payload map[string]any) bool { return matchesAwait(match, payload) }); sub != nil {
+			rs.subs = append(rs.subs, sub)
+		}
+	}
+	if len(rs.subs) == 0 {
+		cancel()
+		return
+	}
 
-	renderedToken, err := e.Templater.Render(tokenRaw, data)
-	if err != nil {
-		return constants.EmptyString, utils.Errorf(constants.ErrFailedToRenderToken, err)
+	e.mu.Lock()
+	if _, waiting := e.waiting[token]; !waiting {
+		// A replayed event already resumed the run
+		e.mu.Unlock()
+		rs.close()
+		return
+	}
+	old := e.resumeSubs[token]
+	e.resumeSubs[token] = rs
+	e.mu.Unlock()
+	if old != nil {
+		old.close()
 	}
+}
 
-	return renderedToken, nil
+// resumeSubscription holds a paused run's resume subscriptions together with the cancel
+// function of the context their handlers resume the run with.
+type resumeSubscription struct {
+	subs []event.Subscription
+	stop context.CancelFunc
 }
 
-// setupResumeEventSubscription configures event bus subscription for resume events
-func (e *Engine) setupResumeEventSubscription(ctx context.Context, token string) {
-	e.EventBus.Subscribe(ctx, constants.EventTopicResumePrefix+token, func(payload any) {
-		resumeEvent, ok := payload.(map[string]any)
-		if !ok {
-			return
+func (rs *resumeSubscription) close() {
+	rs.stop()
+	for _, sub := range rs.subs {
+		sub.Close()
+	}
+}
+
+// releaseResumeSubscription closes the resume subscription for token. If rs is non-nil, only
+// that subscription is released, so a late cancellation can't drop a newer one.
+func (e *Engine) releaseResumeSubscription(token string, rs *resumeSubscription) {
+	e.mu.Lock()
+	current, ok := e.resumeSubs[token]
+	if !ok || (rs != nil && current != rs) {
+		e.mu.Unlock()
+		return
+	}
+	delete(e.resumeSubs, token)
+	e.mu.Unlock()
+	current.close()
+}
+
+// RestorePausedRuns subscribes to the resume events of every paused run in storage, so runs
+// paused before a restart (or by another engine) still resume on their source events.
+func (e *Engine) RestorePausedRuns(ctx context.Context) error {
+	if e.Storage == nil || e.EventBus == nil {
+		return nil
+	}
+	persisted, err := e.Storage.LoadPausedRuns(ctx)
+	if err != nil {
+		return err
+	}
+	for token, raw := range persisted {
+		paused, err := pausedRunFromPersisted(raw)
+		if err != nil {
+			utils.ErrorCtx(ctx, "Failed to decode paused run", "token", token, "error", err)
+			continue
+		}
+		e.mu.Lock()
+		_, known := e.waiting[token]
+		if !known {
+			e.waiting[token] = paused
+		}
+		e.mu.Unlock()
+		if !known {
+			e.setupResumeEventSubscription(ctx, paused.Source, paused.Match, token, paused.RunID)
 		}
-		e.Resume(ctx, token, resumeEvent)
+	}
+	return nil
+}
+
+// scheduleAwaitTimeout fails a paused run if no resume event arrives within the step's timeout.
+func (e *Engine) scheduleAwaitTimeout(ctx context.Context, step *model.Step, token string, runID uuid.UUID) {
+	if step.AwaitEvent.Timeout == "" {
+		return
+	}
+	timeout, err := time.ParseDuration(step.AwaitEvent.Timeout)
+	if err != nil {
+		utils.WarnCtx(ctx, "Ignoring invalid await_event timeout", "step", step.ID, "timeout", step.AwaitEvent.Timeout, "error", err)
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+	time.AfterFunc(timeout, func() {
+		e.expirePausedRun(ctx, token, runID)
 	})
 }
 
+// expirePausedRun marks a still-waiting run as failed. If a resume claimed the run first,
+// the compare-and-swap loses and the timeout is a no-op.
+func (e *Engine) expirePausedRun(ctx context.Context, token string, runID uuid.UUID) {
+	if err := e.claimPausedRun(ctx, token, runID, model.RunFailed); err != nil {
+		utils.DebugCtx(ctx, "await_event timeout ignored", "run_id", runID.String(), "error", err)
+		return
+	}
+	utils.InfoCtx(ctx, "await_event timed out", "run_id", runID.String(), "token", token)
+	e.removePausedRun(ctx, token)
+}
+
 // handleExistingPausedRun manages cleanup of existing paused runs with the same token
 func (e *Engine) handleExistingPausedRun(ctx context.Context, token string) {
 	e.mu.Lock()
@@ -444,9 +650,7 @@ func (e *Engine) handleExistingPausedRun(ctx context.Context, token string) {
 	if old, exists := e.waiting[token]; exists {
 		if e.Storage != nil {
 			if existingRun, err := e.Storage.GetRun(ctx, old.RunID); err == nil {
-				existingRun.Status = model.RunSkipped
-				existingRun.EndedAt = ptrTime(time.Now())
-				if err := e.Storage.SaveRun(ctx, existingRun); err != nil {
+				if err := e.Storage.TransitionRun(ctx, existingRun, model.RunSkipped); err != nil {
 					utils.ErrorCtx(ctx, "Failed to mark existing run as skipped: %v", "error", err)
 				}
 			}
@@ -459,7 +663,7 @@ func (e *Engine) handleExistingPausedRun(ctx context.Context, token string) {
 }
 
 // registerPausedRun stores a new paused run for later resumption
-func (e *Engine) registerPausedRun(ctx context.Context, token string, flow *model.Flow, stepCtx *StepContext, stepIdx int, runID uuid.UUID) {
+func (e *Engine) registerPausedRun(ctx context.Context, token string, flow *model.Flow, stepCtx *StepContext, stepIdx int, runID uuid.UUID, source string, match map[string]any) {
 	e.mu.Lock()
 	defer e.mu.Unlock()
 
@@ -472,6 +676,8 @@ func (e *Engine) registerPausedRun(ctx context.Context, token string, flow *mode
 		Outputs: snapshot.Outputs,
 		Token:   token,
 		RunID:   runID,
+		Source:  source,
+		Match:   match,
 	}
 
 	if e.Storage != nil {
@@ -482,7 +688,7 @@ func (e *Engine) registerPausedRun(ctx context.Context, token string, flow *mode
 }
 
 // persistStepResult saves step execution results to storage
-func (e *Engine) persistStepResult(ctx context.Context, step *model.Step, stepCtx *StepContext, execErr error, runID uuid.UUID) error {
+func (e *Engine) persistStepResult(ctx context.Context, step *model.Step, stepCtx *StepContext, execErr error, runID uuid.UUID, startedAt time.Time) error {
 	if e.Storage == nil {
 		return nil
 	}
@@ -506,7 +712,7 @@ func (e *Engine) persistStepResult(ctx context.Context, step *model.Step, stepCt
 		RunID:     runID,
 		StepName:  step.ID,
 		Status:    status,
-		StartedAt: time.Now(),
+		StartedAt: startedAt,
 		EndedAt:   ptrTime(time.Now()),
 		Outputs:   stepOutputs,
 		Error:     errorMsg,
@@ -516,15 +722,26 @@ func (e *Engine) persistStepResult(ctx context.Context, step *model.Step, stepCt
 }
 
 // Resume resumes a paused run with the given token and event.
+//
+// The run is claimed with a WAITING -> RUNNING compare-and-swap before execution continues,
+// so concurrent resumes (or a resume racing a timeout) on any engine sharing the same
+// storage resume the run at most once.
 func (e *Engine) Resume(ctx context.Context, token string, resumeEvent map[string]any) {
 	utils.Debug("Resume called for token %s with event: %+v", token, resumeEvent)
 
-	// Retrieve and remove paused run
-	paused := e.retrieveAndRemovePausedRun(ctx, token)
+	// Look up the paused run locally or in shared storage
+	paused := e.lookupPausedRun(ctx, token)
 	if paused == nil {
 		return
 	}
 
+	// Claim the run; losing the race means someone else resumed, skipped or expired it
+	if err := e.claimPausedRun(ctx, token, paused.RunID, model.RunRunning); err != nil {
+		utils.WarnCtx(ctx, "Resume skipped: run could not be claimed", "run_id", paused.RunID.String(), "token", token, "error", err)
+		return
+	}
+	e.removePausedRun(ctx, token)
+
 	// Prepare context for resumption
 	e.prepareResumeContext(paused, resumeEvent)
 
@@ -532,15 +749,71 @@ func (e *Engine) Resume(ctx context.Context, token string, resumeEvent map[strin
 	e.continueExecutionAndStoreResults(ctx, token, paused)
 }
 
-// retrieveAndRemovePausedRun safely gets and removes a paused run
-func (e *Engine) retrieveAndRemovePausedRun(ctx context.Context, token string) *PausedRun {
+// lookupPausedRun finds a paused run by token without removing it. Storage is authoritative
+// when configured: a local entry whose persisted record is gone was handled elsewhere.
+func (e *Engine) lookupPausedRun(ctx context.Context, token string) *PausedRun {
 	e.mu.Lock()
-	defer e.mu.Unlock()
+	local := e.waiting[token]
+	e.mu.Unlock()
 
-	paused, ok := e.waiting[token]
-	if !ok {
+	if e.Storage == nil {
+		return local
+	}
+	raw, err := e.Storage.LoadPausedRun(ctx, token)
+	if err != nil {
+		utils.ErrorCtx(ctx, "Failed to load paused run", "token", token, "error", err)
+		return local
+	}
+	if raw == nil {
+		if local != nil {
+			e.mu.Lock()
+			delete(e.waiting, token)
+			e.mu.Unlock()
+			e.releaseResumeSubscription(token, nil)
+		}
 		return nil
 	}
+	if local != nil {
+		return local
+	}
+	paused, err := pausedRunFromPersisted(raw)
+	if err != nil {
+		utils.ErrorCtx(ctx, "Failed to decode paused run", "token", token, "error", err)
+		return nil
+	}
+	return paused
+}
+
+// claimPausedRun moves a paused run out of WAITING with compare-and-swap semantics. The run
+// version is read before confirming the token is still paused, so a claimer that lost the
+// race can't succeed against a later pause of the same run.
+func (e *Engine) claimPausedRun(ctx context.Context, token string, runID uuid.UUID, to model.RunStatus) error {
+	if e.Storage == nil {
+		return nil
+	}
+	run, err := e.Storage.GetRun(ctx, runID)
+	if err != nil {
+		return err
+	}
+	if run.Status != model.RunWaiting {
+		return utils.Errorf("%w: run %s is %s, not %s", storage.ErrVersionConflict, runID, run.Status, model.RunWaiting)
+	}
+	persisted, err := e.Storage.LoadPausedRun(ctx, token)
+	if err != nil {
+		return err
+	}
+	if persisted == nil {
+		return utils.Errorf("%w: token %s is no longer paused", storage.ErrVersionConflict, token)
+	}
+	return e.Storage.TransitionRun(ctx, run, to)
+}
+
+// removePausedRun drops a paused run from local state and storage.
+func (e *Engine) removePausedRun(ctx context.Context, token string) {
+	e.releaseResumeSubscription(token, nil)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
 
 	delete(e.waiting, token)
 	if e.Storage != nil {
@@ -548,8 +821,25 @@ func (e *Engine) retrieveAndRemovePausedRun(ctx context.Context, token string) *
 			utils.ErrorCtx(ctx, constants.ErrFailedToDeletePausedRun, "error", err)
 		}
 	}
+}
 
-	return paused
+// transitionRun moves a persisted run from one status to another using the storage
+// compare-and-swap, optionally updating other fields first.
+func (e *Engine) transitionRun(ctx context.Context, runID uuid.UUID, from, to model.RunStatus, mutate func(*model.Run)) error {
+	if e.Storage == nil {
+		return nil
+	}
+	run, err := e.Storage.GetRun(ctx, runID)
+	if err != nil {
+		return err
+	}
+	if run.Status != from {
+		return utils.Errorf("%w: run %s is %s, not %s", storage.ErrVersionConflict, runID, run.Status, from)
+	}
+	if mutate != nil {
+		mutate(run)
+	}
+	return e.Storage.TransitionRun(ctx, run, to)
 }
 
 // prepareResumeContext updates the step context with resume event data
@@ -610,21 +900,19 @@ func (e *Engine) updateRunStatusAfterResume(ctx context.Context, paused *PausedR
 
 	status := model.RunSucceeded
 	if err != nil {
+		// Pausing again at a later await_event already moved the run to WAITING
+		if strings.Contains(err.Error(), constants.ErrAwaitEventPause) {
+			return
+		}
 		status = model.RunFailed
 	}
 
 	snapshot := paused.StepCtx.Snapshot()
-	run := &model.Run{
-		ID:        paused.RunID,
-		FlowName:  paused.Flow.Name,
-		Event:     snapshot.Event,
-		Vars:      snapshot.Vars,
-		Status:    status,
-		StartedAt: time.Now(),
-		EndedAt:   ptrTime(time.Now()),
+	setEvent := func(run *model.Run) {
+		run.Event = snapshot.Event
+		run.Vars = snapshot.Vars
 	}
-
-	if err := e.Storage.SaveRun(ctx, run); err != nil {
+	if err := e.transitionRun(ctx, paused.RunID, model.RunRunning, status, setEvent); err != nil {
 		utils.ErrorCtx(ctx, "SaveRun failed: %v", "error", err)
 	}
 }
@@ -657,6 +945,11 @@ func (e *Engine) executeStep(ctx context.Context, step *model.Step, stepCtx *Ste
 		return e.executeForeachBlock(ctx, step, stepCtx, stepID)
 	}
 
+	// A tool step with Do loops over the tool's pages as they arrive
+	if step.Use != "" && len(step.Do) > 0 {
+		return e.executeToolForeach(ctx, step, stepCtx, stepID)
+	}
+
 	// Tool execution
 	return e.executeToolCall(ctx, step, stepCtx, stepID)
 }
@@ -718,6 +1011,9 @@ func (e *Engine) executeSequentialBlock(ctx context.Context, step *model.Step, s
 // executeForeachBlock handles foreach loop execution
 func (e *Engine) executeForeachBlock(ctx context.Context, step *model.Step, stepCtx *StepContext, stepID string) error {
 	// Prepare template data for expression evaluation
+	if err := e.loadReferencedBlobs(ctx, stepCtx, step.Foreach); err != nil {
+		return utils.Errorf(constants.ErrTemplateErrorForeach, err)
+	}
 	data := e.prepareTemplateDataAsMap(stepCtx)
 
 	// Evaluate the foreach expression to get the actual value (not rendered as string)
@@ -778,7 +1074,7 @@ func (e *Engine) executeIterationSteps(ctx context.Context, steps []model.Step,
 		innerCopy := inner
 
 		// Render the step ID as a template
-		renderedStepID, err := e.renderStepID(inner.ID, iterStepCtx)
+		renderedStepID, err := e.renderStepID(ctx, inner.ID, iterStepCtx)
 		if err != nil {
 			return err
 		}
@@ -795,7 +1091,10 @@ func (e *Engine) executeIterationSteps(ctx context.Context, steps []model.Step,
 }
 
 // renderStepID renders a step ID with templating support
-func (e *Engine) renderStepID(stepID string, stepCtx *StepContext) (string, error) {
+func (e *Engine) renderStepID(ctx context.Context, stepID string, stepCtx *StepContext) (string, error) {
+	if err := e.loadReferencedBlobs(ctx, stepCtx, stepID); err != nil {
+		return constants.EmptyString, err
+	}
 	data := e.prepareTemplateDataAsMap(stepCtx)
 	rendered, err := e.renderValue(stepID, data)
 	if err != nil {
@@ -860,7 +1159,7 @@ func (e *Engine) executeForeachSequential(ctx context.Context, step *model.Step,
 func (e *Engine) executeSequentialIterationSteps(ctx context.Context, steps []model.Step, stepCtx *StepContext) error {
 	for _, inner := range steps {
 		// Render the step ID as a template
-		renderedStepID, err := e.renderStepID(inner.ID, stepCtx)
+		renderedStepID, err := e.renderStepID(ctx, inner.ID, stepCtx)
 		if err != nil {
 			return err
 		}
@@ -873,6 +1172,32 @@ func (e *Engine) executeSequentialIterationSteps(ctx context.Context, steps []mo
 	return nil
 }
 
+// executeToolForeach calls a paginated tool and runs the Do steps for the items of each
+// page as the page arrives, instead of waiting for the whole listing
+func (e *Engine) executeToolForeach(ctx context.Context, step *model.Step, stepCtx *StepContext, stepID string) error {
+	streamed := false
+	handler := func(ctx context.Context, items []any) error {
+		streamed = true
+		if len(items) == 0 {
+			return nil
+		}
+		// Tools called from the loop body paginate on their own
+		ctx = adapter.WithPageHandler(ctx, nil)
+		if step.Parallel {
+			return e.executeForeachParallel(ctx, step, stepCtx, "", items)
+		}
+		return e.executeForeachSequential(ctx, step, stepCtx, "", items)
+	}
+
+	if err := e.executeToolCall(adapter.WithPageHandler(ctx, handler), step, stepCtx, stepID); err != nil {
+		return err
+	}
+	if !streamed {
+		return utils.Errorf(constants.ErrToolDidNotPaginate, stepID, step.Use)
+	}
+	return nil
+}
+
 // executeToolCall handles individual tool execution
 func (e *Engine) executeToolCall(ctx context.Context, step *model.Step, stepCtx *StepContext, stepID string) error {
 	if step.Use == "" {
@@ -914,7 +1239,7 @@ func (e *Engine) resolveAdapter(toolName string, stepCtx *StepContext, stepID st
 // executeToolWithInputs prepares inputs and executes the tool
 func (e *Engine) executeToolWithInputs(ctx context.Context, step *model.Step, stepCtx *StepContext, stepID string, adapterInst adapter.Adapter) error {
 	// Prepare inputs for the tool
-	inputs, err := e.prepareToolInputs(step, stepCtx, stepID)
+	inputs, err := e.prepareToolInputs(ctx, step, stepCtx, stepID)
 	if err != nil {
 		return err
 	}
@@ -941,8 +1266,13 @@ func (e *Engine) handleToolExecution(ctx context.Context, toolName, stepID strin
 	// Log payload for debugging using our helper
 	logToolPayload(ctx, toolName, inputs)
 
-	// Execute the tool
+	// Execute the tool; core.blob.* tools and HTTP file uploads use the engine's blob store
+	if e.BlobStore != nil {
+		ctx = blob.WithStore(ctx, e.BlobStore)
+	}
+	ctx = blob.WithFetchPolicy(ctx, e.BlobFetch)
 	outputs, err := adapterInst.Execute(ctx, inputs)
+	outputs = e.offloadOutputs(ctx, stepID, outputs)
 	if err != nil {
 		stepCtx.SetOutput(stepID, outputs)
 		return utils.Errorf(constants.ErrStepFailed, stepID, err)
@@ -964,6 +1294,7 @@ func (e *Engine) prepareTemplateData(stepCtx *StepContext) TemplateData {
 // prepareTemplateDataAsMap creates template data as map for templating system
 func (e *Engine) prepareTemplateDataAsMap(stepCtx *StepContext) map[string]any {
 	templateData := e.prepareTemplateData(stepCtx)
+	templateData.Outputs = stepCtx.inlineLoadedBlobs(templateData.Outputs)
 	return flattenTemplateDataToMap(templateData)
 }
 
@@ -988,6 +1319,7 @@ func isValidIdentifier(s string) bool {
 func (e *Engine) createIterationContext(stepCtx *StepContext, asVar string, item any) *StepContext {
 	snapshot := stepCtx.Snapshot()
 	iterStepCtx := NewStepContext(snapshot.Event, snapshot.Vars, snapshot.Secrets)
+	iterStepCtx.blobs = stepCtx.loadedBlobs()
 
 	// Copy existing outputs
 	for k, v := range snapshot.Outputs {
@@ -1003,7 +1335,10 @@ func (e *Engine) createIterationContext(stepCtx *StepContext, asVar string, item
 }
 
 // prepareToolInputs prepares inputs for tool execution
-func (e *Engine) prepareToolInputs(step *model.Step, stepCtx *StepContext, stepID string) (map[string]any, error) {
+func (e *Engine) prepareToolInputs(ctx context.Context, step *model.Step, stepCtx *StepContext, stepID string) (map[string]any, error) {
+	if err := e.loadReferencedBlobs(ctx, stepCtx, step.With); err != nil {
+		return nil, utils.Errorf(constants.ErrTemplateError, stepID, err)
+	}
 	data := e.prepareTemplateDataAsMap(stepCtx)
 	inputs := make(map[string]any)
 
@@ -1108,6 +1443,7 @@ type StepContext struct {
 	Vars    map[string]any
 	Outputs StepOutputs
 	Secrets SecretsData
+	blobs   map[string]any // blob URL -> loaded value of an offloaded output
 }
 
 // ContextSnapshot returns immutable copies of all context data
@@ -1185,8 +1521,16 @@ func NewCronScheduler() *CronScheduler {
 	return &CronScheduler{}
 }
 
-// Close cleans up all adapters and resources managed by the Engine.
+// Close cleans up all adapters and resources managed by the Engine, including event bus
+// subscriptions for runs that are still waiting. The event bus itself is left open.
 func (e *Engine) Close() error {
+	e.mu.Lock()
+	subs := e.resumeSubs
+	e.resumeSubs = make(map[string]*resumeSubscription)
+	e.mu.Unlock()
+	for _, rs := range subs {
+		rs.close()
+	}
 	if e.Adapters != nil {
 		return e.Adapters.CloseAll()
 	}
@@ -1202,9 +1546,53 @@ func pausedRunToMap(pr *PausedRun) map[string]any {
 		constants.PausedRunKeyOutputs: pr.Outputs,
 		constants.PausedRunKeyToken:   pr.Token,
 		constants.PausedRunKeyRunID:   pr.RunID.String(),
+		constants.PausedRunKeySource:  pr.Source,
+		constants.PausedRunKeyMatch:   pr.Match,
 	}
 }
 
+// pausedRunFromPersisted rebuilds a PausedRun from the value returned by Storage.LoadPausedRuns,
+// which is either the map written by pausedRunToMap or a storage-specific struct of the same shape.
+func pausedRunFromPersisted(raw any) (*PausedRun, error) {
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	var persisted struct {
+		Flow    *model.Flow     `json:"flow"`
+		StepIdx int             `json:"step_idx"`
+		StepCtx ContextSnapshot `json:"step_ctx"`
+		Token   string          `json:"token"`
+		RunID   string          `json:"run_id"`
+		Source  string          `json:"source"`
+		Match   map[string]any  `json:"match"`
+	}
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return nil, err
+	}
+	if persisted.Flow == nil {
+		return nil, utils.Errorf("paused run %s has no flow", persisted.Token)
+	}
+	runID, err := uuid.Parse(persisted.RunID)
+	if err != nil {
+		return nil, utils.Errorf("paused run %s has invalid run id: %w", persisted.Token, err)
+	}
+	stepCtx := NewStepContext(persisted.StepCtx.Event, persisted.StepCtx.Vars, persisted.StepCtx.Secrets)
+	for k, v := range persisted.StepCtx.Outputs {
+		stepCtx.SetOutput(k, v)
+	}
+	return &PausedRun{
+		Flow:    persisted.Flow,
+		StepIdx: persisted.StepIdx,
+		StepCtx: stepCtx,
+		Outputs: stepCtx.Snapshot().Outputs,
+		Token:   persisted.Token,
+		RunID:   runID,
+		Source:  persisted.Source,
+		Match:   persisted.Match,
+	}, nil
+}
+
 // Add a helper to extract runID from context (or use a global if needed).
 func runIDFromContext(ctx context.Context) uuid.UUID {
 	if v := ctx.Value(runIDKey); v != nil {
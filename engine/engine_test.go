@@ -2,19 +2,25 @@ package engine
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
 
 	"gopkg.in/yaml.v3"
 
+	"github.com/awantoch/beemflow/adapter"
 	"github.com/awantoch/beemflow/blob"
 	"github.com/awantoch/beemflow/config"
 	"github.com/awantoch/beemflow/dsl"
 	"github.com/awantoch/beemflow/event"
 	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/registry"
 	"github.com/awantoch/beemflow/storage"
 	"github.com/awantoch/beemflow/utils"
 	"github.com/google/uuid"
@@ -198,8 +204,8 @@ func TestExecute_AllStepTypes(t *testing.T) {
 		{ID: "s2", Use: "core.echo", With: map[string]interface{}{"text": "hi"}},
 	}}
 	_, err := e.Execute(context.Background(), f, map[string]any{"foo": "bar"})
-	if err == nil || !strings.Contains(err.Error(), "missing token in match") {
-		t.Errorf("expected await_event missing token error, got %v", err)
+	if err == nil || !strings.Contains(err.Error(), "is waiting for event") {
+		t.Errorf("expected pause on await_event, got %v", err)
 	}
 }
 
@@ -1294,3 +1300,591 @@ func TestAutoFillRequiredParams(t *testing.T) {
 		t.Error("Expected existing value to be preserved")
 	}
 }
+
+func awaitFlow(name, timeout string) *model.Flow {
+	return &model.Flow{
+		Name: name,
+		Steps: []model.Step{
+			{ID: "start", Use: "core.echo", With: map[string]interface{}{"text": "started"}},
+			{ID: "wait", AwaitEvent: &model.AwaitEventSpec{Source: "test", Match: map[string]interface{}{"token": "{{ event.token }}"}, Timeout: timeout}},
+			{ID: "resumed", Use: "core.echo", With: map[string]interface{}{"text": "{{ event.resume_value }}"}},
+		},
+	}
+}
+
+func TestResume_SharedStorageResumesOnce(t *testing.T) {
+	ctx := context.Background()
+	s, err := storage.NewSqliteStorage(filepath.Join(t.TempDir(), "shared.db"))
+	if err != nil {
+		t.Fatalf("failed to create sqlite storage: %v", err)
+	}
+	defer s.Close()
+
+	newReplica := func() *Engine {
+		return NewEngine(NewDefaultAdapterRegistry(ctx), dsl.NewTemplater(), event.NewInProcEventBus(), nil, s)
+	}
+	first, second := newReplica(), newReplica()
+
+	flow := awaitFlow("resume_once", "")
+	_, err = first.Execute(ctx, flow, map[string]any{"token": "once"})
+	if err == nil || !strings.Contains(err.Error(), "is waiting for event") {
+		t.Fatalf("expected pause on await_event, got: %v", err)
+	}
+	run, err := s.GetLatestRunByFlowName(ctx, flow.Name)
+	if err != nil {
+		t.Fatalf("GetLatestRunByFlowName failed: %v", err)
+	}
+	if run.Status != model.RunWaiting {
+		t.Fatalf("expected WAITING after pause, got %s", run.Status)
+	}
+
+	// Both replicas try to resume the same run at once
+	done := make(chan struct{}, 2)
+	for _, e := range []*Engine{first, second} {
+		go func(e *Engine) {
+			e.Resume(ctx, "once", map[string]any{"resume_value": "go", "token": "once"})
+			done <- struct{}{}
+		}(e)
+	}
+	<-done
+	<-done
+
+	run, err = s.GetRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if run.Status != model.RunSucceeded {
+		t.Errorf("expected SUCCEEDED after resume, got %s", run.Status)
+	}
+	steps, err := s.GetSteps(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetSteps failed: %v", err)
+	}
+	resumed := 0
+	for _, step := range steps {
+		if step.StepName == "resumed" {
+			resumed++
+		}
+	}
+	if resumed != 1 {
+		t.Errorf("expected resumed step to run exactly once, ran %d times", resumed)
+	}
+	paused, err := s.LoadPausedRuns(ctx)
+	if err != nil {
+		t.Fatalf("LoadPausedRuns failed: %v", err)
+	}
+	if _, ok := paused["once"]; ok {
+		t.Errorf("expected paused run to be removed after resume")
+	}
+}
+
+func TestAwaitEvent_TimeoutFailsRun(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemoryStorage()
+	e := NewEngine(NewDefaultAdapterRegistry(ctx), dsl.NewTemplater(), event.NewInProcEventBus(), nil, s)
+
+	flow := awaitFlow("await_timeout", "50ms")
+	_, err := e.Execute(ctx, flow, map[string]any{"token": "late"})
+	if err == nil || !strings.Contains(err.Error(), "is waiting for event") {
+		t.Fatalf("expected pause on await_event, got: %v", err)
+	}
+	run, err := s.GetLatestRunByFlowName(ctx, flow.Name)
+	if err != nil {
+		t.Fatalf("GetLatestRunByFlowName failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if run, err = s.GetRun(ctx, run.ID); err == nil && run.Status == model.RunFailed {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if run.Status != model.RunFailed {
+		t.Fatalf("expected FAILED after timeout, got %s", run.Status)
+	}
+
+	// A late resume must not revive the expired run
+	e.Resume(ctx, "late", map[string]any{"resume_value": "too late", "token": "late"})
+	if run, _ = s.GetRun(ctx, run.ID); run.Status != model.RunFailed {
+		t.Errorf("expected run to stay FAILED after late resume, got %s", run.Status)
+	}
+	if outputs := e.GetCompletedOutputs("late"); outputs != nil {
+		t.Errorf("expected no outputs for expired run, got %v", outputs)
+	}
+}
+
+func TestAwaitEvent_ReleasesResumeSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemoryStorage()
+	bus := event.NewInProcEventBus()
+	defer bus.Close()
+	e := NewEngine(NewDefaultAdapterRegistry(ctx), dsl.NewTemplater(), bus, nil, s)
+	defer e.Close()
+
+	pause := func(ctx context.Context, flow *model.Flow, token string) {
+		t.Helper()
+		_, err := e.Execute(ctx, flow, map[string]any{"token": token})
+		if err == nil || !strings.Contains(err.Error(), "is waiting for event") {
+			t.Fatalf("expected pause on await_event, got: %v", err)
+		}
+	}
+	resumeAll := func(tokens []string) {
+		t.Helper()
+		for _, token := range tokens {
+			if err := bus.Publish("resume."+token, map[string]any{"resume_value": "go", "token": token}); err != nil {
+				t.Fatalf("Publish failed: %v", err)
+			}
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for _, token := range tokens {
+			outputs := e.GetCompletedOutputs(token)
+			for outputs == nil && time.Now().Before(deadline) {
+				time.Sleep(5 * time.Millisecond)
+				outputs = e.GetCompletedOutputs(token)
+			}
+			if outputs == nil {
+				t.Fatalf("run %s was not resumed", token)
+			}
+		}
+	}
+
+	// Warm up so lazily started goroutines don't count as growth
+	pause(ctx, awaitFlow("warmup", ""), "warmup")
+	resumeAll([]string{"warmup"})
+	baseline := runtime.NumGoroutine()
+
+	// Resumed runs
+	var tokens []string
+	for i := 0; i < 20; i++ {
+		token := fmt.Sprintf("resumed-%d", i)
+		pause(ctx, awaitFlow("release_resume", ""), token)
+		tokens = append(tokens, token)
+	}
+	resumeAll(tokens)
+
+	// Runs that time out
+	for i := 0; i < 10; i++ {
+		pause(ctx, awaitFlow("release_timeout", "10ms"), fmt.Sprintf("expired-%d", i))
+	}
+
+	// Runs whose request context is cancelled keep waiting until the engine closes
+	for i := 0; i < 10; i++ {
+		runCtx, cancel := context.WithCancel(ctx)
+		pause(runCtx, awaitFlow("release_cancel", ""), fmt.Sprintf("cancelled-%d", i))
+		cancel()
+	}
+	time.Sleep(20 * time.Millisecond)
+	e.mu.Lock()
+	for i := 0; i < 10; i++ {
+		if _, ok := e.resumeSubs[fmt.Sprintf("cancelled-%d", i)]; !ok {
+			t.Errorf("expected run cancelled-%d to stay subscribed after its context was cancelled", i)
+		}
+	}
+	e.mu.Unlock()
+	if err := e.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		e.mu.Lock()
+		open := len(e.resumeSubs)
+		e.mu.Unlock()
+		if open == 0 && runtime.NumGoroutine() <= baseline {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("resume subscriptions leaked: %d open, %d goroutines running, %d before", open, runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestExecute_OffloadsLargeOutputs(t *testing.T) {
+	ctx := context.Background()
+	bs, err := blob.NewFilesystemBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemBlobStore failed: %v", err)
+	}
+	e := NewDefaultEngine(ctx)
+	e.BlobStore = bs
+	e.OffloadThreshold = 100
+
+	items := make([]any, 20)
+	for i := range items {
+		items[i] = fmt.Sprintf("i%02d-xxxxxx", i)
+	}
+	f := &model.Flow{Name: "offload", Steps: []model.Step{
+		{ID: "big", Use: "core.echo", With: map[string]any{"text": "{{ event.body }}", "items": items, "note": "small"}},
+		{ID: "size", Use: "core.echo", With: map[string]any{"text": "{{ outputs.big.text | length }}"}},
+		{ID: "each", Foreach: "{{ outputs.big.items }}", As: "item", Do: []model.Step{
+			{ID: "out_{{ item }}", Use: "core.echo", With: map[string]any{"text": "{{ item }}"}},
+		}},
+	}}
+	body := strings.Repeat("a", 500)
+	outputs, err := e.Execute(ctx, f, map[string]any{"body": body})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+
+	big := outputs["big"].(map[string]any)
+	textRef, ok := model.AsBlobRef(big["text"])
+	if !ok || textRef.Size != 500 || !strings.HasPrefix(textRef.Mime, "text/plain") {
+		t.Fatalf("expected text to be offloaded as a 500 byte text blob, got %#v", big["text"])
+	}
+	if _, ok := model.AsBlobRef(big["items"]); !ok {
+		t.Errorf("expected items to be offloaded, got %#v", big["items"])
+	}
+	if big["note"] != "small" {
+		t.Errorf("expected small values to stay inline, got %#v", big["note"])
+	}
+	if got := outputs["size"].(map[string]any)["text"]; got != "500" {
+		t.Errorf("expected the template to see the full text, got %v", got)
+	}
+	if got := outputs["out_i19-xxxxxx"]; got == nil {
+		t.Errorf("expected foreach to iterate the offloaded list, outputs: %v", outputs)
+	}
+
+	data, err := bs.Get(ctx, textRef.URL)
+	if err != nil || string(data) != body {
+		t.Errorf("expected the blob to hold the original text, got %d bytes (%v)", len(data), err)
+	}
+
+	runs, _ := e.Storage.ListRuns(ctx)
+	if len(runs) != 1 {
+		t.Fatalf("expected 1 run, got %d", len(runs))
+	}
+	steps, _ := e.Storage.GetSteps(ctx, runs[0].ID)
+	for _, s := range steps {
+		if s.StepName == "big" {
+			if _, ok := model.AsBlobRef(s.Outputs["text"]); !ok {
+				t.Errorf("expected the persisted step to hold a blob ref, got %#v", s.Outputs["text"])
+			}
+		}
+	}
+}
+
+func TestExecute_OffloadedOutputsInStepIDsAndMatch(t *testing.T) {
+	ctx := context.Background()
+	bs, err := blob.NewFilesystemBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemBlobStore failed: %v", err)
+	}
+	e := NewDefaultEngine(ctx)
+	e.BlobStore = bs
+	e.OffloadThreshold = 100
+
+	f := &model.Flow{Name: "offload_refs", Steps: []model.Step{
+		{ID: "big", Use: "core.echo", With: map[string]any{"text": "{{ event.body }}"}},
+		{ID: "each", Foreach: "{{ event.items }}", As: "item", Do: []model.Step{
+			{ID: "len_{{ outputs.big.text | length }}", Use: "core.echo", With: map[string]any{"text": "{{ item }}"}},
+		}},
+		{ID: "wait", AwaitEvent: &model.AwaitEventSpec{Source: "test", Match: map[string]any{"token": "len-{{ outputs.big.text | length }}"}}},
+	}}
+	_, err = e.Execute(ctx, f, map[string]any{"body": strings.Repeat("a", 500), "items": []any{"x"}})
+	if err == nil || !strings.Contains(err.Error(), "is waiting for event") {
+		t.Fatalf("expected pause on await_event, got %v", err)
+	}
+
+	paused, err := e.Storage.LoadPausedRun(ctx, "len-500")
+	if err != nil || paused == nil {
+		t.Fatalf("expected the match to render against the loaded text, got %v, %v", paused, err)
+	}
+	pr, err := pausedRunFromPersisted(paused)
+	if err != nil {
+		t.Fatalf("pausedRunFromPersisted failed: %v", err)
+	}
+	if _, ok := pr.Outputs["len_500"]; !ok {
+		t.Errorf("expected the step ID to render against the loaded text, outputs: %v", pr.Outputs)
+	}
+}
+
+func TestExecute_OffloadDisabled(t *testing.T) {
+	ctx := context.Background()
+	bs, err := blob.NewFilesystemBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemBlobStore failed: %v", err)
+	}
+	// Offloading is off unless a threshold is configured
+	e := NewDefaultEngine(ctx)
+	e.BlobStore = bs
+
+	body := strings.Repeat("a", 1<<17)
+	f := &model.Flow{Name: "inline", Steps: []model.Step{{ID: "big", Use: "core.echo", With: map[string]any{"text": "{{ event.body }}"}}}}
+	outputs, err := e.Execute(ctx, f, map[string]any{"body": body})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got := outputs["big"].(map[string]any)["text"]; got != body {
+		t.Errorf("expected the output to stay inline when offloading is disabled")
+	}
+	if blobs, _ := bs.List(ctx, ""); len(blobs) != 0 {
+		t.Errorf("expected no blobs, got %d", len(blobs))
+	}
+}
+
+func TestExecute_CoreBlobToolsUseEngineBlobStore(t *testing.T) {
+	ctx := context.Background()
+	bs, err := blob.NewFilesystemBlobStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewFilesystemBlobStore failed: %v", err)
+	}
+	e := NewDefaultEngine(ctx)
+	e.BlobStore = bs
+
+	f := &model.Flow{Name: "blob_tools", Steps: []model.Step{
+		{ID: "save", Use: "core.blob.put", With: map[string]any{"text": "{{ event.csv }}", "filename": "report.csv"}},
+		{ID: "load", Use: "core.blob.get", With: map[string]any{"url": "{{ outputs.save.url }}"}},
+	}}
+	outputs, err := e.Execute(ctx, f, map[string]any{"csv": "a,b\n1,2\n"})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if got := outputs["load"].(map[string]any)["text"]; got != "a,b\n1,2\n" {
+		t.Errorf("expected the CSV back, got %v", got)
+	}
+}
+
+// earlyResumeAdapter publishes the resume event for its token before the run reaches await_event.
+type earlyResumeAdapter struct {
+	bus event.EventBus
+}
+
+func (a *earlyResumeAdapter) ID() string { return "test.early_resume" }
+
+func (a *earlyResumeAdapter) Execute(_ context.Context, inputs map[string]any) (map[string]any, error) {
+	token, _ := inputs["token"].(string)
+	return nil, a.bus.Publish("resume."+token, map[string]any{"resume_value": "early", "token": token})
+}
+
+func (a *earlyResumeAdapter) Manifest() *registry.ToolManifest { return nil }
+
+func TestAwaitEvent_ResumesFromEventLog(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemoryStorage()
+	bus := event.NewInProcEventBus()
+	defer bus.Close()
+	bus.SetEventLog(s, time.Hour)
+	e := NewEngine(NewDefaultAdapterRegistry(ctx), dsl.NewTemplater(), bus, nil, s)
+	defer e.Close()
+	e.Adapters.Register(&earlyResumeAdapter{bus: bus})
+
+	// A resume event from before the run started belongs to an earlier run
+	if err := bus.Publish("resume.early", map[string]any{"resume_value": "stale", "token": "early"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	flow := awaitFlow("early_resume", "")
+	flow.Steps[0] = model.Step{ID: "start", Use: "test.early_resume", With: map[string]interface{}{"token": "{{ event.token }}"}}
+	_, err := e.Execute(ctx, flow, map[string]any{"token": "early"})
+	if err == nil || !strings.Contains(err.Error(), "is waiting for event") {
+		t.Fatalf("expected pause on await_event, got: %v", err)
+	}
+
+	var outputs map[string]any
+	deadline := time.Now().Add(2 * time.Second)
+	for outputs == nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		outputs = e.GetCompletedOutputs("early")
+	}
+	if outputs == nil {
+		t.Fatal("expected the logged resume event to resume the run")
+	}
+	if got := outputs["resumed"].(map[string]any)["text"]; got != "early" {
+		t.Errorf("expected the event published during the run, got %v", got)
+	}
+}
+
+func TestAwaitEvent_ResumesOnMatchingSourceEvent(t *testing.T) {
+	ctx := context.Background()
+	s := storage.NewMemoryStorage()
+	bus := event.NewInProcEventBus()
+	defer bus.Close()
+	e := NewEngine(NewDefaultAdapterRegistry(ctx), dsl.NewTemplater(), bus, nil, s)
+	defer e.Close()
+
+	flow := &model.Flow{
+		Name: "airtable_approval",
+		Steps: []model.Step{
+			{ID: "wait", AwaitEvent: &model.AwaitEventSpec{Source: "airtable.*", Match: map[string]interface{}{
+				"record_id": "{{ event.record }}",
+				"base.size": 3,
+				"field":     "fields.Status",
+				"equals":    "Approved",
+			}}},
+			{ID: "resumed", Use: "core.echo", With: map[string]interface{}{"text": "{{ event.approved_by }}"}},
+		},
+	}
+	_, err := e.Execute(ctx, flow, map[string]any{"record": "rec1"})
+	if err == nil || !strings.Contains(err.Error(), "is waiting for event") {
+		t.Fatalf("expected pause on await_event, got: %v", err)
+	}
+	run, err := s.GetLatestRunByFlowName(ctx, flow.Name)
+	if err != nil {
+		t.Fatalf("GetLatestRunByFlowName failed: %v", err)
+	}
+
+	publish := func(payload map[string]any) {
+		t.Helper()
+		if err := bus.Publish("airtable.updated", payload); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+	// Events for another record, with another status or missing a field are ignored
+	publish(map[string]any{"record_id": "rec2", "base": map[string]any{"size": 3}, "fields": map[string]any{"Status": "Approved"}})
+	publish(map[string]any{"record_id": "rec1", "base": map[string]any{"size": 3}, "fields": map[string]any{"Status": "Rejected"}})
+	publish(map[string]any{"record_id": "rec1", "fields": map[string]any{"Status": "Approved"}})
+	time.Sleep(20 * time.Millisecond)
+	if run, _ = s.GetRun(ctx, run.ID); run.Status != model.RunWaiting {
+		t.Fatalf("expected non-matching events to leave the run WAITING, got %s", run.Status)
+	}
+
+	publish(map[string]any{"record_id": "rec1", "base": map[string]any{"size": 3.0}, "fields": map[string]any{"Status": "Approved"}, "approved_by": "ada"})
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if run, err = s.GetRun(ctx, run.ID); err == nil && run.Status == model.RunSucceeded {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if run.Status != model.RunSucceeded {
+		t.Fatalf("expected the matching event to resume the run, got %s", run.Status)
+	}
+	steps, err := s.GetSteps(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetSteps failed: %v", err)
+	}
+	var text any
+	for _, step := range steps {
+		if step.StepName == "resumed" {
+			text = step.Outputs["text"]
+		}
+	}
+	if text != "ada" {
+		t.Errorf("expected the resume event in later steps, got %v", text)
+	}
+}
+
+func TestAwaitEvent_ResumesOnSourceEventAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	s, err := storage.NewSqliteStorage(filepath.Join(t.TempDir(), "restart.db"))
+	if err != nil {
+		t.Fatalf("failed to create sqlite storage: %v", err)
+	}
+	defer s.Close()
+
+	flow := &model.Flow{
+		Name: "restart_approval",
+		Steps: []model.Step{
+			{ID: "wait", AwaitEvent: &model.AwaitEventSpec{Source: "airtable.updated", Match: map[string]interface{}{
+				"record_id": "{{ event.record }}",
+			}}},
+			{ID: "resumed", Use: "core.echo", With: map[string]interface{}{"text": "{{ event.approved_by }}"}},
+		},
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	first := NewEngine(NewDefaultAdapterRegistry(ctx), dsl.NewTemplater(), event.NewInProcEventBus(), nil, s)
+	_, err = first.Execute(runCtx, flow, map[string]any{"record": "rec1"})
+	if err == nil || !strings.Contains(err.Error(), "is waiting for event") {
+		t.Fatalf("expected pause on await_event, got: %v", err)
+	}
+	cancel()
+	first.Close()
+
+	// The snapshot keeps the source and the rendered match
+	paused, err := s.LoadPausedRuns(ctx)
+	if err != nil {
+		t.Fatalf("LoadPausedRuns failed: %v", err)
+	}
+	if len(paused) != 1 {
+		t.Fatalf("expected one paused run, got %d", len(paused))
+	}
+	for _, raw := range paused {
+		pr, err := pausedRunFromPersisted(raw)
+		if err != nil {
+			t.Fatalf("pausedRunFromPersisted failed: %v", err)
+		}
+		if pr.Source != "airtable.updated" || pr.Match["record_id"] != "rec1" {
+			t.Errorf("expected source and rendered match in the snapshot, got %q %v", pr.Source, pr.Match)
+		}
+	}
+
+	// A new engine on the same storage resumes the run on a matching source event
+	bus := event.NewInProcEventBus()
+	defer bus.Close()
+	second := NewEngine(NewDefaultAdapterRegistry(ctx), dsl.NewTemplater(), bus, nil, s)
+	defer second.Close()
+	if err := second.RestorePausedRuns(ctx); err != nil {
+		t.Fatalf("RestorePausedRuns failed: %v", err)
+	}
+	if err := bus.Publish("airtable.updated", map[string]any{"record_id": "rec1", "approved_by": "ada"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	run, err := s.GetLatestRunByFlowName(ctx, flow.Name)
+	if err != nil {
+		t.Fatalf("GetLatestRunByFlowName failed: %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if run, err = s.GetRun(ctx, run.ID); err == nil && run.Status == model.RunSucceeded {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if run.Status != model.RunSucceeded {
+		t.Fatalf("expected the restored subscription to resume the run, got %s", run.Status)
+	}
+}
+
+func TestExecute_ToolForeachStreamsPages(t *testing.T) {
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			w.Write([]byte(`{"records": ["a", "b"], "next": "c2"}`))
+		default:
+			w.Write([]byte(`{"records": ["c"]}`))
+		}
+	}))
+	defer server.Close()
+
+	e := NewDefaultEngine(context.Background())
+	e.Adapters.Register(&adapter.HTTPAdapter{AdapterID: "records.list", ToolManifest: &registry.ToolManifest{
+		Name:     "records.list",
+		Endpoint: server.URL,
+		Method:   "GET",
+		Paginate: &registry.PaginationPolicy{Type: "cursor", Items: "records", Cursor: "next", Param: "cursor"},
+	}})
+	f := &model.Flow{Name: "stream_pages", Steps: []model.Step{{
+		ID:  "each_record",
+		Use: "records.list",
+		As:  "record",
+		Do: []model.Step{{
+			ID:   "echo_{{ record }}",
+			Use:  "core.echo",
+			With: map[string]any{"text": "{{ record }}"},
+		}},
+	}}}
+	outputs, err := e.Execute(context.Background(), f, map[string]any{})
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	for _, id := range []string{"echo_a", "echo_b", "echo_c"} {
+		if _, ok := outputs[id]; !ok {
+			t.Errorf("expected output %s, got %v", id, outputs)
+		}
+	}
+	listing, _ := outputs["each_record"].(map[string]any)
+	if listing["count"] != 3 || listing["pages"] != 2 || requests != 2 {
+		t.Errorf("expected 3 records streamed from 2 pages, got %v", listing)
+	}
+
+	// Tools that don't paginate can't feed a loop
+	f.Name, f.Steps[0].Use = "stream_echo", "core.echo"
+	if _, err := e.Execute(context.Background(), f, map[string]any{}); err == nil || !strings.Contains(err.Error(), "did not stream any pages") {
+		t.Errorf("expected an error for a tool without pagination, got %v", err)
+	}
+}
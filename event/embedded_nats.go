@@ -0,0 +1,135 @@
+package event
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ThreeDotsLabs/watermill"
+	natsjs "github.com/ThreeDotsLabs/watermill-nats/v2/pkg/nats"
+	"github.com/ThreeDotsLabs/watermill/message"
+	"github.com/awantoch/beemflow/utils"
+	"github.com/nats-io/nats-server/v2/server"
+	natsgo "github.com/nats-io/nats.go"
+)
+
+const (
+	// embeddedStream is the JetStream stream the embedded driver stores events in.
+	embeddedStream = "BEEMFLOW_EVENTS"
+	// embeddedSubjectPrefix maps topics to subjects of embeddedStream.
+	embeddedSubjectPrefix = "beemflow.events."
+	// embeddedMaxAge is how long the embedded stream keeps events.
+	embeddedMaxAge = 7 * 24 * time.Hour
+	// embeddedStartTimeout bounds how long the embedded server may take to start.
+	embeddedStartTimeout = 10 * time.Second
+)
+
+// NewWatermillEmbeddedNATSBus starts an in-process NATS server with JetStream, storing events
+// under dir, and returns a bus on it. The server doesn't listen on the network; closing the
+// bus shuts it down.
+func NewWatermillEmbeddedNATSBus(dir string) (*WatermillEventBus, error) {
+	ns, err := server.NewServer(&server.Options{
+		ServerName: "beemflow",
+		JetStream:  true,
+		StoreDir:   dir,
+		DontListen: true,
+		NoSigs:     true,
+		NoLog:      true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedded NATS server: %w", err)
+	}
+	go ns.Start()
+	if !ns.ReadyForConnections(embeddedStartTimeout) {
+		ns.Shutdown()
+		return nil, fmt.Errorf("embedded NATS server did not start within %s", embeddedStartTimeout)
+	}
+	shutdown := func() {
+		ns.Shutdown()
+		ns.WaitForShutdown()
+	}
+
+	if err := ensureEmbeddedStream(ns); err != nil {
+		shutdown()
+		return nil, err
+	}
+
+	logger := watermill.NewStdLogger(false, false)
+	connect := []natsgo.Option{natsgo.InProcessServer(ns), natsgo.ErrorHandler(logEmbeddedNATSError)}
+	subjects := func(_, topic string) *natsjs.SubjectDetail {
+		return &natsjs.SubjectDetail{Primary: embeddedSubjectPrefix + topic}
+	}
+	pub, err := natsjs.NewPublisher(natsjs.PublisherConfig{
+		NatsOptions:       connect,
+		SubjectCalculator: subjects,
+		Marshaler:         embeddedMarshaler{},
+	}, logger)
+	if err != nil {
+		shutdown()
+		return nil, fmt.Errorf("failed to create embedded NATS publisher: %w", err)
+	}
+	sub, err := natsjs.NewSubscriber(natsjs.SubscriberConfig{
+		NatsOptions:       connect,
+		SubjectCalculator: subjects,
+		CloseTimeout:      30 * time.Second,
+		AckWaitTimeout:    30 * time.Second,
+		JetStream: natsjs.JetStreamConfig{
+			// Every subscription gets its own consumer, starting with the next event
+			SubscribeOptions: []natsgo.SubOpt{natsgo.DeliverNew(), natsgo.AckExplicit()},
+		},
+	}, logger)
+	if err != nil {
+		shutdown()
+		return nil, errors.Join(fmt.Errorf("failed to create embedded NATS subscriber: %w", err), pub.Close())
+	}
+
+	return &WatermillEventBus{publisher: pub, subscriber: sub, onClose: shutdown}, nil
+}
+
+// logEmbeddedNATSError logs asynchronous connection errors instead of printing them to stderr.
+// The in-process pipe closing while the bus shuts down is expected.
+func logEmbeddedNATSError(_ *natsgo.Conn, _ *natsgo.Subscription, err error) {
+	if errors.Is(err, io.ErrClosedPipe) {
+		return
+	}
+	utils.Warn("Embedded NATS connection error: %v", err)
+}
+
+// embeddedMarshaler publishes topics under embeddedSubjectPrefix. The publisher takes the
+// subject from the marshaler, not from the SubjectCalculator subscribers use.
+type embeddedMarshaler struct {
+	natsjs.NATSMarshaler
+}
+
+func (m embeddedMarshaler) Marshal(topic string, msg *message.Message) (*natsgo.Msg, error) {
+	return m.NATSMarshaler.Marshal(embeddedSubjectPrefix+topic, msg)
+}
+
+// ensureEmbeddedStream creates the stream that holds every topic, if it doesn't exist yet.
+func ensureEmbeddedStream(ns *server.Server) error {
+	nc, err := natsgo.Connect("", natsgo.InProcessServer(ns))
+	if err != nil {
+		return fmt.Errorf("failed to connect to embedded NATS server: %w", err)
+	}
+	defer nc.Close()
+	js, err := nc.JetStream()
+	if err != nil {
+		return fmt.Errorf("failed to open JetStream: %w", err)
+	}
+	if _, err := js.StreamInfo(embeddedStream); err == nil {
+		return nil
+	} else if !errors.Is(err, natsgo.ErrStreamNotFound) {
+		return fmt.Errorf("failed to look up stream %s: %w", embeddedStream, err)
+	}
+	_, err = js.AddStream(&natsgo.StreamConfig{
+		Name:     embeddedStream,
+		Subjects: []string{embeddedSubjectPrefix + ">"},
+		Storage:  natsgo.FileStorage,
+		MaxAge:   embeddedMaxAge,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stream %s: %w", embeddedStream, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+)
+
+func TestEmbeddedNATSBus_PubSub(t *testing.T) {
+	dir := t.TempDir()
+	bus, err := NewEventBusFromConfig(&config.EventConfig{Driver: "embedded", Directory: dir, RetryBackoff: "1ms"})
+	if err != nil {
+		t.Fatalf("NewEventBusFromConfig failed: %v", err)
+	}
+	defer bus.Close()
+	ctx := context.Background()
+
+	exact := make(chan any, 2)
+	if _, err := bus.Subscribe(ctx, "orders.created", func(payload any) { exact <- payload }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	wildcard := make(chan string, 2)
+	var failures int
+	if _, err := bus.SubscribeWithTopic(ctx, "orders.*", func(topic string, payload any) error {
+		if failures++; failures == 1 {
+			return errors.New("first delivery fails")
+		}
+		wildcard <- topic
+		return nil
+	}); err != nil {
+		t.Fatalf("SubscribeWithTopic failed: %v", err)
+	}
+
+	if err := bus.Publish("orders.created", map[string]any{"id": "o1"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	select {
+	case payload := <-exact:
+		if m, _ := payload.(map[string]any); m["id"] != "o1" {
+			t.Errorf("unexpected payload %v", payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("exact subscriber got no event")
+	}
+	select {
+	case topic := <-wildcard:
+		if topic != "orders.created" {
+			t.Errorf("unexpected topic %s", topic)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("wildcard subscriber got no redelivered event")
+	}
+	select {
+	case payload := <-exact:
+		t.Errorf("expected one delivery per subscriber, got another %v", payload)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	// The stream survives a restart on the same directory
+	restarted, err := NewWatermillEmbeddedNATSBus(dir)
+	if err != nil {
+		t.Fatalf("restarting on the same directory failed: %v", err)
+	}
+	if err := restarted.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+}
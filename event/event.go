@@ -2,14 +2,44 @@ package event
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/awantoch/beemflow/config"
 )
 
+// ErrBusClosed is returned when subscribing to a bus that has been closed.
+var ErrBusClosed = errors.New("event bus is closed")
+
+// EventBus delivers published payloads to the handlers subscribed to their topic.
 type EventBus interface {
 	Publish(topic string, payload any) error
-	Subscribe(ctx context.Context, topic string, handler func(payload any))
+	// Subscribe calls handler for every payload published to a topic matching pattern (see
+	// MatchTopic) until the returned subscription is closed or ctx is cancelled. If handler
+	// panics, the payload is redelivered according to the bus's RedeliveryPolicy.
+	Subscribe(ctx context.Context, pattern string, handler func(payload any)) (Subscription, error)
+	// SubscribeWithTopic is like Subscribe but also passes handler the topic the payload was
+	// published to, which is useful for wildcard patterns. Returning an error redelivers the
+	// payload just like a panic.
+	SubscribeWithTopic(ctx context.Context, pattern string, handler TopicHandler) (Subscription, error)
+	// SubscribeFrom is like SubscribeWithTopic, but first delivers the events matching pattern
+	// that the event log holds from the given position. It returns ErrNoEventLog if the bus
+	// doesn't log events.
+	SubscribeFrom(ctx context.Context, pattern string, from Position, handler TopicHandler) (Subscription, error)
+	// Close ends all subscriptions and releases the bus's connections.
+	Close() error
+}
+
+// TopicHandler receives an event together with the topic it was published to. An error
+// means the event was not handled and should be delivered again.
+type TopicHandler func(topic string, payload any) error
+
+// Subscription is a handler's registration with an EventBus.
+type Subscription interface {
+	// Close stops delivery to the handler and releases the subscription's resources. A handler
+	// call that is already running is allowed to finish. Close is idempotent and may be called
+	// from within the handler.
+	Close() error
 }
 
 // NewInProcEventBus returns a new in-memory event bus. Used when event config driver=="memory" or omitted.
@@ -21,10 +51,27 @@ func NewInProcEventBus() *WatermillEventBus {
 // NewEventBusFromConfig returns an EventBus based on config. Supported: memory (default), nats (with url).
 // Unknown drivers fail cleanly. See docs/flow.config.schema.json for config schema.
 func NewEventBusFromConfig(cfg *config.EventConfig) (EventBus, error) {
+	policy, err := RedeliveryPolicyFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
 	if cfg == nil || cfg.Driver == "" || cfg.Driver == "memory" {
-		return NewWatermillInMemBus(), nil
+		bus := NewWatermillInMemBus()
+		bus.SetRedeliveryPolicy(policy)
+		return bus, nil
 	}
 	switch cfg.Driver {
+	case "embedded":
+		dir := cfg.Directory
+		if dir == "" {
+			dir = config.DefaultNATSDir
+		}
+		bus, err := NewWatermillEmbeddedNATSBus(dir)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create embedded NATS event bus: %w", err)
+		}
+		bus.SetRedeliveryPolicy(policy)
+		return bus, nil
 	case "nats":
 		if cfg.URL == "" {
 			return nil, fmt.Errorf("NATS driver requires url")
@@ -33,6 +80,7 @@ func NewEventBusFromConfig(cfg *config.EventConfig) (EventBus, error) {
 		if err != nil {
 			return nil, fmt.Errorf("failed to create NATS event bus: %w", err)
 		}
+		bus.SetRedeliveryPolicy(policy)
 		return bus, nil
 	default:
 		return nil, fmt.Errorf("unsupported event bus driver: %s", cfg.Driver)
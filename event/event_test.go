@@ -2,7 +2,11 @@ package event
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -321,6 +325,207 @@ func TestWatermillEventBus_Subscribe_SubscribeError(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
 }
 
+// Test that closing subscriptions stops delivery and releases their goroutines
+func TestWatermillEventBus_SubscriptionClose(t *testing.T) {
+	bus := NewWatermillInMemBus()
+	defer bus.Close()
+	ctx := context.Background()
+	baseline := runtime.NumGoroutine()
+
+	var delivered atomic.Int32
+	subs := make([]Subscription, 0, 50)
+	for i := 0; i < 50; i++ {
+		sub, err := bus.Subscribe(ctx, fmt.Sprintf("topic-%d", i), func(payload any) {
+			delivered.Add(1)
+		})
+		if err != nil {
+			t.Fatalf("Subscribe failed: %v", err)
+		}
+		subs = append(subs, sub)
+	}
+	if runtime.NumGoroutine() <= baseline {
+		t.Fatal("expected subscriptions to run goroutines")
+	}
+	for _, sub := range subs {
+		if err := sub.Close(); err != nil {
+			t.Errorf("Close failed: %v", err)
+		}
+	}
+	// Closing twice is harmless
+	subs[0].Close()
+
+	if err := bus.Publish("topic-0", "after close"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	waitForGoroutines(t, baseline)
+	if n := delivered.Load(); n != 0 {
+		t.Errorf("expected no deliveries after Close, got %d", n)
+	}
+}
+
+// Test that a handler can close its own subscription without deadlocking
+func TestWatermillEventBus_CloseFromHandler(t *testing.T) {
+	bus := NewWatermillInMemBus()
+	defer bus.Close()
+
+	var sub Subscription
+	var mu sync.Mutex
+	calls := 0
+	done := make(chan struct{})
+	mu.Lock()
+	sub, err := bus.Subscribe(context.Background(), "once", func(payload any) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		sub.Close()
+		close(done)
+	})
+	mu.Unlock()
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	bus.Publish("once", "first")
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler did not run")
+	}
+	bus.Publish("once", "second")
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	if calls != 1 {
+		t.Errorf("expected 1 delivery, got %d", calls)
+	}
+}
+
+// Test that closing the bus ends all subscriptions
+func TestWatermillEventBus_Close(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	bus := NewWatermillInMemBus()
+	for i := 0; i < 10; i++ {
+		if _, err := bus.Subscribe(context.Background(), "topic", func(payload any) {}); err != nil {
+			t.Fatalf("Subscribe failed: %v", err)
+		}
+	}
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := bus.Close(); err != nil {
+		t.Errorf("second Close failed: %v", err)
+	}
+	if _, err := bus.Subscribe(context.Background(), "topic", func(payload any) {}); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("expected ErrBusClosed, got %v", err)
+	}
+	waitForGoroutines(t, baseline)
+}
+
+// Test that wildcard subscriptions receive matching topics, with the topic they were published to
+func TestWatermillEventBus_WildcardSubscriptions(t *testing.T) {
+	bus := NewWatermillInMemBus()
+	defer bus.Close()
+	ctx := context.Background()
+
+	type delivery struct {
+		topic   string
+		payload any
+	}
+	var mu sync.Mutex
+	received := map[string][]delivery{}
+	subscribe := func(pattern string) {
+		t.Helper()
+		_, err := bus.SubscribeWithTopic(ctx, pattern, func(topic string, payload any) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received[pattern] = append(received[pattern], delivery{topic, payload})
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("SubscribeWithTopic(%q) failed: %v", pattern, err)
+		}
+	}
+	for _, pattern := range []string{"orders.*", "github.>", ">", "orders.created"} {
+		subscribe(pattern)
+	}
+
+	for _, topic := range []string{"orders.created", "orders.eu.created", "github.pull_request.opened", "audit"} {
+		if err := bus.Publish(topic, map[string]any{"topic": topic}); err != nil {
+			t.Fatalf("Publish(%q) failed: %v", topic, err)
+		}
+	}
+
+	want := map[string][]string{
+		"orders.*":       {"orders.created"},
+		"github.>":       {"github.pull_request.opened"},
+		">":              {"orders.created", "orders.eu.created", "github.pull_request.opened", "audit"},
+		"orders.created": {"orders.created"},
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		done := true
+		for pattern, topics := range want {
+			done = done && len(received[pattern]) >= len(topics)
+		}
+		mu.Unlock()
+		if done || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+	for pattern, topics := range want {
+		got := received[pattern]
+		if len(got) != len(topics) {
+			t.Errorf("%s: got %d events %v, want %v", pattern, len(got), got, topics)
+			continue
+		}
+		// Delivery order across topics is not guaranteed
+		seen := map[string]bool{}
+		for _, d := range got {
+			if payload, _ := d.payload.(map[string]any); payload["topic"] != d.topic {
+				t.Errorf("%s: event %+v delivered with the wrong topic", pattern, d)
+			}
+			seen[d.topic] = true
+		}
+		for _, topic := range topics {
+			if !seen[topic] {
+				t.Errorf("%s: missing %s in %v", pattern, topic, got)
+			}
+		}
+	}
+}
+
+// Test that invalid patterns and topics are rejected
+func TestWatermillEventBus_InvalidTopics(t *testing.T) {
+	bus := NewWatermillInMemBus()
+	defer bus.Close()
+	if _, err := bus.Subscribe(context.Background(), "github.>.push", func(payload any) {}); err == nil {
+		t.Error("expected error for invalid pattern")
+	}
+	if err := bus.Publish("orders.*", "x"); err == nil {
+		t.Error("expected error when publishing to a pattern")
+	}
+	if err := bus.Publish(firehoseTopic, "x"); err == nil {
+		t.Error("expected error when publishing to a reserved topic")
+	}
+}
+
+// waitForGoroutines fails the test if the goroutine count does not drop back to baseline.
+func waitForGoroutines(t *testing.T, baseline int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines leaked: %d running, %d before", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
 // Helper function to compare maps
 func mapsEqual(a, b map[string]any) bool {
 	if len(a) != len(b) {
@@ -0,0 +1,52 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/model"
+)
+
+// ErrNoEventLog is returned by SubscribeFrom on a bus without an event log.
+var ErrNoEventLog = errors.New("event bus has no event log")
+
+// MetadataOffset is the message metadata key that carries an event's offset in the event log.
+const MetadataOffset = "beemflow_offset"
+
+// DefaultLogRetention is how long logged events are kept when the config doesn't say.
+const DefaultLogRetention = 7 * 24 * time.Hour
+
+// trimInterval is the least time between two trims of the event log.
+const trimInterval = time.Minute
+
+// replayBatchSize is how many logged events a replaying subscription reads at a time.
+const replayBatchSize = 100
+
+// EventLog durably records published events in offset order, so subscribers can replay
+// events that were published before they subscribed. storage.Storage satisfies it.
+type EventLog interface {
+	AppendEvent(ctx context.Context, rec *model.EventRecord) error
+	ListEvents(ctx context.Context, q model.EventQuery) ([]*model.EventRecord, error)
+	TrimEvents(ctx context.Context, before time.Time) (int, error)
+}
+
+// Position is where a replaying subscription starts reading the event log: after Offset,
+// skipping events published before Since. The zero Position replays the whole log.
+type Position struct {
+	Offset int64
+	Since  time.Time
+}
+
+// LogRetentionFromConfig returns how long the event log keeps events.
+func LogRetentionFromConfig(cfg *config.EventConfig) (time.Duration, error) {
+	if cfg == nil {
+		return DefaultLogRetention, nil
+	}
+	d, err := parseDuration("logRetention", cfg.LogRetention)
+	if err != nil || d > 0 {
+		return d, err
+	}
+	return DefaultLogRetention, nil
+}
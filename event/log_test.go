@@ -0,0 +1,165 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/model"
+)
+
+type memEventLog struct {
+	mu      sync.Mutex
+	records []*model.EventRecord
+	trimmed time.Time
+}
+
+func (l *memEventLog) AppendEvent(_ context.Context, rec *model.EventRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rec.Offset = int64(len(l.records) + 1)
+	rec.PublishedAt = time.Now()
+	cp := *rec
+	l.records = append(l.records, &cp)
+	return nil
+}
+
+func (l *memEventLog) ListEvents(_ context.Context, q model.EventQuery) ([]*model.EventRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []*model.EventRecord
+	for _, rec := range l.records {
+		if rec.Offset <= q.AfterOffset || rec.PublishedAt.Before(q.Since) || (q.Topic != "" && rec.Topic != q.Topic) {
+			continue
+		}
+		out = append(out, rec)
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+func (l *memEventLog) TrimEvents(_ context.Context, before time.Time) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.trimmed = before
+	return 0, nil
+}
+
+type topicPayload struct {
+	topic   string
+	payload any
+}
+
+func TestWatermillEventBus_SubscribeFromReplaysLog(t *testing.T) {
+	bus := NewWatermillInMemBus()
+	defer bus.Close()
+	log := &memEventLog{}
+	bus.SetEventLog(log, time.Hour)
+	ctx := context.Background()
+
+	for i := 0; i < replayBatchSize+5; i++ {
+		if err := bus.Publish("orders.created", i); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+	if err := bus.Publish("users.created", "u1"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	if log.trimmed.IsZero() {
+		t.Error("expected publishing to trim the log")
+	}
+
+	got := make(chan topicPayload, 2*replayBatchSize)
+	sub, err := bus.SubscribeFrom(ctx, "orders.*", Position{Offset: 2}, func(topic string, payload any) error {
+		got <- topicPayload{topic, payload}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SubscribeFrom failed: %v", err)
+	}
+	defer sub.Close()
+	if err := bus.Publish("orders.paid", "live"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	var received []topicPayload
+	deadline := time.After(2 * time.Second)
+	for len(received) < replayBatchSize+4 {
+		select {
+		case p := <-got:
+			received = append(received, p)
+		case <-deadline:
+			t.Fatalf("expected %d events, got %d", replayBatchSize+4, len(received))
+		}
+	}
+	select {
+	case p := <-got:
+		t.Fatalf("expected each event once, got an extra %+v", p)
+	case <-time.After(50 * time.Millisecond):
+	}
+	// Events after offset 2 in publish order, then the live event
+	if first := received[0]; first.topic != "orders.created" || fmt.Sprint(first.payload) != "2" {
+		t.Errorf("expected replay to start after offset 2, got %+v", first)
+	}
+	if last := received[len(received)-1]; last.topic != "orders.paid" || last.payload != "live" {
+		t.Errorf("expected the live event last, got %+v", last)
+	}
+}
+
+func TestWatermillEventBus_SubscribeFromSince(t *testing.T) {
+	bus := NewWatermillInMemBus()
+	defer bus.Close()
+	bus.SetEventLog(&memEventLog{}, 0)
+
+	if err := bus.Publish("t", "old"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	since := time.Now()
+	if err := bus.Publish("t", "new"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	got := make(chan any, 2)
+	if _, err := bus.SubscribeFrom(context.Background(), "t", Position{Since: since}, func(_ string, payload any) error {
+		got <- payload
+		return nil
+	}); err != nil {
+		t.Fatalf("SubscribeFrom failed: %v", err)
+	}
+	select {
+	case payload := <-got:
+		if payload != "new" {
+			t.Errorf("expected only events since the position, got %v", payload)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("logged event was not replayed")
+	}
+}
+
+func TestWatermillEventBus_SubscribeFromWithoutLog(t *testing.T) {
+	bus := NewWatermillInMemBus()
+	defer bus.Close()
+	_, err := bus.SubscribeFrom(context.Background(), "t", Position{}, func(string, any) error { return nil })
+	if !errors.Is(err, ErrNoEventLog) {
+		t.Errorf("expected ErrNoEventLog, got %v", err)
+	}
+}
+
+func TestLogRetentionFromConfig(t *testing.T) {
+	if d, err := LogRetentionFromConfig(&config.EventConfig{}); err != nil || d != DefaultLogRetention {
+		t.Errorf("expected the default retention, got %v, %v", d, err)
+	}
+	if d, err := LogRetentionFromConfig(&config.EventConfig{LogRetention: "36h"}); err != nil || d != 36*time.Hour {
+		t.Errorf("expected 36h, got %v, %v", d, err)
+	}
+	if _, err := LogRetentionFromConfig(&config.EventConfig{LogRetention: "forever"}); err == nil {
+		t.Error("expected an invalid logRetention to be rejected")
+	}
+}
@@ -0,0 +1,98 @@
+package event
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/model"
+)
+
+// DeadLetterTopic is the internal topic dead letters are published on, JSON-encoded as
+// model.DeadLetter, so they can be watched with Subscribe. It can't be published to directly.
+const DeadLetterTopic = reservedPrefix + "deadletter"
+
+const (
+	DefaultMaxAttempts = 3
+	DefaultBackoff     = time.Second
+	DefaultMaxBackoff  = 30 * time.Second
+)
+
+// RedeliveryPolicy controls how often an event is handed to a handler that panics or returns
+// an error. The wait before each retry doubles from Backoff up to MaxBackoff; once MaxAttempts
+// deliveries have failed the event is dead-lettered. Zero values fall back to the defaults above.
+type RedeliveryPolicy struct {
+	MaxAttempts int
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+}
+
+// RedeliveryPolicyFromConfig converts the redelivery settings of the event config.
+func RedeliveryPolicyFromConfig(cfg *config.EventConfig) (RedeliveryPolicy, error) {
+	var p RedeliveryPolicy
+	if cfg == nil {
+		return p, nil
+	}
+	var err error
+	if p.Backoff, err = parseDuration("retryBackoff", cfg.RetryBackoff); err != nil {
+		return p, err
+	}
+	if p.MaxBackoff, err = parseDuration("maxRetryBackoff", cfg.MaxRetryBackoff); err != nil {
+		return p, err
+	}
+	p.MaxAttempts = cfg.MaxAttempts
+	return p, nil
+}
+
+func parseDuration(name, val string) (time.Duration, error) {
+	if val == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid event.%s %q: %w", name, val, err)
+	}
+	return d, nil
+}
+
+func (p RedeliveryPolicy) withDefaults() RedeliveryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.Backoff <= 0 {
+		p.Backoff = DefaultBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultMaxBackoff
+	}
+	if p.MaxBackoff < p.Backoff {
+		p.MaxBackoff = p.Backoff
+	}
+	return p
+}
+
+// delay returns the wait after the given failed attempt (counted from 1).
+func (p RedeliveryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempt && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, p.MaxBackoff)
+}
+
+// DeadLetterStore keeps the events handlers gave up on, so they can be inspected and replayed.
+// storage.Storage satisfies it.
+type DeadLetterStore interface {
+	SaveDeadLetter(ctx context.Context, dl *model.DeadLetter) error
+}
+
+// callHandler runs handler, turning a panic into an error.
+func callHandler(handler TopicHandler, topic string, payload any) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(topic, payload)
+}
@@ -0,0 +1,179 @@
+package event
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/model"
+)
+
+type memDeadLetters struct {
+	mu      sync.Mutex
+	letters []*model.DeadLetter
+}
+
+func (s *memDeadLetters) SaveDeadLetter(_ context.Context, dl *model.DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters = append(s.letters, dl)
+	return nil
+}
+
+func (s *memDeadLetters) list() []*model.DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*model.DeadLetter(nil), s.letters...)
+}
+
+func TestWatermillEventBus_RedeliversFailedEvents(t *testing.T) {
+	bus := NewWatermillInMemBus()
+	defer bus.Close()
+	bus.SetRedeliveryPolicy(RedeliveryPolicy{MaxAttempts: 3, Backoff: time.Millisecond})
+	store := &memDeadLetters{}
+	bus.SetDeadLetterStore(store)
+
+	var attempts atomic.Int32
+	handled := make(chan any, 1)
+	_, err := bus.SubscribeWithTopic(context.Background(), "orders.created", func(_ string, payload any) error {
+		m := payload.(map[string]any)
+		if attempts.Add(1) < 3 {
+			m["mutated"] = true
+			return errors.New("not yet")
+		}
+		handled <- m
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SubscribeWithTopic failed: %v", err)
+	}
+	if err := bus.Publish("orders.created", map[string]any{"id": "o1"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	select {
+	case payload := <-handled:
+		if m := payload.(map[string]any); m["id"] != "o1" || m["mutated"] != nil {
+			t.Errorf("expected every attempt to get the original payload, got %v", m)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("event was not redelivered")
+	}
+	if n := attempts.Load(); n != 3 {
+		t.Errorf("expected 3 attempts, got %d", n)
+	}
+	if letters := store.list(); len(letters) != 0 {
+		t.Errorf("expected no dead letters, got %+v", letters)
+	}
+}
+
+func TestWatermillEventBus_DeadLettersPanickingHandler(t *testing.T) {
+	bus := NewWatermillInMemBus()
+	defer bus.Close()
+	bus.SetRedeliveryPolicy(RedeliveryPolicy{MaxAttempts: 2, Backoff: time.Millisecond})
+	store := &memDeadLetters{}
+	bus.SetDeadLetterStore(store)
+	ctx := context.Background()
+
+	watched := make(chan any, 1)
+	if _, err := bus.Subscribe(ctx, DeadLetterTopic, func(payload any) { watched <- payload }); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	var attempts atomic.Int32
+	if _, err := bus.Subscribe(ctx, "orders.*", func(payload any) {
+		attempts.Add(1)
+		var m map[string]any
+		m["boom"] = payload // nil map
+	}); err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := bus.Publish("orders.paid", map[string]any{"id": "o2"}); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	var published map[string]any
+	select {
+	case payload := <-watched:
+		published, _ = payload.(map[string]any)
+	case <-time.After(2 * time.Second):
+		t.Fatal("dead letter was not published")
+	}
+	letters := store.list()
+	if len(letters) != 1 {
+		t.Fatalf("expected 1 dead letter, got %+v", letters)
+	}
+	dl := letters[0]
+	if dl.Topic != "orders.paid" || dl.Subscription != "orders.*" || dl.Payload != `{"id":"o2"}` ||
+		dl.Attempts != 2 || !strings.Contains(dl.Error, "panicked") || dl.ID == "" {
+		t.Errorf("unexpected dead letter: %+v", dl)
+	}
+	if published["id"] != dl.ID || published["topic"] != "orders.paid" {
+		t.Errorf("expected the dead letter on %s, got %v", DeadLetterTopic, published)
+	}
+	if n := attempts.Load(); n != 2 {
+		t.Errorf("expected 2 attempts, got %d", n)
+	}
+	if err := bus.Publish(DeadLetterTopic, "x"); err == nil {
+		t.Error("expected publishing to the dead-letter topic to be rejected")
+	}
+}
+
+func TestWatermillEventBus_CloseDuringBackoff(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	bus := NewWatermillInMemBus()
+	bus.SetRedeliveryPolicy(RedeliveryPolicy{MaxAttempts: 5, Backoff: time.Hour})
+	store := &memDeadLetters{}
+	bus.SetDeadLetterStore(store)
+
+	failed := make(chan struct{}, 1)
+	_, err := bus.Subscribe(context.Background(), "t", func(any) {
+		failed <- struct{}{}
+		panic("boom")
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	if err := bus.Publish("t", "x"); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	<-failed
+	if err := bus.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	waitForGoroutines(t, baseline)
+	if letters := store.list(); len(letters) != 0 {
+		t.Errorf("expected no dead letters for an interrupted retry, got %+v", letters)
+	}
+}
+
+func TestRedeliveryPolicy_Delay(t *testing.T) {
+	p := RedeliveryPolicy{Backoff: 100 * time.Millisecond, MaxBackoff: 350 * time.Millisecond}.withDefaults()
+	want := []time.Duration{100, 200, 350, 350}
+	for i, w := range want {
+		if got := p.delay(i + 1); got != w*time.Millisecond {
+			t.Errorf("delay(%d) = %v, want %v", i+1, got, w*time.Millisecond)
+		}
+	}
+	if p.MaxAttempts != DefaultMaxAttempts {
+		t.Errorf("expected default max attempts, got %d", p.MaxAttempts)
+	}
+}
+
+func TestRedeliveryPolicyFromConfig(t *testing.T) {
+	p, err := RedeliveryPolicyFromConfig(&config.EventConfig{MaxAttempts: 5, RetryBackoff: "250ms", MaxRetryBackoff: "1m"})
+	if err != nil {
+		t.Fatalf("RedeliveryPolicyFromConfig failed: %v", err)
+	}
+	if p.MaxAttempts != 5 || p.Backoff != 250*time.Millisecond || p.MaxBackoff != time.Minute {
+		t.Errorf("unexpected policy: %+v", p)
+	}
+	if _, err := NewEventBusFromConfig(&config.EventConfig{RetryBackoff: "soon"}); err == nil {
+		t.Error("expected an invalid retryBackoff to be rejected")
+	}
+}
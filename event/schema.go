@@ -0,0 +1,105 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v5"
+)
+
+// ErrInvalidPayload is returned when an event payload doesn't match a schema of its topic.
+var ErrInvalidPayload = errors.New("invalid event payload")
+
+// SchemaSet holds the JSON Schemas that event payloads must match, by topic pattern.
+type SchemaSet struct {
+	schemas []topicSchema
+}
+
+type topicSchema struct {
+	pattern string
+	source  string
+	schema  *jsonschema.Schema
+}
+
+// Add compiles schema, a JSON Schema as decoded from JSON or YAML, for the topics matching
+// pattern. source says where the schema was declared and is quoted in validation errors.
+func (s *SchemaSet) Add(pattern, source string, schema any) error {
+	if err := ValidatePattern(pattern); err != nil {
+		return err
+	}
+	compiled, err := CompileSchema(schema)
+	if err != nil {
+		return fmt.Errorf("invalid schema for %s in %s: %w", pattern, source, err)
+	}
+	s.schemas = append(s.schemas, topicSchema{pattern: pattern, source: source, schema: compiled})
+	return nil
+}
+
+// Len returns the number of schemas in the set.
+func (s *SchemaSet) Len() int {
+	return len(s.schemas)
+}
+
+// Validate checks payload against every schema whose pattern matches topic. The error wraps
+// ErrInvalidPayload and lists each violation with the location of the offending field.
+func (s *SchemaSet) Validate(topic string, payload any) error {
+	var doc any
+	for _, ts := range s.schemas {
+		if !MatchTopic(ts.pattern, topic) {
+			continue
+		}
+		if doc == nil {
+			// Validate the payload as subscribers will see it
+			data, err := json.Marshal(payload)
+			if err != nil {
+				return fmt.Errorf("%w for %s: %v", ErrInvalidPayload, topic, err)
+			}
+			if err := json.Unmarshal(data, &doc); err != nil {
+				return fmt.Errorf("%w for %s: %v", ErrInvalidPayload, topic, err)
+			}
+		}
+		if err := ts.schema.Validate(doc); err != nil {
+			return fmt.Errorf("%w for %s (schema from %s): %s", ErrInvalidPayload, topic, ts.source, describeViolations(err))
+		}
+	}
+	return nil
+}
+
+// CompileSchema compiles a JSON Schema decoded from JSON or YAML.
+func CompileSchema(schema any) (*jsonschema.Schema, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	return jsonschema.CompileString("event.schema.json", string(data))
+}
+
+// describeViolations flattens a validation error to its leaf causes, e.g.
+// "/amount: expected number, but got string".
+func describeViolations(err error) string {
+	var ve *jsonschema.ValidationError
+	if !errors.As(err, &ve) {
+		return err.Error()
+	}
+	var out []string
+	var walk func(*jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			loc := e.InstanceLocation
+			if loc == "" {
+				loc = "/"
+			}
+			out = append(out, loc+": "+e.Message)
+			return
+		}
+		for _, cause := range e.Causes {
+			walk(cause)
+		}
+	}
+	walk(ve)
+	sort.Strings(out)
+	return strings.Join(out, "; ")
+}
@@ -0,0 +1,52 @@
+package event
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSchemaSet_Validate(t *testing.T) {
+	var set SchemaSet
+	err := set.Add("orders.*", "flow order_audit", map[string]any{
+		"type":     "object",
+		"required": []any{"id"},
+		"properties": map[string]any{
+			"id":     map[string]any{"type": "string"},
+			"amount": map[string]any{"type": "number"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if set.Len() != 1 {
+		t.Fatalf("expected 1 schema, got %d", set.Len())
+	}
+
+	if err := set.Validate("orders.created", map[string]any{"id": "o1", "amount": 12}); err != nil {
+		t.Errorf("expected a valid payload to pass, got %v", err)
+	}
+	if err := set.Validate("users.created", map[string]any{"name": "x"}); err != nil {
+		t.Errorf("expected topics without a schema to pass, got %v", err)
+	}
+
+	err = set.Validate("orders.created", map[string]any{"amount": "12"})
+	if !errors.Is(err, ErrInvalidPayload) {
+		t.Fatalf("expected ErrInvalidPayload, got %v", err)
+	}
+	for _, want := range []string{"orders.created", "flow order_audit", "/amount: expected number, but got string", "/: missing properties: 'id'"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected %q in %q", want, err.Error())
+		}
+	}
+}
+
+func TestSchemaSet_AddRejectsInvalid(t *testing.T) {
+	var set SchemaSet
+	if err := set.Add("orders.*", "config", map[string]any{"type": 5}); err == nil {
+		t.Error("expected an invalid schema to be rejected")
+	}
+	if err := set.Add("orders..x", "config", map[string]any{}); err == nil {
+		t.Error("expected an invalid pattern to be rejected")
+	}
+}
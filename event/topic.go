@@ -0,0 +1,101 @@
+package event
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Topic patterns follow NATS subject semantics. Topics are dot-separated tokens; in a pattern,
+// "*" matches exactly one token and ">" (only as the last token) matches one or more tokens:
+//
+//	orders.*      matches orders.created, not orders or orders.eu.created
+//	github.>      matches github.push and github.pull_request.opened, not github
+//	>             matches every topic
+const (
+	tokenSeparator   = "."
+	singleWildcard   = "*"
+	trailingWildcard = ">"
+)
+
+// firehoseTopic is the internal topic every event is also published on so that drivers
+// without native wildcard support can serve pattern subscriptions. Topics starting with
+// reservedPrefix can't be published to directly.
+const (
+	reservedPrefix = "_beemflow."
+	firehoseTopic  = reservedPrefix + "firehose"
+)
+
+// MetadataTopic is the message metadata key that carries an event's topic.
+const MetadataTopic = "beemflow_topic"
+
+// IsPattern reports whether pattern contains wildcard tokens.
+func IsPattern(pattern string) bool {
+	for _, token := range strings.Split(pattern, tokenSeparator) {
+		if token == singleWildcard || token == trailingWildcard {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTopic checks that topic can be published to: non-empty tokens, no wildcards and
+// not reserved.
+func ValidateTopic(topic string) error {
+	if strings.HasPrefix(topic, reservedPrefix) {
+		return fmt.Errorf("invalid topic %q: the %q prefix is reserved", topic, reservedPrefix)
+	}
+	if err := validateTokens(topic); err != nil {
+		return err
+	}
+	if IsPattern(topic) {
+		return fmt.Errorf("invalid topic %q: wildcards are only allowed in subscriptions", topic)
+	}
+	return nil
+}
+
+// ValidatePattern checks that pattern is a topic or a well-formed wildcard pattern.
+func ValidatePattern(pattern string) error {
+	if err := validateTokens(pattern); err != nil {
+		return err
+	}
+	tokens := strings.Split(pattern, tokenSeparator)
+	for i, token := range tokens {
+		if token == trailingWildcard && i != len(tokens)-1 {
+			return fmt.Errorf("invalid pattern %q: %q must be the last token", pattern, trailingWildcard)
+		}
+		if token != singleWildcard && token != trailingWildcard && strings.ContainsAny(token, singleWildcard+trailingWildcard) {
+			return fmt.Errorf("invalid pattern %q: wildcards must be whole tokens", pattern)
+		}
+	}
+	return nil
+}
+
+func validateTokens(topic string) error {
+	if topic == "" {
+		return fmt.Errorf("topic must not be empty")
+	}
+	for _, token := range strings.Split(topic, tokenSeparator) {
+		if token == "" {
+			return fmt.Errorf("invalid topic %q: empty token", topic)
+		}
+	}
+	return nil
+}
+
+// MatchTopic reports whether topic matches pattern.
+func MatchTopic(pattern, topic string) bool {
+	patternTokens := strings.Split(pattern, tokenSeparator)
+	topicTokens := strings.Split(topic, tokenSeparator)
+	for i, token := range patternTokens {
+		if token == trailingWildcard {
+			return i == len(patternTokens)-1 && len(topicTokens) > i
+		}
+		if i >= len(topicTokens) {
+			return false
+		}
+		if token != singleWildcard && token != topicTokens[i] {
+			return false
+		}
+	}
+	return len(patternTokens) == len(topicTokens)
+}
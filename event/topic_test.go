@@ -0,0 +1,57 @@
+package event
+
+import "testing"
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern, topic string
+		want           bool
+	}{
+		{"orders.created", "orders.created", true},
+		{"orders.created", "orders.updated", false},
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders", false},
+		{"orders.*", "orders.eu.created", false},
+		{"*.created", "orders.created", true},
+		{"orders.*.created", "orders.eu.created", true},
+		{"github.>", "github.push", true},
+		{"github.>", "github.pull_request.opened", true},
+		{"github.>", "github", false},
+		{"github.>", "gitlab.push", false},
+		{">", "anything", true},
+		{">", "any.thing.at.all", true},
+		{"*", "one", true},
+		{"*", "one.two", false},
+		{"orders.*.>", "orders.eu", false},
+		{"orders.*.>", "orders.eu.created.v2", true},
+	}
+	for _, tt := range tests {
+		if got := MatchTopic(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	for _, valid := range []string{"orders", "orders.*", "github.>", ">", "*.created", "test-topic with spaces"} {
+		if err := ValidatePattern(valid); err != nil {
+			t.Errorf("ValidatePattern(%q) failed: %v", valid, err)
+		}
+	}
+	for _, invalid := range []string{"", "orders.", ".orders", "orders..created", "github.>.push", "orders.cre*", "git>"} {
+		if err := ValidatePattern(invalid); err == nil {
+			t.Errorf("ValidatePattern(%q) should fail", invalid)
+		}
+	}
+}
+
+func TestValidateTopic(t *testing.T) {
+	if err := ValidateTopic("orders.created"); err != nil {
+		t.Errorf("ValidateTopic failed: %v", err)
+	}
+	for _, invalid := range []string{"", "orders.*", "github.>", firehoseTopic, "a..b"} {
+		if err := ValidateTopic(invalid); err == nil {
+			t.Errorf("ValidateTopic(%q) should fail", invalid)
+		}
+	}
+}
@@ -3,14 +3,20 @@ package event
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ThreeDotsLabs/watermill"
 	"github.com/ThreeDotsLabs/watermill-nats/pkg/nats"
 	"github.com/ThreeDotsLabs/watermill/message"
 	"github.com/ThreeDotsLabs/watermill/pubsub/gochannel"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/utils"
+	"github.com/google/uuid"
 	stan "github.com/nats-io/stan.go"
 )
 
@@ -18,6 +24,16 @@ import (
 type WatermillEventBus struct {
 	publisher  message.Publisher
 	subscriber message.Subscriber
+
+	mu          sync.Mutex
+	subs        map[*watermillSubscription]struct{}
+	closed      bool
+	redelivery  RedeliveryPolicy
+	deadLetters DeadLetterStore
+	log         EventLog
+	retention   time.Duration
+	lastTrim    time.Time
+	onClose     func() // stops what the driver runs in-process, after the pub/sub is closed
 }
 
 // NewWatermillInMemBus returns a Watermill-based, in-memory bus.
@@ -27,7 +43,6 @@ func NewWatermillInMemBus() *WatermillEventBus {
 	return &WatermillEventBus{publisher: ps, subscriber: ps}
 }
 
-
 // NewWatermillNATSBUS returns a NATS-backed bus or error if setup fails.
 func NewWatermillNATSBUS(clusterID, clientID, url string) (*WatermillEventBus, error) {
 	logger := watermill.NewStdLogger(false, false)
@@ -59,7 +74,44 @@ func NewWatermillNATSBUS(clusterID, clientID, url string) (*WatermillEventBus, e
 	return &WatermillEventBus{publisher: pub, subscriber: sub}, nil
 }
 
+// SetRedeliveryPolicy changes how failed deliveries are retried, for deliveries that start
+// afterwards.
+func (b *WatermillEventBus) SetRedeliveryPolicy(p RedeliveryPolicy) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.redelivery = p
+}
+
+// SetDeadLetterStore makes the bus save dead letters to store, in addition to publishing them
+// on DeadLetterTopic.
+func (b *WatermillEventBus) SetDeadLetterStore(store DeadLetterStore) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.deadLetters = store
+}
+
+// SetEventLog makes the bus append every published event to log, which enables SubscribeFrom.
+// Events older than retention are trimmed from the log as new ones are published.
+func (b *WatermillEventBus) SetEventLog(log EventLog, retention time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.log = log
+	b.retention = retention
+}
+
+func (b *WatermillEventBus) eventLog() EventLog {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.log
+}
+
+// Publish sends payload to the subscribers of topic. Every event is also published on an
+// internal firehose topic that serves wildcard subscriptions, so they work the same on every
+// driver. With an event log, the event is logged first and publishing fails if it can't be.
 func (b *WatermillEventBus) Publish(topic string, payload any) error {
+	if err := ValidateTopic(topic); err != nil {
+		return err
+	}
 	var data []byte
 	switch v := payload.(type) {
 	case []byte:
@@ -77,45 +129,299 @@ func (b *WatermillEventBus) Publish(topic string, payload any) error {
 		data = []byte(fmt.Sprintf("%v", v))
 	}
 	msg := message.NewMessage(watermill.NewUUID(), data)
-	return b.publisher.Publish(topic, msg)
+	msg.Metadata.Set(MetadataTopic, topic)
+	if log := b.eventLog(); log != nil {
+		rec := &model.EventRecord{Topic: topic, Payload: string(data)}
+		if err := log.AppendEvent(context.Background(), rec); err != nil {
+			return fmt.Errorf("failed to log event: %w", err)
+		}
+		msg.Metadata.Set(MetadataOffset, strconv.FormatInt(rec.Offset, 10))
+		b.trimLog(log)
+	}
+	if err := b.publisher.Publish(topic, msg); err != nil {
+		return err
+	}
+	return b.publisher.Publish(firehoseTopic, msg.Copy())
 }
 
-func (b *WatermillEventBus) Subscribe(ctx context.Context, topic string, handler func(payload any)) {
-	
-	ch, err := b.subscriber.Subscribe(ctx, topic)
-	if err != nil {
+// trimLog drops events older than the retention from log, at most once per trimInterval.
+func (b *WatermillEventBus) trimLog(log EventLog) {
+	b.mu.Lock()
+	now := time.Now()
+	if now.Sub(b.lastTrim) < trimInterval || b.retention <= 0 {
+		b.mu.Unlock()
 		return
 	}
+	b.lastTrim = now
+	retention := b.retention
+	b.mu.Unlock()
+	if _, err := log.TrimEvents(context.Background(), now.Add(-retention)); err != nil {
+		utils.Warn("Failed to trim event log: %v", err)
+	}
+}
+
+// Subscribe calls handler for every payload published to a topic matching pattern.
+func (b *WatermillEventBus) Subscribe(ctx context.Context, pattern string, handler func(payload any)) (Subscription, error) {
+	return b.SubscribeWithTopic(ctx, pattern, func(_ string, payload any) error {
+		handler(payload)
+		return nil
+	})
+}
+
+// SubscribeWithTopic calls handler for every payload published to a topic matching pattern,
+// together with that topic. Exact topics are subscribed to directly; wildcard patterns read
+// the firehose topic and filter it.
+func (b *WatermillEventBus) SubscribeWithTopic(ctx context.Context, pattern string, handler TopicHandler) (Subscription, error) {
+	return b.subscribe(ctx, pattern, nil, handler)
+}
+
+// SubscribeFrom replays the logged events matching pattern from the given position, then
+// continues with live events like SubscribeWithTopic. The live subscription is set up before
+// the log is read, and events seen in both are delivered once.
+func (b *WatermillEventBus) SubscribeFrom(ctx context.Context, pattern string, from Position, handler TopicHandler) (Subscription, error) {
+	if b.eventLog() == nil {
+		return nil, ErrNoEventLog
+	}
+	return b.subscribe(ctx, pattern, &from, handler)
+}
+
+// subscribe implements SubscribeWithTopic, and SubscribeFrom when from is set.
+func (b *WatermillEventBus) subscribe(ctx context.Context, pattern string, from *Position, handler TopicHandler) (Subscription, error) {
+	if err := ValidatePattern(pattern); err != nil {
+		return nil, err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBusClosed
+	}
+	log := b.log
+	source := pattern
+	if IsPattern(pattern) {
+		source = firehoseTopic
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	ch, err := b.subscriber.Subscribe(subCtx, source)
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("failed to subscribe to %s: %w", pattern, err)
+	}
+	sub := &watermillSubscription{cancel: cancel, done: make(chan struct{})}
+	if b.subs == nil {
+		b.subs = make(map[*watermillSubscription]struct{})
+	}
+	b.subs[sub] = struct{}{}
+
 	go func() {
+		defer close(sub.done)
+		defer b.forget(sub)
+		// Offset of the last replayed event; live events up to it were already delivered
+		var replayed int64
+		if from != nil {
+			var ok bool
+			if replayed, ok = b.replay(subCtx, log, sub, pattern, *from, handler); !ok {
+				return
+			}
+		}
 		for {
 			select {
-			case <-ctx.Done():
-				// Context cancelled, exit goroutine
+			case <-subCtx.Done():
+				// Subscription closed or context cancelled, exit goroutine
 				return
 			case msg, ok := <-ch:
 				if !ok {
 					// Channel closed, exit goroutine
 					return
 				}
-
-				data := msg.Payload // msg.Payload is []byte
-				// Try to decode as int
-				if i, err := strconv.Atoi(string(data)); err == nil {
-					handler(i)
+				if subCtx.Err() != nil {
+					return
+				}
+				topic := msg.Metadata.Get(MetadataTopic)
+				if source != firehoseTopic && topic == "" {
+					// Published without metadata, e.g. by an older client
+					topic = source
+				}
+				if source == firehoseTopic && (topic == "" || !MatchTopic(pattern, topic)) {
 					msg.Ack()
 					continue
 				}
-				// Try to decode as map[string]any (JSON)
-				var m map[string]any
-				if err := json.Unmarshal(data, &m); err == nil && len(m) > 0 {
-					handler(m)
+				if offset, err := strconv.ParseInt(msg.Metadata.Get(MetadataOffset), 10, 64); err == nil && offset <= replayed {
 					msg.Ack()
 					continue
 				}
-				// fallback: pass as string
-				handler(string(data))
+				sub.delivering.Store(true)
+				handled := b.deliver(subCtx, pattern, topic, msg, handler)
+				sub.delivering.Store(false)
+				if !handled {
+					// Closed while waiting to retry; leave the message to the broker
+					msg.Nack()
+					return
+				}
 				msg.Ack()
 			}
 		}
 	}()
+	return sub, nil
+}
+
+// replay delivers the events in log that match pattern, starting at from, and returns the
+// offset of the last event it read. It returns false if ctx ended first.
+func (b *WatermillEventBus) replay(ctx context.Context, log EventLog, sub *watermillSubscription, pattern string, from Position, handler TopicHandler) (int64, bool) {
+	q := model.EventQuery{AfterOffset: from.Offset, Since: from.Since, Limit: replayBatchSize}
+	if !IsPattern(pattern) {
+		q.Topic = pattern
+	}
+	last := from.Offset
+	for {
+		records, err := log.ListEvents(ctx, q)
+		if err != nil {
+			utils.ErrorCtx(ctx, "Failed to replay event log", "subscription", pattern, "error", err)
+			return last, ctx.Err() == nil
+		}
+		for _, rec := range records {
+			last = rec.Offset
+			if !MatchTopic(pattern, rec.Topic) {
+				continue
+			}
+			sub.delivering.Store(true)
+			handled := b.deliver(ctx, pattern, rec.Topic, message.NewMessage(watermill.NewUUID(), []byte(rec.Payload)), handler)
+			sub.delivering.Store(false)
+			if !handled || ctx.Err() != nil {
+				return last, false
+			}
+		}
+		if len(records) < replayBatchSize {
+			return last, true
+		}
+		q.AfterOffset = last
+	}
+}
+
+// deliver hands msg to handler, retrying failures with backoff. When all attempts fail the
+// message is dead-lettered. It returns false if ctx ended before the message was handled or
+// dead-lettered.
+func (b *WatermillEventBus) deliver(ctx context.Context, pattern, topic string, msg *message.Message, handler TopicHandler) bool {
+	b.mu.Lock()
+	policy := b.redelivery.withDefaults()
+	b.mu.Unlock()
+	for attempt := 1; ; attempt++ {
+		// Decode for every attempt so changes a failed handler made to the payload don't carry over
+		err := callHandler(handler, topic, decodePayload(msg.Payload))
+		if err == nil {
+			return true
+		}
+		if attempt >= policy.MaxAttempts {
+			b.deadLetter(ctx, pattern, topic, msg, err, attempt)
+			return true
+		}
+		utils.WarnCtx(ctx, "Event handler failed, retrying", "topic", topic, "subscription", pattern,
+			"attempt", attempt, "error", err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(policy.delay(attempt)):
+		}
+	}
+}
+
+// deadLetter records a message whose handler failed on every attempt: it is saved to the
+// dead-letter store, if there is one, and published on DeadLetterTopic.
+func (b *WatermillEventBus) deadLetter(ctx context.Context, pattern, topic string, msg *message.Message, cause error, attempts int) {
+	dl := &model.DeadLetter{
+		ID:           uuid.NewString(),
+		Topic:        topic,
+		Subscription: pattern,
+		Payload:      string(msg.Payload),
+		Error:        cause.Error(),
+		Attempts:     attempts,
+		FailedAt:     time.Now(),
+	}
+	utils.ErrorCtx(ctx, "Event handler failed, dead-lettering event", "topic", topic, "subscription", pattern,
+		"attempts", attempts, "dead_letter_id", dl.ID, "error", cause)
+
+	b.mu.Lock()
+	store := b.deadLetters
+	b.mu.Unlock()
+	if store != nil {
+		if err := store.SaveDeadLetter(context.WithoutCancel(ctx), dl); err != nil {
+			utils.ErrorCtx(ctx, "Failed to save dead letter", "dead_letter_id", dl.ID, "error", err)
+		}
+	}
+	if topic == DeadLetterTopic {
+		// Don't feed a failing dead-letter watcher its own failures
+		return
+	}
+	data, err := json.Marshal(dl)
+	if err != nil {
+		return
+	}
+	out := message.NewMessage(watermill.NewUUID(), data)
+	out.Metadata.Set(MetadataTopic, DeadLetterTopic)
+	if err := b.publisher.Publish(DeadLetterTopic, out); err != nil {
+		utils.WarnCtx(ctx, "Failed to publish dead letter", "dead_letter_id", dl.ID, "error", err)
+	}
+}
+
+// Close ends all subscriptions and closes the underlying publisher and subscriber.
+func (b *WatermillEventBus) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	subs := make([]*watermillSubscription, 0, len(b.subs))
+	for sub := range b.subs {
+		subs = append(subs, sub)
+	}
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		sub.Close()
+	}
+	err := b.subscriber.Close()
+	if pub, ok := b.publisher.(message.Subscriber); !ok || pub != b.subscriber {
+		err = errors.Join(err, b.publisher.Close())
+	}
+	if b.onClose != nil {
+		b.onClose()
+	}
+	return err
+}
+
+// forget drops a finished subscription from the bus.
+func (b *WatermillEventBus) forget(sub *watermillSubscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.subs, sub)
+}
+
+// decodePayload turns a message payload back into the value handlers expect: an int, a
+// non-empty JSON object as map[string]any, or else a string.
+func decodePayload(data []byte) any {
+	if i, err := strconv.Atoi(string(data)); err == nil {
+		return i
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err == nil && len(m) > 0 {
+		return m
+	}
+	return string(data)
+}
+
+// watermillSubscription is the Subscription returned by WatermillEventBus.Subscribe.
+type watermillSubscription struct {
+	cancel     context.CancelFunc
+	done       chan struct{}
+	delivering atomic.Bool
+}
+
+// Close stops delivery and, unless a handler call is in progress (possibly the caller
+// itself), waits for the delivery goroutine to exit.
+func (s *watermillSubscription) Close() error {
+	s.cancel()
+	if !s.delivering.Load() {
+		<-s.done
+	}
+	return nil
 }
@@ -1,6 +1,10 @@
 package model
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,6 +18,10 @@ type Flow struct {
 	Vars    map[string]any `yaml:"vars,omitempty" json:"vars,omitempty"`
 	Steps   []Step         `yaml:"steps" json:"steps"`
 	Catch   []Step         `yaml:"catch,omitempty" json:"catch,omitempty"`
+
+	// Origin is the stored definition this flow was parsed from. It is not part of the YAML;
+	// runs started from the flow are pinned to Origin's version.
+	Origin *FlowVersion `yaml:"-" json:"-"`
 }
 
 type Step struct {
@@ -57,6 +65,10 @@ type Run struct {
 	StartedAt time.Time      `json:"startedAt"`
 	EndedAt   *time.Time     `json:"endedAt,omitempty"`
 	Steps     []StepRun      `json:"steps,omitempty"`
+	Version   int64          `json:"version"` // Incremented on every persisted change; used for compare-and-swap
+
+	FlowVersion int    `json:"flowVersion,omitempty"` // Flow repository version the run executed
+	FlowHash    string `json:"flowHash,omitempty"`    // Content hash of that version
 }
 
 type StepRun struct {
@@ -70,6 +82,140 @@ type StepRun struct {
 	Outputs   map[string]any `json:"outputs,omitempty"`
 }
 
+// QueuedRun is an entry in the storage-backed run queue. A worker owns it while its lease is live;
+// once the lease expires it is handed to the next worker that asks.
+type QueuedRun struct {
+	RunID          uuid.UUID  `json:"runId"`
+	FlowName       string     `json:"flowName"`
+	Attempts       int        `json:"attempts"`
+	LeaseOwner     string     `json:"leaseOwner,omitempty"`
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty"`
+	EnqueuedAt     time.Time  `json:"enqueuedAt"`
+}
+
+// FlowVersion is one saved revision of a flow definition in the flow repository. Versions are
+// numbered from 1 per flow; Hash is the SHA-256 of Source, so saving unchanged YAML is a no-op.
+// A Version of 0 means the definition was read from the flows directory and is not stored yet.
+type FlowVersion struct {
+	FlowName  string    `json:"flowName"`
+	Version   int       `json:"version"`
+	Hash      string    `json:"hash"`
+	Source    string    `json:"source,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// DeadLetter is an event that a subscriber failed to handle on every delivery attempt.
+// Payload is the message body as it was published, so replaying it republishes the same event.
+type DeadLetter struct {
+	ID           string    `json:"id"`
+	Topic        string    `json:"topic"`
+	Subscription string    `json:"subscription"` // pattern the failing handler subscribed to
+	Payload      string    `json:"payload"`
+	Error        string    `json:"error"`
+	Attempts     int       `json:"attempts"`
+	FailedAt     time.Time `json:"failedAt"`
+}
+
+// EventRecord is a published event in the durable event log. Offsets grow with every event,
+// so a subscriber can pick up after the last offset it has seen.
+type EventRecord struct {
+	Offset      int64     `json:"offset"`
+	Topic       string    `json:"topic"`
+	Payload     string    `json:"payload"`
+	PublishedAt time.Time `json:"publishedAt"`
+}
+
+// EventQuery selects records from the event log, oldest first: those after AfterOffset that were
+// published at or after Since, optionally only on Topic. A Limit of 0 means no limit.
+type EventQuery struct {
+	Topic       string    `json:"topic,omitempty"`
+	AfterOffset int64     `json:"afterOffset,omitempty"`
+	Since       time.Time `json:"since"`
+	Limit       int       `json:"limit,omitempty"`
+}
+
+// StatsQuery selects the runs aggregated into FlowStats: runs started in [Since, Until),
+// optionally limited to one flow.
+type StatsQuery struct {
+	FlowName string    `json:"flowName,omitempty"`
+	Since    time.Time `json:"since"`
+	Until    time.Time `json:"until"`
+}
+
+// FlowStats summarizes the runs of one flow over a time window. Durations are in milliseconds
+// and only include runs and steps that have ended.
+type FlowStats struct {
+	FlowName      string            `json:"flowName"`
+	Runs          int               `json:"runs"`
+	ByStatus      map[RunStatus]int `json:"byStatus"`
+	SuccessRate   float64           `json:"successRate"` // SUCCEEDED / (SUCCEEDED + FAILED); 0 when none finished
+	AvgDurationMs float64           `json:"avgDurationMs"`
+	P95DurationMs float64           `json:"p95DurationMs"`
+	Steps         []*StepStats      `json:"steps,omitempty"`
+}
+
+// StepStats summarizes the executions of one step of a flow over the same window.
+type StepStats struct {
+	StepName       string          `json:"stepName"`
+	Runs           int             `json:"runs"`
+	Failed         int             `json:"failed"`
+	AvgDurationMs  float64         `json:"avgDurationMs"`
+	P95DurationMs  float64         `json:"p95DurationMs"`
+	FailureReasons []FailureReason `json:"failureReasons,omitempty"` // Most frequent errors first
+}
+
+// FailureReason counts the failures of a step that ended with the same error message.
+type FailureReason struct {
+	Error string `json:"error"`
+	Count int    `json:"count"`
+}
+
+// FlowHash returns the content hash used to identify a flow version.
+func FlowHash(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// BlobRefKey marks a map as a BlobRef: {"$blob": url, "mime": ..., "size": ...}.
+const BlobRefKey = "$blob"
+
+// BlobRef stands in for a step output value that was too large to keep inline and was
+// written to the blob store instead. It travels through outputs, storage and APIs as a
+// plain map (see Map) so it survives JSON round trips unchanged.
+type BlobRef struct {
+	URL  string `json:"$blob"`
+	Mime string `json:"mime"`
+	Size int64  `json:"size"`
+}
+
+// Map returns the map form of r stored in step outputs.
+func (r BlobRef) Map() map[string]any {
+	return map[string]any{BlobRefKey: r.URL, "mime": r.Mime, "size": r.Size}
+}
+
+// AsBlobRef reports whether v is the map form of a BlobRef and returns it.
+func AsBlobRef(v any) (BlobRef, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 3 {
+		return BlobRef{}, false
+	}
+	url, ok := m[BlobRefKey].(string)
+	if !ok || url == "" {
+		return BlobRef{}, false
+	}
+	ref := BlobRef{URL: url}
+	ref.Mime, _ = m["mime"].(string)
+	switch size := m["size"].(type) {
+	case int64:
+		ref.Size = size
+	case int:
+		ref.Size = int64(size)
+	case float64: // decoded from JSON
+		ref.Size = int64(size)
+	}
+	return ref, true
+}
+
 type RunStatus string
 
 type StepStatus string
@@ -89,3 +235,38 @@ const (
 	StepWaiting   StepStatus = "WAITING"
 )
 
+// ErrInvalidRunTransition is returned when a run status change is not allowed by the run state machine.
+var ErrInvalidRunTransition = errors.New("invalid run status transition")
+
+// runTransitions lists the legal status changes for a run. Terminal statuses have no entry.
+//
+//	PENDING -> RUNNING -> WAITING -> RUNNING -> ... -> SUCCEEDED | FAILED | SKIPPED
+var runTransitions = map[RunStatus][]RunStatus{
+	RunPending: {RunRunning, RunFailed, RunSkipped},
+	RunRunning: {RunWaiting, RunSucceeded, RunFailed, RunSkipped},
+	RunWaiting: {RunRunning, RunFailed, RunSkipped},
+}
+
+// IsTerminal reports whether no further transitions are possible from this status.
+func (s RunStatus) IsTerminal() bool {
+	_, ok := runTransitions[s]
+	return !ok
+}
+
+// CanTransitionTo reports whether a run may move from s to the given status.
+func (s RunStatus) CanTransitionTo(to RunStatus) bool {
+	for _, next := range runTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateRunTransition returns an error wrapping ErrInvalidRunTransition if from -> to is illegal.
+func ValidateRunTransition(from, to RunStatus) error {
+	if !from.CanTransitionTo(to) {
+		return fmt.Errorf("%w: %s -> %s", ErrInvalidRunTransition, from, to)
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package model_test
 
 import (
+	"encoding/json"
+	"errors"
 	"testing"
 
 	"gopkg.in/yaml.v3"
@@ -198,3 +200,65 @@ func TestRetryAwaitWait_EdgeCases(t *testing.T) {
 		t.Errorf("expected zero values, got %+v", w)
 	}
 }
+
+func TestRunStatus_Transitions(t *testing.T) {
+	cases := []struct {
+		from, to model.RunStatus
+		ok       bool
+	}{
+		{model.RunPending, model.RunRunning, true},
+		{model.RunRunning, model.RunWaiting, true},
+		{model.RunWaiting, model.RunRunning, true},
+		{model.RunWaiting, model.RunFailed, true},
+		{model.RunRunning, model.RunSucceeded, true},
+		{model.RunWaiting, model.RunSucceeded, false},
+		{model.RunPending, model.RunWaiting, false},
+		{model.RunSucceeded, model.RunRunning, false},
+		{model.RunFailed, model.RunRunning, false},
+		{model.RunSkipped, model.RunWaiting, false},
+	}
+	for _, c := range cases {
+		err := model.ValidateRunTransition(c.from, c.to)
+		if c.ok && err != nil {
+			t.Errorf("%s -> %s: unexpected error %v", c.from, c.to, err)
+		}
+		if !c.ok && !errors.Is(err, model.ErrInvalidRunTransition) {
+			t.Errorf("%s -> %s: expected ErrInvalidRunTransition, got %v", c.from, c.to, err)
+		}
+	}
+	for _, s := range []model.RunStatus{model.RunSucceeded, model.RunFailed, model.RunSkipped} {
+		if !s.IsTerminal() {
+			t.Errorf("expected %s to be terminal", s)
+		}
+	}
+	if model.RunWaiting.IsTerminal() {
+		t.Errorf("expected WAITING not to be terminal")
+	}
+}
+
+func TestBlobRef_SurvivesJSONRoundTrip(t *testing.T) {
+	ref := model.BlobRef{URL: "file:///tmp/outputs/x.json", Mime: "application/json", Size: 1234}
+	data, err := json.Marshal(map[string]any{"body": ref.Map()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := model.AsBlobRef(decoded["body"])
+	if !ok || got != ref {
+		t.Errorf("expected %+v, got %+v (ok=%v)", ref, got, ok)
+	}
+
+	for _, v := range []any{
+		"file:///tmp/x",
+		map[string]any{"$blob": "file:///tmp/x"},
+		map[string]any{"$blob": "", "mime": "text/plain", "size": 1},
+		map[string]any{"url": "file:///tmp/x", "mime": "text/plain", "size": 1},
+	} {
+		if _, ok := model.AsBlobRef(v); ok {
+			t.Errorf("did not expect %#v to be a blob ref", v)
+		}
+	}
+}
@@ -21,6 +21,16 @@ type RegistryEntry struct {
 	Parameters  map[string]any    `json:"parameters,omitempty"`
 	Endpoint    string            `json:"endpoint,omitempty"`
 	Headers     map[string]string `json:"headers,omitempty"`
+	// HTTP tool fields, copied into the tool's manifest
+	Method         string                `json:"method,omitempty"`
+	Query          map[string]string     `json:"query,omitempty"`
+	Body           map[string]any        `json:"body,omitempty"`
+	BodyType       string                `json:"body_type,omitempty"`
+	Timeout        string                `json:"timeout,omitempty"`
+	Retry          *RetryPolicy          `json:"retry,omitempty"`
+	CircuitBreaker *CircuitBreakerPolicy `json:"circuit_breaker,omitempty"`
+	ExpectStatus   any                   `json:"expect_status,omitempty"`
+	Paginate       *PaginationPolicy     `json:"paginate,omitempty"`
 	// MCP server fields
 	Command   string            `json:"command,omitempty"`
 	Args      []string          `json:"args,omitempty"`
@@ -29,6 +39,27 @@ type RegistryEntry struct {
 	Transport string            `json:"transport,omitempty"`
 }
 
+// ToolManifest returns the manifest of a tool entry.
+func (e RegistryEntry) ToolManifest() *ToolManifest {
+	return &ToolManifest{
+		Name:           e.Name,
+		Description:    e.Description,
+		Kind:           e.Kind,
+		Parameters:     e.Parameters,
+		Endpoint:       e.Endpoint,
+		Method:         e.Method,
+		Headers:        e.Headers,
+		Query:          e.Query,
+		Body:           e.Body,
+		BodyType:       e.BodyType,
+		Timeout:        e.Timeout,
+		Retry:          e.Retry,
+		CircuitBreaker: e.CircuitBreaker,
+		ExpectStatus:   e.ExpectStatus,
+		Paginate:       e.Paginate,
+	}
+}
+
 // ListOptions allows filtering and pagination for registry queries.
 type ListOptions struct {
 	Query    string
@@ -210,7 +241,52 @@ type ToolManifest struct {
 	Name        string            `json:"name"`
 	Description string            `json:"description"`
 	Kind        string            `json:"kind"`
-	Parameters  map[string]any    `json:"parameters"`
-	Endpoint    string            `json:"endpoint,omitempty"`
+	Parameters  map[string]any    `json:"parameters"`         // JSON Schema; a property's "in" is path, query, header or body
+	Endpoint    string            `json:"endpoint,omitempty"` // may contain {param} path parameters
+	Method      string            `json:"method,omitempty"`   // default POST
 	Headers     map[string]string `json:"headers,omitempty"`
+	Query       map[string]string `json:"query,omitempty"`     // static query parameters
+	Body        map[string]any    `json:"body,omitempty"`      // static body fields, overridden by inputs
+	BodyType    string            `json:"body_type,omitempty"` // json (default), form, multipart, text or binary
+
+	// HTTP call policy; unset fields use the adapter defaults
+	Timeout        string                `json:"timeout,omitempty"` // per attempt, e.g. "30s"; "0" disables
+	Retry          *RetryPolicy          `json:"retry,omitempty"`
+	CircuitBreaker *CircuitBreakerPolicy `json:"circuit_breaker,omitempty"`
+	ExpectStatus   any                   `json:"expect_status,omitempty"` // e.g. 201, "4xx" or a list; default 2xx
+	Paginate       *PaginationPolicy     `json:"paginate,omitempty"`
+}
+
+// RetryPolicy controls how an HTTP tool retries transport errors and 429/5xx responses.
+// Waits start at Backoff and double up to MaxBackoff; a Retry-After header sets the wait
+// instead, and a Retry-After longer than MaxBackoff ends the retries.
+type RetryPolicy struct {
+	Attempts   int    `json:"attempts,omitempty"`    // total attempts including the first; 1 disables retries
+	Backoff    string `json:"backoff,omitempty"`     // e.g. "500ms"
+	MaxBackoff string `json:"max_backoff,omitempty"` // e.g. "30s"
+	// NonIdempotent also retries POST and PATCH requests that failed for reasons other than
+	// 429 or Retry-After, which may repeat their side effects.
+	NonIdempotent bool `json:"non_idempotent,omitempty"`
+}
+
+// CircuitBreakerPolicy controls when calls to an HTTP tool fail fast. After Failures
+// consecutive failed calls the circuit opens for Cooldown; then one trial call is let
+// through, and its outcome closes or reopens the circuit.
+type CircuitBreakerPolicy struct {
+	Failures int    `json:"failures,omitempty"` // 0 uses the default; negative disables the breaker
+	Cooldown string `json:"cooldown,omitempty"` // e.g. "30s"
+}
+
+// PaginationPolicy makes an HTTP tool fetch every page of a listing. Type is how the next
+// page is requested: "cursor" sends the value at Cursor in the response as Param, "link"
+// follows the Link header's rel="next" URL, and "page" and "offset" count up Param from
+// Start by one page or by the number of items received. Paging stops when there is no next
+// cursor or link, a page has no items, or MaxPages pages have been fetched.
+type PaginationPolicy struct {
+	Type     string `json:"type"`
+	Items    string `json:"items,omitempty"`     // dotted path to each page's list; default the body
+	Cursor   string `json:"cursor,omitempty"`    // dotted path to the next cursor, e.g. "nextPageToken"
+	Param    string `json:"param,omitempty"`     // defaults to "page" and "offset" for those types
+	Start    *int   `json:"start,omitempty"`     // first page (default 1) or offset (default 0)
+	MaxPages int    `json:"max_pages,omitempty"` // default 100
 }
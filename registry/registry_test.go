@@ -133,6 +133,23 @@ func TestRegistryEntry_Namespacing(t *testing.T) {
 	}
 }
 
+func TestRegistryEntry_ToolManifest(t *testing.T) {
+	var entry RegistryEntry
+	data := `{"type": "tool", "name": "acme.upload", "endpoint": "https://acme.test/upload",
+		"method": "PUT", "query": {"v": "2"}, "body_type": "multipart", "timeout": "10s", "retry": {"attempts": 2}, "circuit_breaker": {"failures": 3}, "expect_status": 201}`
+	if err := json.Unmarshal([]byte(data), &entry); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	m := entry.ToolManifest()
+	if m.Name != "acme.upload" || m.Endpoint != "https://acme.test/upload" || m.BodyType != "multipart" || m.Timeout != "10s" ||
+		m.Method != "PUT" || m.Query["v"] != "2" {
+		t.Errorf("unexpected manifest: %+v", m)
+	}
+	if m.Retry == nil || m.Retry.Attempts != 2 || m.CircuitBreaker == nil || m.CircuitBreaker.Failures != 3 || m.ExpectStatus != float64(201) {
+		t.Errorf("expected the HTTP policy to be copied, got %+v", m)
+	}
+}
+
 // TestLocalRegistry_ListMCPServers ensures ListMCPServers filters only mcp_server entries.
 func TestLocalRegistry_ListMCPServers(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -0,0 +1,519 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/awantoch/beemflow/encryption"
+	"github.com/awantoch/beemflow/model"
+	"github.com/google/uuid"
+)
+
+// EncryptedValueKey is the key of the single-entry map that stands in for an encrypted value
+// in stored run data: {"$enc": "<base64 envelope>"}.
+const EncryptedValueKey = "$enc"
+
+var _ Storage = (*EncryptedStorage)(nil)
+
+// EncryptedStorage encrypts the sensitive parts of run data before handing them to another
+// Storage: run events and vars, step outputs, paused-run snapshots (which carry resolved
+// secrets) and the payloads of dead letters and logged events. Identifiers, statuses and timestamps stay in the clear so queries, the run queue
+// and statistics keep working. Values stored before encryption was enabled are read as-is.
+type EncryptedStorage struct {
+	Storage
+	env *encryption.Envelope
+}
+
+// NewEncryptedStorage wraps inner so that run data is encrypted with env.
+func NewEncryptedStorage(inner Storage, env *encryption.Envelope) *EncryptedStorage {
+	return &EncryptedStorage{Storage: inner, env: env}
+}
+
+// CurrentKeyID returns the ID of the key new data is encrypted with.
+func (s *EncryptedStorage) CurrentKeyID() string {
+	return s.env.CurrentKeyID()
+}
+
+// Close closes the wrapped storage if it holds resources.
+func (s *EncryptedStorage) Close() error {
+	if closer, ok := s.Storage.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (s *EncryptedStorage) SaveRun(ctx context.Context, run *model.Run) error {
+	sealed, err := s.sealRun(ctx, run)
+	if err != nil {
+		return err
+	}
+	if err := s.Storage.SaveRun(ctx, sealed); err != nil {
+		return err
+	}
+	run.Version = sealed.Version
+	return nil
+}
+
+func (s *EncryptedStorage) EnqueueRun(ctx context.Context, run *model.Run, item *model.QueuedRun) error {
+	sealed, err := s.sealRun(ctx, run)
+	if err != nil {
+		return err
+	}
+	if err := s.Storage.EnqueueRun(ctx, sealed, item); err != nil {
+		return err
+	}
+	run.Version = sealed.Version
+	return nil
+}
+
+func (s *EncryptedStorage) GetRun(ctx context.Context, id uuid.UUID) (*model.Run, error) {
+	run, err := s.Storage.GetRun(ctx, id)
+	if err != nil || run == nil {
+		return run, err
+	}
+	return run, s.openRun(ctx, run)
+}
+
+func (s *EncryptedStorage) TransitionRun(ctx context.Context, run *model.Run, to model.RunStatus) error {
+	sealed, err := s.sealRun(ctx, run)
+	if err != nil {
+		return err
+	}
+	if err := s.Storage.TransitionRun(ctx, sealed, to); err != nil {
+		return err
+	}
+	run.Status, run.EndedAt, run.Version = sealed.Status, sealed.EndedAt, sealed.Version
+	return nil
+}
+
+func (s *EncryptedStorage) SaveStep(ctx context.Context, step *model.StepRun) error {
+	outputs, err := s.sealMap(ctx, step.Outputs)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt outputs of step %s: %w", step.StepName, err)
+	}
+	sealed := *step
+	sealed.Outputs = outputs
+	return s.Storage.SaveStep(ctx, &sealed)
+}
+
+func (s *EncryptedStorage) GetSteps(ctx context.Context, runID uuid.UUID) ([]*model.StepRun, error) {
+	steps, err := s.Storage.GetSteps(ctx, runID)
+	if err != nil {
+		return nil, err
+	}
+	opened := make([]*model.StepRun, len(steps))
+	for i, step := range steps {
+		// Copy, as some stores hand out the steps they hold
+		plain := *step
+		if plain.Outputs, err = s.openMap(ctx, step.Outputs); err != nil {
+			return nil, fmt.Errorf("failed to decrypt outputs of step %s: %w", step.StepName, err)
+		}
+		opened[i] = &plain
+	}
+	return opened, nil
+}
+
+func (s *EncryptedStorage) ResolveWait(ctx context.Context, token uuid.UUID) (*model.Run, error) {
+	run, err := s.Storage.ResolveWait(ctx, token)
+	if err != nil || run == nil {
+		return run, err
+	}
+	return run, s.openRun(ctx, run)
+}
+
+func (s *EncryptedStorage) ListRuns(ctx context.Context) ([]*model.Run, error) {
+	runs, err := s.Storage.ListRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		if err := s.openRun(ctx, run); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+func (s *EncryptedStorage) SavePausedRun(ctx context.Context, token string, paused any) error {
+	m, err := pausedToMap(paused)
+	if err != nil {
+		return err
+	}
+	for _, field := range pausedSealedFields {
+		v, ok := m[field]
+		if !ok || v == nil {
+			continue
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if m[field], err = s.seal(ctx, data); err != nil {
+			return fmt.Errorf("failed to encrypt paused run %s: %w", token, err)
+		}
+	}
+	return s.Storage.SavePausedRun(ctx, token, m)
+}
+
+func (s *EncryptedStorage) LoadPausedRuns(ctx context.Context) (map[string]any, error) {
+	paused, err := s.Storage.LoadPausedRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for token, v := range paused {
+		if paused[token], err = s.openPaused(ctx, token, v); err != nil {
+			return nil, err
+		}
+	}
+	return paused, nil
+}
+
+func (s *EncryptedStorage) LoadPausedRun(ctx context.Context, token string) (any, error) {
+	paused, err := s.Storage.LoadPausedRun(ctx, token)
+	if err != nil || paused == nil {
+		return nil, err
+	}
+	return s.openPaused(ctx, token, paused)
+}
+
+// openPaused returns a paused-run snapshot as a map with its sealed fields decrypted.
+func (s *EncryptedStorage) openPaused(ctx context.Context, token string, paused any) (map[string]any, error) {
+	m, err := pausedToMap(paused)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range pausedSealedFields {
+		data, ok, err := s.open(ctx, m[field])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt paused run %s: %w", token, err)
+		}
+		if !ok {
+			continue
+		}
+		var value any
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		m[field] = value
+	}
+	return m, nil
+}
+
+// pausedSealedFields are the fields of a paused-run snapshot (see PausedRunPersist) that are
+// encrypted: the step context holds the run's event, vars and resolved secrets, and the match
+// values are rendered from them. The flow, step index, token, run ID and source stay readable
+// so every backend can store the snapshot.
+var pausedSealedFields = []string{"step_ctx", "outputs", "match"}
+
+// pausedToMap returns a paused-run snapshot as a generic map.
+func pausedToMap(paused any) (map[string]any, error) {
+	data, err := json.Marshal(paused)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *EncryptedStorage) SaveDeadLetter(ctx context.Context, dl *model.DeadLetter) error {
+	payload, err := s.sealString(ctx, dl.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt payload of dead letter %s: %w", dl.ID, err)
+	}
+	cp := *dl
+	cp.Payload = payload
+	return s.Storage.SaveDeadLetter(ctx, &cp)
+}
+
+func (s *EncryptedStorage) GetDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error) {
+	dl, err := s.Storage.GetDeadLetter(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return dl, s.openDeadLetter(ctx, dl)
+}
+
+func (s *EncryptedStorage) ListDeadLetters(ctx context.Context) ([]*model.DeadLetter, error) {
+	letters, err := s.Storage.ListDeadLetters(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, dl := range letters {
+		if err := s.openDeadLetter(ctx, dl); err != nil {
+			return nil, err
+		}
+	}
+	return letters, nil
+}
+
+// openDeadLetter decrypts dl's payload in place.
+func (s *EncryptedStorage) openDeadLetter(ctx context.Context, dl *model.DeadLetter) error {
+	payload, err := s.openString(ctx, dl.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt payload of dead letter %s: %w", dl.ID, err)
+	}
+	dl.Payload = payload
+	return nil
+}
+
+func (s *EncryptedStorage) AppendEvent(ctx context.Context, rec *model.EventRecord) error {
+	payload, err := s.sealString(ctx, rec.Payload)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt event payload: %w", err)
+	}
+	sealed := *rec
+	sealed.Payload = payload
+	if err := s.Storage.AppendEvent(ctx, &sealed); err != nil {
+		return err
+	}
+	rec.Offset, rec.PublishedAt = sealed.Offset, sealed.PublishedAt
+	return nil
+}
+
+func (s *EncryptedStorage) ListEvents(ctx context.Context, q model.EventQuery) ([]*model.EventRecord, error) {
+	records, err := s.Storage.ListEvents(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	for _, rec := range records {
+		if rec.Payload, err = s.openString(ctx, rec.Payload); err != nil {
+			return nil, fmt.Errorf("failed to decrypt event %d: %w", rec.Offset, err)
+		}
+	}
+	return records, nil
+}
+
+// sealString encrypts a string value into its JSON-encoded stand-in map.
+func (s *EncryptedStorage) sealString(ctx context.Context, v string) (string, error) {
+	sealed, err := s.seal(ctx, []byte(v))
+	if err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(sealed)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// openString decrypts a value written by sealString; any other string is returned unchanged.
+func (s *EncryptedStorage) openString(ctx context.Context, v string) (string, error) {
+	data, ok, err := s.open(ctx, stringStandIn(v))
+	if err != nil || !ok {
+		return v, err
+	}
+	return string(data), nil
+}
+
+// stringStandIn returns the stand-in map a string sealed by sealString was written as, or nil.
+func stringStandIn(v string) map[string]any {
+	var m map[string]any
+	if err := json.Unmarshal([]byte(v), &m); err != nil {
+		return nil
+	}
+	if _, ok := sealedValue(m); !ok {
+		return nil
+	}
+	return m
+}
+
+// ReencryptResult reports what Reencrypt rewrote.
+type ReencryptResult struct {
+	Runs        int `json:"runs"`
+	Steps       int `json:"steps"`
+	PausedRuns  int `json:"pausedRuns"`
+	DeadLetters int `json:"deadLetters"`
+	SkippedRuns int `json:"skippedRuns"` // unfinished runs, re-encrypted by their next status change
+}
+
+// Reencrypt rewrites run data that is stored in the clear or under a key other than the
+// current one, so retired keys can be removed. Rows of unfinished runs are left to their next
+// status change, which always writes with the current key, to avoid racing the engine; paused
+// snapshots are rewritten, so run it when no runs are being resumed. The event log is
+// append-only and not rewritten; keep retired keys until its records have been trimmed.
+func (s *EncryptedStorage) Reencrypt(ctx context.Context) (*ReencryptResult, error) {
+	current := s.env.CurrentKeyID()
+	result := &ReencryptResult{}
+	runs, err := s.Storage.ListRuns(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		if !s.isCurrent(run.Event, current) || !s.isCurrent(run.Vars, current) {
+			if !run.Status.IsTerminal() {
+				result.SkippedRuns++
+			} else {
+				if err := s.openRun(ctx, run); err != nil {
+					return result, err
+				}
+				if err := s.SaveRun(ctx, run); err != nil {
+					return result, err
+				}
+				result.Runs++
+			}
+		}
+		steps, err := s.Storage.GetSteps(ctx, run.ID)
+		if err != nil {
+			return result, err
+		}
+		for _, step := range steps {
+			if s.isCurrent(step.Outputs, current) {
+				continue
+			}
+			plain := *step
+			if plain.Outputs, err = s.openMap(ctx, step.Outputs); err != nil {
+				return result, err
+			}
+			if err := s.SaveStep(ctx, &plain); err != nil {
+				return result, err
+			}
+			result.Steps++
+		}
+	}
+
+	paused, err := s.Storage.LoadPausedRuns(ctx)
+	if err != nil {
+		return result, err
+	}
+	for token, v := range paused {
+		m, err := pausedToMap(v)
+		if err != nil {
+			return result, err
+		}
+		if stepCtx, _ := m["step_ctx"].(map[string]any); s.isCurrent(stepCtx, current) {
+			continue
+		}
+		plain, err := s.openPaused(ctx, token, m)
+		if err != nil {
+			return result, err
+		}
+		if err := s.SavePausedRun(ctx, token, plain); err != nil {
+			return result, err
+		}
+		result.PausedRuns++
+	}
+
+	letters, err := s.Storage.ListDeadLetters(ctx)
+	if err != nil {
+		return result, err
+	}
+	for _, dl := range letters {
+		if sealed := stringStandIn(dl.Payload); sealed != nil && s.isCurrent(sealed, current) {
+			continue
+		}
+		if err := s.openDeadLetter(ctx, dl); err != nil {
+			return result, err
+		}
+		if err := s.SaveDeadLetter(ctx, dl); err != nil {
+			return result, err
+		}
+		result.DeadLetters++
+	}
+	return result, nil
+}
+
+// sealRun returns a copy of run with its event and vars encrypted.
+func (s *EncryptedStorage) sealRun(ctx context.Context, run *model.Run) (*model.Run, error) {
+	event, err := s.sealMap(ctx, run.Event)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt event of run %s: %w", run.ID, err)
+	}
+	vars, err := s.sealMap(ctx, run.Vars)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt vars of run %s: %w", run.ID, err)
+	}
+	sealed := *run
+	sealed.Event, sealed.Vars = event, vars
+	return &sealed, nil
+}
+
+// openRun decrypts run's event and vars in place.
+func (s *EncryptedStorage) openRun(ctx context.Context, run *model.Run) error {
+	var err error
+	if run.Event, err = s.openMap(ctx, run.Event); err != nil {
+		return fmt.Errorf("failed to decrypt event of run %s: %w", run.ID, err)
+	}
+	if run.Vars, err = s.openMap(ctx, run.Vars); err != nil {
+		return fmt.Errorf("failed to decrypt vars of run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// sealMap encrypts m into its stand-in map. A nil map stays nil.
+func (s *EncryptedStorage) sealMap(ctx context.Context, m map[string]any) (map[string]any, error) {
+	if m == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return s.seal(ctx, data)
+}
+
+// openMap decrypts a map written by sealMap; any other map is returned unchanged.
+func (s *EncryptedStorage) openMap(ctx context.Context, m map[string]any) (map[string]any, error) {
+	data, ok, err := s.open(ctx, m)
+	if err != nil || !ok {
+		return m, err
+	}
+	var out map[string]any
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (s *EncryptedStorage) seal(ctx context.Context, data []byte) (map[string]any, error) {
+	sealed, err := s.env.Encrypt(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{EncryptedValueKey: base64.StdEncoding.EncodeToString(sealed)}, nil
+}
+
+// open returns the plaintext behind a stand-in map, and false if v is not one.
+func (s *EncryptedStorage) open(ctx context.Context, v any) ([]byte, bool, error) {
+	sealed, ok := sealedValue(v)
+	if !ok {
+		return nil, false, nil
+	}
+	data, err := s.env.Decrypt(ctx, sealed)
+	return data, true, err
+}
+
+// isCurrent reports whether v needs no re-encryption: it is nil, or sealed under keyID.
+func (s *EncryptedStorage) isCurrent(v map[string]any, keyID string) bool {
+	if v == nil {
+		return true
+	}
+	sealed, ok := sealedValue(v)
+	if !ok {
+		return false
+	}
+	id, err := encryption.KeyID(sealed)
+	return err == nil && id == keyID
+}
+
+// sealedValue returns the envelope held by a stand-in map.
+func sealedValue(v any) ([]byte, bool) {
+	m, ok := v.(map[string]any)
+	if !ok || len(m) != 1 {
+		return nil, false
+	}
+	encoded, ok := m[EncryptedValueKey].(string)
+	if !ok {
+		return nil, false
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || !encryption.IsEncrypted(sealed) {
+		return nil, false
+	}
+	return sealed, true
+}
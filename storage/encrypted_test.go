@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/encryption"
+	"github.com/awantoch/beemflow/model"
+	"github.com/google/uuid"
+)
+
+func newTestEncryptedStorage(t *testing.T) (*EncryptedStorage, *SqliteStorage, string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.json")
+	if _, err := encryption.RotateKeyFile(keyFile); err != nil {
+		t.Fatalf("RotateKeyFile failed: %v", err)
+	}
+	provider, err := encryption.LoadKeyFile(keyFile)
+	if err != nil {
+		t.Fatalf("LoadKeyFile failed: %v", err)
+	}
+	dbPath := filepath.Join(dir, "flow.db")
+	inner, err := NewSqliteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewSqliteStorage failed: %v", err)
+	}
+	t.Cleanup(func() { inner.Close() })
+	return NewEncryptedStorage(inner, encryption.New(provider)), inner, keyFile, dbPath
+}
+
+func TestEncryptedStorage_RoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, inner, _, dbPath := newTestEncryptedStorage(t)
+
+	run := &model.Run{
+		ID:        uuid.New(),
+		FlowName:  "billing",
+		Event:     map[string]any{"card": "4111-1111-1111-1111"},
+		Vars:      map[string]any{"api_key": "sk_live_topsecret"},
+		Status:    model.RunPending,
+		StartedAt: time.Now(),
+	}
+	if err := store.SaveRun(ctx, run); err != nil {
+		t.Fatalf("SaveRun failed: %v", err)
+	}
+	if err := store.TransitionRun(ctx, run, model.RunRunning); err != nil {
+		t.Fatalf("TransitionRun failed: %v", err)
+	}
+	step := &model.StepRun{ID: uuid.New(), RunID: run.ID, StepName: "charge", Status: model.StepSucceeded,
+		StartedAt: time.Now(), Outputs: map[string]any{"receipt": "rcpt_private"}}
+	if err := store.SaveStep(ctx, step); err != nil {
+		t.Fatalf("SaveStep failed: %v", err)
+	}
+	if err := store.SavePausedRun(ctx, "tok", map[string]any{
+		"flow": &model.Flow{Name: "billing"}, "token": "tok", "run_id": run.ID.String(),
+		"step_ctx": map[string]any{"secrets": map[string]any{"STRIPE": "resolved-secret"}},
+	}); err != nil {
+		t.Fatalf("SavePausedRun failed: %v", err)
+	}
+	if err := store.SaveDeadLetter(ctx, &model.DeadLetter{ID: "dl1", Topic: "billing.charge",
+		Payload: `{"card":"5500-0000-0000-0004"}`, FailedAt: time.Now()}); err != nil {
+		t.Fatalf("SaveDeadLetter failed: %v", err)
+	}
+	logged := &model.EventRecord{Topic: "resume.tok", Payload: `{"otp":"918273"}`}
+	if err := store.AppendEvent(ctx, logged); err != nil || logged.Offset == 0 {
+		t.Fatalf("AppendEvent failed: %v, offset %d", err, logged.Offset)
+	}
+
+	got, err := store.GetRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if got.Event["card"] != "4111-1111-1111-1111" || got.Vars["api_key"] != "sk_live_topsecret" || got.Status != model.RunRunning {
+		t.Errorf("unexpected run after round trip: %+v", got)
+	}
+	steps, err := store.GetSteps(ctx, run.ID)
+	if err != nil || len(steps) != 1 || steps[0].Outputs["receipt"] != "rcpt_private" {
+		t.Errorf("unexpected steps after round trip: %v, %v", steps, err)
+	}
+	paused, err := store.LoadPausedRuns(ctx)
+	snapshot, _ := paused["tok"].(map[string]any)
+	stepCtx, _ := snapshot["step_ctx"].(map[string]any)
+	if err != nil || stepCtx["secrets"].(map[string]any)["STRIPE"] != "resolved-secret" || snapshot["run_id"] != run.ID.String() {
+		t.Errorf("unexpected paused runs after round trip: %v, %v", paused, err)
+	}
+	letters, err := store.ListDeadLetters(ctx)
+	if err != nil || len(letters) != 1 || letters[0].Payload != `{"card":"5500-0000-0000-0004"}` {
+		t.Errorf("unexpected dead letters after round trip: %v, %v", letters, err)
+	}
+	events, err := store.ListEvents(ctx, model.EventQuery{})
+	if err != nil || len(events) != 1 || events[0].Payload != `{"otp":"918273"}` || events[0].Offset != logged.Offset {
+		t.Errorf("unexpected event log after round trip: %v, %v", events, err)
+	}
+
+	raw, err := inner.GetRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if _, ok := raw.Event[EncryptedValueKey]; !ok {
+		t.Errorf("expected the stored event to be encrypted, got %v", raw.Event)
+	}
+	inner.Close()
+	db, _ := os.ReadFile(dbPath)
+	for _, secret := range []string{"4111-1111", "sk_live", "rcpt_private", "resolved-secret", "5500-0000", "918273"} {
+		if bytes.Contains(db, []byte(secret)) {
+			t.Errorf("database file contains %q in the clear", secret)
+		}
+	}
+}
+
+func TestEncryptedStorage_Reencrypt(t *testing.T) {
+	ctx := context.Background()
+	store, inner, keyFile, _ := newTestEncryptedStorage(t)
+
+	// Written before encryption was enabled
+	legacy := &model.Run{ID: uuid.New(), FlowName: "f", Event: map[string]any{"old": true},
+		Status: model.RunSucceeded, StartedAt: time.Now()}
+	if err := inner.SaveRun(ctx, legacy); err != nil {
+		t.Fatalf("SaveRun failed: %v", err)
+	}
+	done := &model.Run{ID: uuid.New(), FlowName: "f", Event: map[string]any{"n": 1},
+		Status: model.RunSucceeded, StartedAt: time.Now()}
+	running := &model.Run{ID: uuid.New(), FlowName: "f", Vars: map[string]any{"n": 2},
+		Status: model.RunRunning, StartedAt: time.Now()}
+	for _, run := range []*model.Run{done, running} {
+		if err := store.SaveRun(ctx, run); err != nil {
+			t.Fatalf("SaveRun failed: %v", err)
+		}
+	}
+	if err := store.SaveStep(ctx, &model.StepRun{ID: uuid.New(), RunID: done.ID, StepName: "s",
+		Status: model.StepSucceeded, StartedAt: time.Now(), Outputs: map[string]any{"x": "y"}}); err != nil {
+		t.Fatalf("SaveStep failed: %v", err)
+	}
+
+	if err := store.SavePausedRun(ctx, "tok", map[string]any{"flow": &model.Flow{Name: "f"}, "token": "tok",
+		"run_id": running.ID.String(), "step_ctx": map[string]any{"vars": map[string]any{"n": 2}}}); err != nil {
+		t.Fatalf("SavePausedRun failed: %v", err)
+	}
+	if err := inner.SaveDeadLetter(ctx, &model.DeadLetter{ID: "legacy", Topic: "t", Payload: "plain",
+		FailedAt: time.Now()}); err != nil {
+		t.Fatalf("SaveDeadLetter failed: %v", err)
+	}
+
+	newKey, err := encryption.RotateKeyFile(keyFile)
+	if err != nil {
+		t.Fatalf("RotateKeyFile failed: %v", err)
+	}
+	provider, _ := encryption.LoadKeyFile(keyFile)
+	rotated := NewEncryptedStorage(inner, encryption.New(provider))
+
+	result, err := rotated.Reencrypt(ctx)
+	if err != nil {
+		t.Fatalf("Reencrypt failed: %v", err)
+	}
+	if result.Runs != 2 || result.Steps != 1 || result.PausedRuns != 1 || result.DeadLetters != 1 || result.SkippedRuns != 1 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	raw, _ := inner.GetRun(ctx, legacy.ID)
+	if !rotated.isCurrent(raw.Event, newKey) {
+		t.Errorf("legacy run was not encrypted with %s", newKey)
+	}
+	got, err := rotated.GetRun(ctx, legacy.ID)
+	if err != nil || got.Event["old"] != true {
+		t.Errorf("unexpected legacy run after re-encryption: %v, %v", got, err)
+	}
+	if dl, err := rotated.GetDeadLetter(ctx, "legacy"); err != nil || dl.Payload != "plain" {
+		t.Errorf("unexpected legacy dead letter after re-encryption: %v, %v", dl, err)
+	}
+	if result, _ := rotated.Reencrypt(ctx); result.Runs != 0 || result.Steps != 0 || result.PausedRuns != 0 || result.DeadLetters != 0 {
+		t.Errorf("second pass should have nothing to do: %+v", result)
+	}
+}
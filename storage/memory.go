@@ -4,7 +4,9 @@ import (
 	"context"
 	"database/sql"
 	"maps"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/awantoch/beemflow/model"
 	"github.com/google/uuid"
@@ -13,9 +15,14 @@ import (
 // MemoryStorage implements Storage in-memory (for fallback/dev mode).
 type MemoryStorage struct {
 	runs   map[uuid.UUID]*model.Run
-	steps  map[uuid.UUID][]*model.StepRun // runID -> steps
-	mu     sync.RWMutex                   // RWMutex is sufficient for most use cases; consider context-aware primitives if high concurrency or cancellation is needed.
-	paused map[string]any                 // token -> paused run
+	steps  map[uuid.UUID][]*model.StepRun  // runID -> steps
+	mu     sync.RWMutex                    // RWMutex is sufficient for most use cases; consider context-aware primitives if high concurrency or cancellation is needed.
+	paused map[string]any                  // token -> paused run
+	queue  map[uuid.UUID]*model.QueuedRun  // runID -> queue entry
+	flows  map[string][]*model.FlowVersion // flow name -> versions, oldest first
+	dlq    map[string]*model.DeadLetter    // dead letter ID -> dead letter
+	events []*model.EventRecord            // event log, in offset order
+	offset int64                           // offset of the last appended event
 }
 
 var _ Storage = (*MemoryStorage)(nil)
@@ -25,16 +32,27 @@ func NewMemoryStorage() *MemoryStorage {
 		runs:   make(map[uuid.UUID]*model.Run),
 		steps:  make(map[uuid.UUID][]*model.StepRun),
 		paused: make(map[string]any),
+		queue:  make(map[uuid.UUID]*model.QueuedRun),
+		flows:  make(map[string][]*model.FlowVersion),
+		dlq:    make(map[string]*model.DeadLetter),
 	}
 }
 
 func (m *MemoryStorage) SaveRun(ctx context.Context, run *model.Run) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.runs[run.ID] = run
+	m.saveRunLocked(run)
 	return nil
 }
 
+func (m *MemoryStorage) saveRunLocked(run *model.Run) {
+	run.Version = 1
+	if existing, ok := m.runs[run.ID]; ok {
+		run.Version = existing.Version + 1
+	}
+	m.runs[run.ID] = cloneRun(run)
+}
+
 func (m *MemoryStorage) GetRun(ctx context.Context, id uuid.UUID) (*model.Run, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
@@ -42,7 +60,26 @@ func (m *MemoryStorage) GetRun(ctx context.Context, id uuid.UUID) (*model.Run, e
 	if !ok {
 		return nil, sql.ErrNoRows
 	}
-	return run, nil
+	return cloneRun(run), nil
+}
+
+func (m *MemoryStorage) TransitionRun(ctx context.Context, run *model.Run, to model.RunStatus) error {
+	endedAt, err := prepareTransition(run, to)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.runs[run.ID]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if current.Version != run.Version || current.Status != run.Status {
+		return ErrVersionConflict
+	}
+	applyTransition(run, to, endedAt)
+	m.runs[run.ID] = cloneRun(run)
+	return nil
 }
 
 func (m *MemoryStorage) SaveStep(ctx context.Context, step *model.StepRun) error {
@@ -71,7 +108,7 @@ func (m *MemoryStorage) ListRuns(ctx context.Context) ([]*model.Run, error) {
 	defer m.mu.RUnlock()
 	var out []*model.Run
 	for _, run := range m.runs {
-		out = append(out, run)
+		out = append(out, cloneRun(run))
 	}
 	return out, nil
 }
@@ -91,6 +128,12 @@ func (m *MemoryStorage) LoadPausedRuns(ctx context.Context) (map[string]any, err
 	return out, nil
 }
 
+func (m *MemoryStorage) LoadPausedRun(ctx context.Context, token string) (any, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.paused[token], nil
+}
+
 func (m *MemoryStorage) DeletePausedRun(ctx context.Context, token string) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -103,6 +146,7 @@ func (m *MemoryStorage) DeleteRun(ctx context.Context, id uuid.UUID) error {
 	defer m.mu.Unlock()
 	delete(m.runs, id)
 	delete(m.steps, id)
+	delete(m.queue, id)
 	return nil
 }
 
@@ -124,5 +168,277 @@ func (m *MemoryStorage) GetLatestRunByFlowName(ctx context.Context, flowName str
 	if latest == nil {
 		return nil, sql.ErrNoRows
 	}
-	return latest, nil
+	return cloneRun(latest), nil
+}
+
+func (m *MemoryStorage) EnqueueRun(ctx context.Context, run *model.Run, item *model.QueuedRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.saveRunLocked(run)
+	cp := *item
+	m.queue[item.RunID] = &cp
+	return nil
+}
+
+func (m *MemoryStorage) LeaseRun(ctx context.Context, owner string, ttl time.Duration, limits map[string]int) (*model.QueuedRun, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	active := make(map[string]int)
+	var candidates []*model.QueuedRun
+	for _, item := range m.queue {
+		if leaseAvailable(item, now) {
+			candidates = append(candidates, item)
+		} else {
+			active[item.FlowName]++
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].EnqueuedAt.Before(candidates[j].EnqueuedAt)
+	})
+	for _, item := range candidates {
+		if !withinFlowLimit(limits, item.FlowName, active[item.FlowName]) {
+			continue
+		}
+		expires := now.Add(ttl)
+		item.LeaseOwner = owner
+		item.LeaseExpiresAt = &expires
+		item.Attempts++
+		cp := *item
+		return &cp, nil
+	}
+	return nil, nil
+}
+
+func (m *MemoryStorage) RenewLease(ctx context.Context, runID uuid.UUID, owner string, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.queue[runID]
+	if !ok || item.LeaseOwner != owner {
+		return ErrLeaseLost
+	}
+	expires := time.Now().Add(ttl)
+	item.LeaseExpiresAt = &expires
+	return nil
+}
+
+func (m *MemoryStorage) CompleteQueuedRun(ctx context.Context, runID uuid.UUID, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.queue[runID]
+	if !ok || item.LeaseOwner != owner {
+		return ErrLeaseLost
+	}
+	delete(m.queue, runID)
+	return nil
+}
+
+func (m *MemoryStorage) SaveFlowVersion(ctx context.Context, fv *model.FlowVersion) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	versions := m.flows[fv.FlowName]
+	if n := len(versions); n > 0 && versions[n-1].Hash == fv.Hash {
+		*fv = *versions[n-1]
+		return nil
+	}
+	fv.Version = len(versions) + 1
+	fv.CreatedAt = time.Now()
+	cp := *fv
+	m.flows[fv.FlowName] = append(versions, &cp)
+	return nil
+}
+
+func (m *MemoryStorage) GetFlowVersion(ctx context.Context, name string, version int) (*model.FlowVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions := m.flows[name]
+	if version == 0 {
+		version = len(versions)
+	}
+	if version < 1 || version > len(versions) {
+		return nil, ErrFlowNotFound
+	}
+	cp := *versions[version-1]
+	return &cp, nil
+}
+
+func (m *MemoryStorage) ListFlowVersions(ctx context.Context, name string) ([]*model.FlowVersion, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	versions := m.flows[name]
+	out := make([]*model.FlowVersion, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		cp := *versions[i]
+		cp.Source = ""
+		out = append(out, &cp)
+	}
+	return out, nil
+}
+
+func (m *MemoryStorage) ListFlowNames(ctx context.Context) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	names := make([]string, 0, len(m.flows))
+	for name := range m.flows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (m *MemoryStorage) DeleteFlow(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.flows[name]; !ok {
+		return ErrFlowNotFound
+	}
+	delete(m.flows, name)
+	return nil
+}
+
+func (m *MemoryStorage) FlowStats(ctx context.Context, q model.StatsQuery) ([]*model.FlowStats, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	b := statsBuilder{}
+	runDurations := make(map[*model.FlowStats][]float64)
+	stepDurations := make(map[*model.StepStats][]float64)
+	for _, run := range m.runs {
+		if !statsWindowContains(q, run.FlowName, run.StartedAt) {
+			continue
+		}
+		fs := b.flow(run.FlowName)
+		fs.Runs++
+		fs.ByStatus[run.Status]++
+		if run.EndedAt != nil {
+			runDurations[fs] = append(runDurations[fs], float64(run.EndedAt.Sub(run.StartedAt).Milliseconds()))
+		}
+		for _, step := range m.steps[run.ID] {
+			if step.EndedAt == nil {
+				continue
+			}
+			ss := b.step(run.FlowName, step.StepName)
+			ss.Runs++
+			stepDurations[ss] = append(stepDurations[ss], float64(step.EndedAt.Sub(step.StartedAt).Milliseconds()))
+			if step.Status == model.StepFailed {
+				ss.Failed++
+				addFailureReason(ss, step.Error)
+			}
+		}
+	}
+	for fs, d := range runDurations {
+		fs.AvgDurationMs, fs.P95DurationMs = durationStats(d)
+	}
+	for ss, d := range stepDurations {
+		ss.AvgDurationMs, ss.P95DurationMs = durationStats(d)
+	}
+	return b.result(), nil
+}
+
+func (m *MemoryStorage) SaveDeadLetter(ctx context.Context, dl *model.DeadLetter) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cp := *dl
+	m.dlq[dl.ID] = &cp
+	return nil
+}
+
+func (m *MemoryStorage) GetDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	dl, ok := m.dlq[id]
+	if !ok {
+		return nil, ErrDeadLetterNotFound
+	}
+	cp := *dl
+	return &cp, nil
+}
+
+func (m *MemoryStorage) ListDeadLetters(ctx context.Context) ([]*model.DeadLetter, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*model.DeadLetter, 0, len(m.dlq))
+	for _, dl := range m.dlq {
+		cp := *dl
+		out = append(out, &cp)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].FailedAt.Equal(out[j].FailedAt) {
+			return out[i].FailedAt.Before(out[j].FailedAt)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out, nil
+}
+
+func (m *MemoryStorage) DeleteDeadLetter(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.dlq[id]; !ok {
+		return ErrDeadLetterNotFound
+	}
+	delete(m.dlq, id)
+	return nil
+}
+
+func (m *MemoryStorage) AppendEvent(ctx context.Context, rec *model.EventRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.offset++
+	rec.Offset = m.offset
+	if rec.PublishedAt.IsZero() {
+		rec.PublishedAt = time.Now()
+	}
+	cp := *rec
+	m.events = append(m.events, &cp)
+	return nil
+}
+
+func (m *MemoryStorage) ListEvents(ctx context.Context, q model.EventQuery) ([]*model.EventRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	// Records are appended in offset order, so the first one after AfterOffset can be searched for
+	start := sort.Search(len(m.events), func(i int) bool { return m.events[i].Offset > q.AfterOffset })
+	out := []*model.EventRecord{}
+	for _, rec := range m.events[start:] {
+		if q.Limit > 0 && len(out) == q.Limit {
+			break
+		}
+		if (q.Topic != "" && rec.Topic != q.Topic) || rec.PublishedAt.Before(q.Since) {
+			continue
+		}
+		cp := *rec
+		out = append(out, &cp)
+	}
+	return out, nil
+}
+
+func (m *MemoryStorage) TrimEvents(ctx context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.events[:0]
+	for _, rec := range m.events {
+		if !rec.PublishedAt.Before(before) {
+			kept = append(kept, rec)
+		}
+	}
+	n := len(m.events) - len(kept)
+	clear(m.events[len(kept):])
+	m.events = kept
+	return n, nil
+}
+
+func addFailureReason(ss *model.StepStats, reason string) {
+	for i := range ss.FailureReasons {
+		if ss.FailureReasons[i].Error == reason {
+			ss.FailureReasons[i].Count++
+			return
+		}
+	}
+	ss.FailureReasons = append(ss.FailureReasons, model.FailureReason{Error: reason, Count: 1})
+}
+
+// cloneRun copies a run so callers can't mutate stored state behind the version check.
+func cloneRun(run *model.Run) *model.Run {
+	cp := *run
+	return &cp
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"time"
 
@@ -57,7 +58,8 @@ CREATE TABLE IF NOT EXISTS runs (
 	vars JSONB,
 	status TEXT NOT NULL,
 	started_at TIMESTAMPTZ NOT NULL,
-	ended_at TIMESTAMPTZ
+	ended_at TIMESTAMPTZ,
+	version BIGINT NOT NULL DEFAULT 0
 );
 
 CREATE TABLE IF NOT EXISTS steps (
@@ -82,20 +84,73 @@ CREATE TABLE IF NOT EXISTS paused_runs (
 	flow JSONB NOT NULL,
 	step_idx INTEGER NOT NULL,
 	step_ctx JSONB NOT NULL,
-	outputs JSONB NOT NULL
+	outputs JSONB NOT NULL,
+	run_id TEXT,
+	await_source TEXT,
+	await_match JSONB
+);
+
+CREATE TABLE IF NOT EXISTS run_queue (
+	run_id UUID PRIMARY KEY REFERENCES runs(id) ON DELETE CASCADE,
+	flow_name TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	lease_owner TEXT,
+	lease_expires_at TIMESTAMPTZ,
+	enqueued_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS flow_versions (
+	flow_name TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	hash TEXT NOT NULL,
+	source TEXT NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	PRIMARY KEY (flow_name, version)
+);
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+	id TEXT PRIMARY KEY,
+	topic TEXT NOT NULL,
+	subscription TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	error TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	failed_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS event_log (
+	id BIGSERIAL PRIMARY KEY, -- the event's offset
+	topic TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	published_at TIMESTAMPTZ NOT NULL
 );
 
+-- Columns added after the initial schema
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE paused_runs ADD COLUMN IF NOT EXISTS run_id TEXT;
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS flow_version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE runs ADD COLUMN IF NOT EXISTS flow_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE paused_runs ADD COLUMN IF NOT EXISTS await_source TEXT;
+ALTER TABLE paused_runs ADD COLUMN IF NOT EXISTS await_match JSONB;
+
 -- Create indexes for better performance
 CREATE INDEX IF NOT EXISTS idx_runs_flow_name ON runs(flow_name);
 CREATE INDEX IF NOT EXISTS idx_runs_started_at ON runs(started_at DESC);
 CREATE INDEX IF NOT EXISTS idx_steps_run_id ON steps(run_id);
 CREATE INDEX IF NOT EXISTS idx_steps_started_at ON steps(started_at DESC);
+CREATE INDEX IF NOT EXISTS idx_run_queue_enqueued_at ON run_queue(enqueued_at);
+CREATE INDEX IF NOT EXISTS idx_event_log_topic ON event_log(topic, id);
+CREATE INDEX IF NOT EXISTS idx_event_log_published_at ON event_log(published_at);
 `
 	_, err := db.Exec(sqlStmt)
 	return err
 }
 
 func (s *PostgresStorage) SaveRun(ctx context.Context, run *model.Run) error {
+	return savePostgresRun(ctx, s.db, run)
+}
+
+func savePostgresRun(ctx context.Context, q queryer, run *model.Run) error {
 	event, err := json.Marshal(run.Event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal run event: %w", err)
@@ -105,28 +160,71 @@ func (s *PostgresStorage) SaveRun(ctx context.Context, run *model.Run) error {
 		return fmt.Errorf("failed to marshal run vars: %w", err)
 	}
 
-	_, err = s.db.ExecContext(ctx, `
-INSERT INTO runs (id, flow_name, event, vars, status, started_at, ended_at)
-VALUES ($1, $2, $3, $4, $5, $6, $7)
+	return q.QueryRowContext(ctx, `
+INSERT INTO runs (id, flow_name, event, vars, status, started_at, ended_at, version, flow_version, flow_hash)
+VALUES ($1, $2, $3, $4, $5, $6, $7, 1, $8, $9)
 ON CONFLICT(id) DO UPDATE SET 
 	flow_name = EXCLUDED.flow_name,
 	event = EXCLUDED.event,
 	vars = EXCLUDED.vars,
 	status = EXCLUDED.status,
 	started_at = EXCLUDED.started_at,
-	ended_at = EXCLUDED.ended_at
-`, run.ID, run.FlowName, event, vars, run.Status, run.StartedAt, run.EndedAt)
-	return err
+	ended_at = EXCLUDED.ended_at,
+	version = runs.version + 1,
+	flow_version = EXCLUDED.flow_version,
+	flow_hash = EXCLUDED.flow_hash
+RETURNING version
+`, run.ID, run.FlowName, event, vars, run.Status, run.StartedAt, run.EndedAt, run.FlowVersion, run.FlowHash).Scan(&run.Version)
+}
+
+func (s *PostgresStorage) TransitionRun(ctx context.Context, run *model.Run, to model.RunStatus) error {
+	endedAt, err := prepareTransition(run, to)
+	if err != nil {
+		return err
+	}
+	event, err := json.Marshal(run.Event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run event: %w", err)
+	}
+	vars, err := json.Marshal(run.Vars)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run vars: %w", err)
+	}
+
+	res, err := s.db.ExecContext(ctx, `
+UPDATE runs SET
+	status = $1,
+	event = $2,
+	vars = $3,
+	ended_at = $4,
+	version = version + 1
+WHERE id = $5 AND version = $6 AND status = $7
+`, to, event, vars, endedAt, run.ID, run.Version, run.Status)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := s.GetRun(ctx, run.ID); err != nil {
+			return err
+		}
+		return ErrVersionConflict
+	}
+	applyTransition(run, to, endedAt)
+	return nil
 }
 
 func (s *PostgresStorage) GetRun(ctx context.Context, id uuid.UUID) (*model.Run, error) {
 	row := s.db.QueryRowContext(ctx, `
-SELECT id, flow_name, event, vars, status, started_at, ended_at 
+SELECT id, flow_name, event, vars, status, started_at, ended_at, version, flow_version, flow_hash
 FROM runs WHERE id = $1`, id)
 
 	var run model.Run
 	var event, vars []byte
-	err := row.Scan(&run.ID, &run.FlowName, &event, &vars, &run.Status, &run.StartedAt, &run.EndedAt)
+	err := row.Scan(&run.ID, &run.FlowName, &event, &vars, &run.Status, &run.StartedAt, &run.EndedAt, &run.Version, &run.FlowVersion, &run.FlowHash)
 	if err != nil {
 		return nil, err
 	}
@@ -223,21 +321,28 @@ func (s *PostgresStorage) SavePausedRun(ctx context.Context, token string, pause
 	if err != nil {
 		return err
 	}
+	matchBytes, err := json.Marshal(persist.Match)
+	if err != nil {
+		return err
+	}
 
 	_, err = s.db.ExecContext(ctx, `
-INSERT INTO paused_runs (token, flow, step_idx, step_ctx, outputs)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO paused_runs (token, flow, step_idx, step_ctx, outputs, run_id, await_source, await_match)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 ON CONFLICT(token) DO UPDATE SET 
 	flow = EXCLUDED.flow,
 	step_idx = EXCLUDED.step_idx,
 	step_ctx = EXCLUDED.step_ctx,
-	outputs = EXCLUDED.outputs
-`, token, flowBytes, persist.StepIdx, stepCtxBytes, outputsBytes)
+	outputs = EXCLUDED.outputs,
+	run_id = EXCLUDED.run_id,
+	await_source = EXCLUDED.await_source,
+	await_match = EXCLUDED.await_match
+`, token, flowBytes, persist.StepIdx, stepCtxBytes, outputsBytes, persist.RunID, persist.Source, matchBytes)
 	return err
 }
 
 func (s *PostgresStorage) LoadPausedRuns(ctx context.Context) (map[string]any, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT token, flow, step_idx, step_ctx, outputs FROM paused_runs`)
+	rows, err := s.db.QueryContext(ctx, `SELECT token, flow, step_idx, step_ctx, outputs, run_id, await_source, await_match FROM paused_runs`)
 	if err != nil {
 		return nil, err
 	}
@@ -246,35 +351,35 @@ func (s *PostgresStorage) LoadPausedRuns(ctx context.Context) (map[string]any, e
 	result := make(map[string]any)
 	for rows.Next() {
 		var token string
-		var flowBytes, stepCtxBytes, outputsBytes []byte
+		var flowBytes, stepCtxBytes, outputsBytes, matchBytes []byte
 		var stepIdx int
-		if err := rows.Scan(&token, &flowBytes, &stepIdx, &stepCtxBytes, &outputsBytes); err != nil {
+		var runID, source sql.NullString
+		if err := rows.Scan(&token, &flowBytes, &stepIdx, &stepCtxBytes, &outputsBytes, &runID, &source, &matchBytes); err != nil {
 			continue
 		}
-
-		var flow model.Flow
-		var stepCtx map[string]any
-		var outputs map[string]any
-		if err := json.Unmarshal(flowBytes, &flow); err != nil {
-			continue
-		}
-		if err := json.Unmarshal(stepCtxBytes, &stepCtx); err != nil {
-			continue
-		}
-		if err := json.Unmarshal(outputsBytes, &outputs); err != nil {
-			continue
+		if persist, ok := decodePausedRun(token, flowBytes, stepIdx, stepCtxBytes, outputsBytes, runID, source, matchBytes); ok {
+			result[token] = persist
 		}
+	}
+	return result, nil
+}
 
-		result[token] = PausedRunPersist{
-			Flow:    &flow,
-			StepIdx: stepIdx,
-			StepCtx: stepCtx,
-			Outputs: outputs,
-			Token:   token,
-			RunID:   runIDFromStepCtx(stepCtx),
+func (s *PostgresStorage) LoadPausedRun(ctx context.Context, token string) (any, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT flow, step_idx, step_ctx, outputs, run_id, await_source, await_match FROM paused_runs WHERE token = $1`, token)
+	var flowBytes, stepCtxBytes, outputsBytes, matchBytes []byte
+	var stepIdx int
+	var runID, source sql.NullString
+	if err := row.Scan(&flowBytes, &stepIdx, &stepCtxBytes, &outputsBytes, &runID, &source, &matchBytes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
 		}
+		return nil, err
 	}
-	return result, nil
+	persist, ok := decodePausedRun(token, flowBytes, stepIdx, stepCtxBytes, outputsBytes, runID, source, matchBytes)
+	if !ok {
+		return nil, fmt.Errorf("failed to decode paused run %s", token)
+	}
+	return persist, nil
 }
 
 func (s *PostgresStorage) DeletePausedRun(ctx context.Context, token string) error {
@@ -284,7 +389,7 @@ func (s *PostgresStorage) DeletePausedRun(ctx context.Context, token string) err
 
 func (s *PostgresStorage) ListRuns(ctx context.Context) ([]*model.Run, error) {
 	rows, err := s.db.QueryContext(ctx, `
-SELECT id, flow_name, event, vars, status, started_at, ended_at 
+SELECT id, flow_name, event, vars, status, started_at, ended_at, version, flow_version, flow_hash
 FROM runs ORDER BY started_at DESC`)
 	if err != nil {
 		return nil, err
@@ -296,7 +401,7 @@ FROM runs ORDER BY started_at DESC`)
 		var run model.Run
 		var event, vars []byte
 		if err := rows.Scan(&run.ID, &run.FlowName, &event, &vars,
-			&run.Status, &run.StartedAt, &run.EndedAt); err != nil {
+			&run.Status, &run.StartedAt, &run.EndedAt, &run.Version, &run.FlowVersion, &run.FlowHash); err != nil {
 			continue
 		}
 		if err := json.Unmarshal(event, &run.Event); err != nil {
@@ -319,7 +424,7 @@ func (s *PostgresStorage) DeleteRun(ctx context.Context, id uuid.UUID) error {
 // GetLatestRunByFlowName retrieves the most recent run for a given flow name
 func (s *PostgresStorage) GetLatestRunByFlowName(ctx context.Context, flowName string) (*model.Run, error) {
 	row := s.db.QueryRowContext(ctx, `
-SELECT id, flow_name, event, vars, status, started_at, ended_at 
+SELECT id, flow_name, event, vars, status, started_at, ended_at, version, flow_version, flow_hash
 FROM runs 
 WHERE flow_name = $1 
 ORDER BY started_at DESC 
@@ -327,7 +432,7 @@ LIMIT 1`, flowName)
 
 	var run model.Run
 	var event, vars []byte
-	err := row.Scan(&run.ID, &run.FlowName, &event, &vars, &run.Status, &run.StartedAt, &run.EndedAt)
+	err := row.Scan(&run.ID, &run.FlowName, &event, &vars, &run.Status, &run.StartedAt, &run.EndedAt, &run.Version, &run.FlowVersion, &run.FlowHash)
 	if err != nil {
 		return nil, err
 	}
@@ -343,7 +448,435 @@ LIMIT 1`, flowName)
 }
 
 
+func (s *PostgresStorage) EnqueueRun(ctx context.Context, run *model.Run, item *model.QueuedRun) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := savePostgresRun(ctx, tx, run); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO run_queue (run_id, flow_name, attempts, enqueued_at)
+VALUES ($1, $2, $3, $4)
+ON CONFLICT(run_id) DO NOTHING
+`, item.RunID, item.FlowName, item.Attempts, item.EnqueuedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// runQueueLockKey is the advisory lock that serializes leasing across workers, so per-flow
+// lease counts can't be overrun by concurrent transactions.
+const runQueueLockKey = "beemflow.run_queue"
+
+// LeaseRun picks and leases the next run in one statement. Lease times use the database
+// clock so workers on different hosts agree on expiry.
+func (s *PostgresStorage) LeaseRun(ctx context.Context, owner string, ttl time.Duration, limits map[string]int) (*model.QueuedRun, error) {
+	limitsJSON, err := json.Marshal(limits)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal flow limits: %w", err)
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, runQueueLockKey); err != nil {
+		return nil, err
+	}
+
+	var item model.QueuedRun
+	var expires time.Time
+	err = tx.QueryRowContext(ctx, `
+WITH active AS (
+	SELECT flow_name, COUNT(*) AS n FROM run_queue
+	WHERE lease_expires_at > now()
+	GROUP BY flow_name
+), next AS (
+	SELECT q.run_id FROM run_queue q
+	LEFT JOIN active a ON a.flow_name = q.flow_name
+	WHERE (q.lease_expires_at IS NULL OR q.lease_expires_at <= now())
+	  AND (COALESCE(($3::jsonb ->> q.flow_name)::int, 0) <= 0
+	       OR COALESCE(a.n, 0) < ($3::jsonb ->> q.flow_name)::int)
+	ORDER BY q.enqueued_at, q.run_id
+	LIMIT 1
+)
+UPDATE run_queue SET
+	lease_owner = $1,
+	lease_expires_at = now() + $2 * interval '1 millisecond',
+	attempts = attempts + 1
+WHERE run_id = (SELECT run_id FROM next)
+RETURNING run_id, flow_name, attempts, lease_owner, lease_expires_at, enqueued_at
+`, owner, ttl.Milliseconds(), limitsJSON).Scan(&item.RunID, &item.FlowName, &item.Attempts, &item.LeaseOwner, &expires, &item.EnqueuedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	item.LeaseExpiresAt = &expires
+	return &item, nil
+}
+
+func (s *PostgresStorage) RenewLease(ctx context.Context, runID uuid.UUID, owner string, ttl time.Duration) error {
+	res, err := s.db.ExecContext(ctx, `
+UPDATE run_queue SET lease_expires_at = now() + $3 * interval '1 millisecond'
+WHERE run_id = $1 AND lease_owner = $2
+`, runID, owner, ttl.Milliseconds())
+	return leaseResult(res, err)
+}
+
+func (s *PostgresStorage) CompleteQueuedRun(ctx context.Context, runID uuid.UUID, owner string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM run_queue WHERE run_id = $1 AND lease_owner = $2`, runID, owner)
+	return leaseResult(res, err)
+}
+
+// SaveFlowVersion serializes saves of the same flow on an advisory lock keyed by its name,
+// so concurrent publishes get consecutive version numbers.
+func (s *PostgresStorage) SaveFlowVersion(ctx context.Context, fv *model.FlowVersion) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock(hashtext($1))`, "beemflow.flow:"+fv.FlowName); err != nil {
+		return err
+	}
+	var latest int
+	var hash, source string
+	var createdAt time.Time
+	err = tx.QueryRowContext(ctx, `
+SELECT version, hash, source, created_at FROM flow_versions
+WHERE flow_name = $1 ORDER BY version DESC LIMIT 1`, fv.FlowName).Scan(&latest, &hash, &source, &createdAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && hash == fv.Hash {
+		fv.Version, fv.Source, fv.CreatedAt = latest, source, createdAt
+		return nil
+	}
+	if err := tx.QueryRowContext(ctx, `
+INSERT INTO flow_versions (flow_name, version, hash, source, created_at)
+VALUES ($1, $2, $3, $4, now())
+RETURNING created_at`, fv.FlowName, latest+1, fv.Hash, fv.Source).Scan(&createdAt); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	fv.Version = latest + 1
+	fv.CreatedAt = createdAt
+	return nil
+}
+
+func (s *PostgresStorage) GetFlowVersion(ctx context.Context, name string, version int) (*model.FlowVersion, error) {
+	// version 0 selects the latest
+	row := s.db.QueryRowContext(ctx, `
+SELECT flow_name, version, hash, source, created_at FROM flow_versions
+WHERE flow_name = $1 AND ($2 = 0 OR version = $2)
+ORDER BY version DESC LIMIT 1`, name, version)
+
+	var fv model.FlowVersion
+	err := row.Scan(&fv.FlowName, &fv.Version, &fv.Hash, &fv.Source, &fv.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFlowNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &fv, nil
+}
+
+func (s *PostgresStorage) ListFlowVersions(ctx context.Context, name string) ([]*model.FlowVersion, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT flow_name, version, hash, created_at FROM flow_versions
+WHERE flow_name = $1 ORDER BY version DESC`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []*model.FlowVersion{}
+	for rows.Next() {
+		var fv model.FlowVersion
+		if err := rows.Scan(&fv.FlowName, &fv.Version, &fv.Hash, &fv.CreatedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, &fv)
+	}
+	return versions, rows.Err()
+}
+
+func (s *PostgresStorage) ListFlowNames(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT flow_name FROM flow_versions ORDER BY flow_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *PostgresStorage) DeleteFlow(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM flow_versions WHERE flow_name = $1`, name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrFlowNotFound
+	}
+	return nil
+}
+
+// FlowStats computes the aggregates in SQL, using percentile_disc for the nearest-rank p95.
+func (s *PostgresStorage) FlowStats(ctx context.Context, q model.StatsQuery) ([]*model.FlowStats, error) {
+	where := `r.started_at >= $1`
+	args := []any{q.Since}
+	if !q.Until.IsZero() {
+		args = append(args, q.Until)
+		where += fmt.Sprintf(` AND r.started_at < $%d`, len(args))
+	}
+	if q.FlowName != "" {
+		args = append(args, q.FlowName)
+		where += fmt.Sprintf(` AND r.flow_name = $%d`, len(args))
+	}
+	b := statsBuilder{}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT r.flow_name, r.status, COUNT(*) FROM runs r
+WHERE `+where+`
+GROUP BY r.flow_name, r.status`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var flowName string
+		var status model.RunStatus
+		var n int
+		if err := rows.Scan(&flowName, &status, &n); err != nil {
+			return nil, err
+		}
+		fs := b.flow(flowName)
+		fs.ByStatus[status] = n
+		fs.Runs += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+SELECT r.flow_name,
+	AVG(EXTRACT(EPOCH FROM r.ended_at - r.started_at) * 1000),
+	percentile_disc(0.95) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM r.ended_at - r.started_at) * 1000)
+FROM runs r
+WHERE r.ended_at IS NOT NULL AND `+where+`
+GROUP BY r.flow_name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var flowName string
+		var avg, p95 float64
+		if err := rows.Scan(&flowName, &avg, &p95); err != nil {
+			return nil, err
+		}
+		fs := b.flow(flowName)
+		fs.AvgDurationMs, fs.P95DurationMs = avg, p95
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	failed := len(args) + 1
+	rows, err = s.db.QueryContext(ctx, fmt.Sprintf(`
+SELECT r.flow_name, s.step_name, COUNT(*), COUNT(*) FILTER (WHERE s.status = $%d),
+	AVG(EXTRACT(EPOCH FROM s.ended_at - s.started_at) * 1000),
+	percentile_disc(0.95) WITHIN GROUP (ORDER BY EXTRACT(EPOCH FROM s.ended_at - s.started_at) * 1000)
+FROM steps s JOIN runs r ON r.id = s.run_id
+WHERE s.ended_at IS NOT NULL AND `+where+`
+GROUP BY r.flow_name, s.step_name`, failed), append(args, model.StepFailed)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var flowName, stepName string
+		var runs, failedRuns int
+		var avg, p95 float64
+		if err := rows.Scan(&flowName, &stepName, &runs, &failedRuns, &avg, &p95); err != nil {
+			return nil, err
+		}
+		ss := b.step(flowName, stepName)
+		ss.Runs, ss.Failed, ss.AvgDurationMs, ss.P95DurationMs = runs, failedRuns, avg, p95
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, fmt.Sprintf(`
+SELECT r.flow_name, s.step_name, COALESCE(s.error, ''), COUNT(*)
+FROM steps s JOIN runs r ON r.id = s.run_id
+WHERE s.status = $%d AND `+where+`
+GROUP BY r.flow_name, s.step_name, s.error`, failed), append(args, model.StepFailed)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var flowName, stepName string
+		var reason model.FailureReason
+		if err := rows.Scan(&flowName, &stepName, &reason.Error, &reason.Count); err != nil {
+			return nil, err
+		}
+		ss := b.step(flowName, stepName)
+		ss.FailureReasons = append(ss.FailureReasons, reason)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return b.result(), nil
+}
+
 // Close closes the underlying PostgreSQL database connection.
 func (s *PostgresStorage) Close() error {
 	return s.db.Close()
 }
+
+func (s *PostgresStorage) SaveDeadLetter(ctx context.Context, dl *model.DeadLetter) error {
+	_, err := s.db.ExecContext(ctx, `
+INSERT INTO dead_letters (id, topic, subscription, payload, error, attempts, failed_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7)
+ON CONFLICT (id) DO UPDATE SET
+	topic = EXCLUDED.topic,
+	subscription = EXCLUDED.subscription,
+	payload = EXCLUDED.payload,
+	error = EXCLUDED.error,
+	attempts = EXCLUDED.attempts,
+	failed_at = EXCLUDED.failed_at`,
+		dl.ID, dl.Topic, dl.Subscription, dl.Payload, dl.Error, dl.Attempts, dl.FailedAt)
+	return err
+}
+
+func (s *PostgresStorage) GetDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error) {
+	row := s.db.QueryRowContext(ctx, `
+SELECT id, topic, subscription, payload, error, attempts, failed_at FROM dead_letters
+WHERE id = $1`, id)
+
+	var dl model.DeadLetter
+	err := row.Scan(&dl.ID, &dl.Topic, &dl.Subscription, &dl.Payload, &dl.Error, &dl.Attempts, &dl.FailedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeadLetterNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &dl, nil
+}
+
+func (s *PostgresStorage) ListDeadLetters(ctx context.Context) ([]*model.DeadLetter, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, topic, subscription, payload, error, attempts, failed_at FROM dead_letters
+ORDER BY failed_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	letters := []*model.DeadLetter{}
+	for rows.Next() {
+		var dl model.DeadLetter
+		if err := rows.Scan(&dl.ID, &dl.Topic, &dl.Subscription, &dl.Payload, &dl.Error, &dl.Attempts, &dl.FailedAt); err != nil {
+			return nil, err
+		}
+		letters = append(letters, &dl)
+	}
+	return letters, rows.Err()
+}
+
+func (s *PostgresStorage) DeleteDeadLetter(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM dead_letters WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+func (s *PostgresStorage) AppendEvent(ctx context.Context, rec *model.EventRecord) error {
+	if rec.PublishedAt.IsZero() {
+		rec.PublishedAt = time.Now()
+	}
+	return s.db.QueryRowContext(ctx, `
+INSERT INTO event_log (topic, payload, published_at) VALUES ($1, $2, $3) RETURNING id`,
+		rec.Topic, rec.Payload, rec.PublishedAt).Scan(&rec.Offset)
+}
+
+func (s *PostgresStorage) ListEvents(ctx context.Context, q model.EventQuery) ([]*model.EventRecord, error) {
+	query := `SELECT id, topic, payload, published_at FROM event_log WHERE id > $1`
+	args := []any{q.AfterOffset}
+	if !q.Since.IsZero() {
+		args = append(args, q.Since)
+		query += fmt.Sprintf(` AND published_at >= $%d`, len(args))
+	}
+	if q.Topic != "" {
+		args = append(args, q.Topic)
+		query += fmt.Sprintf(` AND topic = $%d`, len(args))
+	}
+	query += ` ORDER BY id`
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(` LIMIT $%d`, len(args))
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []*model.EventRecord{}
+	for rows.Next() {
+		var rec model.EventRecord
+		if err := rows.Scan(&rec.Offset, &rec.Topic, &rec.Payload, &rec.PublishedAt); err != nil {
+			return nil, err
+		}
+		records = append(records, &rec)
+	}
+	return records, rows.Err()
+}
+
+func (s *PostgresStorage) TrimEvents(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM event_log WHERE published_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -28,6 +29,48 @@ type PausedRunPersist struct {
 	Outputs map[string]any `json:"outputs"`
 	Token   string         `json:"token"`
 	RunID   string         `json:"run_id"`
+	// Source and Match are the await_event step's topic and rendered match fields, kept so a
+	// restarted engine can subscribe to the source again.
+	Source string         `json:"source"`
+	Match  map[string]any `json:"match"`
+}
+
+// decodePausedRun rebuilds a paused run from its stored columns. Rows that don't decode
+// are reported as not ok.
+func decodePausedRun(token string, flowBytes []byte, stepIdx int, stepCtxBytes, outputsBytes []byte, runID, source sql.NullString, matchBytes []byte) (PausedRunPersist, bool) {
+	var flow model.Flow
+	var stepCtx map[string]any
+	var outputs map[string]any
+	if err := json.Unmarshal(flowBytes, &flow); err != nil {
+		return PausedRunPersist{}, false
+	}
+	if err := json.Unmarshal(stepCtxBytes, &stepCtx); err != nil {
+		return PausedRunPersist{}, false
+	}
+	if err := json.Unmarshal(outputsBytes, &outputs); err != nil {
+		return PausedRunPersist{}, false
+	}
+	// Rows saved before the await columns existed have no match
+	var match map[string]any
+	if len(matchBytes) > 0 {
+		if err := json.Unmarshal(matchBytes, &match); err != nil {
+			return PausedRunPersist{}, false
+		}
+	}
+	persistedRunID := runID.String
+	if persistedRunID == "" {
+		persistedRunID = runIDFromStepCtx(stepCtx)
+	}
+	return PausedRunPersist{
+		Flow:    &flow,
+		StepIdx: stepIdx,
+		StepCtx: stepCtx,
+		Outputs: outputs,
+		Token:   token,
+		RunID:   persistedRunID,
+		Source:  source.String,
+		Match:   match,
+	}, true
 }
 
 func runIDFromStepCtx(ctx map[string]any) string {
@@ -78,7 +121,9 @@ CREATE TABLE IF NOT EXISTS runs (
 	vars JSON,
 	status TEXT,
 	started_at INTEGER,
-	ended_at INTEGER
+	ended_at INTEGER,
+	duration_ms INTEGER,
+	version INTEGER NOT NULL DEFAULT 0
 );
 CREATE TABLE IF NOT EXISTS steps (
 	id TEXT PRIMARY KEY,
@@ -87,6 +132,7 @@ CREATE TABLE IF NOT EXISTS steps (
 	status TEXT,
 	started_at INTEGER,
 	ended_at INTEGER,
+	duration_ms INTEGER,
 	outputs JSON,
 	error TEXT
 );
@@ -99,18 +145,126 @@ CREATE TABLE IF NOT EXISTS paused_runs (
 	flow JSON,
 	step_idx INTEGER,
 	step_ctx JSON,
-	outputs JSON
+	outputs JSON,
+	run_id TEXT,
+	await_source TEXT,
+	await_match JSON
+);
+CREATE TABLE IF NOT EXISTS run_queue (
+	run_id TEXT PRIMARY KEY,
+	flow_name TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	lease_owner TEXT,
+	lease_expires_at INTEGER, -- unix milliseconds
+	enqueued_at INTEGER NOT NULL -- unix milliseconds
+);
+CREATE INDEX IF NOT EXISTS idx_run_queue_enqueued_at ON run_queue(enqueued_at);
+CREATE TABLE IF NOT EXISTS flow_versions (
+	flow_name TEXT NOT NULL,
+	version INTEGER NOT NULL,
+	hash TEXT NOT NULL,
+	source TEXT NOT NULL,
+	created_at INTEGER NOT NULL,
+	PRIMARY KEY (flow_name, version)
+);
+CREATE TABLE IF NOT EXISTS dead_letters (
+	id TEXT PRIMARY KEY,
+	topic TEXT NOT NULL,
+	subscription TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	error TEXT NOT NULL,
+	attempts INTEGER NOT NULL,
+	failed_at INTEGER NOT NULL -- unix milliseconds
 );
+CREATE TABLE IF NOT EXISTS event_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT, -- the event's offset
+	topic TEXT NOT NULL,
+	payload TEXT NOT NULL,
+	published_at INTEGER NOT NULL -- unix milliseconds
+);
+CREATE INDEX IF NOT EXISTS idx_event_log_topic ON event_log(topic, id);
+CREATE INDEX IF NOT EXISTS idx_event_log_published_at ON event_log(published_at);
 `
 	_, err = db.Exec(sqlStmt)
 	if err != nil {
 		db.Close()
 		return nil, err
 	}
+	// Columns added after the initial schema; CREATE TABLE IF NOT EXISTS won't add them to old databases.
+	if err := ensureSqliteColumn(db, "runs", "version", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureSqliteColumn(db, "paused_runs", "run_id", "TEXT"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureSqliteColumn(db, "runs", "flow_version", "INTEGER NOT NULL DEFAULT 0"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureSqliteColumn(db, "runs", "flow_hash", "TEXT NOT NULL DEFAULT ''"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureSqliteColumn(db, "paused_runs", "await_source", "TEXT"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureSqliteColumn(db, "paused_runs", "await_match", "JSON"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureSqliteColumn(db, "runs", "duration_ms", "INTEGER"); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := ensureSqliteColumn(db, "steps", "duration_ms", "INTEGER"); err != nil {
+		db.Close()
+		return nil, err
+	}
 	return &SqliteStorage{db: db}, nil
 }
 
+// durationMillis is the millisecond duration stored next to the second-resolution timestamps,
+// so flow stats stay exact for sub-second runs and steps. It is NULL until ended is set.
+func durationMillis(started time.Time, ended *time.Time) any {
+	if ended == nil {
+		return nil
+	}
+	return ended.Sub(started).Milliseconds()
+}
+
+// ensureSqliteColumn adds a column to an existing table if it is not present yet.
+func ensureSqliteColumn(db *sql.DB, table, column, decl string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, decl))
+	return err
+}
+
 func (s *SqliteStorage) SaveRun(ctx context.Context, run *model.Run) error {
+	return saveSqliteRun(ctx, s.db, run)
+}
+
+func saveSqliteRun(ctx context.Context, q queryer, run *model.Run) error {
 	event, err := json.Marshal(run.Event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal run event: %w", err)
@@ -125,22 +279,58 @@ func (s *SqliteStorage) SaveRun(ctx context.Context, run *model.Run) error {
 	} else {
 		endedAt = nil
 	}
-	_, err = s.db.ExecContext(ctx, `
-INSERT INTO runs (id, flow_name, event, vars, status, started_at, ended_at)
-VALUES (?, ?, ?, ?, ?, ?, ?)
-ON CONFLICT(id) DO UPDATE SET flow_name=excluded.flow_name, event=excluded.event, vars=excluded.vars, status=excluded.status, started_at=excluded.started_at, ended_at=excluded.ended_at
-`, run.ID.String(), run.FlowName, event, vars, run.Status, run.StartedAt.Unix(), endedAt)
-	return err
+	return q.QueryRowContext(ctx, `
+INSERT INTO runs (id, flow_name, event, vars, status, started_at, ended_at, duration_ms, version, flow_version, flow_hash)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)
+ON CONFLICT(id) DO UPDATE SET flow_name=excluded.flow_name, event=excluded.event, vars=excluded.vars, status=excluded.status, started_at=excluded.started_at, ended_at=excluded.ended_at, duration_ms=excluded.duration_ms, version=runs.version+1, flow_version=excluded.flow_version, flow_hash=excluded.flow_hash
+RETURNING version
+`, run.ID.String(), run.FlowName, event, vars, run.Status, run.StartedAt.Unix(), endedAt, durationMillis(run.StartedAt, run.EndedAt), run.FlowVersion, run.FlowHash).Scan(&run.Version)
+}
+
+func (s *SqliteStorage) TransitionRun(ctx context.Context, run *model.Run, to model.RunStatus) error {
+	endedAt, err := prepareTransition(run, to)
+	if err != nil {
+		return err
+	}
+	event, err := json.Marshal(run.Event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run event: %w", err)
+	}
+	vars, err := json.Marshal(run.Vars)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run vars: %w", err)
+	}
+	var endedAtUnix any
+	if endedAt != nil {
+		endedAtUnix = endedAt.Unix()
+	}
+	res, err := s.db.ExecContext(ctx, `
+UPDATE runs SET status=?, event=?, vars=?, ended_at=?, duration_ms=?, version=version+1
+WHERE id=? AND version=? AND status=?
+`, to, event, vars, endedAtUnix, durationMillis(run.StartedAt, endedAt), run.ID.String(), run.Version, run.Status)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		if _, err := s.GetRun(ctx, run.ID); err != nil {
+			return err
+		}
+		return ErrVersionConflict
+	}
+	applyTransition(run, to, endedAt)
+	return nil
 }
 
 func (s *SqliteStorage) GetRun(ctx context.Context, id uuid.UUID) (*model.Run, error) {
-	row := s.db.QueryRowContext(ctx, `SELECT id, flow_name, event, vars, status, started_at, ended_at FROM runs WHERE id=?`, id.String())
+	row := s.db.QueryRowContext(ctx, `SELECT id, flow_name, event, vars, status, started_at, ended_at, version, flow_version, flow_hash FROM runs WHERE id=?`, id.String())
 	var run model.Run
 	var event, vars []byte
 	var startedAt, endedAtInt int64
 	var endedAtPtr *time.Time
 	var endedAt sql.NullInt64
-	if err := row.Scan(&run.ID, &run.FlowName, &event, &vars, &run.Status, &startedAt, &endedAt); err != nil {
+	if err := row.Scan(&run.ID, &run.FlowName, &event, &vars, &run.Status, &startedAt, &endedAt, &run.Version, &run.FlowVersion, &run.FlowHash); err != nil {
 		return nil, err
 	}
 	if err := json.Unmarshal(event, &run.Event); err != nil {
@@ -171,10 +361,10 @@ func (s *SqliteStorage) SaveStep(ctx context.Context, step *model.StepRun) error
 		endedAt = nil
 	}
 	_, err = s.db.ExecContext(ctx, `
-INSERT INTO steps (id, run_id, step_name, status, started_at, ended_at, outputs, error)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?)
-ON CONFLICT(id) DO UPDATE SET run_id=excluded.run_id, step_name=excluded.step_name, status=excluded.status, started_at=excluded.started_at, ended_at=excluded.ended_at, outputs=excluded.outputs, error=excluded.error
-`, step.ID.String(), step.RunID.String(), step.StepName, step.Status, step.StartedAt.Unix(), endedAt, outputs, step.Error)
+INSERT INTO steps (id, run_id, step_name, status, started_at, ended_at, duration_ms, outputs, error)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(id) DO UPDATE SET run_id=excluded.run_id, step_name=excluded.step_name, status=excluded.status, started_at=excluded.started_at, ended_at=excluded.ended_at, duration_ms=excluded.duration_ms, outputs=excluded.outputs, error=excluded.error
+`, step.ID.String(), step.RunID.String(), step.StepName, step.Status, step.StartedAt.Unix(), endedAt, durationMillis(step.StartedAt, step.EndedAt), outputs, step.Error)
 	return err
 }
 
@@ -250,21 +440,25 @@ func (s *SqliteStorage) SavePausedRun(ctx context.Context, token string, paused
 	if err != nil {
 		return err
 	}
+	matchBytes, err := json.Marshal(persist.Match)
+	if err != nil {
+		return err
+	}
 	if v, ok := persist.StepCtx["run_id"]; ok {
 		if s, ok := v.(string); ok {
 			persist.RunID = s
 		}
 	}
 	_, err = s.db.ExecContext(ctx, `
-	INSERT INTO paused_runs (token, flow, step_idx, step_ctx, outputs)
-	VALUES (?, ?, ?, ?, ?)
-	ON CONFLICT(token) DO UPDATE SET flow=excluded.flow, step_idx=excluded.step_idx, step_ctx=excluded.step_ctx, outputs=excluded.outputs
-	`, token, flowBytes, persist.StepIdx, stepCtxBytes, outputsBytes)
+	INSERT INTO paused_runs (token, flow, step_idx, step_ctx, outputs, run_id, await_source, await_match)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(token) DO UPDATE SET flow=excluded.flow, step_idx=excluded.step_idx, step_ctx=excluded.step_ctx, outputs=excluded.outputs, run_id=excluded.run_id, await_source=excluded.await_source, await_match=excluded.await_match
+	`, token, flowBytes, persist.StepIdx, stepCtxBytes, outputsBytes, persist.RunID, persist.Source, matchBytes)
 	return err
 }
 
 func (s *SqliteStorage) LoadPausedRuns(ctx context.Context) (map[string]any, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT token, flow, step_idx, step_ctx, outputs FROM paused_runs`)
+	rows, err := s.db.QueryContext(ctx, `SELECT token, flow, step_idx, step_ctx, outputs, run_id, await_source, await_match FROM paused_runs`)
 	if err != nil {
 		return nil, err
 	}
@@ -272,48 +466,50 @@ func (s *SqliteStorage) LoadPausedRuns(ctx context.Context) (map[string]any, err
 	result := make(map[string]any)
 	for rows.Next() {
 		var token string
-		var flowBytes, stepCtxBytes, outputsBytes []byte
+		var flowBytes, stepCtxBytes, outputsBytes, matchBytes []byte
 		var stepIdx int
-		if err := rows.Scan(&token, &flowBytes, &stepIdx, &stepCtxBytes, &outputsBytes); err != nil {
+		var runID, source sql.NullString
+		if err := rows.Scan(&token, &flowBytes, &stepIdx, &stepCtxBytes, &outputsBytes, &runID, &source, &matchBytes); err != nil {
 			continue
 		}
-		var flow model.Flow
-		var stepCtx map[string]any
-		var outputs map[string]any
-		if err := json.Unmarshal(flowBytes, &flow); err != nil {
-			continue
-		}
-		if err := json.Unmarshal(stepCtxBytes, &stepCtx); err != nil {
-			continue
-		}
-		if err := json.Unmarshal(outputsBytes, &outputs); err != nil {
-			continue
-		}
-		result[token] = PausedRunPersist{
-			Flow:    &flow,
-			StepIdx: stepIdx,
-			StepCtx: stepCtx,
-			Outputs: outputs,
-			Token:   token,
-			RunID:   runIDFromStepCtx(stepCtx),
+		if persist, ok := decodePausedRun(token, flowBytes, stepIdx, stepCtxBytes, outputsBytes, runID, source, matchBytes); ok {
+			result[token] = persist
 		}
 	}
 	return result, nil
 }
 
+func (s *SqliteStorage) LoadPausedRun(ctx context.Context, token string) (any, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT flow, step_idx, step_ctx, outputs, run_id, await_source, await_match FROM paused_runs WHERE token=?`, token)
+	var flowBytes, stepCtxBytes, outputsBytes, matchBytes []byte
+	var stepIdx int
+	var runID, source sql.NullString
+	if err := row.Scan(&flowBytes, &stepIdx, &stepCtxBytes, &outputsBytes, &runID, &source, &matchBytes); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	persist, ok := decodePausedRun(token, flowBytes, stepIdx, stepCtxBytes, outputsBytes, runID, source, matchBytes)
+	if !ok {
+		return nil, fmt.Errorf("failed to decode paused run %s", token)
+	}
+	return persist, nil
+}
+
 func (s *SqliteStorage) DeletePausedRun(ctx context.Context, token string) error {
 	_, err := s.db.ExecContext(ctx, `DELETE FROM paused_runs WHERE token=?`, token)
 	return err
 }
 
 func (s *SqliteStorage) GetLatestRunByFlowName(ctx context.Context, flowName string) (*model.Run, error) {
-	row := s.db.QueryRowContext(ctx, `SELECT id, flow_name, event, vars, status, started_at, ended_at FROM runs WHERE flow_name = ? ORDER BY started_at DESC LIMIT 1`, flowName)
+	row := s.db.QueryRowContext(ctx, `SELECT id, flow_name, event, vars, status, started_at, ended_at, version, flow_version, flow_hash FROM runs WHERE flow_name = ? ORDER BY started_at DESC LIMIT 1`, flowName)
 	var run model.Run
 	var event, vars []byte
 	var startedAt, endedAtInt int64
 	var endedAtPtr *time.Time
 	var endedAt sql.NullInt64
-	if err := row.Scan(&run.ID, &run.FlowName, &event, &vars, &run.Status, &startedAt, &endedAt); err != nil {
+	if err := row.Scan(&run.ID, &run.FlowName, &event, &vars, &run.Status, &startedAt, &endedAt, &run.Version, &run.FlowVersion, &run.FlowHash); err != nil {
 		return nil, err
 	}
 	if err := json.Unmarshal(event, &run.Event); err != nil {
@@ -333,7 +529,7 @@ func (s *SqliteStorage) GetLatestRunByFlowName(ctx context.Context, flowName str
 }
 
 func (s *SqliteStorage) ListRuns(ctx context.Context) ([]*model.Run, error) {
-	rows, err := s.db.QueryContext(ctx, `SELECT id, flow_name, event, vars, status, started_at, ended_at FROM runs ORDER BY started_at DESC`)
+	rows, err := s.db.QueryContext(ctx, `SELECT id, flow_name, event, vars, status, started_at, ended_at, version, flow_version, flow_hash FROM runs ORDER BY started_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -345,7 +541,7 @@ func (s *SqliteStorage) ListRuns(ctx context.Context) ([]*model.Run, error) {
 		var startedAt, endedAtInt int64
 		var endedAtPtr *time.Time
 		var endedAt sql.NullInt64
-		if err := rows.Scan(&run.ID, &run.FlowName, &event, &vars, &run.Status, &startedAt, &endedAt); err != nil {
+		if err := rows.Scan(&run.ID, &run.FlowName, &event, &vars, &run.Status, &startedAt, &endedAt, &run.Version, &run.FlowVersion, &run.FlowHash); err != nil {
 			continue
 		}
 		if err := json.Unmarshal(event, &run.Event); err != nil {
@@ -371,12 +567,473 @@ func (s *SqliteStorage) DeleteRun(ctx context.Context, id uuid.UUID) error {
 	if err != nil {
 		return err
 	}
+	_, err = s.db.ExecContext(ctx, `DELETE FROM run_queue WHERE run_id=?`, id.String())
+	if err != nil {
+		return err
+	}
 	_, err = s.db.ExecContext(ctx, `DELETE FROM runs WHERE id=?`, id.String())
 	return err
 }
 
+func (s *SqliteStorage) EnqueueRun(ctx context.Context, run *model.Run, item *model.QueuedRun) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := saveSqliteRun(ctx, tx, run); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+INSERT INTO run_queue (run_id, flow_name, attempts, enqueued_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT(run_id) DO NOTHING
+`, item.RunID.String(), item.FlowName, item.Attempts, item.EnqueuedAt.UnixMilli()); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// LeaseRun runs inside BEGIN IMMEDIATE so that workers in other processes sharing the
+// database file serialize on the write lock and see consistent per-flow lease counts.
+func (s *SqliteStorage) LeaseRun(ctx context.Context, owner string, ttl time.Duration, limits map[string]int) (*model.QueuedRun, error) {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return nil, err
+	}
+	item, err := s.leaseRunLocked(ctx, conn, owner, ttl, limits)
+	if err != nil {
+		_, _ = conn.ExecContext(ctx, `ROLLBACK`)
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *SqliteStorage) leaseRunLocked(ctx context.Context, conn *sql.Conn, owner string, ttl time.Duration, limits map[string]int) (*model.QueuedRun, error) {
+	now := time.Now()
+	active := make(map[string]int)
+	rows, err := conn.QueryContext(ctx, `SELECT flow_name, COUNT(*) FROM run_queue WHERE lease_expires_at > ? GROUP BY flow_name`, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var flowName string
+		var n int
+		if err := rows.Scan(&flowName, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		active[flowName] = n
+	}
+	rows.Close()
+
+	rows, err = conn.QueryContext(ctx, `
+SELECT run_id, flow_name, attempts, enqueued_at FROM run_queue
+WHERE lease_expires_at IS NULL OR lease_expires_at <= ?
+ORDER BY enqueued_at, run_id
+`, now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	var picked *model.QueuedRun
+	for rows.Next() {
+		var item model.QueuedRun
+		var enqueuedAt int64
+		if err := rows.Scan(&item.RunID, &item.FlowName, &item.Attempts, &enqueuedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if withinFlowLimit(limits, item.FlowName, active[item.FlowName]) {
+			item.EnqueuedAt = time.UnixMilli(enqueuedAt)
+			picked = &item
+			break
+		}
+	}
+	rows.Close()
+	if picked == nil {
+		return nil, nil
+	}
+
+	expires := now.Add(ttl)
+	if _, err := conn.ExecContext(ctx, `
+UPDATE run_queue SET lease_owner=?, lease_expires_at=?, attempts=attempts+1 WHERE run_id=?
+`, owner, expires.UnixMilli(), picked.RunID.String()); err != nil {
+		return nil, err
+	}
+	picked.LeaseOwner = owner
+	picked.LeaseExpiresAt = &expires
+	picked.Attempts++
+	return picked, nil
+}
+
+func (s *SqliteStorage) RenewLease(ctx context.Context, runID uuid.UUID, owner string, ttl time.Duration) error {
+	res, err := s.db.ExecContext(ctx, `UPDATE run_queue SET lease_expires_at=? WHERE run_id=? AND lease_owner=?`,
+		time.Now().Add(ttl).UnixMilli(), runID.String(), owner)
+	return leaseResult(res, err)
+}
+
+func (s *SqliteStorage) CompleteQueuedRun(ctx context.Context, runID uuid.UUID, owner string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM run_queue WHERE run_id=? AND lease_owner=?`, runID.String(), owner)
+	return leaseResult(res, err)
+}
+
 
 // Close closes the underlying SQL database connection.
 func (s *SqliteStorage) Close() error {
 	return s.db.Close()
 }
+
+// SaveFlowVersion runs inside BEGIN IMMEDIATE so that two processes saving the same flow
+// can't both read the same latest version and number their rows identically.
+func (s *SqliteStorage) SaveFlowVersion(ctx context.Context, fv *model.FlowVersion) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE`); err != nil {
+		return err
+	}
+	if err := saveFlowVersionLocked(ctx, conn, fv); err != nil {
+		_, _ = conn.ExecContext(ctx, `ROLLBACK`)
+		return err
+	}
+	_, err = conn.ExecContext(ctx, `COMMIT`)
+	return err
+}
+
+func saveFlowVersionLocked(ctx context.Context, conn *sql.Conn, fv *model.FlowVersion) error {
+	var latest int
+	var hash, source string
+	var createdAt int64
+	err := conn.QueryRowContext(ctx, `
+SELECT version, hash, source, created_at FROM flow_versions WHERE flow_name=? ORDER BY version DESC LIMIT 1
+`, fv.FlowName).Scan(&latest, &hash, &source, &createdAt)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if err == nil && hash == fv.Hash {
+		fv.Version, fv.Source, fv.CreatedAt = latest, source, time.Unix(createdAt, 0)
+		return nil
+	}
+	now := time.Unix(time.Now().Unix(), 0)
+	if _, err := conn.ExecContext(ctx, `
+INSERT INTO flow_versions (flow_name, version, hash, source, created_at) VALUES (?, ?, ?, ?, ?)
+`, fv.FlowName, latest+1, fv.Hash, fv.Source, now.Unix()); err != nil {
+		return err
+	}
+	fv.Version = latest + 1
+	fv.CreatedAt = now
+	return nil
+}
+
+func (s *SqliteStorage) GetFlowVersion(ctx context.Context, name string, version int) (*model.FlowVersion, error) {
+	query := `SELECT flow_name, version, hash, source, created_at FROM flow_versions WHERE flow_name=? AND version=?`
+	args := []any{name, version}
+	if version == 0 {
+		query = `SELECT flow_name, version, hash, source, created_at FROM flow_versions WHERE flow_name=? ORDER BY version DESC LIMIT 1`
+		args = args[:1]
+	}
+	var fv model.FlowVersion
+	var createdAt int64
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&fv.FlowName, &fv.Version, &fv.Hash, &fv.Source, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrFlowNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	fv.CreatedAt = time.Unix(createdAt, 0)
+	return &fv, nil
+}
+
+func (s *SqliteStorage) ListFlowVersions(ctx context.Context, name string) ([]*model.FlowVersion, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT flow_name, version, hash, created_at FROM flow_versions WHERE flow_name=? ORDER BY version DESC
+`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	versions := []*model.FlowVersion{}
+	for rows.Next() {
+		var fv model.FlowVersion
+		var createdAt int64
+		if err := rows.Scan(&fv.FlowName, &fv.Version, &fv.Hash, &createdAt); err != nil {
+			return nil, err
+		}
+		fv.CreatedAt = time.Unix(createdAt, 0)
+		versions = append(versions, &fv)
+	}
+	return versions, rows.Err()
+}
+
+func (s *SqliteStorage) ListFlowNames(ctx context.Context) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT DISTINCT flow_name FROM flow_versions ORDER BY flow_name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
+
+func (s *SqliteStorage) DeleteFlow(ctx context.Context, name string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM flow_versions WHERE flow_name=?`, name)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrFlowNotFound
+	}
+	return nil
+}
+
+// FlowStats computes the aggregates in SQL. SQLite has no percentile function, so the p95 is the
+// nearest-rank value picked with ROW_NUMBER over each partition. Timestamps are stored in whole
+// seconds, so durations have second resolution.
+func (s *SqliteStorage) FlowStats(ctx context.Context, q model.StatsQuery) ([]*model.FlowStats, error) {
+	where := `r.started_at >= ?`
+	args := []any{q.Since.Unix()}
+	if !q.Until.IsZero() {
+		where += ` AND r.started_at < ?`
+		args = append(args, q.Until.Unix())
+	}
+	if q.FlowName != "" {
+		where += ` AND r.flow_name = ?`
+		args = append(args, q.FlowName)
+	}
+	b := statsBuilder{}
+
+	rows, err := s.db.QueryContext(ctx, `
+SELECT r.flow_name, r.status, COUNT(*) FROM runs r WHERE `+where+` GROUP BY r.flow_name, r.status`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var flowName string
+		var status model.RunStatus
+		var n int
+		if err := rows.Scan(&flowName, &status, &n); err != nil {
+			return nil, err
+		}
+		fs := b.flow(flowName)
+		fs.ByStatus[status] = n
+		fs.Runs += n
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+WITH d AS (
+	SELECT r.flow_name, COALESCE(r.duration_ms, (r.ended_at - r.started_at) * 1000) AS dur,
+		ROW_NUMBER() OVER (PARTITION BY r.flow_name ORDER BY COALESCE(r.duration_ms, (r.ended_at - r.started_at) * 1000)) AS rn,
+		COUNT(*) OVER (PARTITION BY r.flow_name) AS n
+	FROM runs r WHERE r.ended_at IS NOT NULL AND `+where+`
+)
+SELECT flow_name, AVG(dur), MIN(CASE WHEN rn * 100 >= n * 95 THEN dur END) FROM d GROUP BY flow_name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var flowName string
+		var avg, p95 float64
+		if err := rows.Scan(&flowName, &avg, &p95); err != nil {
+			return nil, err
+		}
+		fs := b.flow(flowName)
+		fs.AvgDurationMs, fs.P95DurationMs = avg, p95
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+WITH d AS (
+	SELECT r.flow_name, s.step_name, s.status, COALESCE(s.duration_ms, (s.ended_at - s.started_at) * 1000) AS dur,
+		ROW_NUMBER() OVER (PARTITION BY r.flow_name, s.step_name ORDER BY COALESCE(s.duration_ms, (s.ended_at - s.started_at) * 1000)) AS rn,
+		COUNT(*) OVER (PARTITION BY r.flow_name, s.step_name) AS n
+	FROM steps s JOIN runs r ON r.id = s.run_id
+	WHERE s.ended_at IS NOT NULL AND `+where+`
+)
+SELECT flow_name, step_name, COUNT(*), SUM(CASE WHEN status = ? THEN 1 ELSE 0 END),
+	AVG(dur), MIN(CASE WHEN rn * 100 >= n * 95 THEN dur END)
+FROM d GROUP BY flow_name, step_name`, append(args, model.StepFailed)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var flowName, stepName string
+		var runs, failed int
+		var avg, p95 float64
+		if err := rows.Scan(&flowName, &stepName, &runs, &failed, &avg, &p95); err != nil {
+			return nil, err
+		}
+		ss := b.step(flowName, stepName)
+		ss.Runs, ss.Failed, ss.AvgDurationMs, ss.P95DurationMs = runs, failed, avg, p95
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = s.db.QueryContext(ctx, `
+SELECT r.flow_name, s.step_name, COALESCE(s.error, ''), COUNT(*)
+FROM steps s JOIN runs r ON r.id = s.run_id
+WHERE s.status = ? AND `+where+`
+GROUP BY r.flow_name, s.step_name, s.error`, append([]any{model.StepFailed}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var flowName, stepName string
+		var reason model.FailureReason
+		if err := rows.Scan(&flowName, &stepName, &reason.Error, &reason.Count); err != nil {
+			return nil, err
+		}
+		ss := b.step(flowName, stepName)
+		ss.FailureReasons = append(ss.FailureReasons, reason)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return b.result(), nil
+}
+
+func (s *SqliteStorage) SaveDeadLetter(ctx context.Context, dl *model.DeadLetter) error {
+	_, err := s.db.ExecContext(ctx, `
+INSERT OR REPLACE INTO dead_letters (id, topic, subscription, payload, error, attempts, failed_at)
+VALUES (?, ?, ?, ?, ?, ?, ?)
+`, dl.ID, dl.Topic, dl.Subscription, dl.Payload, dl.Error, dl.Attempts, dl.FailedAt.UnixMilli())
+	return err
+}
+
+func (s *SqliteStorage) GetDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error) {
+	row := s.db.QueryRowContext(ctx, `
+SELECT id, topic, subscription, payload, error, attempts, failed_at FROM dead_letters WHERE id=?
+`, id)
+	dl, err := scanSqliteDeadLetter(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrDeadLetterNotFound
+	}
+	return dl, err
+}
+
+func (s *SqliteStorage) ListDeadLetters(ctx context.Context) ([]*model.DeadLetter, error) {
+	rows, err := s.db.QueryContext(ctx, `
+SELECT id, topic, subscription, payload, error, attempts, failed_at FROM dead_letters ORDER BY failed_at, id
+`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	letters := []*model.DeadLetter{}
+	for rows.Next() {
+		dl, err := scanSqliteDeadLetter(rows)
+		if err != nil {
+			return nil, err
+		}
+		letters = append(letters, dl)
+	}
+	return letters, rows.Err()
+}
+
+func scanSqliteDeadLetter(row interface{ Scan(...any) error }) (*model.DeadLetter, error) {
+	var dl model.DeadLetter
+	var failedAt int64
+	if err := row.Scan(&dl.ID, &dl.Topic, &dl.Subscription, &dl.Payload, &dl.Error, &dl.Attempts, &failedAt); err != nil {
+		return nil, err
+	}
+	dl.FailedAt = time.UnixMilli(failedAt)
+	return &dl, nil
+}
+
+func (s *SqliteStorage) DeleteDeadLetter(ctx context.Context, id string) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM dead_letters WHERE id=?`, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+func (s *SqliteStorage) AppendEvent(ctx context.Context, rec *model.EventRecord) error {
+	if rec.PublishedAt.IsZero() {
+		rec.PublishedAt = time.Now()
+	}
+	res, err := s.db.ExecContext(ctx, `INSERT INTO event_log (topic, payload, published_at) VALUES (?, ?, ?)`,
+		rec.Topic, rec.Payload, rec.PublishedAt.UnixMilli())
+	if err != nil {
+		return err
+	}
+	rec.Offset, err = res.LastInsertId()
+	return err
+}
+
+func (s *SqliteStorage) ListEvents(ctx context.Context, q model.EventQuery) ([]*model.EventRecord, error) {
+	query := `SELECT id, topic, payload, published_at FROM event_log WHERE id > ?`
+	args := []any{q.AfterOffset}
+	if !q.Since.IsZero() {
+		query += ` AND published_at >= ?`
+		args = append(args, q.Since.UnixMilli())
+	}
+	if q.Topic != "" {
+		query += ` AND topic = ?`
+		args = append(args, q.Topic)
+	}
+	query += ` ORDER BY id`
+	if q.Limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, q.Limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	records := []*model.EventRecord{}
+	for rows.Next() {
+		var rec model.EventRecord
+		var publishedAt int64
+		if err := rows.Scan(&rec.Offset, &rec.Topic, &rec.Payload, &publishedAt); err != nil {
+			return nil, err
+		}
+		rec.PublishedAt = time.UnixMilli(publishedAt)
+		records = append(records, &rec)
+	}
+	return records, rows.Err()
+}
+
+func (s *SqliteStorage) TrimEvents(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM event_log WHERE published_at < ?`, before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -2,15 +2,46 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"math"
+	"sort"
+	"time"
 
 	"github.com/awantoch/beemflow/model"
 	"github.com/google/uuid"
 	_ "modernc.org/sqlite"
 )
 
+// ErrVersionConflict is returned by TransitionRun when the stored run was modified
+// (or changed status) since the caller last read it.
+var ErrVersionConflict = errors.New("run version conflict")
+
+// ErrLeaseLost is returned when a worker renews or completes a queued run whose lease it no
+// longer holds (it expired and another worker picked the run up).
+var ErrLeaseLost = errors.New("run queue lease lost")
+
+// ErrFlowNotFound is returned when a flow, or the requested version of it, is not in the flow repository.
+var ErrFlowNotFound = errors.New("flow not found")
+
+// ErrDeadLetterNotFound is returned when a dead letter is not in the dead-letter store.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// queryer is the part of *sql.DB and *sql.Tx that SQL backends need to write the same
+// rows inside or outside a transaction.
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 type Storage interface {
 	SaveRun(ctx context.Context, run *model.Run) error
 	GetRun(ctx context.Context, id uuid.UUID) (*model.Run, error)
+	// TransitionRun moves run to status `to` with compare-and-swap semantics: the update
+	// only applies if the stored version and status still match run.Version and run.Status.
+	// Illegal transitions return model.ErrInvalidRunTransition; lost races return ErrVersionConflict.
+	// On success run.Status, run.EndedAt and run.Version are updated in place.
+	TransitionRun(ctx context.Context, run *model.Run, to model.RunStatus) error
 	SaveStep(ctx context.Context, step *model.StepRun) error
 	GetSteps(ctx context.Context, runID uuid.UUID) ([]*model.StepRun, error)
 	RegisterWait(ctx context.Context, token uuid.UUID, wakeAt *int64) error
@@ -18,6 +49,180 @@ type Storage interface {
 	ListRuns(ctx context.Context) ([]*model.Run, error)
 	SavePausedRun(ctx context.Context, token string, paused any) error
 	LoadPausedRuns(ctx context.Context) (map[string]any, error)
+	// LoadPausedRun returns the paused run saved under token, or nil if there is none.
+	LoadPausedRun(ctx context.Context, token string) (any, error)
 	DeletePausedRun(ctx context.Context, token string) error
 	DeleteRun(ctx context.Context, id uuid.UUID) error
+
+	// EnqueueRun saves run and adds it to the run queue in one transaction, so a failed
+	// enqueue never leaves behind a PENDING run that no worker will lease.
+	EnqueueRun(ctx context.Context, run *model.Run, item *model.QueuedRun) error
+	// LeaseRun hands the oldest available queued run to owner for ttl and increments its attempts.
+	// Entries whose lease has expired are available again, so runs held by a crashed worker are
+	// redelivered. limits caps the live leases per flow name; flows not listed are unlimited.
+	// Returns nil, nil when nothing can be leased.
+	LeaseRun(ctx context.Context, owner string, ttl time.Duration, limits map[string]int) (*model.QueuedRun, error)
+	// RenewLease extends owner's lease on a queued run, or returns ErrLeaseLost.
+	RenewLease(ctx context.Context, runID uuid.UUID, owner string, ttl time.Duration) error
+	// CompleteQueuedRun removes a queued run once owner is done with it, or returns ErrLeaseLost.
+	CompleteQueuedRun(ctx context.Context, runID uuid.UUID, owner string) error
+
+	// SaveFlowVersion stores fv.Source as the next version of fv.FlowName and fills in fv.Version
+	// and fv.CreatedAt. If fv.Hash matches the latest stored version, nothing is written and fv is
+	// filled in from that version instead.
+	SaveFlowVersion(ctx context.Context, fv *model.FlowVersion) error
+	// GetFlowVersion returns one version of a flow, or the latest one when version is 0.
+	// Returns ErrFlowNotFound if it does not exist.
+	GetFlowVersion(ctx context.Context, name string, version int) (*model.FlowVersion, error)
+	// ListFlowVersions returns the version history of a flow, newest first, without sources.
+	ListFlowVersions(ctx context.Context, name string) ([]*model.FlowVersion, error)
+	// ListFlowNames returns the names of all flows in the repository, sorted.
+	ListFlowNames(ctx context.Context) ([]string, error)
+	// DeleteFlow removes a flow and its whole version history, or returns ErrFlowNotFound.
+	DeleteFlow(ctx context.Context, name string) error
+
+	// FlowStats aggregates the runs selected by q, and the steps they executed, per flow.
+	// Flows without runs in the window are omitted; results are sorted by flow name.
+	FlowStats(ctx context.Context, q model.StatsQuery) ([]*model.FlowStats, error)
+
+	// SaveDeadLetter stores dl, replacing any dead letter with the same ID.
+	SaveDeadLetter(ctx context.Context, dl *model.DeadLetter) error
+	// GetDeadLetter returns one dead letter, or ErrDeadLetterNotFound.
+	GetDeadLetter(ctx context.Context, id string) (*model.DeadLetter, error)
+	// ListDeadLetters returns all dead letters, oldest first.
+	ListDeadLetters(ctx context.Context) ([]*model.DeadLetter, error)
+	// DeleteDeadLetter removes a dead letter, or returns ErrDeadLetterNotFound.
+	DeleteDeadLetter(ctx context.Context, id string) error
+
+	// AppendEvent adds rec to the event log and fills in rec.Offset, and rec.PublishedAt if it
+	// is zero.
+	AppendEvent(ctx context.Context, rec *model.EventRecord) error
+	// ListEvents returns the event log records selected by q, in offset order.
+	ListEvents(ctx context.Context, q model.EventQuery) ([]*model.EventRecord, error)
+	// TrimEvents deletes the records published before the given time and returns how many.
+	TrimEvents(ctx context.Context, before time.Time) (int, error)
+}
+
+// prepareTransition validates a status change and returns the ended-at time the run
+// should carry afterwards (set once the run reaches a terminal status).
+func prepareTransition(run *model.Run, to model.RunStatus) (*time.Time, error) {
+	if err := model.ValidateRunTransition(run.Status, to); err != nil {
+		return nil, err
+	}
+	endedAt := run.EndedAt
+	if to.IsTerminal() && endedAt == nil {
+		now := time.Now()
+		endedAt = &now
+	}
+	return endedAt, nil
+}
+
+// applyTransition records a successful transition on the caller's copy of the run.
+func applyTransition(run *model.Run, to model.RunStatus, endedAt *time.Time) {
+	run.Status = to
+	run.EndedAt = endedAt
+	run.Version++
+}
+
+// leaseAvailable reports whether a queued run can be leased at now.
+func leaseAvailable(item *model.QueuedRun, now time.Time) bool {
+	return item.LeaseExpiresAt == nil || !item.LeaseExpiresAt.After(now)
+}
+
+// withinFlowLimit reports whether flowName may take another lease given its live lease count.
+func withinFlowLimit(limits map[string]int, flowName string, active int) bool {
+	limit, ok := limits[flowName]
+	return !ok || limit <= 0 || active < limit
+}
+
+// leaseResult maps an owner-guarded queue update to ErrLeaseLost when no row matched.
+func leaseResult(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// maxFailureReasons caps how many distinct errors FlowStats reports per step.
+const maxFailureReasons = 5
+
+// statsBuilder collects FlowStats per flow name while a backend reads its aggregates.
+type statsBuilder map[string]*model.FlowStats
+
+func (b statsBuilder) flow(name string) *model.FlowStats {
+	fs, ok := b[name]
+	if !ok {
+		fs = &model.FlowStats{FlowName: name, ByStatus: make(map[model.RunStatus]int)}
+		b[name] = fs
+	}
+	return fs
+}
+
+func (b statsBuilder) step(flowName, stepName string) *model.StepStats {
+	fs := b.flow(flowName)
+	for _, ss := range fs.Steps {
+		if ss.StepName == stepName {
+			return ss
+		}
+	}
+	ss := &model.StepStats{StepName: stepName}
+	fs.Steps = append(fs.Steps, ss)
+	return ss
+}
+
+// result derives success rates and returns the flows, steps and failure reasons in a stable order.
+func (b statsBuilder) result() []*model.FlowStats {
+	out := make([]*model.FlowStats, 0, len(b))
+	for _, fs := range b {
+		if finished := fs.ByStatus[model.RunSucceeded] + fs.ByStatus[model.RunFailed]; finished > 0 {
+			fs.SuccessRate = float64(fs.ByStatus[model.RunSucceeded]) / float64(finished)
+		}
+		sort.Slice(fs.Steps, func(i, j int) bool { return fs.Steps[i].StepName < fs.Steps[j].StepName })
+		for _, ss := range fs.Steps {
+			sort.Slice(ss.FailureReasons, func(i, j int) bool {
+				a, b := ss.FailureReasons[i], ss.FailureReasons[j]
+				return a.Count > b.Count || (a.Count == b.Count && a.Error < b.Error)
+			})
+			if len(ss.FailureReasons) > maxFailureReasons {
+				ss.FailureReasons = ss.FailureReasons[:maxFailureReasons]
+			}
+		}
+		out = append(out, fs)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].FlowName < out[j].FlowName })
+	return out
+}
+
+// statsWindowContains reports whether a run belongs to the window selected by q.
+// A zero q.Until leaves the window open-ended.
+func statsWindowContains(q model.StatsQuery, flowName string, startedAt time.Time) bool {
+	if q.FlowName != "" && q.FlowName != flowName {
+		return false
+	}
+	if startedAt.Before(q.Since) {
+		return false
+	}
+	return q.Until.IsZero() || startedAt.Before(q.Until)
+}
+
+// durationStats returns the mean and nearest-rank 95th percentile of durations in milliseconds,
+// matching the percentile_disc(0.95) the SQL backends compute.
+func durationStats(ms []float64) (avg, p95 float64) {
+	if len(ms) == 0 {
+		return 0, 0
+	}
+	sort.Float64s(ms)
+	var sum float64
+	for _, d := range ms {
+		sum += d
+	}
+	rank := int(math.Ceil(0.95 * float64(len(ms))))
+	return sum / float64(len(ms)), ms[rank-1]
 }
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -154,12 +156,24 @@ func TestMemoryStorage_AllOperations(t *testing.T) {
 		t.Error("Expected to find pause_token in paused runs")
 	}
 
+	// Test LoadPausedRun
+	if paused, err := storage.LoadPausedRun(context.Background(), "pause_token"); err != nil || paused == nil {
+		t.Errorf("Expected LoadPausedRun to find pause_token, got %v: %v", paused, err)
+	}
+	if paused, err := storage.LoadPausedRun(context.Background(), "missing_token"); err != nil || paused != nil {
+		t.Errorf("Expected LoadPausedRun to return nil for an unknown token, got %v: %v", paused, err)
+	}
+
 	// Test DeletePausedRun
 	err = storage.DeletePausedRun(context.Background(), "pause_token")
 	if err != nil {
 		t.Fatalf("DeletePausedRun failed: %v", err)
 	}
 
+	if paused, err := storage.LoadPausedRun(context.Background(), "pause_token"); err != nil || paused != nil {
+		t.Errorf("Expected LoadPausedRun to return nil after delete, got %v: %v", paused, err)
+	}
+
 	pausedRuns, err = storage.LoadPausedRuns(context.Background())
 	if err != nil {
 		t.Fatalf("LoadPausedRuns after delete failed: %v", err)
@@ -220,12 +234,24 @@ func TestSqliteStorage_AllOperations(t *testing.T) {
 		t.Errorf("Expected 1 paused run, got %d", len(pausedRuns))
 	}
 
+	// Test LoadPausedRun
+	if paused, err := storage.LoadPausedRun(context.Background(), "sqlite_pause_token"); err != nil || paused == nil {
+		t.Errorf("Expected LoadPausedRun to find sqlite_pause_token, got %v: %v", paused, err)
+	}
+	if paused, err := storage.LoadPausedRun(context.Background(), "missing_token"); err != nil || paused != nil {
+		t.Errorf("Expected LoadPausedRun to return nil for an unknown token, got %v: %v", paused, err)
+	}
+
 	// Test DeletePausedRun
 	err = storage.DeletePausedRun(context.Background(), "sqlite_pause_token")
 	if err != nil {
 		t.Fatalf("DeletePausedRun failed: %v", err)
 	}
 
+	if paused, err := storage.LoadPausedRun(context.Background(), "sqlite_pause_token"); err != nil || paused != nil {
+		t.Errorf("Expected LoadPausedRun to return nil after delete, got %v: %v", paused, err)
+	}
+
 	pausedRuns, err = storage.LoadPausedRuns(context.Background())
 	if err != nil {
 		t.Fatalf("LoadPausedRuns after delete failed: %v", err)
@@ -1282,3 +1308,553 @@ func TestSQLiteStorageSchemaEvolution(t *testing.T) {
 		t.Errorf("Data changed after reopen: got %v, want schema-test", retrieved.FlowName)
 	}
 }
+
+func TestMemoryStorage_TransitionRun(t *testing.T) {
+	testTransitionRun(t, NewMemoryStorage())
+}
+
+func TestSqliteStorage_TransitionRun(t *testing.T) {
+	storage, err := NewSqliteStorage(filepath.Join(t.TempDir(), "transition.db"))
+	if err != nil {
+		t.Fatalf("Failed to create sqlite storage: %v", err)
+	}
+	defer storage.Close()
+
+	testTransitionRun(t, storage)
+}
+
+func testTransitionRun(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	run := &model.Run{
+		ID:        uuid.New(),
+		FlowName:  "transition",
+		Status:    model.RunRunning,
+		StartedAt: time.Now(),
+	}
+	if err := storage.SaveRun(ctx, run); err != nil {
+		t.Fatalf("SaveRun failed: %v", err)
+	}
+	if run.Version != 1 {
+		t.Fatalf("expected version 1 after first save, got %d", run.Version)
+	}
+
+	// Two readers of the same version; only the first transition wins
+	first, err := storage.GetRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	second, err := storage.GetRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if err := storage.TransitionRun(ctx, first, model.RunWaiting); err != nil {
+		t.Fatalf("TransitionRun failed: %v", err)
+	}
+	if first.Status != model.RunWaiting || first.Version != 2 {
+		t.Errorf("expected caller copy updated to WAITING/2, got %s/%d", first.Status, first.Version)
+	}
+	if err := storage.TransitionRun(ctx, second, model.RunWaiting); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected ErrVersionConflict for stale transition, got %v", err)
+	}
+
+	// Illegal transitions are rejected before touching storage
+	if err := storage.TransitionRun(ctx, first, model.RunSucceeded); !errors.Is(err, model.ErrInvalidRunTransition) {
+		t.Errorf("expected ErrInvalidRunTransition for WAITING -> SUCCEEDED, got %v", err)
+	}
+
+	if err := storage.TransitionRun(ctx, first, model.RunRunning); err != nil {
+		t.Fatalf("TransitionRun WAITING -> RUNNING failed: %v", err)
+	}
+	if err := storage.TransitionRun(ctx, first, model.RunSucceeded); err != nil {
+		t.Fatalf("TransitionRun RUNNING -> SUCCEEDED failed: %v", err)
+	}
+	got, err := storage.GetRun(ctx, run.ID)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	if got.Status != model.RunSucceeded || got.Version != 4 || got.EndedAt == nil {
+		t.Errorf("expected SUCCEEDED/4 with EndedAt, got %s/%d ended=%v", got.Status, got.Version, got.EndedAt)
+	}
+	if err := storage.TransitionRun(ctx, got, model.RunRunning); !errors.Is(err, model.ErrInvalidRunTransition) {
+		t.Errorf("expected terminal run to reject transitions, got %v", err)
+	}
+
+	// Missing runs are reported as such, not as conflicts
+	missing := &model.Run{ID: uuid.New(), Status: model.RunRunning, Version: 1}
+	if err := storage.TransitionRun(ctx, missing, model.RunFailed); err == nil || errors.Is(err, ErrVersionConflict) {
+		t.Errorf("expected not-found error for missing run, got %v", err)
+	}
+}
+
+func TestMemoryStorage_RunQueue(t *testing.T) {
+	testRunQueue(t, NewMemoryStorage())
+}
+
+func TestSqliteStorage_RunQueue(t *testing.T) {
+	storage, err := NewSqliteStorage(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatalf("Failed to create sqlite storage: %v", err)
+	}
+	defer storage.Close()
+
+	testRunQueue(t, storage)
+}
+
+func TestSqliteStorage_EnqueueRunIsAtomic(t *testing.T) {
+	storage, err := NewSqliteStorage(filepath.Join(t.TempDir(), "queue.db"))
+	if err != nil {
+		t.Fatalf("Failed to create sqlite storage: %v", err)
+	}
+	defer storage.Close()
+	ctx := context.Background()
+
+	// With the queue insert failing, the PENDING run must not be saved on its own
+	if _, err := storage.db.Exec(`DROP TABLE run_queue`); err != nil {
+		t.Fatalf("failed to drop run_queue: %v", err)
+	}
+	run := &model.Run{ID: uuid.New(), FlowName: "f", Status: model.RunPending, StartedAt: time.Now()}
+	if err := storage.EnqueueRun(ctx, run, &model.QueuedRun{RunID: run.ID, FlowName: "f", EnqueuedAt: time.Now()}); err == nil {
+		t.Fatal("expected EnqueueRun to fail without a run queue")
+	}
+	if _, err := storage.GetRun(ctx, run.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected no saved run after a failed enqueue, got %v", err)
+	}
+}
+
+func testRunQueue(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	base := time.Now().Add(-time.Minute)
+	enqueue := func(flow string, offset time.Duration) uuid.UUID {
+		id := uuid.New()
+		run := &model.Run{ID: id, FlowName: flow, Status: model.RunPending, StartedAt: base}
+		if err := storage.EnqueueRun(ctx, run, &model.QueuedRun{RunID: id, FlowName: flow, EnqueuedAt: base.Add(offset)}); err != nil {
+			t.Fatalf("EnqueueRun failed: %v", err)
+		}
+		return id
+	}
+	first := enqueue("slow", 0)
+	second := enqueue("slow", time.Second)
+	third := enqueue("fast", 2*time.Second)
+	limits := map[string]int{"slow": 1}
+
+	// Oldest first, and the per-flow limit skips the second "slow" run
+	item, err := storage.LeaseRun(ctx, "w1", time.Minute, limits)
+	if err != nil || item == nil {
+		t.Fatalf("LeaseRun failed: %v, %v", item, err)
+	}
+	if item.RunID != first || item.Attempts != 1 || item.LeaseOwner != "w1" || item.LeaseExpiresAt == nil {
+		t.Errorf("expected first run leased by w1 on attempt 1, got %+v", item)
+	}
+	item, err = storage.LeaseRun(ctx, "w2", time.Minute, limits)
+	if err != nil || item == nil || item.RunID != third {
+		t.Fatalf("expected limit to skip to the fast run, got %+v, %v", item, err)
+	}
+	item, err = storage.LeaseRun(ctx, "w2", time.Minute, limits)
+	if err != nil || item != nil {
+		t.Fatalf("expected nothing leasable, got %+v, %v", item, err)
+	}
+
+	// Only the owner may renew or complete
+	if err := storage.RenewLease(ctx, first, "w2", time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("expected ErrLeaseLost renewing someone else's lease, got %v", err)
+	}
+	if err := storage.RenewLease(ctx, first, "w1", time.Minute); err != nil {
+		t.Errorf("RenewLease failed: %v", err)
+	}
+	if err := storage.CompleteQueuedRun(ctx, first, "w2"); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("expected ErrLeaseLost completing someone else's lease, got %v", err)
+	}
+	if err := storage.CompleteQueuedRun(ctx, first, "w1"); err != nil {
+		t.Fatalf("CompleteQueuedRun failed: %v", err)
+	}
+
+	// Completing the first frees the slow flow's slot
+	item, err = storage.LeaseRun(ctx, "w1", 50*time.Millisecond, limits)
+	if err != nil || item == nil || item.RunID != second {
+		t.Fatalf("expected second slow run after completion, got %+v, %v", item, err)
+	}
+
+	// An expired lease is redelivered to another worker with the attempt counted
+	time.Sleep(100 * time.Millisecond)
+	item, err = storage.LeaseRun(ctx, "w3", time.Minute, limits)
+	if err != nil || item == nil || item.RunID != second {
+		t.Fatalf("expected expired lease to be redelivered, got %+v, %v", item, err)
+	}
+	if item.Attempts != 2 || item.LeaseOwner != "w3" {
+		t.Errorf("expected attempt 2 owned by w3, got %+v", item)
+	}
+	if err := storage.RenewLease(ctx, second, "w1", time.Minute); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("expected the crashed worker to have lost its lease, got %v", err)
+	}
+}
+
+func TestMemoryStorage_FlowVersions(t *testing.T) {
+	testFlowVersions(t, NewMemoryStorage())
+}
+
+func TestSqliteStorage_FlowVersions(t *testing.T) {
+	storage, err := NewSqliteStorage(filepath.Join(t.TempDir(), "flows.db"))
+	if err != nil {
+		t.Fatalf("Failed to create sqlite storage: %v", err)
+	}
+	defer storage.Close()
+
+	testFlowVersions(t, storage)
+}
+
+func testFlowVersions(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	save := func(source string) *model.FlowVersion {
+		fv := &model.FlowVersion{FlowName: "hello", Hash: model.FlowHash(source), Source: source}
+		if err := storage.SaveFlowVersion(ctx, fv); err != nil {
+			t.Fatalf("SaveFlowVersion failed: %v", err)
+		}
+		return fv
+	}
+
+	if _, err := storage.GetFlowVersion(ctx, "hello", 0); !errors.Is(err, ErrFlowNotFound) {
+		t.Fatalf("expected ErrFlowNotFound for unknown flow, got %v", err)
+	}
+
+	v1 := save("name: hello\nsteps: []\n")
+	if v1.Version != 1 || v1.CreatedAt.IsZero() {
+		t.Fatalf("expected version 1 with a creation time, got %+v", v1)
+	}
+	// Saving identical content doesn't create a new version
+	if again := save("name: hello\nsteps: []\n"); again.Version != 1 {
+		t.Errorf("expected unchanged source to stay at version 1, got %d", again.Version)
+	}
+	v2 := save("name: hello\nvars: {a: 1}\nsteps: []\n")
+	if v2.Version != 2 {
+		t.Errorf("expected version 2, got %d", v2.Version)
+	}
+
+	latest, err := storage.GetFlowVersion(ctx, "hello", 0)
+	if err != nil || latest.Version != 2 || latest.Hash != v2.Hash || latest.Source != v2.Source {
+		t.Errorf("expected latest to be version 2, got %+v, %v", latest, err)
+	}
+	first, err := storage.GetFlowVersion(ctx, "hello", 1)
+	if err != nil || first.Source != v1.Source {
+		t.Errorf("expected version 1 source, got %+v, %v", first, err)
+	}
+	if _, err := storage.GetFlowVersion(ctx, "hello", 3); !errors.Is(err, ErrFlowNotFound) {
+		t.Errorf("expected ErrFlowNotFound for missing version, got %v", err)
+	}
+
+	history, err := storage.ListFlowVersions(ctx, "hello")
+	if err != nil {
+		t.Fatalf("ListFlowVersions failed: %v", err)
+	}
+	if len(history) != 2 || history[0].Version != 2 || history[1].Version != 1 || history[0].Source != "" {
+		t.Errorf("expected history [2 1] without sources, got %+v", history)
+	}
+
+	save2 := &model.FlowVersion{FlowName: "another", Hash: model.FlowHash("x"), Source: "x"}
+	if err := storage.SaveFlowVersion(ctx, save2); err != nil {
+		t.Fatalf("SaveFlowVersion failed: %v", err)
+	}
+	names, err := storage.ListFlowNames(ctx)
+	if err != nil || len(names) != 2 || names[0] != "another" || names[1] != "hello" {
+		t.Errorf("expected sorted names [another hello], got %v, %v", names, err)
+	}
+
+	if err := storage.DeleteFlow(ctx, "hello"); err != nil {
+		t.Fatalf("DeleteFlow failed: %v", err)
+	}
+	if err := storage.DeleteFlow(ctx, "hello"); !errors.Is(err, ErrFlowNotFound) {
+		t.Errorf("expected ErrFlowNotFound deleting twice, got %v", err)
+	}
+	if history, _ := storage.ListFlowVersions(ctx, "hello"); len(history) != 0 {
+		t.Errorf("expected history to be gone, got %+v", history)
+	}
+
+	// Runs keep the version they were pinned to
+	run := &model.Run{ID: uuid.New(), FlowName: "another", Status: model.RunPending, StartedAt: time.Now(), FlowVersion: 1, FlowHash: save2.Hash}
+	if err := storage.SaveRun(ctx, run); err != nil {
+		t.Fatalf("SaveRun failed: %v", err)
+	}
+	got, err := storage.GetRun(ctx, run.ID)
+	if err != nil || got.FlowVersion != 1 || got.FlowHash != save2.Hash {
+		t.Errorf("expected pinned flow version to round-trip, got %+v, %v", got, err)
+	}
+}
+
+func TestMemoryStorage_FlowStats(t *testing.T) {
+	testFlowStats(t, NewMemoryStorage())
+}
+
+func TestSqliteStorage_FlowStats(t *testing.T) {
+	storage, err := NewSqliteStorage(filepath.Join(t.TempDir(), "stats.db"))
+	if err != nil {
+		t.Fatalf("Failed to create sqlite storage: %v", err)
+	}
+	defer storage.Close()
+
+	testFlowStats(t, storage)
+}
+
+// SQLite stores run and step timestamps in whole seconds, so its stats truncate sub-second
+// durations rather than reporting milliseconds.
+func TestSqliteStorage_FlowStatsMillisecondDurations(t *testing.T) {
+	storage, err := NewSqliteStorage(filepath.Join(t.TempDir(), "stats.db"))
+	if err != nil {
+		t.Fatalf("Failed to create sqlite storage: %v", err)
+	}
+	defer storage.Close()
+
+	ctx := context.Background()
+	start := time.Unix(time.Now().Add(-time.Hour).Unix(), 0)
+	for _, span := range [][2]time.Duration{
+		{200 * time.Millisecond, 450 * time.Millisecond},  // within one second
+		{700 * time.Millisecond, 1450 * time.Millisecond}, // crosses a second boundary
+	} {
+		started, ended := start.Add(span[0]), start.Add(span[1])
+		run := &model.Run{ID: uuid.New(), FlowName: "fast", Status: model.RunSucceeded, StartedAt: started, EndedAt: &ended}
+		if err := storage.SaveRun(ctx, run); err != nil {
+			t.Fatalf("SaveRun failed: %v", err)
+		}
+		step := &model.StepRun{ID: uuid.New(), RunID: run.ID, StepName: "call", Status: model.StepSucceeded, StartedAt: started, EndedAt: &ended}
+		if err := storage.SaveStep(ctx, step); err != nil {
+			t.Fatalf("SaveStep failed: %v", err)
+		}
+	}
+
+	stats, err := storage.FlowStats(ctx, model.StatsQuery{Since: start.Add(-time.Minute)})
+	if err != nil {
+		t.Fatalf("FlowStats failed: %v", err)
+	}
+	if len(stats) != 1 {
+		t.Fatalf("expected stats for one flow, got %d", len(stats))
+	}
+	if stats[0].AvgDurationMs != 500 || stats[0].P95DurationMs != 750 {
+		t.Errorf("expected run durations of 250ms and 750ms (avg 500, p95 750), got %v and %v", stats[0].AvgDurationMs, stats[0].P95DurationMs)
+	}
+	if steps := stats[0].Steps; len(steps) != 1 || steps[0].AvgDurationMs != 500 || steps[0].P95DurationMs != 750 {
+		t.Errorf("expected step durations of 250ms and 750ms (avg 500, p95 750), got %+v", steps)
+	}
+}
+
+func testFlowStats(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	// Whole seconds, since SQLite stores timestamps with second resolution
+	now := time.Unix(time.Now().Unix(), 0)
+	addRun := func(flowName string, status model.RunStatus, startedAt time.Time, dur time.Duration, steps ...*model.StepRun) {
+		run := &model.Run{ID: uuid.New(), FlowName: flowName, Status: status, StartedAt: startedAt}
+		if dur > 0 {
+			ended := startedAt.Add(dur)
+			run.EndedAt = &ended
+		}
+		if err := storage.SaveRun(ctx, run); err != nil {
+			t.Fatalf("SaveRun failed: %v", err)
+		}
+		for _, step := range steps {
+			step.ID = uuid.New()
+			step.RunID = run.ID
+			step.StartedAt = startedAt
+			ended := startedAt.Add(time.Second)
+			step.EndedAt = &ended
+			if err := storage.SaveStep(ctx, step); err != nil {
+				t.Fatalf("SaveStep failed: %v", err)
+			}
+		}
+	}
+	ok := func(name string) *model.StepRun {
+		return &model.StepRun{StepName: name, Status: model.StepSucceeded}
+	}
+	failed := func(name, reason string) *model.StepRun {
+		return &model.StepRun{StepName: name, Status: model.StepFailed, Error: reason}
+	}
+
+	start := now.Add(-time.Hour)
+	addRun("orders", model.RunSucceeded, start, time.Second, ok("fetch"))
+	addRun("orders", model.RunSucceeded, start, 2*time.Second, ok("fetch"))
+	addRun("orders", model.RunSucceeded, start, 10*time.Second, ok("fetch"))
+	addRun("orders", model.RunFailed, start, 4*time.Second, ok("fetch"), failed("post", "boom"))
+	addRun("orders", model.RunRunning, start, 0, failed("post", "boom"))
+	addRun("orders", model.RunFailed, now.Add(-48*time.Hour), time.Second, failed("post", "too old"))
+	addRun("billing", model.RunWaiting, start, 0)
+
+	stats, err := storage.FlowStats(ctx, model.StatsQuery{Since: now.Add(-24 * time.Hour)})
+	if err != nil {
+		t.Fatalf("FlowStats failed: %v", err)
+	}
+	if len(stats) != 2 || stats[0].FlowName != "billing" || stats[1].FlowName != "orders" {
+		t.Fatalf("expected stats for [billing orders], got %+v", stats)
+	}
+	if stats[0].Runs != 1 || stats[0].ByStatus[model.RunWaiting] != 1 || stats[0].SuccessRate != 0 {
+		t.Errorf("unexpected billing stats: %+v", stats[0])
+	}
+
+	orders := stats[1]
+	if orders.Runs != 5 || orders.ByStatus[model.RunSucceeded] != 3 || orders.ByStatus[model.RunFailed] != 1 || orders.ByStatus[model.RunRunning] != 1 {
+		t.Errorf("unexpected run counts: %+v", orders)
+	}
+	if orders.SuccessRate != 0.75 {
+		t.Errorf("expected success rate 0.75, got %v", orders.SuccessRate)
+	}
+	if orders.AvgDurationMs != 4250 || orders.P95DurationMs != 10000 {
+		t.Errorf("expected avg 4250ms and p95 10000ms, got %v and %v", orders.AvgDurationMs, orders.P95DurationMs)
+	}
+	if len(orders.Steps) != 2 {
+		t.Fatalf("expected 2 steps, got %+v", orders.Steps)
+	}
+	fetch, post := orders.Steps[0], orders.Steps[1]
+	if fetch.StepName != "fetch" || fetch.Runs != 4 || fetch.Failed != 0 || fetch.P95DurationMs != 1000 {
+		t.Errorf("unexpected fetch stats: %+v", fetch)
+	}
+	if post.StepName != "post" || post.Runs != 2 || post.Failed != 2 {
+		t.Errorf("unexpected post stats: %+v", post)
+	}
+	if len(post.FailureReasons) != 1 || post.FailureReasons[0] != (model.FailureReason{Error: "boom", Count: 2}) {
+		t.Errorf("expected failures outside the window to be ignored, got %+v", post.FailureReasons)
+	}
+
+	filtered, err := storage.FlowStats(ctx, model.StatsQuery{FlowName: "billing", Since: now.Add(-24 * time.Hour), Until: now})
+	if err != nil || len(filtered) != 1 || filtered[0].FlowName != "billing" {
+		t.Errorf("expected only billing, got %+v, %v", filtered, err)
+	}
+	if empty, err := storage.FlowStats(ctx, model.StatsQuery{Since: now.Add(time.Hour)}); err != nil || len(empty) != 0 {
+		t.Errorf("expected no stats for a future window, got %+v, %v", empty, err)
+	}
+}
+
+func TestMemoryStorage_DeadLetters(t *testing.T) {
+	testDeadLetters(t, NewMemoryStorage())
+}
+
+func TestSqliteStorage_DeadLetters(t *testing.T) {
+	storage, err := NewSqliteStorage(filepath.Join(t.TempDir(), "dlq.db"))
+	if err != nil {
+		t.Fatalf("Failed to create sqlite storage: %v", err)
+	}
+	defer storage.Close()
+
+	testDeadLetters(t, storage)
+}
+
+func testDeadLetters(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	now := time.UnixMilli(time.Now().UnixMilli())
+	newer := &model.DeadLetter{ID: "b", Topic: "orders.created", Subscription: "orders.*",
+		Payload: `{"id":2}`, Error: "boom", Attempts: 3, FailedAt: now}
+	older := &model.DeadLetter{ID: "a", Topic: "orders.paid", Subscription: "orders.paid",
+		Payload: "plain", Error: "panic: nil map", Attempts: 1, FailedAt: now.Add(-time.Minute)}
+	for _, dl := range []*model.DeadLetter{newer, older} {
+		if err := storage.SaveDeadLetter(ctx, dl); err != nil {
+			t.Fatalf("SaveDeadLetter failed: %v", err)
+		}
+	}
+
+	letters, err := storage.ListDeadLetters(ctx)
+	if err != nil {
+		t.Fatalf("ListDeadLetters failed: %v", err)
+	}
+	if len(letters) != 2 || letters[0].ID != "a" || letters[1].ID != "b" {
+		t.Fatalf("expected dead letters oldest first, got %+v", letters)
+	}
+	got, err := storage.GetDeadLetter(ctx, "b")
+	if err != nil {
+		t.Fatalf("GetDeadLetter failed: %v", err)
+	}
+	if got.Topic != newer.Topic || got.Subscription != newer.Subscription || got.Payload != newer.Payload ||
+		got.Error != newer.Error || got.Attempts != 3 || !got.FailedAt.Equal(now) {
+		t.Errorf("unexpected dead letter: %+v", got)
+	}
+
+	newer.Attempts = 6
+	if err := storage.SaveDeadLetter(ctx, newer); err != nil {
+		t.Fatalf("SaveDeadLetter failed: %v", err)
+	}
+	if got, _ := storage.GetDeadLetter(ctx, "b"); got == nil || got.Attempts != 6 {
+		t.Errorf("expected saving the same ID to replace the dead letter, got %+v", got)
+	}
+
+	if err := storage.DeleteDeadLetter(ctx, "a"); err != nil {
+		t.Fatalf("DeleteDeadLetter failed: %v", err)
+	}
+	if _, err := storage.GetDeadLetter(ctx, "a"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("expected ErrDeadLetterNotFound, got %v", err)
+	}
+	if err := storage.DeleteDeadLetter(ctx, "a"); !errors.Is(err, ErrDeadLetterNotFound) {
+		t.Errorf("expected ErrDeadLetterNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestMemoryStorage_EventLog(t *testing.T) {
+	testEventLog(t, NewMemoryStorage())
+}
+
+func TestSqliteStorage_EventLog(t *testing.T) {
+	storage, err := NewSqliteStorage(filepath.Join(t.TempDir(), "events.db"))
+	if err != nil {
+		t.Fatalf("Failed to create sqlite storage: %v", err)
+	}
+	defer storage.Close()
+
+	testEventLog(t, storage)
+}
+
+func testEventLog(t *testing.T, storage Storage) {
+	ctx := context.Background()
+	now := time.UnixMilli(time.Now().UnixMilli())
+	var offsets []int64
+	for i, topic := range []string{"orders.created", "resume.tok", "orders.created"} {
+		rec := &model.EventRecord{Topic: topic, Payload: fmt.Sprintf(`{"n":%d}`, i),
+			PublishedAt: now.Add(time.Duration(i-2) * time.Hour)}
+		if err := storage.AppendEvent(ctx, rec); err != nil {
+			t.Fatalf("AppendEvent failed: %v", err)
+		}
+		if len(offsets) > 0 && rec.Offset <= offsets[len(offsets)-1] {
+			t.Fatalf("expected increasing offsets, got %d after %v", rec.Offset, offsets)
+		}
+		offsets = append(offsets, rec.Offset)
+	}
+
+	offsetsOf := func(q model.EventQuery) []int64 {
+		t.Helper()
+		records, err := storage.ListEvents(ctx, q)
+		if err != nil {
+			t.Fatalf("ListEvents(%+v) failed: %v", q, err)
+		}
+		out := []int64{}
+		for _, rec := range records {
+			out = append(out, rec.Offset)
+		}
+		return out
+	}
+	tests := []struct {
+		q    model.EventQuery
+		want []int64
+	}{
+		{model.EventQuery{}, offsets},
+		{model.EventQuery{Topic: "orders.created"}, []int64{offsets[0], offsets[2]}},
+		{model.EventQuery{AfterOffset: offsets[0]}, offsets[1:]},
+		{model.EventQuery{Since: now.Add(-90 * time.Minute)}, offsets[1:]},
+		{model.EventQuery{Limit: 2}, offsets[:2]},
+		{model.EventQuery{Topic: "orders.created", AfterOffset: offsets[0], Limit: 1}, offsets[2:]},
+	}
+	for _, tt := range tests {
+		if got := offsetsOf(tt.q); fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("ListEvents(%+v) = %v, want %v", tt.q, got, tt.want)
+		}
+	}
+	records, _ := storage.ListEvents(ctx, model.EventQuery{Topic: "resume.tok"})
+	if len(records) != 1 || records[0].Payload != `{"n":1}` || !records[0].PublishedAt.Equal(now.Add(-time.Hour)) {
+		t.Errorf("unexpected record: %+v", records)
+	}
+
+	n, err := storage.TrimEvents(ctx, now.Add(-30*time.Minute))
+	if err != nil || n != 2 {
+		t.Errorf("expected 2 trimmed records, got %d, %v", n, err)
+	}
+	if got := offsetsOf(model.EventQuery{}); fmt.Sprint(got) != fmt.Sprint(offsets[2:]) {
+		t.Errorf("unexpected records after trim: %v", got)
+	}
+	next := &model.EventRecord{Topic: "orders.created", Payload: "{}"}
+	if err := storage.AppendEvent(ctx, next); err != nil {
+		t.Fatalf("AppendEvent failed: %v", err)
+	}
+	if next.Offset <= offsets[2] || next.PublishedAt.IsZero() {
+		t.Errorf("expected offsets to keep growing after a trim, got %+v", next)
+	}
+}
@@ -0,0 +1,266 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/constants"
+	"github.com/awantoch/beemflow/engine"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+	"github.com/awantoch/beemflow/utils"
+	"github.com/google/uuid"
+)
+
+// Worker leases queued runs from storage and executes them.
+//
+// A leased run is kept alive with a heartbeat while it executes. If the worker dies, the
+// lease expires and the run is redelivered to another worker; once a run has been
+// delivered more than MaxAttempts times it is marked FAILED instead of executed again.
+type Worker struct {
+	engine *engine.Engine
+	store  storage.Storage
+	load   FlowLoader
+	opts   Options
+}
+
+// FlowLoader resolves the flow definition for a queued run. Runs pinned to a stored flow
+// version (run.FlowVersion) should get exactly that version back.
+type FlowLoader func(ctx context.Context, run *model.Run) (*model.Flow, error)
+
+const (
+	DefaultLeaseTTL     = 30 * time.Second
+	DefaultPollInterval = time.Second
+	DefaultMaxAttempts  = 3
+)
+
+// Options tune a Worker. Zero values fall back to the defaults above.
+type Options struct {
+	ID                string         // lease owner; defaults to host-pid-random
+	Concurrency       int            // runs this worker executes at once
+	LeaseTTL          time.Duration  // how long a lease lives without a heartbeat
+	HeartbeatInterval time.Duration  // defaults to LeaseTTL/3
+	PollInterval      time.Duration  // wait between lease attempts when the queue is empty
+	MaxAttempts       int            // deliveries before a run is failed
+	FlowConcurrency   map[string]int // live leases per flow across all workers
+}
+
+// OptionsFromConfig converts the queue section of flow.config.json into worker options.
+func OptionsFromConfig(cfg *config.QueueConfig) (Options, error) {
+	var opts Options
+	if cfg == nil {
+		return opts, nil
+	}
+	var err error
+	if opts.LeaseTTL, err = parseDuration("leaseTTL", cfg.LeaseTTL); err != nil {
+		return opts, err
+	}
+	if opts.HeartbeatInterval, err = parseDuration("heartbeatInterval", cfg.HeartbeatInterval); err != nil {
+		return opts, err
+	}
+	if opts.PollInterval, err = parseDuration("pollInterval", cfg.PollInterval); err != nil {
+		return opts, err
+	}
+	opts.MaxAttempts = cfg.MaxAttempts
+	opts.Concurrency = cfg.Concurrency
+	opts.FlowConcurrency = cfg.FlowConcurrency
+	return opts, nil
+}
+
+func parseDuration(name, val string) (time.Duration, error) {
+	if val == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, utils.Errorf("invalid queue.%s %q: %w", name, val, err)
+	}
+	return d, nil
+}
+
+func (o Options) withDefaults() Options {
+	if o.ID == "" {
+		host, _ := os.Hostname()
+		o.ID = fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewString()[:8])
+	}
+	if o.Concurrency <= 0 {
+		o.Concurrency = 1
+	}
+	if o.LeaseTTL <= 0 {
+		o.LeaseTTL = DefaultLeaseTTL
+	}
+	if o.HeartbeatInterval <= 0 || o.HeartbeatInterval >= o.LeaseTTL {
+		o.HeartbeatInterval = o.LeaseTTL / 3
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = DefaultPollInterval
+	}
+	if o.MaxAttempts <= 0 {
+		o.MaxAttempts = DefaultMaxAttempts
+	}
+	return o
+}
+
+// New creates a worker that executes leased runs with eng, reading the queue from eng.Storage.
+func New(eng *engine.Engine, load FlowLoader, opts Options) *Worker {
+	return &Worker{
+		engine: eng,
+		store:  eng.Storage,
+		load:   load,
+		opts:   opts.withDefaults(),
+	}
+}
+
+// ID returns the lease owner name this worker uses.
+func (w *Worker) ID() string {
+	return w.opts.ID
+}
+
+// Run leases and executes queued runs until ctx is cancelled. Runs already in progress
+// are allowed to finish before Run returns.
+func (w *Worker) Run(ctx context.Context) error {
+	utils.Info("Worker %s started (concurrency %d)", w.opts.ID, w.opts.Concurrency)
+	slots := make(chan struct{}, w.opts.Concurrency)
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case slots <- struct{}{}:
+		}
+
+		item, err := w.store.LeaseRun(ctx, w.opts.ID, w.opts.LeaseTTL, w.opts.FlowConcurrency)
+		if err != nil || item == nil {
+			<-slots
+			if err != nil && ctx.Err() == nil {
+				utils.WarnCtx(ctx, "Failed to lease queued run", "worker", w.opts.ID, "error", err)
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(w.opts.PollInterval):
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			w.process(ctx, item)
+		}()
+	}
+}
+
+// ProcessNext leases a single queued run and executes it synchronously. It reports
+// whether a run was leased.
+func (w *Worker) ProcessNext(ctx context.Context) (bool, error) {
+	item, err := w.store.LeaseRun(ctx, w.opts.ID, w.opts.LeaseTTL, w.opts.FlowConcurrency)
+	if err != nil || item == nil {
+		return false, err
+	}
+	w.process(ctx, item)
+	return true, nil
+}
+
+// process executes a leased run under a heartbeat and acknowledges it afterwards.
+// Execution is detached from ctx so shutdown drains in-flight runs instead of failing
+// them; it is only cancelled if the lease is lost to another worker.
+func (w *Worker) process(ctx context.Context, item *model.QueuedRun) {
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	stopHeartbeat := w.heartbeat(runCtx, item.RunID, cancel)
+	w.execute(runCtx, item)
+	stopHeartbeat()
+
+	if runCtx.Err() != nil {
+		// Lease lost: the run now belongs to another worker
+		return
+	}
+	if err := w.store.CompleteQueuedRun(runCtx, item.RunID, w.opts.ID); err != nil {
+		utils.WarnCtx(runCtx, "Failed to complete queued run", "run_id", item.RunID.String(), "worker", w.opts.ID, "error", err)
+	}
+}
+
+// heartbeat renews the lease until the returned stop function is called. If the lease
+// can't be renewed because another worker owns it, lost is called.
+func (w *Worker) heartbeat(ctx context.Context, runID uuid.UUID, lost context.CancelFunc) (stop func()) {
+	done := make(chan struct{})
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		ticker := time.NewTicker(w.opts.HeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				err := w.store.RenewLease(ctx, runID, w.opts.ID, w.opts.LeaseTTL)
+				if errors.Is(err, storage.ErrLeaseLost) {
+					utils.WarnCtx(ctx, "Lease lost, abandoning run", "run_id", runID.String(), "worker", w.opts.ID)
+					lost()
+					return
+				}
+				if err != nil {
+					utils.WarnCtx(ctx, "Failed to renew lease", "run_id", runID.String(), "worker", w.opts.ID, "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-finished
+	}
+}
+
+// execute runs a leased queue entry to completion, a pause, or a failure.
+func (w *Worker) execute(ctx context.Context, item *model.QueuedRun) {
+	run, err := w.store.GetRun(ctx, item.RunID)
+	if errors.Is(err, sql.ErrNoRows) {
+		utils.WarnCtx(ctx, "Queued run no longer exists, dropping", "run_id", item.RunID.String())
+		return
+	}
+	if err != nil {
+		utils.ErrorCtx(ctx, "Failed to load queued run", "run_id", item.RunID.String(), "error", err)
+		return
+	}
+	if run.Status.IsTerminal() || run.Status == model.RunWaiting {
+		// A previous delivery finished the run but died before acknowledging it
+		return
+	}
+	if item.Attempts > w.opts.MaxAttempts {
+		w.failRun(ctx, run, fmt.Sprintf("gave up after %d deliveries", w.opts.MaxAttempts))
+		return
+	}
+
+	flow, err := w.load(ctx, run)
+	if err != nil || flow == nil {
+		w.failRun(ctx, run, fmt.Sprintf("flow %s could not be loaded: %v", item.FlowName, err))
+		return
+	}
+
+	utils.InfoCtx(ctx, "Executing queued run", "run_id", run.ID.String(), "flow", run.FlowName, "attempt", item.Attempts, "worker", w.opts.ID)
+	if _, err := w.engine.ExecuteRun(ctx, flow, run); err != nil && !strings.Contains(err.Error(), constants.ErrAwaitEventPause) {
+		utils.WarnCtx(ctx, "Queued run failed", "run_id", run.ID.String(), "flow", run.FlowName, "error", err)
+	}
+}
+
+func (w *Worker) failRun(ctx context.Context, run *model.Run, reason string) {
+	utils.ErrorCtx(ctx, "Failing queued run", "run_id", run.ID.String(), "flow", run.FlowName, "reason", reason)
+	if err := w.store.TransitionRun(ctx, run, model.RunFailed); err != nil {
+		utils.ErrorCtx(ctx, "Failed to mark queued run as failed", "run_id", run.ID.String(), "error", err)
+	}
+}
@@ -0,0 +1,222 @@
+package worker
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/awantoch/beemflow/config"
+	"github.com/awantoch/beemflow/dsl"
+	"github.com/awantoch/beemflow/engine"
+	"github.com/awantoch/beemflow/event"
+	"github.com/awantoch/beemflow/model"
+	"github.com/awantoch/beemflow/storage"
+	"github.com/awantoch/beemflow/utils"
+	"github.com/google/uuid"
+)
+
+func TestMain(m *testing.M) {
+	utils.WithCleanDirs(m, ".beemflow", config.DefaultConfigDir, config.DefaultFlowsDir)
+}
+
+var echoFlow = &model.Flow{
+	Name:  "queued_echo",
+	Steps: []model.Step{{ID: "s1", Use: "core.echo", With: map[string]interface{}{"text": "{{ event.msg }}"}}},
+}
+
+func newTestEngine(store storage.Storage) *engine.Engine {
+	ctx := context.Background()
+	return engine.NewEngine(engine.NewDefaultAdapterRegistry(ctx), dsl.NewTemplater(), event.NewInProcEventBus(), nil, store)
+}
+
+func staticLoader(flow *model.Flow) FlowLoader {
+	return func(ctx context.Context, run *model.Run) (*model.Flow, error) {
+		return flow, nil
+	}
+}
+
+func runStatus(t *testing.T, store storage.Storage, id uuid.UUID) model.RunStatus {
+	t.Helper()
+	run, err := store.GetRun(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetRun failed: %v", err)
+	}
+	return run.Status
+}
+
+func TestWorker_ProcessNextExecutesQueuedRun(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	eng := newTestEngine(store)
+
+	runID, err := eng.Enqueue(ctx, echoFlow, map[string]any{"msg": "hi"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if got := runStatus(t, store, runID); got != model.RunPending {
+		t.Fatalf("expected PENDING after enqueue, got %s", got)
+	}
+
+	w := New(eng, staticLoader(echoFlow), Options{ID: "w1"})
+	leased, err := w.ProcessNext(ctx)
+	if err != nil || !leased {
+		t.Fatalf("expected a run to be processed, got %v, %v", leased, err)
+	}
+	if got := runStatus(t, store, runID); got != model.RunSucceeded {
+		t.Errorf("expected SUCCEEDED, got %s", got)
+	}
+	steps, _ := store.GetSteps(ctx, runID)
+	if len(steps) != 1 || steps[0].Outputs["text"] != "hi" {
+		t.Errorf("expected echo step output, got %+v", steps)
+	}
+
+	// The queue entry was acknowledged
+	if leased, err := w.ProcessNext(ctx); err != nil || leased {
+		t.Errorf("expected empty queue, got %v, %v", leased, err)
+	}
+}
+
+func TestWorker_RedeliversAfterCrash(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	eng := newTestEngine(store)
+
+	runID, err := eng.Enqueue(ctx, echoFlow, map[string]any{"msg": "again"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+
+	// A worker leases the run, starts it and dies without heartbeating
+	if item, err := store.LeaseRun(ctx, "crashed", 50*time.Millisecond, nil); err != nil || item == nil {
+		t.Fatalf("LeaseRun failed: %v, %v", item, err)
+	}
+	run, _ := store.GetRun(ctx, runID)
+	if err := store.TransitionRun(ctx, run, model.RunRunning); err != nil {
+		t.Fatalf("TransitionRun failed: %v", err)
+	}
+
+	w := New(eng, staticLoader(echoFlow), Options{ID: "w2"})
+	if leased, _ := w.ProcessNext(ctx); leased {
+		t.Fatalf("expected the live lease to block redelivery")
+	}
+	time.Sleep(100 * time.Millisecond)
+	if leased, err := w.ProcessNext(ctx); err != nil || !leased {
+		t.Fatalf("expected redelivery after lease expiry, got %v, %v", leased, err)
+	}
+	if got := runStatus(t, store, runID); got != model.RunSucceeded {
+		t.Errorf("expected redelivered run to succeed, got %s", got)
+	}
+}
+
+func TestWorker_FailsRunAfterMaxAttempts(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	eng := newTestEngine(store)
+
+	runID, err := eng.Enqueue(ctx, echoFlow, map[string]any{"msg": "poison"})
+	if err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	if item, err := store.LeaseRun(ctx, "crashed", time.Millisecond, nil); err != nil || item == nil {
+		t.Fatalf("LeaseRun failed: %v, %v", item, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	w := New(eng, staticLoader(echoFlow), Options{ID: "w2", MaxAttempts: 1})
+	if leased, err := w.ProcessNext(ctx); err != nil || !leased {
+		t.Fatalf("expected the run to be leased, got %v, %v", leased, err)
+	}
+	if got := runStatus(t, store, runID); got != model.RunFailed {
+		t.Errorf("expected FAILED after exceeding max attempts, got %s", got)
+	}
+	steps, _ := store.GetSteps(ctx, runID)
+	if len(steps) != 0 {
+		t.Errorf("expected no steps to execute, got %d", len(steps))
+	}
+}
+
+func TestWorker_HeartbeatKeepsLease(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewMemoryStorage()
+	eng := newTestEngine(store)
+
+	if _, err := eng.Enqueue(ctx, echoFlow, map[string]any{"msg": "slow"}); err != nil {
+		t.Fatalf("Enqueue failed: %v", err)
+	}
+	started := make(chan struct{})
+	slowLoader := func(ctx context.Context, run *model.Run) (*model.Flow, error) {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		return echoFlow, nil
+	}
+	w := New(eng, slowLoader, Options{ID: "w1", LeaseTTL: 100 * time.Millisecond, HeartbeatInterval: 20 * time.Millisecond})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := w.ProcessNext(ctx); err != nil {
+			t.Errorf("ProcessNext failed: %v", err)
+		}
+	}()
+	<-started
+	time.Sleep(200 * time.Millisecond) // well past the TTL without heartbeats
+	if item, err := store.LeaseRun(ctx, "w2", time.Minute, nil); err != nil || item != nil {
+		t.Errorf("expected heartbeat to keep the lease, got %+v, %v", item, err)
+	}
+	<-done
+}
+
+func TestWorker_RunDrainsQueue(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	eng := newTestEngine(store)
+
+	var ids []uuid.UUID
+	for _, msg := range []string{"a", "b", "c"} {
+		id, err := eng.Enqueue(context.Background(), echoFlow, map[string]any{"msg": msg})
+		if err != nil {
+			t.Fatalf("Enqueue failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	w := New(eng, staticLoader(echoFlow), Options{Concurrency: 2, PollInterval: 10 * time.Millisecond})
+	go func() {
+		defer wg.Done()
+		if err := w.Run(ctx); err != nil {
+			t.Errorf("Run failed: %v", err)
+		}
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for _, id := range ids {
+		for runStatus(t, store, id) != model.RunSucceeded && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if got := runStatus(t, store, id); got != model.RunSucceeded {
+			t.Errorf("expected run %s to succeed, got %s", id, got)
+		}
+	}
+	cancel()
+	wg.Wait()
+}
+
+func TestOptionsFromConfig(t *testing.T) {
+	opts, err := OptionsFromConfig(&config.QueueConfig{LeaseTTL: "1m", MaxAttempts: 5, FlowConcurrency: map[string]int{"llm": 2}})
+	if err != nil {
+		t.Fatalf("OptionsFromConfig failed: %v", err)
+	}
+	opts = opts.withDefaults()
+	if opts.LeaseTTL != time.Minute || opts.HeartbeatInterval != 20*time.Second || opts.MaxAttempts != 5 || opts.FlowConcurrency["llm"] != 2 {
+		t.Errorf("unexpected options: %+v", opts)
+	}
+	if opts.ID == "" || opts.Concurrency != 1 || opts.PollInterval != DefaultPollInterval {
+		t.Errorf("expected defaults to be filled, got %+v", opts)
+	}
+	if _, err := OptionsFromConfig(&config.QueueConfig{PollInterval: "soon"}); err == nil {
+		t.Errorf("expected error for invalid duration")
+	}
+}